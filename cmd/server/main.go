@@ -3,24 +3,37 @@ package main
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
-	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
-	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/jackc/pgx/v5/stdlib"
 	"github.com/joho/godotenv"
+	"google.golang.org/grpc"
 
-	"virtualservers/internal/api"
+	"virtualservers/internal/chaos"
+	"virtualservers/internal/domain"
+	"virtualservers/internal/grpcapi"
+	"virtualservers/internal/logging"
+	"virtualservers/internal/metrics"
 	"virtualservers/internal/repository"
 	"virtualservers/internal/service"
+	"virtualservers/internal/telemetry"
 )
 
 func main() {
 	_ = godotenv.Load() // loads .env if present
+	if _, err := logging.Setup(); err != nil {
+		log.Fatal(err)
+	}
 
 	dsn := os.Getenv("DATABASE_URL")
 	if dsn == "" {
@@ -30,47 +43,174 @@ func main() {
 	if addr == "" {
 		addr = ":8080"
 	}
-	db, err := sql.Open("pgx", dsn)
+	grpcAddr := os.Getenv("GRPC_ADDR")
+	if grpcAddr == "" {
+		grpcAddr = ":9090"
+	}
+	shutdownTracing, err := telemetry.Setup(context.Background(), "virtualservers")
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Repository latency is injected below the tracing driver, so it shows
+	// in the query spans
+	chaosEngine := chaos.NewEngine()
+	chaosEngine.OnFault = func(fault string) { metrics.ChaosFaults.WithLabelValues(fault).Inc() }
+	sql.Register("pgx-chaos", chaosEngine.WrapDriver(stdlib.GetDefaultDriver()))
+	db, err := telemetry.OpenDB("pgx-chaos", dsn)
 	if err != nil {
 		log.Fatal(err)
 	}
-	store := &repository.Store{DB: db}
-	h := &api.Handler{Store: store}
-	//Starting billing daemon
+	store := &repository.Store{DB: db, Transitions: transitionsFromEnv(), Chaos: chaosEngine}
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	go service.StartBillingDaemon(ctx, store, 60*time.Second)
-	go service.StartIdleReaper(ctx, store, 30*time.Second)
-	r := chi.NewRouter()
-	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
-	r.Use(middleware.Recoverer)
-	r.Use(middleware.Timeout(60 * time.Second))
-
-	//Routes
-	r.Get("/servers", h.ListServers)
-	r.Get("/servers/{id}", h.GetServer)
-	r.Post("/servers/{id}/action", h.ServerAction)
-	r.Get("/servers/{id}/logs", h.GetServerLogs)
-	r.Post("/server", h.CreateServer)
-	health := &api.HealthHandler{DB: db}
-	r.Get("/healthz", health.Healthz)
-	r.Get("/readyz", health.Healthz)
+	// Fallback reaper policy for servers no stored policy matches
+	defaultIdle := envDuration("REAPER_DEFAULT_IDLE", 30*time.Minute)
+	defaultHibernatedIdle := envDuration("REAPER_DEFAULT_HIBERNATED_IDLE", 7*24*time.Hour)
+	reaperDefault := repository.ReaperPolicy{
+		Name:              "default",
+		IdleSeconds:       int(defaultIdle.Seconds()),
+		WarnBeforeSeconds: int(envDuration("REAPER_DEFAULT_WARN", 5*time.Minute).Seconds()),
+		Enabled:           defaultIdle > 0 || defaultHibernatedIdle > 0,
+	}
+	if defaultHibernatedIdle > 0 {
+		secs := int(defaultHibernatedIdle.Seconds())
+		reaperDefault.HibernatedIdleSeconds = &secs
+	}
+	//Starting leader-only daemons (billing, reaper, scheduler, transitions,
+	//operations, chaos)
+	leader := &service.LeaderElector{
+		Store:  store,
+		Name:   "daemons",
+		Holder: leaderID(),
+		TTL:    envDuration("LEADER_LEASE_TTL", 15*time.Second),
+	}
+	leaderDone := make(chan struct{})
+	go func() {
+		defer close(leaderDone)
+		leader.Run(ctx, func(ctx context.Context) {
+			var wg sync.WaitGroup
+			wg.Add(6)
+			go func() { defer wg.Done(); service.StartBillingDaemon(ctx, store, 60*time.Second) }()
+			go func() { defer wg.Done(); service.StartIdleReaper(ctx, store, 30*time.Second, reaperDefault) }()
+			go func() { defer wg.Done(); service.StartScheduler(ctx, store, 30*time.Second) }()
+			go func() { defer wg.Done(); service.StartTransitionWorker(ctx, store, time.Second) }()
+			go func() { defer wg.Done(); service.StartOperationWorker(ctx, store, time.Second) }()
+			go func() { defer wg.Done(); service.StartChaosMonkey(ctx, store, chaosEngine, 10*time.Second) }()
+			wg.Wait()
+		})
+	}()
+	hub := service.NewEventHub()
+	go service.StartEventListener(ctx, store, hub)
+	go service.StartWebhookDispatcher(ctx, store, 5*time.Second)
+	go service.StartChaosSync(ctx, store, chaosEngine, 5*time.Second)
+	r := newRouter(routerDeps{
+		Store:         store,
+		DB:            db,
+		Leader:        leader,
+		Hub:           hub,
+		Chaos:         chaosEngine,
+		ReaperDefault: reaperDefault,
+		SnapshotPerGB: envDuration("SNAPSHOT_DURATION_PER_GB", 500*time.Millisecond),
+	})
 	srv := &http.Server{
 		Addr:    addr,
 		Handler: r,
 	}
 
 	go func() {
-		log.Printf("HTTP listening on %s", addr)
+		slog.Info("HTTP listening", "addr", addr)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatal(err)
 		}
 	}()
+	grpcServer := grpcapi.New(store, hub)
+	grpcLis, err := net.Listen("tcp", grpcAddr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go func() {
+		slog.Info("gRPC listening", "addr", grpcAddr)
+		if err := grpcServer.Serve(grpcLis); err != nil {
+			log.Fatal(err)
+		}
+	}()
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 	<-quit
+	// Stopping daemons first releases the leader lease for a fast failover
+	cancel()
+	<-leaderDone
 	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	_ = srv.Shutdown(ctx)
+	stopGRPC(ctx, grpcServer)
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("tracing shutdown failed", "err", err)
+	}
+}
+
+// stopGRPC drains in-flight calls, cutting off what is left (typically
+// WatchEvents streams) when ctx expires
+func stopGRPC(ctx context.Context, gs *grpc.Server) {
+	done := make(chan struct{})
+	go func() {
+		gs.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		gs.Stop()
+	}
+}
+
+// envDuration reads a Go duration ("30m") from the environment; "0" disables
+func envDuration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Fatalf("%s: %v", key, err)
+	}
+	return d
+}
+
+// transitionsFromEnv reads the simulated transition settings:
+// TRANSITION_STARTING/_STOPPING/_TERMINATING durations (default 0, i.e.
+// instantaneous), TRANSITION_BILLED (comma-separated transitional statuses
+// billed like RUNNING) and TRANSITION_POLICY (reject or queue)
+func transitionsFromEnv() repository.Transitions {
+	t := repository.Transitions{Durations: map[string]time.Duration{}, Billed: map[string]bool{}}
+	for _, status := range []string{"STARTING", "STOPPING", "TERMINATING"} {
+		t.Durations[status] = envDuration("TRANSITION_"+status, 0)
+	}
+	for _, status := range strings.Split(os.Getenv("TRANSITION_BILLED"), ",") {
+		status = strings.ToUpper(strings.TrimSpace(status))
+		if status == "" {
+			continue
+		}
+		if !domain.IsTransitional(status) {
+			log.Fatalf("TRANSITION_BILLED: %q is not STARTING, STOPPING or TERMINATING", status)
+		}
+		t.Billed[status] = true
+	}
+	switch p := os.Getenv("TRANSITION_POLICY"); p {
+	case "", "reject":
+	case "queue":
+		t.Queue = true
+	default:
+		log.Fatalf("TRANSITION_POLICY must be reject or queue (got %q)", p)
+	}
+	return t
+}
+
+// leaderID identifies this replica in leader election (LEADER_ID or host-pid)
+func leaderID() string {
+	if id := os.Getenv("LEADER_ID"); id != "" {
+		return id
+	}
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
 }
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+
+	"virtualservers/internal/api"
+	"virtualservers/internal/chaos"
+	"virtualservers/internal/logging"
+	"virtualservers/internal/metrics"
+	"virtualservers/internal/repository"
+	"virtualservers/internal/service"
+	"virtualservers/internal/telemetry"
+)
+
+// routerDeps is what the HTTP handlers are built from
+type routerDeps struct {
+	Store  *repository.Store
+	DB     *sql.DB
+	Leader *service.LeaderElector
+	Hub    *service.EventHub
+	Chaos  *chaos.Engine
+	// ReaperDefault applies to servers no stored reaper policy matches
+	ReaperDefault repository.ReaperPolicy
+	SnapshotPerGB time.Duration
+}
+
+// newRouter builds the HTTP API. openapi.json must document exactly its
+// routes (checked by api.ValidateRoutes in the tests).
+func newRouter(d routerDeps) chi.Router {
+	h := &api.Handler{Store: d.Store}
+	wh := &api.WebhookHandler{Store: d.Store}
+	sched := &api.ScheduleHandler{Store: d.Store}
+	reaper := &api.ReaperHandler{Store: d.Store, Default: d.ReaperDefault}
+	vol := &api.VolumeHandler{Store: d.Store}
+	sg := &api.SecurityGroupHandler{Store: d.Store}
+	nw := &api.NetworkHandler{Store: d.Store}
+	pl := &api.PlacementHandler{Store: d.Store}
+	hosts := &api.HostHandler{Store: d.Store}
+	ch := &api.ChaosHandler{Store: d.Store, Engine: d.Chaos}
+	snap := &api.SnapshotHandler{Store: d.Store, PerGB: d.SnapshotPerGB}
+	stream := &api.StreamHandler{Store: d.Store, Hub: d.Hub}
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(middleware.RealIP)
+	r.Use(telemetry.Middleware)
+	r.Use(logging.Middleware)
+	r.Use(metrics.Middleware)
+	r.Use(middleware.Recoverer)
+	r.NotFound(api.NotFound)
+	r.MethodNotAllowed(api.MethodNotAllowed)
+
+	//Routes
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.Timeout(60 * time.Second))
+		r.Use(api.Chaos(d.Chaos))
+		r.Use(api.Idempotency(d.Store))
+		r.Get("/servers", h.ListServers)
+		r.Get("/servers/{id}", h.GetServer)
+		r.Post("/servers/actions", h.BulkAction)
+		r.Post("/servers/{id}/action", h.ServerAction)
+		r.Post("/servers/{id}/resize", h.ResizeServer)
+		r.Get("/servers/{id}/logs", h.GetServerLogs)
+		r.Put("/servers/{id}/protection", h.SetProtection)
+		r.Get("/servers/{id}/locks", h.ListLocks)
+		r.Post("/servers/{id}/locks", h.AddLock)
+		r.Delete("/servers/{id}/locks/{name}", h.RemoveLock)
+		r.Get("/servers/{id}/security-groups", sg.ListServerGroups)
+		r.Post("/servers/{id}/security-groups", sg.AttachGroup)
+		r.Delete("/servers/{id}/security-groups/{groupID}", sg.DetachGroup)
+		r.Get("/servers/{id}/reachability", sg.Reachability)
+		r.Post("/server", h.CreateServer)
+
+		r.Post("/volumes", vol.CreateVolume)
+		r.Get("/volumes", vol.ListVolumes)
+		r.Get("/volumes/{id}", vol.GetVolume)
+		r.Delete("/volumes/{id}", vol.DeleteVolume)
+		r.Post("/volumes/{id}/attach", vol.AttachVolume)
+		r.Post("/volumes/{id}/detach", vol.DetachVolume)
+
+		r.Post("/vpcs", nw.CreateVPC)
+		r.Get("/vpcs", nw.ListVPCs)
+		r.Get("/vpcs/{id}", nw.GetVPC)
+		r.Delete("/vpcs/{id}", nw.DeleteVPC)
+		r.Post("/subnets", nw.CreateSubnet)
+		r.Get("/subnets", nw.ListSubnets)
+		r.Get("/subnets/{id}", nw.GetSubnet)
+		r.Delete("/subnets/{id}", nw.DeleteSubnet)
+
+		r.Get("/zones", pl.ListZones)
+		r.Get("/zones/{name}", pl.GetZone)
+		r.Post("/zones/{name}/impair", pl.ImpairZone)
+		r.Post("/zones/{name}/recover", pl.RecoverZone)
+		r.Post("/placement-groups", pl.CreatePlacementGroup)
+		r.Get("/placement-groups", pl.ListPlacementGroups)
+		r.Get("/placement-groups/{id}", pl.GetPlacementGroup)
+		r.Delete("/placement-groups/{id}", pl.DeletePlacementGroup)
+
+		r.Post("/hosts", hosts.CreateHost)
+		r.Get("/hosts", hosts.ListHosts)
+		r.Get("/hosts/{id}", hosts.GetHost)
+		r.Delete("/hosts/{id}", hosts.DeleteHost)
+		r.Post("/hosts/{id}/maintenance", hosts.Maintenance)
+		r.Post("/hosts/{id}/activate", hosts.Activate)
+
+		r.Post("/security-groups", sg.CreateSecurityGroup)
+		r.Get("/security-groups", sg.ListSecurityGroups)
+		r.Get("/security-groups/{id}", sg.GetSecurityGroup)
+		r.Delete("/security-groups/{id}", sg.DeleteSecurityGroup)
+		r.Post("/security-groups/{id}/rules", sg.AddRule)
+		r.Delete("/security-groups/{id}/rules/{ruleID}", sg.DeleteRule)
+
+		r.Post("/snapshots", snap.CreateSnapshot)
+		r.Get("/snapshots", snap.ListSnapshots)
+		r.Get("/snapshots/{id}", snap.GetSnapshot)
+		r.Delete("/snapshots/{id}", snap.DeleteSnapshot)
+		r.Post("/images", snap.RegisterImage)
+		r.Get("/images", snap.ListImages)
+		r.Get("/images/{id}", snap.GetImage)
+		r.Delete("/images/{id}", snap.DeregisterImage)
+		r.Get("/operations", snap.ListOperations)
+		r.Get("/operations/{id}", snap.GetOperation)
+
+		r.Post("/webhooks", wh.CreateWebhook)
+		r.Get("/webhooks", wh.ListWebhooks)
+		r.Get("/webhooks/dead-letters", wh.ListDeadLetters)
+		r.Get("/webhooks/deliveries/{deliveryID}/attempts", wh.ListDeliveryAttempts)
+		r.Post("/webhooks/deliveries/{deliveryID}/retry", wh.RetryDelivery)
+		r.Get("/webhooks/{id}", wh.GetWebhook)
+		r.Delete("/webhooks/{id}", wh.DeleteWebhook)
+		r.Get("/webhooks/{id}/deliveries", wh.ListDeliveries)
+
+		r.Post("/schedules", sched.CreateSchedule)
+		r.Get("/schedules", sched.ListSchedules)
+		r.Get("/schedules/{id}", sched.GetSchedule)
+		r.Patch("/schedules/{id}", sched.UpdateSchedule)
+		r.Delete("/schedules/{id}", sched.DeleteSchedule)
+
+		r.Post("/reaper/policies", reaper.CreatePolicy)
+		r.Get("/reaper/policies", reaper.ListPolicies)
+		r.Get("/reaper/policies/{id}", reaper.GetPolicy)
+		r.Delete("/reaper/policies/{id}", reaper.DeletePolicy)
+		r.Get("/reaper/preview", reaper.Preview)
+	})
+	// Chaos settings stay reachable while HTTP errors are injected
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.Timeout(60 * time.Second))
+		r.Get("/chaos", ch.GetConfig)
+		r.Put("/chaos", ch.PutConfig)
+	})
+	// Long-lived SSE streams are kept out of the request timeout
+	r.Get("/events/stream", stream.StreamEvents)
+	r.Get("/servers/{id}/events/stream", stream.StreamServerEvents)
+	health := &api.HealthHandler{DB: d.DB, Leader: d.Leader}
+	r.Get("/healthz", health.Healthz)
+	r.Get("/readyz", health.Readyz)
+	r.Method(http.MethodGet, "/metrics", metrics.Handler(d.Store, d.DB))
+	r.Get("/openapi.json", api.OpenAPI)
+	return r
+}
@@ -0,0 +1,13 @@
+package main
+
+import (
+	"testing"
+
+	"virtualservers/internal/api"
+)
+
+func TestRoutesMatchOpenAPI(t *testing.T) {
+	if err := api.ValidateRoutes(newRouter(routerDeps{})); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"virtualservers/pkg/client"
+)
+
+// clearScreen is written before each refresh of a watched table
+const clearScreen = "\033[H\033[2J"
+
+func cmdList(ctx context.Context, g *globals, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	selector := fs.String("l", "", "label selector key=value[,key=value]")
+	status := fs.String("status", "", "filter by status")
+	region := fs.String("region", "", "filter by region")
+	zone := fs.String("zone", "", "filter by availability zone")
+	typ := fs.String("type", "", "filter by instance type")
+	limit := fs.Int("limit", 0, "maximum servers (default: all)")
+	watch := fs.Bool("w", false, "watch: refresh on every lifecycle event")
+	if err := parseFlags(g, fs, args); err != nil {
+		return err
+	}
+	labels, err := parseSelector(*selector)
+	if err != nil {
+		return err
+	}
+	c := g.client()
+	p := client.ListServersParams{Region: *region, Zone: *zone, Type: *typ, Status: *status, Labels: labels}
+	show := func() error {
+		items, err := listAll(ctx, c, p, *limit)
+		if err != nil {
+			return err
+		}
+		return g.printer().servers(items)
+	}
+	if !*watch {
+		return show()
+	}
+	return watchEvents(ctx, g, c, client.StreamParams{Labels: labels}, show)
+}
+
+func cmdGet(ctx context.Context, g *globals, args []string) error {
+	fs := flag.NewFlagSet("get", flag.ContinueOnError)
+	watch := fs.Bool("w", false, "watch: refresh on every lifecycle event")
+	if err := parseFlags(g, fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: vsctl get <id> [-w]")
+	}
+	id := fs.Arg(0)
+	c := g.client()
+	show := func() error {
+		s, err := c.GetServer(ctx, id)
+		if err != nil {
+			return err
+		}
+		return g.printer().server(s)
+	}
+	if !*watch {
+		return show()
+	}
+	return watchEvents(ctx, g, c, client.StreamParams{ServerID: id}, show)
+}
+
+func cmdCreate(ctx context.Context, g *globals, args []string) error {
+	fs := flag.NewFlagSet("create", flag.ContinueOnError)
+	name := fs.String("name", "", "server name (required)")
+	region := fs.String("region", "", "region (required)")
+	typ := fs.String("type", "", "instance type (required)")
+	labelFlag := fs.String("labels", "", "labels key=value[,key=value]")
+	image := fs.String("image", "", "image to create the server from")
+	groups := fs.String("security-groups", "", "security group IDs to attach, comma-separated")
+	subnet := fs.String("subnet", "", "subnet to take the IP from (default: the region's default subnet)")
+	zone := fs.String("zone", "", "availability zone (default: picked by --placement or --placement-group)")
+	placement := fs.String("placement", "", "zone placement without a group: spread (default) or pack")
+	group := fs.String("placement-group", "", "placement group whose strategy picks the zone")
+	if err := parseFlags(g, fs, args); err != nil {
+		return err
+	}
+	if *name == "" || *region == "" || *typ == "" {
+		return errors.New("usage: vsctl create --name NAME --region REGION --type TYPE [--labels k=v,...] [--image ID] [--security-groups ID,...] [--subnet ID] [--zone ZONE | --placement spread|pack | --placement-group ID]")
+	}
+	labels, err := parseSelector(*labelFlag)
+	if err != nil {
+		return err
+	}
+	st, err := g.client().CreateServer(ctx, client.CreateServerRequest{Name: *name, Region: *region, Type: *typ, Labels: labels, ImageID: *image,
+		SecurityGroupIDs: splitList(*groups), SubnetID: *subnet, Zone: *zone, Placement: *placement, PlacementGroupID: *group})
+	if err != nil {
+		return err
+	}
+	return g.printer().results([]actionResult{{ID: st.ID, Status: st.Status}})
+}
+
+func cmdResize(ctx context.Context, g *globals, args []string) error {
+	fs := flag.NewFlagSet("resize", flag.ContinueOnError)
+	typ := fs.String("type", "", "target instance type (required)")
+	live := fs.Bool("live", false, "resize a RUNNING server through a reboot")
+	if err := parseFlags(g, fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || *typ == "" {
+		return errors.New("usage: vsctl resize <id> --type TYPE [--live]")
+	}
+	res, err := g.client().Resize(ctx, fs.Arg(0), *typ, *live)
+	if err != nil {
+		return err
+	}
+	return g.printer().resize(res)
+}
+
+// actionCommand builds the lifecycle commands on top of the bulk
+// action endpoint. Targets are the given IDs or every non-terminated server
+// matching -l; selector-based terminations need --yes.
+func actionCommand(action string) command {
+	return func(ctx context.Context, g *globals, args []string) error {
+		fs := flag.NewFlagSet(action, flag.ContinueOnError)
+		selector := fs.String("l", "", "apply to all servers matching this label selector")
+		yes := fs.Bool("yes", false, "confirm a selector-based terminate")
+		dryRun := fs.Bool("dry-run", false, "show what would happen without changing anything")
+		parallel := fs.Int("parallel", 0, "servers acted on concurrently (server default 8, max 32)")
+		if err := parseFlags(g, fs, args); err != nil {
+			return err
+		}
+		if (fs.NArg() == 0) == (*selector == "") {
+			return fmt.Errorf("usage: vsctl %s <id>... | -l key=value[,key=value] [--dry-run]", action)
+		}
+		req := client.BulkActionRequest{Action: action, IDs: fs.Args(), DryRun: *dryRun, Concurrency: *parallel}
+		if *selector != "" {
+			labels, err := parseSelector(*selector)
+			if err != nil {
+				return err
+			}
+			req.Filter = &client.BulkActionFilter{Labels: labels}
+		}
+		c := g.client()
+		pr := g.printer()
+
+		if req.Filter != nil && action == client.ActionTerminate && !*yes && !*dryRun {
+			// Show what would go before refusing
+			req.DryRun = true
+			res, err := c.BulkAction(ctx, req)
+			if err != nil {
+				return err
+			}
+			if res.Matched == 0 {
+				fmt.Fprintln(os.Stderr, "no servers match", *selector)
+				return nil
+			}
+			if err := pr.results(bulkResults(res)); err != nil {
+				return err
+			}
+			return fmt.Errorf("refusing to terminate %d servers matching %q without --yes", res.Matched, *selector)
+		}
+
+		res, err := c.BulkAction(ctx, req)
+		if err != nil {
+			return err
+		}
+		if res.Matched == 0 {
+			fmt.Fprintln(os.Stderr, "no servers match", *selector)
+			return nil
+		}
+		if err := pr.results(bulkResults(res)); err != nil {
+			return err
+		}
+		if res.Failed > 0 {
+			verb := action
+			if res.DryRun {
+				verb += " (dry run)"
+			}
+			return fmt.Errorf("%s failed for %d of %d servers", verb, res.Failed, res.Matched)
+		}
+		return nil
+	}
+}
+
+func bulkResults(res *client.BulkActionResponse) []actionResult {
+	out := make([]actionResult, 0, len(res.Results))
+	for _, r := range res.Results {
+		row := actionResult{ID: r.ID, Status: r.Status}
+		if r.Error != nil {
+			row.Error = r.Error.Code
+			if r.Error.Detail != "" {
+				row.Error += ": " + r.Error.Detail
+			}
+		}
+		out = append(out, row)
+	}
+	return out
+}
+
+func cmdLogs(ctx context.Context, g *globals, args []string) error {
+	fs := flag.NewFlagSet("logs", flag.ContinueOnError)
+	events := fs.String("event", "", "comma-separated event types")
+	since := fs.Duration("since", 0, "only events newer than this (e.g. 1h)")
+	limit := fs.Int("limit", 0, "maximum events (default 100)")
+	follow := fs.Bool("f", false, "follow: stream new events")
+	if err := parseFlags(g, fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: vsctl logs <id> [--event a,b] [--since 1h] [--limit N] [-f]")
+	}
+	id := fs.Arg(0)
+	c := g.client()
+	p := client.LogsParams{Limit: *limit}
+	if *events != "" {
+		p.Events = strings.Split(*events, ",")
+	}
+	if *since > 0 {
+		p.Since = time.Now().Add(-*since)
+	}
+	items, err := c.Logs(ctx, id, p)
+	if err != nil {
+		return err
+	}
+	// Oldest first, like a log file
+	sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+	pr := g.printer()
+	if err := pr.events(items, true); err != nil {
+		return err
+	}
+	if !*follow {
+		return nil
+	}
+	var last int64
+	if len(items) > 0 {
+		last = items[len(items)-1].ID
+	}
+	return c.StreamEvents(ctx, client.StreamParams{ServerID: id, Events: p.Events, LastEventID: last}, func(ev client.ServerEvent) error {
+		return pr.events([]client.ServerEvent{ev}, false)
+	})
+}
+
+func cmdConfig(ctx context.Context, g *globals, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: vsctl config view | set-profile <name> [--url U] [--actor A] [--output F] | use <name>")
+	}
+	cfg, path, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "view":
+		b, err := yaml.Marshal(cfg)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("# %s\n%s", path, b)
+		return nil
+	case "set-profile":
+		fs := flag.NewFlagSet("config set-profile", flag.ContinueOnError)
+		url := fs.String("url", "", "API base URL")
+		actor := fs.String("actor", "", "X-Actor header")
+		output := fs.String("output", "", "default output format")
+		if err := fs.Parse(interleave(fs, args[1:])); err != nil {
+			return err
+		}
+		if fs.NArg() != 1 {
+			return errors.New("usage: vsctl config set-profile <name> [--url U] [--actor A] [--output F]")
+		}
+		name := fs.Arg(0)
+		p := cfg.Profiles[name]
+		p.URL = first(*url, p.URL)
+		p.Actor = first(*actor, p.Actor)
+		p.Output = first(*output, p.Output)
+		cfg.Profiles[name] = p
+		if cfg.Current == "" {
+			cfg.Current = name
+		}
+		return saveConfig(cfg, path)
+	case "use":
+		if len(args) != 2 {
+			return errors.New("usage: vsctl config use <name>")
+		}
+		if _, ok := cfg.Profiles[args[1]]; !ok {
+			return fmt.Errorf("unknown profile %q (have: %v)", args[1], profileNames(cfg))
+		}
+		cfg.Current = args[1]
+		return saveConfig(cfg, path)
+	default:
+		return fmt.Errorf("unknown config command %q", args[0])
+	}
+}
+
+// listAll pages through /servers; max <= 0 means no limit
+func listAll(ctx context.Context, c *client.Client, p client.ListServersParams, max int) ([]client.Server, error) {
+	const page = 200
+	var out []client.Server
+	for {
+		p.Limit = page
+		if max > 0 && max-len(out) < page {
+			p.Limit = max - len(out)
+		}
+		p.Offset = len(out)
+		res, err := c.ListServers(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, res.Items...)
+		if len(res.Items) < p.Limit || len(out) >= res.Total || (max > 0 && len(out) >= max) {
+			return out, nil
+		}
+	}
+}
+
+// watchEvents shows the current state, then refreshes it after lifecycle
+// events (coalescing bursts) until interrupted
+func watchEvents(ctx context.Context, g *globals, c *client.Client, p client.StreamParams, show func() error) error {
+	refresh := func() error {
+		if g.output == "table" {
+			fmt.Print(clearScreen)
+		}
+		return show()
+	}
+	if err := refresh(); err != nil {
+		return err
+	}
+	changed := make(chan struct{}, 1)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.StreamEvents(ctx, p, func(client.ServerEvent) error {
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
+			return nil
+		})
+	}()
+	for {
+		select {
+		case err := <-errc:
+			return err
+		case <-changed:
+			// Let a burst of events (e.g. a bulk action) settle
+			time.Sleep(200 * time.Millisecond)
+			if err := refresh(); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+const defaultURL = "http://localhost:8080"
+
+// Profile is one named API endpoint in the config file
+type Profile struct {
+	URL    string `yaml:"url"`
+	Actor  string `yaml:"actor,omitempty"`
+	Output string `yaml:"output,omitempty"`
+}
+
+// Config is ~/.config/vsctl/config.yaml (or $VSCTL_CONFIG):
+//
+//	current: local
+//	profiles:
+//	  local: {url: "http://localhost:8080"}
+//	  prod:  {url: "https://virt.example.com", actor: alice, output: json}
+type Config struct {
+	Current  string             `yaml:"current,omitempty"`
+	Profiles map[string]Profile `yaml:"profiles,omitempty"`
+}
+
+func configPath() (string, error) {
+	if p := os.Getenv("VSCTL_CONFIG"); p != "" {
+		return p, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "vsctl", "config.yaml"), nil
+}
+
+// loadConfig returns an empty config when the file does not exist
+func loadConfig() (*Config, string, error) {
+	path, err := configPath()
+	if err != nil {
+		return nil, "", err
+	}
+	cfg := &Config{Profiles: map[string]Profile{}}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, path, nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if err := yaml.Unmarshal(b, cfg); err != nil {
+		return nil, "", fmt.Errorf("%s: %w", path, err)
+	}
+	if cfg.Profiles == nil {
+		cfg.Profiles = map[string]Profile{}
+	}
+	return cfg, path, nil
+}
+
+func saveConfig(cfg *Config, path string) error {
+	b, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o600)
+}
+
+// resolve merges flags, environment and the selected profile, in that order
+// of precedence
+func (g *globals) resolve() error {
+	cfg, _, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	name := first(g.profile, os.Getenv("VSCTL_PROFILE"), cfg.Current)
+	var p Profile
+	if name != "" {
+		var ok bool
+		if p, ok = cfg.Profiles[name]; !ok {
+			return fmt.Errorf("unknown profile %q (have: %v)", name, profileNames(cfg))
+		}
+	}
+	g.url = first(g.url, os.Getenv("VSCTL_URL"), p.URL, defaultURL)
+	g.actor = first(g.actor, os.Getenv("VSCTL_ACTOR"), p.Actor)
+	g.output = first(g.output, os.Getenv("VSCTL_OUTPUT"), p.Output, "table")
+	switch g.output {
+	case "table", "json", "yaml":
+	default:
+		return fmt.Errorf("output must be table, json or yaml (got %q)", g.output)
+	}
+	return nil
+}
+
+func profileNames(cfg *Config) []string {
+	names := make([]string, 0, len(cfg.Profiles))
+	for n := range cfg.Profiles {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func first(vals ...string) string {
+	for _, v := range vals {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,212 @@
+// vsctl is the operator CLI for the Virtual Servers API.
+//
+//	vsctl [global flags] <command> [flags] [args]
+//
+// The API endpoint comes from --url, $VSCTL_URL or the selected profile
+// (--profile, $VSCTL_PROFILE or the config file's current profile).
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"virtualservers/pkg/client"
+)
+
+const usage = `vsctl - operate virtual servers through the HTTP API
+
+Usage:
+  vsctl [global flags] <command> [flags] [args]
+
+Commands:
+  list                       List servers (-l selector, --status, --region, --zone, --type, -w)
+  get <id>                   Show one server (-w to watch)
+  create                     Provision a server (--name, --region, --type, --labels, --image, --security-groups, --subnet,
+                             --zone, --placement, --placement-group)
+  start|stop|reboot|hibernate|resume|terminate <id>... | -l selector
+                             Lifecycle actions, one or many servers
+                             (--dry-run, --parallel N, --yes for terminate -l)
+  resize <id>                Change the instance type (--type, --live for RUNNING servers)
+  logs <id>                  Lifecycle events (--event, --since, --limit, -f to follow)
+  config view                Show profiles
+  config set-profile <name>  Create or update a profile (--url, --actor, --output)
+  config use <name>          Select the default profile
+
+Global flags (also accepted after the command):
+  --profile NAME   config profile          ($VSCTL_PROFILE)
+  --url URL        API base URL            ($VSCTL_URL, default ` + defaultURL + `)
+  --actor NAME     X-Actor for audit logs  ($VSCTL_ACTOR)
+  -o FORMAT        table, json or yaml     ($VSCTL_OUTPUT)
+  --timeout D      per-request timeout (default 30s)
+
+Config file: $VSCTL_CONFIG or ~/.config/vsctl/config.yaml
+`
+
+type globals struct {
+	profile string
+	url     string
+	actor   string
+	output  string
+	timeout time.Duration
+}
+
+// bind registers the global flags on fs so they work before and after the
+// command name
+func (g *globals) bind(fs *flag.FlagSet) {
+	fs.StringVar(&g.profile, "profile", g.profile, "config profile")
+	fs.StringVar(&g.url, "url", g.url, "API base URL")
+	fs.StringVar(&g.actor, "actor", g.actor, "X-Actor header")
+	fs.StringVar(&g.output, "o", g.output, "output format: table, json or yaml")
+	fs.DurationVar(&g.timeout, "timeout", g.timeout, "per-request timeout")
+}
+
+func (g *globals) client() *client.Client {
+	opts := []client.Option{client.WithHTTPClient(&http.Client{Timeout: g.timeout})}
+	if g.actor != "" {
+		opts = append(opts, client.WithActor(g.actor))
+	}
+	return client.New(g.url, opts...)
+}
+
+func (g *globals) printer() *printer {
+	return &printer{w: os.Stdout, format: g.output}
+}
+
+type command func(ctx context.Context, g *globals, args []string) error
+
+var commands = map[string]command{
+	"list":      cmdList,
+	"get":       cmdGet,
+	"create":    cmdCreate,
+	"start":     actionCommand(client.ActionStart),
+	"stop":      actionCommand(client.ActionStop),
+	"reboot":    actionCommand(client.ActionReboot),
+	"hibernate": actionCommand(client.ActionHibernate),
+	"resume":    actionCommand(client.ActionResume),
+	"terminate": actionCommand(client.ActionTerminate),
+	"resize":    cmdResize,
+	"logs":      cmdLogs,
+	"config":    cmdConfig,
+}
+
+func main() {
+	g := &globals{timeout: 30 * time.Second}
+	fs := flag.NewFlagSet("vsctl", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	g.bind(fs)
+	if err := fs.Parse(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		os.Exit(2)
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	name, args := fs.Arg(0), fs.Args()[1:]
+	if name == "help" {
+		fmt.Print(usage)
+		return
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "vsctl: unknown command %q\n\n%s", name, usage)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := cmd(ctx, g, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		if ctx.Err() != nil {
+			os.Exit(130)
+		}
+		fmt.Fprintln(os.Stderr, "vsctl:", err)
+		os.Exit(1)
+	}
+}
+
+// parseFlags parses a command's flags (plus the global ones) and resolves
+// the configuration
+func parseFlags(g *globals, fs *flag.FlagSet, args []string) error {
+	g.bind(fs)
+	if err := fs.Parse(interleave(fs, args)); err != nil {
+		return err
+	}
+	if g.timeout <= 0 {
+		return errors.New("--timeout must be positive")
+	}
+	return g.resolve()
+}
+
+// interleave moves flags after positional arguments to the front, so
+// "vsctl stop srv-1 -o json" works like "vsctl stop -o json srv-1"
+func interleave(fs *flag.FlagSet, args []string) []string {
+	var flags, positional []string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" {
+			positional = append(positional, args[i+1:]...)
+			break
+		}
+		if !strings.HasPrefix(a, "-") || a == "-" {
+			positional = append(positional, a)
+			continue
+		}
+		flags = append(flags, a)
+		name := strings.TrimLeft(a, "-")
+		if strings.Contains(name, "=") {
+			continue
+		}
+		f := fs.Lookup(name)
+		if f == nil {
+			continue
+		}
+		if bf, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && bf.IsBoolFlag() {
+			continue
+		}
+		if i+1 < len(args) {
+			flags = append(flags, args[i+1])
+			i++
+		}
+	}
+	return append(flags, positional...)
+}
+
+// parseSelector parses "k=v,k2=v2"
+func parseSelector(s string) (map[string]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	out := map[string]string{}
+	for _, part := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid label selector %q (want key=value[,key=value])", part)
+		}
+		out[k] = v
+	}
+	return out, nil
+}
+
+// splitList parses a comma-separated flag, dropping empty entries
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"virtualservers/pkg/client"
+)
+
+// printer renders API objects in the selected output format. Tables are
+// written by the table callback; json and yaml use the object's JSON shape.
+type printer struct {
+	w      io.Writer
+	format string
+}
+
+func (p *printer) print(v any, table func(tw *tabwriter.Writer)) error {
+	switch p.format {
+	case "json":
+		enc := json.NewEncoder(p.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case "yaml":
+		// Round-trip through JSON so yaml keys follow the json tags
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		var generic any
+		if err := json.Unmarshal(b, &generic); err != nil {
+			return err
+		}
+		out, err := yaml.Marshal(generic)
+		if err != nil {
+			return err
+		}
+		_, err = p.w.Write(append(out, []byte("---\n")...))
+		return err
+	default:
+		tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+		table(tw)
+		return tw.Flush()
+	}
+}
+
+func (p *printer) servers(items []client.Server) error {
+	if items == nil {
+		items = []client.Server{}
+	}
+	return p.print(items, func(tw *tabwriter.Writer) {
+		fmt.Fprintln(tw, "ID\tNAME\tREGION\tZONE\tTYPE\tSTATUS\tIP\tAGE\tLABELS")
+		for _, s := range items {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				s.ID, s.Name, s.Region, s.Zone, s.Type, s.Status, deref(s.IP), age(s.CreatedAt), formatLabels(s.Labels))
+		}
+	})
+}
+
+func (p *printer) server(s *client.ServerDetail) error {
+	return p.print(s, func(tw *tabwriter.Writer) {
+		rows := [][2]string{
+			{"ID", s.ID},
+			{"Name", s.Name},
+			{"Region", s.Region},
+			{"Zone", s.Zone},
+			{"Type", s.Type},
+			{"Status", s.Status},
+			{"IP", deref(s.IP)},
+			{"Labels", formatLabels(s.Labels)},
+			{"Termination protection", fmt.Sprint(s.TerminationProtection)},
+			{"Hourly rate", fmt.Sprintf("%.4f", s.HourlyRate)},
+			{"Storage rate", fmt.Sprintf("%.4f", s.StorageHourlyRate)},
+			{"Uptime", (time.Duration(s.LiveUptime) * time.Second).String()},
+			{"Cost", fmt.Sprintf("%.6f", s.LiveCost)},
+			{"Created", s.CreatedAt.Format(time.RFC3339)},
+			{"Updated", s.UpdatedAt.Format(time.RFC3339)},
+		}
+		if t := s.Transition; t != nil {
+			row := fmt.Sprintf("%s -> %s, due %s", t.Action, t.TargetStatus, t.DueAt.Local().Format(time.RFC3339))
+			if t.QueuedAction != "" {
+				row += ", then " + t.QueuedAction
+			}
+			rows = append(rows, [2]string{"Transition", row})
+		}
+		if s.ImageID != nil {
+			rows = append(rows, [2]string{"Image", *s.ImageID})
+		}
+		if s.SubnetID != nil {
+			rows = append(rows, [2]string{"Subnet", fmt.Sprintf("%s (VPC %s)", *s.SubnetID, deref(s.VPCID))})
+		}
+		if s.PlacementGroupID != nil {
+			rows = append(rows, [2]string{"Placement group", *s.PlacementGroupID})
+		}
+		if s.HostID != nil {
+			rows = append(rows, [2]string{"Host", *s.HostID})
+		}
+		if len(s.SecurityGroupIDs) > 0 {
+			rows = append(rows, [2]string{"Security groups", strings.Join(s.SecurityGroupIDs, ", ")})
+		}
+		for _, r := range rows {
+			fmt.Fprintf(tw, "%s:\t%s\n", r[0], r[1])
+		}
+	})
+}
+
+func (p *printer) events(items []client.ServerEvent, header bool) error {
+	if items == nil {
+		items = []client.ServerEvent{}
+	}
+	return p.print(items, func(tw *tabwriter.Writer) {
+		if header {
+			fmt.Fprintln(tw, "TIME\tSERVER\tEVENT\tMESSAGE")
+		}
+		for _, e := range items {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", e.Timestamp.Local().Format(time.RFC3339), e.ServerID, e.Event, e.Message)
+		}
+	})
+}
+
+// actionResult is one row of a (bulk) lifecycle action
+type actionResult struct {
+	ID     string `json:"id"`
+	Status string `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+func (p *printer) results(items []actionResult) error {
+	return p.print(items, func(tw *tabwriter.Writer) {
+		fmt.Fprintln(tw, "ID\tSTATUS\tERROR")
+		for _, r := range items {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", r.ID, r.Status, r.Error)
+		}
+	})
+}
+
+func (p *printer) resize(r *client.ResizeResult) error {
+	return p.print(r, func(tw *tabwriter.Writer) {
+		fmt.Fprintln(tw, "ID\tSTATUS\tTYPE\tPREVIOUS TYPE")
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.ID, r.Status, r.Type, r.PreviousType)
+	})
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func formatLabels(labels map[string]string) string {
+	parts := make([]string, 0, len(labels))
+	for k, v := range labels {
+		parts = append(parts, k+"="+v)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+func age(t time.Time) string {
+	d := time.Since(t)
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+}
@@ -0,0 +1,19 @@
+-- Free-form key/value labels on servers (matched by label selectors)
+ALTER TABLE servers ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}'::jsonb;
+CREATE INDEX IF NOT EXISTS servers_labels_idx ON servers USING GIN (labels);
+
+-- Event ids are used as SSE ids, so replay walks them in order
+CREATE INDEX IF NOT EXISTS server_events_id_svr_idx ON server_events(server_id, id);
+
+-- Wake up stream listeners whenever a lifecycle event is committed
+CREATE OR REPLACE FUNCTION notify_server_event() RETURNS trigger AS $$
+BEGIN
+  PERFORM pg_notify('server_events', NEW.id::text);
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS server_events_notify ON server_events;
+CREATE TRIGGER server_events_notify
+AFTER INSERT ON server_events
+FOR EACH ROW EXECUTE FUNCTION notify_server_event();
@@ -0,0 +1,49 @@
+-- Webhook subscriptions (empty events array = every event)
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+  id          UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  url         TEXT NOT NULL,
+  events      TEXT[] NOT NULL DEFAULT '{}',
+  secret      TEXT NOT NULL,
+  active      BOOLEAN NOT NULL DEFAULT TRUE,
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Transactional outbox, written in the same transaction as server_events
+CREATE TABLE IF NOT EXISTS event_outbox (
+  id             BIGSERIAL PRIMARY KEY,
+  event_id       BIGINT NOT NULL REFERENCES server_events(id) ON DELETE CASCADE,
+  server_id      UUID NOT NULL,
+  event          TEXT NOT NULL,
+  payload        JSONB NOT NULL,
+  created_at     TIMESTAMPTZ NOT NULL DEFAULT now(),
+  dispatched_at  TIMESTAMPTZ               -- fanned out into deliveries
+);
+CREATE INDEX IF NOT EXISTS event_outbox_pending_idx ON event_outbox(id) WHERE dispatched_at IS NULL;
+
+-- One row per (subscription, event); retried until succeeded or dead
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+  id                BIGSERIAL PRIMARY KEY,
+  subscription_id   UUID NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+  outbox_id         BIGINT NOT NULL REFERENCES event_outbox(id) ON DELETE CASCADE,
+  status            TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending','succeeded','dead')),
+  attempts          INT NOT NULL DEFAULT 0,
+  next_attempt_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+  last_status_code  INT,
+  last_error        TEXT,
+  created_at        TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at        TIMESTAMPTZ NOT NULL DEFAULT now(),
+  UNIQUE (subscription_id, outbox_id)
+);
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS webhook_deliveries_sub_idx ON webhook_deliveries(subscription_id, id DESC);
+
+-- Delivery log: every HTTP attempt
+CREATE TABLE IF NOT EXISTS webhook_delivery_attempts (
+  id            BIGSERIAL PRIMARY KEY,
+  delivery_id   BIGINT NOT NULL REFERENCES webhook_deliveries(id) ON DELETE CASCADE,
+  attempted_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+  status_code   INT,
+  error         TEXT,
+  duration_ms   INT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS webhook_delivery_attempts_idx ON webhook_delivery_attempts(delivery_id, id DESC);
@@ -0,0 +1,18 @@
+-- Scheduled start/stop policies (office-hours schedules)
+CREATE TABLE IF NOT EXISTS schedules (
+  id           UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  name         TEXT NOT NULL,
+  cron_expr    TEXT NOT NULL,                 -- standard 5-field cron
+  timezone     TEXT NOT NULL DEFAULT 'UTC',   -- IANA zone the cron is evaluated in
+  action       TEXT NOT NULL CHECK (action IN ('start','stop')),
+  server_id    UUID REFERENCES servers(id) ON DELETE CASCADE,
+  selector     JSONB,                         -- label selector when server_id is NULL
+  catch_up     TEXT NOT NULL DEFAULT 'skip' CHECK (catch_up IN ('skip','once')),
+  enabled      BOOLEAN NOT NULL DEFAULT TRUE,
+  next_run_at  TIMESTAMPTZ NOT NULL,
+  last_run_at  TIMESTAMPTZ,
+  created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+  CHECK ((server_id IS NULL) <> (selector IS NULL))
+);
+CREATE INDEX IF NOT EXISTS schedules_due_idx ON schedules(next_run_at) WHERE enabled;
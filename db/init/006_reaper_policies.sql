@@ -0,0 +1,18 @@
+-- Idle-reaper policies; the most specific enabled match wins per server
+CREATE TABLE IF NOT EXISTS reaper_policies (
+  id                   UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  name                 TEXT NOT NULL,
+  project              TEXT,                          -- matches servers.labels->>'project'
+  selector             JSONB NOT NULL DEFAULT '{}',   -- label selector, {} matches all
+  idle_seconds         INT NOT NULL CHECK (idle_seconds > 0),
+  warn_before_seconds  INT NOT NULL DEFAULT 0 CHECK (warn_before_seconds >= 0),
+  exclude_server_ids   UUID[] NOT NULL DEFAULT '{}',
+  dry_run              BOOLEAN NOT NULL DEFAULT FALSE,  -- only report, never terminate
+  priority             INT NOT NULL DEFAULT 0,
+  enabled              BOOLEAN NOT NULL DEFAULT TRUE,
+  created_at           TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at           TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- When the pre-termination warning fired for the current STOPPED period
+ALTER TABLE servers ADD COLUMN IF NOT EXISTS reaper_warned_at TIMESTAMPTZ;
@@ -0,0 +1,11 @@
+-- Termination protection flag and named deletion locks
+ALTER TABLE servers ADD COLUMN IF NOT EXISTS termination_protection BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS server_locks (
+  server_id   UUID NOT NULL REFERENCES servers(id) ON DELETE CASCADE,
+  name        TEXT NOT NULL,
+  reason      TEXT NOT NULL DEFAULT '',
+  created_by  TEXT NOT NULL,
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (server_id, name)
+);
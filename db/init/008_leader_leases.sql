@@ -0,0 +1,9 @@
+-- Leases for leader election between API replicas
+CREATE TABLE IF NOT EXISTS leader_leases (
+  name         TEXT PRIMARY KEY,
+  holder       TEXT NOT NULL,
+  token        BIGINT NOT NULL,        -- fencing token, bumped whenever the holder changes
+  acquired_at  TIMESTAMPTZ NOT NULL,
+  renewed_at   TIMESTAMPTZ NOT NULL,
+  expires_at   TIMESTAMPTZ NOT NULL
+);
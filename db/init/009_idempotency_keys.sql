@@ -0,0 +1,15 @@
+-- Stored responses for POST requests sent with an Idempotency-Key header
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+  principal     TEXT NOT NULL,          -- "api" or "api:<X-Actor>"; keys are scoped per caller
+  key           TEXT NOT NULL,
+  method        TEXT NOT NULL,
+  path          TEXT NOT NULL,
+  request_hash  TEXT NOT NULL,          -- sha256 of method, path and body
+  status_code   INT,                    -- NULL while the first request is in flight
+  content_type  TEXT,
+  body          BYTEA,
+  created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (principal, key)
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_created_at_idx ON idempotency_keys (created_at);
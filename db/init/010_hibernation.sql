@@ -0,0 +1,14 @@
+-- Hibernation: RUNNING -> HIBERNATED -> (resume) RUNNING. Hibernated
+-- servers are billed at the instance type's storage-only rate.
+ALTER TYPE server_status ADD VALUE IF NOT EXISTS 'HIBERNATED';
+
+ALTER TABLE instance_types
+  ADD COLUMN IF NOT EXISTS storage_hourly_rate NUMERIC(10,4) NOT NULL DEFAULT 0 CHECK (storage_hourly_rate >= 0);
+-- Storage defaults to a tenth of the compute rate
+UPDATE instance_types SET storage_hourly_rate = round(hourly_rate * 0.1, 4) WHERE storage_hourly_rate = 0;
+
+ALTER TABLE servers ADD COLUMN IF NOT EXISTS hibernated_at TIMESTAMPTZ;
+
+-- Idle threshold for HIBERNATED servers; NULL leaves them alone
+ALTER TABLE reaper_policies
+  ADD COLUMN IF NOT EXISTS hibernated_idle_seconds INT CHECK (hibernated_idle_seconds > 0);
@@ -0,0 +1,17 @@
+-- Simulated transitions: start/stop/terminate can pass through STARTING,
+-- STOPPING and TERMINATING for a configured time before a background
+-- worker moves the server to transition_target
+ALTER TYPE server_status ADD VALUE IF NOT EXISTS 'STARTING';
+ALTER TYPE server_status ADD VALUE IF NOT EXISTS 'STOPPING';
+ALTER TYPE server_status ADD VALUE IF NOT EXISTS 'TERMINATING';
+
+ALTER TABLE servers
+  ADD COLUMN IF NOT EXISTS transition_action     TEXT,
+  ADD COLUMN IF NOT EXISTS transition_target     TEXT,
+  ADD COLUMN IF NOT EXISTS transition_started_at TIMESTAMPTZ,
+  ADD COLUMN IF NOT EXISTS transition_due_at     TIMESTAMPTZ,
+  -- An action received during the transition, run when it completes
+  ADD COLUMN IF NOT EXISTS queued_action         TEXT;
+
+CREATE INDEX IF NOT EXISTS servers_transition_due_idx
+  ON servers(transition_due_at) WHERE transition_due_at IS NOT NULL;
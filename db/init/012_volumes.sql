@@ -0,0 +1,41 @@
+-- Block storage volumes. Volumes live in one region, attach to one server
+-- there and are billed per GB-month until deleted, attached or not.
+CREATE TABLE IF NOT EXISTS volume_types (
+  type          TEXT PRIMARY KEY,          -- e.g., 'ssd'
+  gb_month_rate NUMERIC(10,4) NOT NULL CHECK (gb_month_rate >= 0)
+);
+
+INSERT INTO volume_types (type, gb_month_rate) VALUES
+  ('standard', 0.0450),
+  ('ssd',      0.1000),
+  ('io1',      0.1250)
+ON CONFLICT DO NOTHING;
+
+-- Attachment limit per instance type
+ALTER TABLE instance_types
+  ADD COLUMN IF NOT EXISTS max_volumes INT NOT NULL DEFAULT 4 CHECK (max_volumes >= 0);
+UPDATE instance_types SET max_volumes = 2 WHERE type = 't2.micro';
+UPDATE instance_types SET max_volumes = 8 WHERE type = 't2.medium';
+
+CREATE TABLE IF NOT EXISTS volumes (
+  id                    UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  name                  TEXT NOT NULL,
+  region                TEXT NOT NULL,
+  type                  TEXT NOT NULL REFERENCES volume_types(type),
+  size_gb               INT NOT NULL CHECK (size_gb BETWEEN 1 AND 16384),
+  status                TEXT NOT NULL DEFAULT 'available' CHECK (status IN ('available','in-use','deleted')),
+  server_id             UUID REFERENCES servers(id),
+  device                TEXT,
+  delete_on_termination BOOLEAN NOT NULL DEFAULT FALSE,
+  labels                JSONB NOT NULL DEFAULT '{}'::jsonb,
+  created_at            TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at            TIMESTAMPTZ NOT NULL DEFAULT now(),
+  attached_at           TIMESTAMPTZ,
+  deleted_at            TIMESTAMPTZ,
+  billing_last_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+  accrued_cost          NUMERIC(12,6) NOT NULL DEFAULT 0,
+  CHECK ((status = 'in-use') = (server_id IS NOT NULL))
+);
+CREATE INDEX IF NOT EXISTS volumes_region_idx ON volumes(region);
+CREATE INDEX IF NOT EXISTS volumes_server_idx ON volumes(server_id) WHERE server_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS volumes_server_device_idx ON volumes(server_id, device) WHERE server_id IS NOT NULL;
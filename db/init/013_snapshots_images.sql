@@ -0,0 +1,60 @@
+-- Snapshots of a server's root disk or of a volume, images registered from
+-- snapshots, and the long-running operations that track snapshot progress
+
+-- Root disk size, used as the size of server snapshots
+ALTER TABLE instance_types
+  ADD COLUMN IF NOT EXISTS root_gb INT NOT NULL DEFAULT 8 CHECK (root_gb > 0);
+
+CREATE TABLE IF NOT EXISTS snapshots (
+  id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  name            TEXT NOT NULL,
+  source_type     TEXT NOT NULL CHECK (source_type IN ('server','volume')),
+  source_id       UUID NOT NULL,
+  region          TEXT NOT NULL,
+  size_gb         INT NOT NULL CHECK (size_gb > 0),
+  status          TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending','available','failed','deleted')),
+  progress        INT NOT NULL DEFAULT 0 CHECK (progress BETWEEN 0 AND 100),
+  labels          JSONB NOT NULL DEFAULT '{}'::jsonb,
+  -- Storage price per GB-month, fixed when the snapshot is taken
+  gb_month_rate   NUMERIC(10,4) NOT NULL DEFAULT 0.0500,
+  created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+  completed_at    TIMESTAMPTZ,
+  deleted_at      TIMESTAMPTZ,
+  billing_last_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  accrued_cost    NUMERIC(12,6) NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS snapshots_source_idx ON snapshots(source_type, source_id);
+
+CREATE TABLE IF NOT EXISTS images (
+  id          UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  name        TEXT NOT NULL,
+  description TEXT NOT NULL DEFAULT '',
+  snapshot_id UUID NOT NULL REFERENCES snapshots(id),
+  region      TEXT NOT NULL,
+  status      TEXT NOT NULL DEFAULT 'available' CHECK (status IN ('available','deregistered')),
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS images_snapshot_idx ON images(snapshot_id);
+
+ALTER TABLE servers ADD COLUMN IF NOT EXISTS image_id UUID REFERENCES images(id);
+
+-- Long-running operations; progress is simulated from started_at and
+-- duration_ms by the operations worker
+CREATE TABLE IF NOT EXISTS operations (
+  id            UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  type          TEXT NOT NULL,                 -- e.g., 'create_snapshot'
+  resource_type TEXT NOT NULL,
+  resource_id   UUID NOT NULL,
+  status        TEXT NOT NULL DEFAULT 'running' CHECK (status IN ('running','succeeded','failed')),
+  progress      INT NOT NULL DEFAULT 0 CHECK (progress BETWEEN 0 AND 100),
+  error         TEXT,
+  actor         TEXT,
+  started_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+  duration_ms   BIGINT NOT NULL CHECK (duration_ms >= 0),
+  updated_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+  done_at       TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS operations_running_idx ON operations(started_at) WHERE status = 'running';
+CREATE INDEX IF NOT EXISTS operations_resource_idx ON operations(resource_type, resource_id);
@@ -0,0 +1,39 @@
+-- Security groups: named sets of ingress/egress rules in one region,
+-- attached to servers there. Traffic is allowed only when a rule of an
+-- attached group matches it.
+CREATE TABLE IF NOT EXISTS security_groups (
+  id          UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  name        TEXT NOT NULL,
+  description TEXT NOT NULL DEFAULT '',
+  region      TEXT NOT NULL,
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+  UNIQUE (region, name)
+);
+
+CREATE TABLE IF NOT EXISTS security_group_rules (
+  id              BIGSERIAL PRIMARY KEY,
+  group_id        UUID NOT NULL REFERENCES security_groups(id) ON DELETE CASCADE,
+  direction       TEXT NOT NULL CHECK (direction IN ('ingress','egress')),
+  protocol        TEXT NOT NULL CHECK (protocol IN ('tcp','udp','icmp','all')),
+  port_from       INT CHECK (port_from BETWEEN 1 AND 65535),
+  port_to         INT CHECK (port_to BETWEEN 1 AND 65535),
+  -- The peer is either an address range or the servers in another group
+  -- (the source for ingress, the destination for egress)
+  cidr            CIDR,
+  source_group_id UUID REFERENCES security_groups(id),
+  description     TEXT NOT NULL DEFAULT '',
+  created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+  CHECK ((cidr IS NULL) <> (source_group_id IS NULL)),
+  CHECK (port_from <= port_to)
+);
+CREATE INDEX IF NOT EXISTS security_group_rules_group_idx ON security_group_rules(group_id);
+CREATE INDEX IF NOT EXISTS security_group_rules_source_idx ON security_group_rules(source_group_id);
+
+CREATE TABLE IF NOT EXISTS server_security_groups (
+  server_id   UUID NOT NULL REFERENCES servers(id),
+  group_id    UUID NOT NULL REFERENCES security_groups(id) ON DELETE CASCADE,
+  attached_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (server_id, group_id)
+);
+CREATE INDEX IF NOT EXISTS server_security_groups_group_idx ON server_security_groups(group_id);
@@ -0,0 +1,57 @@
+-- Virtual networks. A VPC covers a CIDR in one region and is split into
+-- subnets; every address of a subnet is a row of ip_pool, so servers get
+-- their IP from the subnet they are created in. Address ranges do not
+-- overlap across VPCs (ip_pool.ip stays globally unique).
+CREATE TABLE IF NOT EXISTS vpcs (
+  id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  name       TEXT NOT NULL,
+  region     TEXT NOT NULL,
+  cidr       CIDR NOT NULL,
+  is_default BOOLEAN NOT NULL DEFAULT FALSE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS vpcs_default_idx ON vpcs(region) WHERE is_default;
+
+CREATE TABLE IF NOT EXISTS subnets (
+  id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  vpc_id     UUID NOT NULL REFERENCES vpcs(id),
+  name       TEXT NOT NULL,
+  region     TEXT NOT NULL,
+  zone       TEXT,
+  cidr       CIDR NOT NULL,
+  is_default BOOLEAN NOT NULL DEFAULT FALSE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS subnets_vpc_idx ON subnets(vpc_id);
+CREATE UNIQUE INDEX IF NOT EXISTS subnets_default_idx ON subnets(region) WHERE is_default;
+
+ALTER TABLE ip_pool ADD COLUMN IF NOT EXISTS subnet_id UUID REFERENCES subnets(id);
+CREATE INDEX IF NOT EXISTS ip_pool_subnet_free_idx ON ip_pool(subnet_id) WHERE NOT allocated;
+
+ALTER TABLE servers ADD COLUMN IF NOT EXISTS subnet_id UUID REFERENCES subnets(id);
+
+-- Move each region's existing pool into a default VPC with one default
+-- subnet spanning the smallest network that holds all of its addresses
+INSERT INTO vpcs (name, region, cidr, is_default)
+SELECT 'default', region, network(inet_merge(min(ip), max(ip))), TRUE
+FROM ip_pool
+GROUP BY region
+ON CONFLICT DO NOTHING;
+
+INSERT INTO subnets (vpc_id, name, region, cidr, is_default)
+SELECT v.id, 'default', v.region, v.cidr, TRUE
+FROM vpcs v
+WHERE v.is_default
+ON CONFLICT DO NOTHING;
+
+UPDATE ip_pool p
+SET subnet_id = sn.id
+FROM subnets sn
+WHERE sn.region = p.region AND sn.is_default AND p.subnet_id IS NULL;
+
+UPDATE servers s
+SET subnet_id = p.subnet_id
+FROM ip_pool p
+WHERE p.id = s.ip_id AND s.subnet_id IS NULL;
@@ -0,0 +1,44 @@
+-- Availability zones. Every region gets zones <region>a, b and c; a zone
+-- marked impaired (by the fault API) takes no new servers and its servers
+-- cannot start.
+CREATE TABLE IF NOT EXISTS zones (
+  name            TEXT PRIMARY KEY,
+  region          TEXT NOT NULL,
+  impaired        BOOLEAN NOT NULL DEFAULT FALSE,
+  impaired_reason TEXT,
+  impaired_at     TIMESTAMPTZ,
+  created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at      TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS zones_region_idx ON zones(region);
+
+INSERT INTO zones (name, region)
+SELECT r.region || z.suffix, r.region
+FROM (SELECT DISTINCT region FROM ip_pool) r
+CROSS JOIN (VALUES ('a'), ('b'), ('c')) AS z(suffix)
+ON CONFLICT DO NOTHING;
+
+-- Placement groups decide the zone of their members: spread, pack, or
+-- spread_by_label (members sharing a value of label_key spread out)
+CREATE TABLE IF NOT EXISTS placement_groups (
+  id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  name       TEXT NOT NULL,
+  region     TEXT NOT NULL,
+  strategy   TEXT NOT NULL CHECK (strategy IN ('spread', 'pack', 'spread_by_label')),
+  label_key  TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  UNIQUE (region, name)
+);
+
+ALTER TABLE servers ADD COLUMN IF NOT EXISTS zone TEXT REFERENCES zones(name);
+ALTER TABLE servers ADD COLUMN IF NOT EXISTS placement_group_id UUID REFERENCES placement_groups(id);
+CREATE INDEX IF NOT EXISTS servers_zone_idx ON servers(zone);
+CREATE INDEX IF NOT EXISTS servers_placement_group_idx ON servers(placement_group_id) WHERE placement_group_id IS NOT NULL;
+
+-- Existing servers land in their subnet's zone, or the region's first zone
+UPDATE servers s
+SET zone = COALESCE(
+  (SELECT z.name FROM subnets sn JOIN zones z ON z.name = sn.zone WHERE sn.id = s.subnet_id),
+  (SELECT min(z.name) FROM zones z WHERE z.region = s.region))
+WHERE s.zone IS NULL;
@@ -0,0 +1,47 @@
+-- Simulated hypervisor hosts. Servers that are starting, running,
+-- rebooting or stopping occupy their instance type's vCPUs and memory on
+-- one host of their zone; stopped and hibernated servers hold no host.
+
+ALTER TABLE instance_types
+  ADD COLUMN IF NOT EXISTS vcpus INT NOT NULL DEFAULT 1 CHECK (vcpus > 0),
+  ADD COLUMN IF NOT EXISTS memory_mib INT NOT NULL DEFAULT 1024 CHECK (memory_mib > 0);
+UPDATE instance_types SET vcpus = 1, memory_mib = 2048 WHERE type = 't2.small';
+UPDATE instance_types SET vcpus = 2, memory_mib = 4096 WHERE type = 't2.medium';
+
+CREATE TABLE IF NOT EXISTS hosts (
+  id                 UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  name               TEXT NOT NULL UNIQUE,
+  region             TEXT NOT NULL,
+  zone               TEXT NOT NULL REFERENCES zones(name),
+  vcpus              INT NOT NULL CHECK (vcpus > 0),
+  memory_mib         INT NOT NULL CHECK (memory_mib > 0),
+  status             TEXT NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'maintenance')),
+  maintenance_reason TEXT,
+  maintenance_at     TIMESTAMPTZ,
+  created_at         TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at         TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS hosts_zone_idx ON hosts(zone);
+
+ALTER TABLE servers ADD COLUMN IF NOT EXISTS host_id UUID REFERENCES hosts(id);
+CREATE INDEX IF NOT EXISTS servers_host_idx ON servers(host_id) WHERE host_id IS NOT NULL;
+
+-- Two hosts per zone
+INSERT INTO hosts (name, region, zone, vcpus, memory_mib)
+SELECT z.name || '-h' || n, z.region, z.name, 16, 65536
+FROM zones z CROSS JOIN generate_series(1, 2) n
+ON CONFLICT DO NOTHING;
+
+-- Spread servers that are already up across their zone's hosts
+WITH up AS (
+  SELECT id, zone, row_number() OVER (PARTITION BY zone ORDER BY created_at, id) - 1 AS rn
+  FROM servers
+  WHERE status IN ('STARTING', 'RUNNING', 'REBOOTING', 'STOPPING') AND host_id IS NULL AND zone IS NOT NULL
+), h AS (
+  SELECT id, zone, row_number() OVER (PARTITION BY zone ORDER BY name) - 1 AS rn, count(*) OVER (PARTITION BY zone) AS n
+  FROM hosts
+)
+UPDATE servers s
+SET host_id = h.id
+FROM up JOIN h ON h.zone = up.zone AND h.rn = up.rn % h.n
+WHERE s.id = up.id;
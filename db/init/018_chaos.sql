@@ -0,0 +1,10 @@
+-- Fault injection settings, one row shared by every replica
+CREATE TABLE IF NOT EXISTS chaos_config (
+  id         BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+  config     JSONB NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Set when fault injection leaves a reboot stuck: complete-reboot is
+-- refused until then
+ALTER TABLE servers ADD COLUMN IF NOT EXISTS reboot_stuck_until TIMESTAMPTZ;
@@ -0,0 +1,4 @@
+-- Each claim of a delivery gets a fresh token; a dispatcher only records
+-- the attempt while its token is still the delivery's, so a send that
+-- outlived its lease (and was claimed again elsewhere) is not recorded twice.
+ALTER TABLE webhook_deliveries ADD COLUMN IF NOT EXISTS claim_token UUID;
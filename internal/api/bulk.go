@@ -0,0 +1,145 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"virtualservers/internal/domain"
+	"virtualservers/internal/logging"
+	"virtualservers/internal/repository"
+	"virtualservers/internal/service"
+)
+
+const (
+	maxBulkTargets         = 1000
+	defaultBulkConcurrency = 8
+	maxBulkConcurrency     = 32
+)
+
+type bulkFilter struct {
+	Region string            `json:"region"`
+	Zone   string            `json:"zone"`
+	Type   string            `json:"type"`
+	Status string            `json:"status"`
+	Labels map[string]string `json:"labels"`
+}
+
+type bulkActionReq struct {
+	Action      string      `json:"action"`
+	IDs         []string    `json:"ids"`
+	Filter      *bulkFilter `json:"filter"`
+	DryRun      bool        `json:"dry_run"`
+	Concurrency int         `json:"concurrency"`
+}
+
+type bulkResult struct {
+	ID             string   `json:"id"`
+	PreviousStatus string   `json:"previous_status,omitempty"`
+	Status         string   `json:"status,omitempty"`
+	Error          *Problem `json:"error,omitempty"`
+}
+
+type bulkActionResp struct {
+	Action    string       `json:"action"`
+	DryRun    bool         `json:"dry_run"`
+	Matched   int          `json:"matched"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+	Results   []bulkResult `json:"results"`
+}
+
+// BulkAction applies one lifecycle action to a list of servers or to every
+// server matching a filter, reporting per-server results. Individual
+// failures do not fail the request; dry_run previews without changing
+// anything.
+func (h *Handler) BulkAction(w http.ResponseWriter, r *http.Request) {
+	var req bulkActionReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "invalid JSON body")
+		return
+	}
+	action := domain.NormalizeAction(req.Action)
+	if !domain.KnownAction(action) {
+		badRequest(w, r, fmt.Sprintf("unknown action %q", req.Action))
+		return
+	}
+	if (len(req.IDs) > 0) == (req.Filter != nil) {
+		badRequest(w, r, "exactly one of ids or filter is required")
+		return
+	}
+	concurrency := req.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultBulkConcurrency
+	}
+	concurrency = min(concurrency, maxBulkConcurrency)
+
+	var targets []repository.BulkTarget
+	if req.Filter != nil {
+		f := req.Filter
+		if f.Region == "" && f.Zone == "" && f.Type == "" && strings.TrimSpace(f.Status) == "" && len(f.Labels) == 0 {
+			badRequest(w, r, "filter needs at least one of region, zone, type, status or labels")
+			return
+		}
+		lf := repository.ListFilters{Region: f.Region, Zone: f.Zone, Type: f.Type, Status: strings.TrimSpace(f.Status), Labels: f.Labels}
+		var err error
+		if targets, err = h.Store.BulkTargetsMatching(r.Context(), lf, maxBulkTargets); err != nil {
+			writeError(w, r, "BulkAction", err)
+			return
+		}
+	} else {
+		ids := dedupe(req.IDs)
+		if len(ids) > maxBulkTargets {
+			badRequest(w, r, fmt.Sprintf("at most %d ids per request", maxBulkTargets))
+			return
+		}
+		found, err := h.Store.BulkTargetsByID(r.Context(), ids)
+		if err != nil {
+			internalError(w, r, "BulkAction", err)
+			return
+		}
+		// Unknown IDs keep an empty status and are reported as not found
+		for _, id := range ids {
+			t, ok := found[id]
+			if !ok {
+				t = repository.BulkTarget{ID: id}
+			}
+			targets = append(targets, t)
+		}
+	}
+
+	results := service.RunBulkAction(eventContext(r), h.Store, targets, action, concurrency, req.DryRun)
+	resp := bulkActionResp{Action: action, DryRun: req.DryRun, Matched: len(results), Results: []bulkResult{}}
+	for _, res := range results {
+		item := bulkResult{ID: res.ID, PreviousStatus: res.PreviousStatus, Status: res.Status}
+		if res.Err != nil {
+			p, ok := ProblemFor(res.Err)
+			if !ok {
+				logging.FromRequest(r).Error("BulkAction failed", "server_id", res.ID, "err", res.Err)
+				p = Problem{Status: http.StatusInternalServerError, Code: codeInternal}
+			}
+			p.fill()
+			item.Error = &p
+			item.Status = ""
+			resp.Failed++
+		} else {
+			resp.Succeeded++
+		}
+		resp.Results = append(resp.Results, item)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func dedupe(ids []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, id := range ids {
+		if id = strings.TrimSpace(id); id != "" && !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"virtualservers/internal/chaos"
+	"virtualservers/internal/repository"
+)
+
+// ChaosHandler serves the fault injection settings. Changes apply to this
+// replica at once and to the others within a few seconds.
+type ChaosHandler struct {
+	Store  *repository.Store
+	Engine *chaos.Engine
+}
+
+type chaosReq struct {
+	Enabled                     bool              `json:"enabled"`
+	Seed                        *int64            `json:"seed"`
+	CrashProbability            float64           `json:"crash_probability"`
+	ProvisionFailureProbability float64           `json:"provision_failure_probability"`
+	StuckRebootProbability      float64           `json:"stuck_reboot_probability"`
+	StuckRebootSeconds          *int              `json:"stuck_reboot_seconds"`
+	LatencyProbability          float64           `json:"latency_probability"`
+	LatencyMS                   int               `json:"latency_ms"`
+	HTTPErrorProbability        float64           `json:"http_error_probability"`
+	Regions                     []string          `json:"regions"`
+	Selector                    map[string]string `json:"selector"`
+}
+
+func (h *ChaosHandler) GetConfig(w http.ResponseWriter, r *http.Request) {
+	cfg, err := h.Store.GetChaosConfig(r.Context())
+	if err != nil {
+		internalError(w, r, "GetChaosConfig", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cfg)
+}
+
+// PutConfig replaces the settings. Without a seed one is picked (and
+// returned) so the run can be replayed; stuck reboots last 300s unless
+// stuck_reboot_seconds says otherwise.
+func (h *ChaosHandler) PutConfig(w http.ResponseWriter, r *http.Request) {
+	var req chaosReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "invalid JSON body")
+		return
+	}
+	cfg := chaos.Config{
+		Enabled:                     req.Enabled,
+		Seed:                        time.Now().UnixNano(),
+		CrashProbability:            req.CrashProbability,
+		ProvisionFailureProbability: req.ProvisionFailureProbability,
+		StuckRebootProbability:      req.StuckRebootProbability,
+		StuckRebootSeconds:          300,
+		LatencyProbability:          req.LatencyProbability,
+		LatencyMS:                   req.LatencyMS,
+		HTTPErrorProbability:        req.HTTPErrorProbability,
+		Regions:                     req.Regions,
+		Selector:                    req.Selector,
+	}
+	if req.Seed != nil {
+		cfg.Seed = *req.Seed
+	}
+	if cfg.Regions == nil {
+		cfg.Regions = []string{}
+	}
+	if cfg.Selector == nil {
+		cfg.Selector = map[string]string{}
+	}
+	if req.StuckRebootSeconds != nil {
+		cfg.StuckRebootSeconds = *req.StuckRebootSeconds
+	}
+	if err := cfg.Validate(); err != nil {
+		writeError(w, r, "PutChaosConfig", err)
+		return
+	}
+	cfg, err := h.Store.SaveChaosConfig(r.Context(), cfg)
+	if err != nil {
+		internalError(w, r, "SaveChaosConfig", err)
+		return
+	}
+	h.Engine.Set(cfg)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cfg)
+}
+
+// Chaos fails requests with 503 chaos_injected at the configured HTTP
+// error probability, before they reach the handler
+func Chaos(engine *chaos.Engine) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if engine.HTTPError() {
+				problem(w, r, http.StatusServiceUnavailable, codeChaosInjected, "request failed by chaos mode")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -4,10 +4,13 @@ import (
 	"database/sql"
 	"encoding/json"
 	"net/http"
+
+	"virtualservers/internal/service"
 )
 
 type HealthHandler struct {
-	DB *sql.DB
+	DB     *sql.DB
+	Leader *service.LeaderElector
 }
 
 //Always ok if process is up
@@ -17,7 +20,8 @@ func (h *HealthHandler) Healthz(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("ok"))
 }
 
-// Checking DB Connection
+// Checking DB Connection; also reports whether this replica runs the daemons.
+// Followers are still ready: every replica serves the API.
 func (h *HealthHandler) Readyz(w http.ResponseWriter, r *http.Request) {
 	if err := h.DB.PingContext(r.Context()); err != nil {
 		w.WriteHeader(http.StatusServiceUnavailable)
@@ -27,7 +31,11 @@ func (h *HealthHandler) Readyz(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
-	json.NewEncoder(w).Encode(map[string]string{
+	resp := map[string]any{
 		"status": "ready",
-	})
+	}
+	if h.Leader != nil {
+		resp["leader"] = h.Leader.Status()
+	}
+	json.NewEncoder(w).Encode(resp)
 }
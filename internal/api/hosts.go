@@ -0,0 +1,124 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"virtualservers/internal/repository"
+)
+
+// HostHandler serves the simulated hypervisor hosts servers are packed on
+// and their maintenance
+type HostHandler struct {
+	Store *repository.Store
+}
+
+type hostReq struct {
+	Name      string `json:"name"`
+	Zone      string `json:"zone"`
+	VCPUs     int    `json:"vcpus"`
+	MemoryMiB int    `json:"memory_mib"`
+}
+
+func (h *HostHandler) CreateHost(w http.ResponseWriter, r *http.Request) {
+	var req hostReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "invalid JSON body")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || req.Zone == "" {
+		badRequest(w, r, "missing fields (name, zone, vcpus, memory_mib required)")
+		return
+	}
+	host, err := h.Store.CreateHost(r.Context(), repository.Host{
+		Name:      req.Name,
+		Zone:      req.Zone,
+		VCPUs:     req.VCPUs,
+		MemoryMiB: req.MemoryMiB,
+	})
+	if err != nil {
+		writeError(w, r, "CreateHost", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(host)
+}
+
+func (h *HostHandler) ListHosts(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	items, err := h.Store.ListHosts(r.Context(), repository.HostFilter{
+		Region: q.Get("region"),
+		Zone:   q.Get("zone"),
+		Status: q.Get("status"),
+	})
+	if err != nil {
+		internalError(w, r, "ListHosts", err)
+		return
+	}
+	if items == nil {
+		items = []repository.Host{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"items": items})
+}
+
+func (h *HostHandler) GetHost(w http.ResponseWriter, r *http.Request) {
+	host, err := h.Store.GetHost(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		internalError(w, r, "GetHost", err)
+		return
+	}
+	if host == nil {
+		notFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(host)
+}
+
+// DeleteHost deletes a host no server is on
+func (h *HostHandler) DeleteHost(w http.ResponseWriter, r *http.Request) {
+	if err := h.Store.DeleteHost(r.Context(), chi.URLParam(r, "id")); err != nil {
+		writeError(w, r, "DeleteHost", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Maintenance puts a host into maintenance, with an optional
+// {"reason": ...}, and drains it: its servers are live-migrated within the
+// zone or stopped when nothing has room. Responds with the drain report.
+func (h *HostHandler) Maintenance(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		badRequest(w, r, "invalid JSON body")
+		return
+	}
+	report, err := h.Store.DrainHost(eventContext(r), chi.URLParam(r, "id"), strings.TrimSpace(req.Reason))
+	if err != nil {
+		writeError(w, r, "DrainHost", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// Activate ends a host's maintenance
+func (h *HostHandler) Activate(w http.ResponseWriter, r *http.Request) {
+	host, err := h.Store.ActivateHost(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, "ActivateHost", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(host)
+}
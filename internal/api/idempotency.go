@@ -0,0 +1,112 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"virtualservers/internal/logging"
+	"virtualservers/internal/repository"
+)
+
+const (
+	idempotencyTTL     = 24 * time.Hour
+	idempotencyKeySize = 255
+	maxIdempotentBody  = 1 << 20
+)
+
+// Idempotency makes POST requests carrying an Idempotency-Key header safe to
+// retry: the first response (unless it is a 5xx) is stored for 24h and
+// replayed, with an Idempotent-Replayed: true header, for every retry from
+// the same principal. Reusing a key for a different request is rejected.
+func Idempotency(store *repository.Store) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get("Idempotency-Key")
+			if r.Method != http.MethodPost || key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > idempotencyKeySize {
+				badRequest(w, r, "Idempotency-Key must be at most 255 characters")
+				return
+			}
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotentBody+1))
+			if err != nil {
+				badRequest(w, r, "could not read request body")
+				return
+			}
+			if len(body) > maxIdempotentBody {
+				problem(w, r, http.StatusRequestEntityTooLarge, codeBodyTooLarge, "request body is larger than 1 MiB")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			sum := sha256.New()
+			io.WriteString(sum, r.Method+" "+r.URL.Path+"\n")
+			sum.Write(body)
+			hash := hex.EncodeToString(sum.Sum(nil))
+			principal := logging.Principal(r)
+
+			rec, claimed, err := store.ClaimIdempotencyKey(r.Context(), principal, key, r.Method, r.URL.Path, hash, idempotencyTTL)
+			if err != nil {
+				internalError(w, r, "Idempotency", err)
+				return
+			}
+			if !claimed {
+				switch {
+				case rec != nil && rec.RequestHash != hash:
+					problem(w, r, http.StatusUnprocessableEntity, codeKeyReused,
+						"Idempotency-Key was already used for a different request")
+				case rec == nil || rec.StatusCode == nil:
+					w.Header().Set("Retry-After", "1")
+					problem(w, r, http.StatusConflict, codeKeyInProgress,
+						"a request with this Idempotency-Key is still in progress")
+				default:
+					if rec.ContentType != "" {
+						w.Header().Set("Content-Type", rec.ContentType)
+					}
+					w.Header().Set("Idempotent-Replayed", "true")
+					w.WriteHeader(*rec.StatusCode)
+					w.Write(rec.Body)
+				}
+				return
+			}
+
+			// The outcome is stored even if the client went away meanwhile
+			ctx := context.WithoutCancel(r.Context())
+			completed := false
+			defer func() {
+				if !completed {
+					if err := store.ReleaseIdempotencyKey(ctx, principal, key); err != nil {
+						logging.FromRequest(r).Error("Idempotency release failed", "err", err)
+					}
+				}
+			}()
+
+			var buf bytes.Buffer
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			ww.Tee(&buf)
+			next.ServeHTTP(ww, r)
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if status >= 500 {
+				return
+			}
+			if err := store.CompleteIdempotencyKey(ctx, principal, key, status, ww.Header().Get("Content-Type"), buf.Bytes()); err != nil {
+				logging.FromRequest(r).Error("Idempotency complete failed", "err", err)
+				return
+			}
+			completed = true
+		})
+	}
+}
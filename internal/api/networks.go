@@ -0,0 +1,154 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"virtualservers/internal/repository"
+)
+
+// NetworkHandler serves VPCs and their subnets
+type NetworkHandler struct {
+	Store *repository.Store
+}
+
+type vpcReq struct {
+	Name   string `json:"name"`
+	Region string `json:"region"`
+	CIDR   string `json:"cidr"`
+}
+
+func (h *NetworkHandler) CreateVPC(w http.ResponseWriter, r *http.Request) {
+	var req vpcReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "invalid JSON body")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || req.Region == "" || req.CIDR == "" {
+		badRequest(w, r, "missing fields (name, region, cidr required)")
+		return
+	}
+	v, err := h.Store.CreateVPC(r.Context(), repository.VPC{Name: req.Name, Region: req.Region, CIDR: strings.TrimSpace(req.CIDR)})
+	if err != nil {
+		writeError(w, r, "CreateVPC", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (h *NetworkHandler) ListVPCs(w http.ResponseWriter, r *http.Request) {
+	items, err := h.Store.ListVPCs(r.Context(), r.URL.Query().Get("region"))
+	if err != nil {
+		internalError(w, r, "ListVPCs", err)
+		return
+	}
+	if items == nil {
+		items = []repository.VPC{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"items": items})
+}
+
+func (h *NetworkHandler) GetVPC(w http.ResponseWriter, r *http.Request) {
+	v, err := h.Store.GetVPC(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		internalError(w, r, "GetVPC", err)
+		return
+	}
+	if v == nil {
+		notFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// DeleteVPC deletes a VPC once its subnets are gone; default VPCs stay
+func (h *NetworkHandler) DeleteVPC(w http.ResponseWriter, r *http.Request) {
+	if err := h.Store.DeleteVPC(r.Context(), chi.URLParam(r, "id")); err != nil {
+		writeError(w, r, "DeleteVPC", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type subnetReq struct {
+	VPCID string `json:"vpc_id"`
+	Name  string `json:"name"`
+	Zone  string `json:"zone"`
+	CIDR  string `json:"cidr"`
+}
+
+func (h *NetworkHandler) CreateSubnet(w http.ResponseWriter, r *http.Request) {
+	var req subnetReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "invalid JSON body")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.VPCID == "" || req.Name == "" || req.CIDR == "" {
+		badRequest(w, r, "missing fields (vpc_id, name, cidr required)")
+		return
+	}
+	sn, err := h.Store.CreateSubnet(r.Context(), repository.Subnet{
+		VPCID: req.VPCID,
+		Name:  req.Name,
+		Zone:  req.Zone,
+		CIDR:  strings.TrimSpace(req.CIDR),
+	})
+	if err != nil {
+		writeError(w, r, "CreateSubnet", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(sn)
+}
+
+// ListSubnets filters by vpc_id, region and zone
+func (h *NetworkHandler) ListSubnets(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	items, err := h.Store.ListSubnets(r.Context(), repository.SubnetFilter{
+		VPCID:  q.Get("vpc_id"),
+		Region: q.Get("region"),
+		Zone:   q.Get("zone"),
+	})
+	if err != nil {
+		internalError(w, r, "ListSubnets", err)
+		return
+	}
+	if items == nil {
+		items = []repository.Subnet{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"items": items})
+}
+
+func (h *NetworkHandler) GetSubnet(w http.ResponseWriter, r *http.Request) {
+	sn, err := h.Store.GetSubnet(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		internalError(w, r, "GetSubnet", err)
+		return
+	}
+	if sn == nil {
+		notFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sn)
+}
+
+// DeleteSubnet deletes a subnet whose addresses were never handed out
+func (h *NetworkHandler) DeleteSubnet(w http.ResponseWriter, r *http.Request) {
+	if err := h.Store.DeleteSubnet(r.Context(), chi.URLParam(r, "id")); err != nil {
+		writeError(w, r, "DeleteSubnet", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+// OpenAPI serves the OpenAPI 3.1 description of this API
+func OpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
+
+// ValidateRoutes checks that the spec documents exactly the routes
+// registered on router, so a handler cannot be added or removed without
+// updating openapi.json
+func ValidateRoutes(router chi.Routes) error {
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		return fmt.Errorf("openapi.json: %w", err)
+	}
+	documented := map[string]bool{}
+	for path, item := range spec.Paths {
+		for method := range item {
+			switch method {
+			case "get", "put", "post", "delete", "patch", "head", "options":
+				documented[strings.ToUpper(method)+" "+path] = true
+			}
+		}
+	}
+
+	routed := map[string]bool{}
+	err := chi.Walk(router, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		routed[method+" "+route] = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	for op := range routed {
+		if !documented[op] {
+			problems = append(problems, "undocumented route "+op)
+		}
+	}
+	for op := range documented {
+		if !routed[op] {
+			problems = append(problems, "documented route not registered "+op)
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("openapi.json does not match the router: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
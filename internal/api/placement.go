@@ -0,0 +1,142 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"virtualservers/internal/repository"
+)
+
+// PlacementHandler serves availability zones, their simulated faults and
+// placement groups
+type PlacementHandler struct {
+	Store *repository.Store
+}
+
+func (h *PlacementHandler) ListZones(w http.ResponseWriter, r *http.Request) {
+	items, err := h.Store.ListZones(r.Context(), r.URL.Query().Get("region"))
+	if err != nil {
+		internalError(w, r, "ListZones", err)
+		return
+	}
+	if items == nil {
+		items = []repository.Zone{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"items": items})
+}
+
+func (h *PlacementHandler) GetZone(w http.ResponseWriter, r *http.Request) {
+	z, err := h.Store.GetZone(r.Context(), chi.URLParam(r, "name"))
+	if err != nil {
+		internalError(w, r, "GetZone", err)
+		return
+	}
+	if z == nil {
+		notFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(z)
+}
+
+// ImpairZone simulates an outage of a zone, with an optional
+// {"reason": ...}: nothing is placed in or started in it until RecoverZone
+func (h *PlacementHandler) ImpairZone(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		badRequest(w, r, "invalid JSON body")
+		return
+	}
+	h.setImpaired(w, r, true, strings.TrimSpace(req.Reason))
+}
+
+func (h *PlacementHandler) RecoverZone(w http.ResponseWriter, r *http.Request) {
+	h.setImpaired(w, r, false, "")
+}
+
+func (h *PlacementHandler) setImpaired(w http.ResponseWriter, r *http.Request, impaired bool, reason string) {
+	z, err := h.Store.SetZoneImpaired(eventContext(r), chi.URLParam(r, "name"), impaired, reason)
+	if err != nil {
+		writeError(w, r, "SetZoneImpaired", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(z)
+}
+
+type placementGroupReq struct {
+	Name     string `json:"name"`
+	Region   string `json:"region"`
+	Strategy string `json:"strategy"`
+	LabelKey string `json:"label_key"`
+}
+
+func (h *PlacementHandler) CreatePlacementGroup(w http.ResponseWriter, r *http.Request) {
+	var req placementGroupReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "invalid JSON body")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || req.Region == "" || req.Strategy == "" {
+		badRequest(w, r, "missing fields (name, region, strategy required)")
+		return
+	}
+	g, err := h.Store.CreatePlacementGroup(r.Context(), repository.PlacementGroup{
+		Name:     req.Name,
+		Region:   req.Region,
+		Strategy: strings.ToLower(strings.TrimSpace(req.Strategy)),
+		LabelKey: strings.TrimSpace(req.LabelKey),
+	})
+	if err != nil {
+		writeError(w, r, "CreatePlacementGroup", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(g)
+}
+
+func (h *PlacementHandler) ListPlacementGroups(w http.ResponseWriter, r *http.Request) {
+	items, err := h.Store.ListPlacementGroups(r.Context(), r.URL.Query().Get("region"))
+	if err != nil {
+		internalError(w, r, "ListPlacementGroups", err)
+		return
+	}
+	if items == nil {
+		items = []repository.PlacementGroup{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"items": items})
+}
+
+func (h *PlacementHandler) GetPlacementGroup(w http.ResponseWriter, r *http.Request) {
+	g, err := h.Store.GetPlacementGroup(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		internalError(w, r, "GetPlacementGroup", err)
+		return
+	}
+	if g == nil {
+		notFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(g)
+}
+
+// DeletePlacementGroup deletes a group without live members
+func (h *PlacementHandler) DeletePlacementGroup(w http.ResponseWriter, r *http.Request) {
+	if err := h.Store.DeletePlacementGroup(r.Context(), chi.URLParam(r, "id")); err != nil {
+		writeError(w, r, "DeletePlacementGroup", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
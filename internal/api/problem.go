@@ -0,0 +1,197 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"virtualservers/internal/domain"
+	"virtualservers/internal/logging"
+)
+
+// Error codes not owned by the domain package
+const (
+	codeBadRequest       = "bad_request"
+	codeNotFound         = "not_found"
+	codeMethodNotAllowed = "method_not_allowed"
+	codeInternal         = "internal_error"
+	codeKeyReused        = "idempotency_key_reused"
+	codeKeyInProgress    = "idempotency_key_in_progress"
+	codeBodyTooLarge     = "request_too_large"
+	codeChaosInjected    = "chaos_injected"
+)
+
+// Problem is an RFC 7807 problem details body. Code is the stable,
+// machine-readable identifier clients should switch on; Extensions are
+// merged into the top-level object.
+type Problem struct {
+	Type       string         `json:"type"`
+	Title      string         `json:"title"`
+	Status     int            `json:"status"`
+	Detail     string         `json:"detail,omitempty"`
+	Instance   string         `json:"instance,omitempty"`
+	Code       string         `json:"code"`
+	RequestID  string         `json:"request_id,omitempty"`
+	Extensions map[string]any `json:"-"`
+}
+
+func (p Problem) MarshalJSON() ([]byte, error) {
+	type base Problem
+	b, err := json.Marshal(base(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return b, err
+	}
+	m := map[string]any{}
+	for k, v := range p.Extensions {
+		m[k] = v
+	}
+	// Standard members win over extensions with the same name
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return json.Marshal(m)
+}
+
+func writeProblem(w http.ResponseWriter, r *http.Request, p Problem) {
+	p.fill()
+	p.Instance = r.URL.Path
+	p.RequestID = middleware.GetReqID(r.Context())
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// fill derives Type and Title from Code and Status
+func (p *Problem) fill() {
+	p.Type = "urn:virtualservers:problem:" + p.Code
+	p.Title = http.StatusText(p.Status)
+}
+
+func problem(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	writeProblem(w, r, Problem{Status: status, Code: code, Detail: detail})
+}
+
+func badRequest(w http.ResponseWriter, r *http.Request, detail string) {
+	problem(w, r, http.StatusBadRequest, codeBadRequest, detail)
+}
+
+func notFound(w http.ResponseWriter, r *http.Request) {
+	problem(w, r, http.StatusNotFound, codeNotFound, "")
+}
+
+// internalError logs err with the request context and hides it from the client
+func internalError(w http.ResponseWriter, r *http.Request, op string, err error) {
+	logging.FromRequest(r).Error(op+" failed", "err", err)
+	problem(w, r, http.StatusInternalServerError, codeInternal, "")
+}
+
+// ProblemFor maps typed domain and repository errors to a problem. ok is
+// false for any other error, which callers must treat as internal. The gRPC
+// API shares this mapping.
+func ProblemFor(err error) (p Problem, ok bool) {
+	var (
+		ve  *domain.ValidationError
+		ite *domain.InvalidTransitionError
+		tbe *domain.TransitionInProgressError
+		vse *domain.VolumeStateError
+		rse *domain.ResourceStateError
+		ipe *domain.IPPoolExhaustedError
+		qe  *domain.QuotaExceededError
+		zie *domain.ZoneImpairedError
+		ice *domain.InsufficientCapacityError
+		pfe *domain.ProvisionFailedError
+		rbe *domain.RebootStuckError
+		pe  *domain.ProtectedError
+	)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return Problem{Status: http.StatusNotFound, Code: codeNotFound}, true
+	case errors.As(err, &ve):
+		return Problem{Status: http.StatusBadRequest, Code: codeBadRequest, Detail: ve.Error()}, true
+	case errors.As(err, &ite):
+		ext := map[string]any{"current_status": ite.Current, "allowed_actions": ite.Allowed}
+		if ite.Action != "" {
+			ext["action"] = ite.Action
+		}
+		return Problem{Status: http.StatusConflict, Code: domain.CodeInvalidTransition,
+			Detail: ite.Error(), Extensions: ext}, true
+	case errors.As(err, &tbe):
+		ext := map[string]any{"current_status": tbe.Current, "action": tbe.Action}
+		if tbe.Queued != "" {
+			ext["queued_action"] = tbe.Queued
+		}
+		return Problem{Status: http.StatusConflict, Code: domain.CodeTransitionInProgress,
+			Detail: tbe.Error(), Extensions: ext}, true
+	case errors.As(err, &vse):
+		ext := map[string]any{"volume_status": vse.Status}
+		if vse.ServerStatus != "" {
+			ext["server_status"] = vse.ServerStatus
+		}
+		return Problem{Status: http.StatusConflict, Code: domain.CodeVolumeState,
+			Detail: vse.Error(), Extensions: ext}, true
+	case errors.As(err, &rse):
+		return Problem{Status: http.StatusConflict, Code: domain.CodeResourceState,
+			Detail: rse.Error(), Extensions: map[string]any{"resource": rse.Resource, "status": rse.Status}}, true
+	case errors.As(err, &ipe):
+		ext := map[string]any{"region": ipe.Region}
+		if ipe.SubnetID != "" {
+			ext["subnet_id"] = ipe.SubnetID
+		}
+		return Problem{Status: http.StatusConflict, Code: domain.CodeIPPoolExhausted,
+			Detail: ipe.Error(), Extensions: ext}, true
+	case errors.As(err, &zie):
+		ext := map[string]any{"region": zie.Region}
+		if zie.Zone != "" {
+			ext["zone"] = zie.Zone
+		}
+		return Problem{Status: http.StatusConflict, Code: domain.CodeZoneImpaired,
+			Detail: zie.Error(), Extensions: ext}, true
+	case errors.As(err, &ice):
+		return Problem{Status: http.StatusConflict, Code: domain.CodeInsufficientCapacity,
+			Detail: ice.Error(), Extensions: map[string]any{
+				"zone": ice.Zone, "type": ice.Type, "vcpus": ice.VCPUs, "memory_mib": ice.Memory,
+			}}, true
+	case errors.As(err, &pfe):
+		return Problem{Status: http.StatusServiceUnavailable, Code: domain.CodeProvisionFailed,
+			Detail: pfe.Error(), Extensions: map[string]any{"region": pfe.Region}}, true
+	case errors.As(err, &rbe):
+		return Problem{Status: http.StatusConflict, Code: domain.CodeRebootStuck,
+			Detail: rbe.Error(), Extensions: map[string]any{"stuck_until": rbe.Until}}, true
+	case errors.As(err, &qe):
+		return Problem{Status: http.StatusForbidden, Code: domain.CodeQuotaExceeded,
+			Detail: qe.Error(), Extensions: map[string]any{
+				"resource": qe.Resource, "limit": qe.Limit, "used": qe.Used, "requested": qe.Requested,
+			}}, true
+	case errors.As(err, &pe):
+		return Problem{Status: http.StatusConflict, Code: domain.CodeProtected,
+			Detail: pe.Error(), Extensions: map[string]any{
+				"termination_protection": pe.Protection, "locks": pe.Locks,
+			}}, true
+	case errors.Is(err, domain.ErrLockExists):
+		return Problem{Status: http.StatusConflict, Code: domain.CodeLockExists, Detail: err.Error()}, true
+	}
+	return Problem{}, false
+}
+
+// writeError writes the problem for err, treating unmapped errors as
+// internal errors
+func writeError(w http.ResponseWriter, r *http.Request, op string, err error) {
+	p, ok := ProblemFor(err)
+	if !ok {
+		internalError(w, r, op, err)
+		return
+	}
+	writeProblem(w, r, p)
+}
+
+// NotFound and MethodNotAllowed replace chi's plain-text defaults
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	notFound(w, r)
+}
+
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	problem(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, "")
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"virtualservers/internal/domain"
+)
+
+func TestProblemFor(t *testing.T) {
+	stuck := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	locks := []domain.ServerLock{{ServerID: "s-1", Name: "backup", Reason: "nightly"}}
+	for _, tc := range []struct {
+		name   string
+		err    error
+		status int
+		code   string
+		ext    map[string]any
+	}{
+		{"not found", sql.ErrNoRows, http.StatusNotFound, codeNotFound, nil},
+		{"validation", &domain.ValidationError{Message: "name is required"}, http.StatusBadRequest, codeBadRequest, nil},
+		{"invalid transition",
+			&domain.InvalidTransitionError{Current: "STOPPED", Action: "reboot", Allowed: []string{"start", "terminate"}},
+			http.StatusConflict, domain.CodeInvalidTransition,
+			map[string]any{"current_status": "STOPPED", "allowed_actions": []string{"start", "terminate"}, "action": "reboot"}},
+		{"invalid transition to a status",
+			&domain.InvalidTransitionError{Current: "TERMINATED", Target: "RUNNING", Allowed: []string{}},
+			http.StatusConflict, domain.CodeInvalidTransition,
+			map[string]any{"current_status": "TERMINATED", "allowed_actions": []string{}}},
+		{"transition in progress",
+			&domain.TransitionInProgressError{Current: "STARTING", Action: "stop", Queued: "reboot"},
+			http.StatusConflict, domain.CodeTransitionInProgress,
+			map[string]any{"current_status": "STARTING", "action": "stop", "queued_action": "reboot"}},
+		{"volume state",
+			&domain.VolumeStateError{VolumeID: "v-1", Op: "attach", Status: "available", ServerStatus: "TERMINATED"},
+			http.StatusConflict, domain.CodeVolumeState,
+			map[string]any{"volume_status": "available", "server_status": "TERMINATED"}},
+		{"resource state",
+			&domain.ResourceStateError{Resource: "snapshot", ID: "snap-1", Op: "delete", Status: "pending"},
+			http.StatusConflict, domain.CodeResourceState,
+			map[string]any{"resource": "snapshot", "status": "pending"}},
+		{"ip pool exhausted", &domain.IPPoolExhaustedError{Region: "us-east-1"},
+			http.StatusConflict, domain.CodeIPPoolExhausted, map[string]any{"region": "us-east-1"}},
+		{"subnet exhausted", &domain.IPPoolExhaustedError{Region: "us-east-1", SubnetID: "sn-1"},
+			http.StatusConflict, domain.CodeIPPoolExhausted, map[string]any{"region": "us-east-1", "subnet_id": "sn-1"}},
+		{"quota exceeded",
+			&domain.QuotaExceededError{Resource: "volume_attachments", Limit: 2, Used: 2, Requested: 1},
+			http.StatusForbidden, domain.CodeQuotaExceeded,
+			map[string]any{"resource": "volume_attachments", "limit": 2, "used": 2, "requested": 1}},
+		{"region impaired", &domain.ZoneImpairedError{Region: "us-east-1"},
+			http.StatusConflict, domain.CodeZoneImpaired, map[string]any{"region": "us-east-1"}},
+		{"zone impaired", &domain.ZoneImpairedError{Region: "us-east-1", Zone: "us-east-1a", Reason: "power"},
+			http.StatusConflict, domain.CodeZoneImpaired, map[string]any{"region": "us-east-1", "zone": "us-east-1a"}},
+		{"insufficient capacity",
+			&domain.InsufficientCapacityError{Zone: "us-east-1a", Type: "t2.medium", VCPUs: 2, Memory: 4096},
+			http.StatusConflict, domain.CodeInsufficientCapacity,
+			map[string]any{"zone": "us-east-1a", "type": "t2.medium", "vcpus": 2, "memory_mib": 4096}},
+		{"provision failed", &domain.ProvisionFailedError{Region: "eu-west-1"},
+			http.StatusServiceUnavailable, domain.CodeProvisionFailed, map[string]any{"region": "eu-west-1"}},
+		{"reboot stuck", &domain.RebootStuckError{Until: stuck},
+			http.StatusConflict, domain.CodeRebootStuck, map[string]any{"stuck_until": stuck}},
+		{"protected", &domain.ProtectedError{ServerID: "s-1", Protection: true, Locks: locks},
+			http.StatusConflict, domain.CodeProtected,
+			map[string]any{"termination_protection": true, "locks": locks}},
+		{"lock exists", domain.ErrLockExists, http.StatusConflict, domain.CodeLockExists, nil},
+		{"wrapped", fmt.Errorf("start s-1: %w", &domain.ZoneImpairedError{Region: "us-east-1", Zone: "us-east-1b"}),
+			http.StatusConflict, domain.CodeZoneImpaired, map[string]any{"region": "us-east-1", "zone": "us-east-1b"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p, ok := ProblemFor(tc.err)
+			if !ok {
+				t.Fatalf("ProblemFor(%v) not mapped", tc.err)
+			}
+			if p.Status != tc.status || p.Code != tc.code {
+				t.Fatalf("ProblemFor(%v) = %d %s, want %d %s", tc.err, p.Status, p.Code, tc.status, tc.code)
+			}
+			if len(p.Extensions) != 0 || len(tc.ext) != 0 {
+				if !reflect.DeepEqual(p.Extensions, tc.ext) {
+					t.Errorf("extensions = %#v, want %#v", p.Extensions, tc.ext)
+				}
+			}
+			if tc.code != codeNotFound && p.Detail == "" {
+				t.Error("no detail")
+			}
+		})
+	}
+}
+
+func TestProblemForUnmapped(t *testing.T) {
+	for _, err := range []error{errors.New("connection refused"), sql.ErrConnDone} {
+		if p, ok := ProblemFor(err); ok {
+			t.Errorf("ProblemFor(%v) = %+v, want unmapped", err, p)
+		}
+	}
+}
+
+func TestProblemJSON(t *testing.T) {
+	p, _ := ProblemFor(&domain.InvalidTransitionError{Current: "STOPPED", Action: "reboot", Allowed: []string{"start"}})
+	p.fill()
+	// An extension cannot shadow a standard member
+	p.Extensions["status"] = "RUNNING"
+	b, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	for k, want := range map[string]any{
+		"type":            "urn:virtualservers:problem:invalid_transition",
+		"title":           "Conflict",
+		"status":          float64(http.StatusConflict),
+		"code":            "invalid_transition",
+		"current_status":  "STOPPED",
+		"action":          "reboot",
+		"allowed_actions": []any{"start"},
+	} {
+		if !reflect.DeepEqual(got[k], want) {
+			t.Errorf("%s = %#v, want %#v", k, got[k], want)
+		}
+	}
+}
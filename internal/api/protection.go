@@ -0,0 +1,97 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type protectionReq struct {
+	Enabled *bool `json:"enabled"`
+}
+
+type lockReq struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// SetProtection turns termination protection on or off: {"enabled": true}
+func (h *Handler) SetProtection(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var req protectionReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Enabled == nil {
+		badRequest(w, r, "bad request (enabled required)")
+		return
+	}
+	if err := h.Store.SetTerminationProtection(eventContext(r), id, *req.Enabled); err != nil {
+		if err == sql.ErrNoRows {
+			notFound(w, r)
+			return
+		}
+		internalError(w, r, "SetProtection", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"id":                     id,
+		"termination_protection": *req.Enabled,
+	})
+}
+
+func (h *Handler) ListLocks(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	srv, err := h.Store.GetServerByID(r.Context(), id)
+	if err != nil {
+		internalError(w, r, "ListLocks", err)
+		return
+	}
+	if srv == nil {
+		notFound(w, r)
+		return
+	}
+	locks, err := h.Store.ListLocks(r.Context(), id)
+	if err != nil {
+		internalError(w, r, "ListLocks", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"items": locks})
+}
+
+// AddLock places a named deletion lock: {"name": "prod-db", "reason": "..."}
+func (h *Handler) AddLock(w http.ResponseWriter, r *http.Request) {
+	var req lockReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "invalid JSON body")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		badRequest(w, r, "missing fields (name required)")
+		return
+	}
+	lock, err := h.Store.AddLock(eventContext(r), chi.URLParam(r, "id"), req.Name, req.Reason)
+	if err != nil {
+		writeError(w, r, "AddLock", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(lock)
+}
+
+func (h *Handler) RemoveLock(w http.ResponseWriter, r *http.Request) {
+	err := h.Store.RemoveLock(eventContext(r), chi.URLParam(r, "id"), chi.URLParam(r, "name"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			notFound(w, r)
+			return
+		}
+		internalError(w, r, "RemoveLock", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
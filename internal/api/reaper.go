@@ -0,0 +1,121 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"virtualservers/internal/repository"
+	"virtualservers/internal/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type ReaperHandler struct {
+	Store *repository.Store
+	// Default applies to servers no stored policy matches
+	Default repository.ReaperPolicy
+}
+
+type reaperPolicyReq struct {
+	Name              string            `json:"name"`
+	Project           *string           `json:"project"`
+	Selector          map[string]string `json:"selector"`
+	IdleSeconds       int               `json:"idle_seconds"`
+	HibernatedIdle    *int              `json:"hibernated_idle_seconds"`
+	WarnBeforeSeconds int               `json:"warn_before_seconds"`
+	ExcludeServerIDs  []string          `json:"exclude_server_ids"`
+	DryRun            bool              `json:"dry_run"`
+	Priority          int               `json:"priority"`
+	Enabled           *bool             `json:"enabled"`
+}
+
+func (h *ReaperHandler) CreatePolicy(w http.ResponseWriter, r *http.Request) {
+	var req reaperPolicyReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "invalid JSON body")
+		return
+	}
+	if req.Name == "" || req.IdleSeconds <= 0 {
+		badRequest(w, r, "missing fields (name, idle_seconds > 0 required)")
+		return
+	}
+	if req.HibernatedIdle != nil && *req.HibernatedIdle <= 0 {
+		badRequest(w, r, "hibernated_idle_seconds must be > 0")
+		return
+	}
+	if req.WarnBeforeSeconds < 0 {
+		badRequest(w, r, "warn_before_seconds must be >= 0")
+		return
+	}
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+	p, err := h.Store.CreateReaperPolicy(r.Context(), repository.ReaperPolicy{
+		Name:                  req.Name,
+		Project:               req.Project,
+		Selector:              req.Selector,
+		IdleSeconds:           req.IdleSeconds,
+		HibernatedIdleSeconds: req.HibernatedIdle,
+		WarnBeforeSeconds:     req.WarnBeforeSeconds,
+		ExcludeServerIDs:      req.ExcludeServerIDs,
+		DryRun:                req.DryRun,
+		Priority:              req.Priority,
+		Enabled:               enabled,
+	})
+	if err != nil {
+		internalError(w, r, "CreateReaperPolicy", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(p)
+}
+
+func (h *ReaperHandler) ListPolicies(w http.ResponseWriter, r *http.Request) {
+	items, err := h.Store.ListReaperPolicies(r.Context())
+	if err != nil {
+		internalError(w, r, "ListReaperPolicies", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"items": items, "default": h.Default})
+}
+
+func (h *ReaperHandler) GetPolicy(w http.ResponseWriter, r *http.Request) {
+	p, err := h.Store.GetReaperPolicy(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		internalError(w, r, "GetReaperPolicy", err)
+		return
+	}
+	if p == nil {
+		notFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+func (h *ReaperHandler) DeletePolicy(w http.ResponseWriter, r *http.Request) {
+	if err := h.Store.DeleteReaperPolicy(r.Context(), chi.URLParam(r, "id")); err != nil {
+		if err == sql.ErrNoRows {
+			notFound(w, r)
+			return
+		}
+		internalError(w, r, "DeleteReaperPolicy", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Preview reports what the reaper would do right now without changing anything
+func (h *ReaperHandler) Preview(w http.ResponseWriter, r *http.Request) {
+	report, err := service.RunReaper(r.Context(), h.Store, h.Default, true)
+	if err != nil {
+		internalError(w, r, "ReaperPreview", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
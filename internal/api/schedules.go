@@ -0,0 +1,169 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"virtualservers/internal/domain"
+	"virtualservers/internal/repository"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type ScheduleHandler struct {
+	Store *repository.Store
+}
+
+type scheduleReq struct {
+	Name     string            `json:"name"`
+	Cron     string            `json:"cron"`
+	Timezone string            `json:"timezone"`
+	Action   string            `json:"action"`
+	ServerID string            `json:"server_id"`
+	Selector map[string]string `json:"selector"`
+	CatchUp  string            `json:"catch_up"`
+}
+
+func (h *ScheduleHandler) CreateSchedule(w http.ResponseWriter, r *http.Request) {
+	var req scheduleReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "invalid JSON body")
+		return
+	}
+	req.Action = strings.ToLower(strings.TrimSpace(req.Action))
+	if req.Name == "" || req.Cron == "" {
+		badRequest(w, r, "missing fields (name, cron required)")
+		return
+	}
+	if req.Action != "start" && req.Action != "stop" {
+		badRequest(w, r, "action must be start or stop")
+		return
+	}
+	if (req.ServerID == "") == (len(req.Selector) == 0) {
+		badRequest(w, r, "exactly one of server_id or selector is required")
+		return
+	}
+	if req.Timezone == "" {
+		req.Timezone = "UTC"
+	}
+	if req.CatchUp == "" {
+		req.CatchUp = domain.CatchUpSkip
+	}
+	if req.CatchUp != domain.CatchUpSkip && req.CatchUp != domain.CatchUpOnce {
+		badRequest(w, r, "catch_up must be skip or once")
+		return
+	}
+	next, err := domain.NextScheduleRun(req.Cron, req.Timezone, time.Now())
+	if err != nil {
+		badRequest(w, r, err.Error())
+		return
+	}
+
+	sc := repository.Schedule{
+		Name:      req.Name,
+		CronExpr:  req.Cron,
+		Timezone:  req.Timezone,
+		Action:    req.Action,
+		CatchUp:   req.CatchUp,
+		NextRunAt: next,
+	}
+	if req.ServerID != "" {
+		srv, err := h.Store.GetServerByID(r.Context(), req.ServerID)
+		if err != nil {
+			internalError(w, r, "CreateSchedule", err)
+			return
+		}
+		if srv == nil {
+			badRequest(w, r, "server not found")
+			return
+		}
+		sc.ServerID = &req.ServerID
+	} else {
+		sc.Selector = req.Selector
+	}
+
+	created, err := h.Store.CreateSchedule(r.Context(), sc)
+	if err != nil {
+		internalError(w, r, "CreateSchedule", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func (h *ScheduleHandler) ListSchedules(w http.ResponseWriter, r *http.Request) {
+	items, err := h.Store.ListSchedules(r.Context())
+	if err != nil {
+		internalError(w, r, "ListSchedules", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"items": items})
+}
+
+func (h *ScheduleHandler) GetSchedule(w http.ResponseWriter, r *http.Request) {
+	sc, err := h.Store.GetSchedule(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		internalError(w, r, "GetSchedule", err)
+		return
+	}
+	if sc == nil {
+		notFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sc)
+}
+
+// UpdateSchedule pauses or resumes a schedule: {"enabled": false}
+func (h *ScheduleHandler) UpdateSchedule(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Enabled == nil {
+		badRequest(w, r, "bad request (enabled required)")
+		return
+	}
+	id := chi.URLParam(r, "id")
+	cur, err := h.Store.GetSchedule(r.Context(), id)
+	if err != nil {
+		internalError(w, r, "UpdateSchedule", err)
+		return
+	}
+	if cur == nil {
+		notFound(w, r)
+		return
+	}
+	next, err := domain.NextScheduleRun(cur.CronExpr, cur.Timezone, time.Now())
+	if err != nil {
+		badRequest(w, r, err.Error())
+		return
+	}
+	sc, err := h.Store.SetScheduleEnabled(r.Context(), id, *req.Enabled, next)
+	if err != nil {
+		internalError(w, r, "UpdateSchedule", err)
+		return
+	}
+	if sc == nil {
+		notFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sc)
+}
+
+func (h *ScheduleHandler) DeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	if err := h.Store.DeleteSchedule(r.Context(), chi.URLParam(r, "id")); err != nil {
+		if err == sql.ErrNoRows {
+			notFound(w, r)
+			return
+		}
+		internalError(w, r, "DeleteSchedule", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,216 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"virtualservers/internal/domain"
+	"virtualservers/internal/repository"
+)
+
+type SecurityGroupHandler struct {
+	Store *repository.Store
+}
+
+type ruleReq struct {
+	Direction     string `json:"direction"`
+	Protocol      string `json:"protocol"`
+	PortFrom      int    `json:"port_from"`
+	PortTo        int    `json:"port_to"`
+	CIDR          string `json:"cidr"`
+	SourceGroupID string `json:"source_group_id"`
+	Description   string `json:"description"`
+}
+
+func (req ruleReq) rule() repository.SecurityGroupRule {
+	return repository.SecurityGroupRule{
+		Rule: domain.Rule{
+			Direction:     req.Direction,
+			Protocol:      req.Protocol,
+			PortFrom:      req.PortFrom,
+			PortTo:        req.PortTo,
+			CIDR:          req.CIDR,
+			SourceGroupID: strings.TrimSpace(req.SourceGroupID),
+		},
+		Description: req.Description,
+	}
+}
+
+type securityGroupReq struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Region      string    `json:"region"`
+	Rules       []ruleReq `json:"rules"`
+}
+
+func (h *SecurityGroupHandler) CreateSecurityGroup(w http.ResponseWriter, r *http.Request) {
+	var req securityGroupReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "invalid JSON body")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || req.Region == "" {
+		badRequest(w, r, "missing fields (name, region required)")
+		return
+	}
+	g := repository.SecurityGroup{Name: req.Name, Description: req.Description, Region: req.Region}
+	for _, rr := range req.Rules {
+		g.Rules = append(g.Rules, rr.rule())
+	}
+	out, err := h.Store.CreateSecurityGroup(r.Context(), g)
+	if err != nil {
+		writeError(w, r, "CreateSecurityGroup", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(out)
+}
+
+func (h *SecurityGroupHandler) ListSecurityGroups(w http.ResponseWriter, r *http.Request) {
+	items, err := h.Store.ListSecurityGroups(r.Context(), r.URL.Query().Get("region"))
+	if err != nil {
+		internalError(w, r, "ListSecurityGroups", err)
+		return
+	}
+	if items == nil {
+		items = []repository.SecurityGroup{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"items": items})
+}
+
+func (h *SecurityGroupHandler) GetSecurityGroup(w http.ResponseWriter, r *http.Request) {
+	g, err := h.Store.GetSecurityGroup(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		internalError(w, r, "GetSecurityGroup", err)
+		return
+	}
+	if g == nil {
+		notFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(g)
+}
+
+// DeleteSecurityGroup deletes a group that no live server uses and no
+// other group's rules refer to
+func (h *SecurityGroupHandler) DeleteSecurityGroup(w http.ResponseWriter, r *http.Request) {
+	if err := h.Store.DeleteSecurityGroup(r.Context(), chi.URLParam(r, "id")); err != nil {
+		writeError(w, r, "DeleteSecurityGroup", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *SecurityGroupHandler) AddRule(w http.ResponseWriter, r *http.Request) {
+	var req ruleReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "invalid JSON body")
+		return
+	}
+	rule, err := h.Store.AddSecurityGroupRule(r.Context(), chi.URLParam(r, "id"), req.rule())
+	if err != nil {
+		writeError(w, r, "AddRule", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rule)
+}
+
+func (h *SecurityGroupHandler) DeleteRule(w http.ResponseWriter, r *http.Request) {
+	ruleID, err := strconv.ParseInt(chi.URLParam(r, "ruleID"), 10, 64)
+	if err != nil {
+		badRequest(w, r, "rule id must be an integer")
+		return
+	}
+	if err := h.Store.DeleteSecurityGroupRule(r.Context(), chi.URLParam(r, "id"), ruleID); err != nil {
+		writeError(w, r, "DeleteRule", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *SecurityGroupHandler) ListServerGroups(w http.ResponseWriter, r *http.Request) {
+	items, err := h.Store.ListServerSecurityGroups(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, "ListServerGroups", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"items": items})
+}
+
+// AttachGroup attaches {"security_group_id": ...} to a server and returns
+// all of its groups
+func (h *SecurityGroupHandler) AttachGroup(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		SecurityGroupID string `json:"security_group_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "invalid JSON body")
+		return
+	}
+	if req.SecurityGroupID == "" {
+		badRequest(w, r, "security_group_id required")
+		return
+	}
+	items, err := h.Store.AttachSecurityGroup(eventContext(r), chi.URLParam(r, "id"), req.SecurityGroupID)
+	if err != nil {
+		writeError(w, r, "AttachGroup", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"items": items})
+}
+
+func (h *SecurityGroupHandler) DetachGroup(w http.ResponseWriter, r *http.Request) {
+	if err := h.Store.DetachSecurityGroup(eventContext(r), chi.URLParam(r, "id"), chi.URLParam(r, "groupID")); err != nil {
+		writeError(w, r, "DetachGroup", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Reachability answers ?source=10.0.0.5&protocol=tcp&port=443 for a
+// server from the rules of the security groups involved
+func (h *SecurityGroupHandler) Reachability(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	source, err := netip.ParseAddr(q.Get("source"))
+	if err != nil {
+		badRequest(w, r, "source must be an IP address")
+		return
+	}
+	protocol := strings.ToLower(q.Get("protocol"))
+	port := 0
+	switch protocol {
+	case domain.ProtocolTCP, domain.ProtocolUDP:
+		if port, err = strconv.Atoi(q.Get("port")); err != nil || port < 1 || port > 65535 {
+			badRequest(w, r, "port must be between 1 and 65535")
+			return
+		}
+	case domain.ProtocolICMP:
+	default:
+		badRequest(w, r, "protocol must be tcp, udp or icmp")
+		return
+	}
+	res, err := h.Store.CheckReachability(r.Context(), chi.URLParam(r, "id"), source, protocol, port)
+	if err != nil {
+		internalError(w, r, "Reachability", err)
+		return
+	}
+	if res == nil {
+		notFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
@@ -1,46 +1,74 @@
 package api
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
-	"log"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
+	"virtualservers/internal/domain"
+	"virtualservers/internal/logging"
 	"virtualservers/internal/repository"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 )
 
 type Handler struct {
 	Store *repository.Store
 }
+
+// eventContext tags repository writes with the caller (X-Actor header) and
+// the request ID, which end up in the data of recorded events
+func eventContext(r *http.Request) context.Context {
+	ctx := repository.WithActor(r.Context(), logging.Principal(r))
+	return repository.WithOperationID(ctx, middleware.GetReqID(r.Context()))
+}
+
 type actionReq struct {
 	Action string `json:"action"`
 }
 
 type createReq struct {
-	Name   string `json:"name"`
-	Region string `json:"region"`
-	Type   string `json:"type"`
+	Name    string            `json:"name"`
+	Region  string            `json:"region"`
+	Type    string            `json:"type"`
+	ImageID string            `json:"image_id"`
+	Labels  map[string]string `json:"labels"`
+	// SecurityGroupIDs are attached when the server is created
+	SecurityGroupIDs []string `json:"security_group_ids"`
+	// SubnetID is where the IP comes from (default: the region's default subnet)
+	SubnetID string `json:"subnet_id"`
+	// Zone pins the server to a zone; otherwise placement_group_id's
+	// strategy, or placement (spread or pack, default spread), picks one
+	Zone             string `json:"zone"`
+	Placement        string `json:"placement"`
+	PlacementGroupID string `json:"placement_group_id"`
 }
 
 func (h *Handler) ListServers(w http.ResponseWriter, r *http.Request) {
 	q := r.URL.Query()
 	limit, _ := strconv.Atoi(q.Get("limit"))
 	offset, _ := strconv.Atoi(q.Get("offset"))
+	labels, err := repository.ParseLabelSelector(q.Get("label"))
+	if err != nil {
+		badRequest(w, r, err.Error())
+		return
+	}
 
 	f := repository.ListFilters{
 		Region: q.Get("region"),
+		Zone:   q.Get("zone"),
 		Status: strings.TrimSpace(q.Get("status")),
 		Type:   q.Get("type"),
+		Labels: labels,
 		Limit:  limit,
 		Offset: offset,
 	}
 	items, total, err := h.Store.ListServers(r.Context(), f)
 	if err != nil {
-		log.Printf("ListServers error: %v", err) // <-- add this
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		internalError(w, r, "ListServers", err)
 		return
 	}
 	resp := map[string]any{
@@ -58,13 +86,12 @@ func (h *Handler) GetServer(w http.ResponseWriter, r *http.Request) {
 
 	srv, err := h.Store.GetServerByID(r.Context(), id)
 	if err != nil {
-		log.Printf("GetServer error:%v", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		internalError(w, r, "GetServer", err)
 		return
 	}
 
 	if srv == nil {
-		http.Error(w, "not found", http.StatusNotFound)
+		notFound(w, r)
 		return
 	}
 
@@ -76,22 +103,12 @@ func (h *Handler) ServerAction(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	var req actionReq
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "bad request", http.StatusBadRequest)
+		badRequest(w, r, "invalid JSON body")
 		return
 	}
-	action := strings.ToLower(strings.TrimSpace(req.Action))
-	newStatus, err := h.Store.ApplyAction(r.Context(), id, action)
+	newStatus, err := h.Store.ApplyAction(eventContext(r), id, domain.NormalizeAction(req.Action))
 	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "not found", http.StatusNotFound)
-			return
-		}
-		if strings.Contains(err.Error(), "invalid transition") {
-			http.Error(w, "invalid transition", http.StatusConflict)
-			return
-		}
-		log.Printf("ServerAction error:%v", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		writeError(w, r, "ServerAction", err)
 		return
 	}
 	resp := map[string]string{
@@ -103,13 +120,59 @@ func (h *Handler) ServerAction(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
+type resizeReq struct {
+	Type string `json:"type"`
+	Live bool   `json:"live"`
+}
+
+// ResizeServer changes the instance type of a STOPPED server, or of a
+// RUNNING one through a reboot when live is set
+func (h *Handler) ResizeServer(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var req resizeReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "invalid JSON body")
+		return
+	}
+	req.Type = strings.TrimSpace(req.Type)
+	if req.Type == "" {
+		badRequest(w, r, "type required")
+		return
+	}
+	res, err := h.Store.Resize(eventContext(r), id, req.Type, req.Live)
+	if err != nil {
+		writeError(w, r, "ResizeServer", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
 func (h *Handler) GetServerLogs(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
+	q := r.URL.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	f := repository.LogFilter{
+		Events: splitList(q.Get("event")),
+		Limit:  limit,
+	}
+	var err error
+	if v := q.Get("since"); v != "" {
+		if f.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			badRequest(w, r, "since must be RFC3339")
+			return
+		}
+	}
+	if v := q.Get("until"); v != "" {
+		if f.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			badRequest(w, r, "until must be RFC3339")
+			return
+		}
+	}
 
-	events, err := h.Store.GetServerLogs(r.Context(), id)
+	events, err := h.Store.GetServerLogs(r.Context(), id, f)
 	if err != nil {
-		log.Printf("GetServerLogs error:%v", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		internalError(w, r, "GetServerLogs", err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -119,18 +182,28 @@ func (h *Handler) GetServerLogs(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) CreateServer(w http.ResponseWriter, r *http.Request) {
 	var req createReq
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "bad request", http.StatusBadRequest)
+		badRequest(w, r, "invalid JSON body")
 		return
 	}
 
-	if req.Name == "" || req.Region == "" || req.Type == "" {
-		http.Error(w, "missing fields (name ,type required)", http.StatusBadRequest)
+	if err := domain.ValidateCreate(req.Name, req.Region, req.Type); err != nil {
+		writeError(w, r, "CreateServer", err)
 		return
 	}
-	id, err := h.Store.CreateServer(r.Context(), req.Name, req.Region, req.Type)
+	id, err := h.Store.CreateServer(eventContext(r), repository.NewServer{
+		Name:             req.Name,
+		Region:           req.Region,
+		Type:             req.Type,
+		ImageID:          strings.TrimSpace(req.ImageID),
+		SubnetID:         strings.TrimSpace(req.SubnetID),
+		SecurityGroupIDs: req.SecurityGroupIDs,
+		Labels:           req.Labels,
+		Zone:             strings.TrimSpace(req.Zone),
+		Placement:        strings.ToLower(strings.TrimSpace(req.Placement)),
+		PlacementGroupID: strings.TrimSpace(req.PlacementGroupID),
+	})
 	if err != nil {
-		log.Printf("CreateServer error :%v", err)
-		http.Error(w, "could not create server", http.StatusInternalServerError)
+		writeError(w, r, "CreateServer", err)
 		return
 	}
 	resp := map[string]string{
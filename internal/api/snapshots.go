@@ -0,0 +1,200 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"virtualservers/internal/repository"
+)
+
+// SnapshotHandler serves snapshots, the images registered from them and
+// the operations that track snapshot progress
+type SnapshotHandler struct {
+	Store *repository.Store
+	// PerGB is the simulated time to snapshot each GB
+	PerGB time.Duration
+}
+
+type snapshotReq struct {
+	Name       string            `json:"name"`
+	SourceType string            `json:"source_type"`
+	SourceID   string            `json:"source_id"`
+	Labels     map[string]string `json:"labels"`
+}
+
+// CreateSnapshot starts a snapshot and returns 202 with the operation
+// tracking it
+func (h *SnapshotHandler) CreateSnapshot(w http.ResponseWriter, r *http.Request) {
+	var req snapshotReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "invalid JSON body")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || req.SourceID == "" {
+		badRequest(w, r, "name and source_id required")
+		return
+	}
+	op, err := h.Store.CreateSnapshot(eventContext(r), req.Name, strings.TrimSpace(req.SourceType), req.SourceID, req.Labels, h.PerGB)
+	if err != nil {
+		writeError(w, r, "CreateSnapshot", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/operations/"+op.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(op)
+}
+
+// ListSnapshots filters by region, status and source_id; deleted
+// snapshots are only listed with status=deleted
+func (h *SnapshotHandler) ListSnapshots(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	items, err := h.Store.ListSnapshots(r.Context(), repository.SnapshotFilter{
+		Region:   q.Get("region"),
+		Status:   strings.TrimSpace(q.Get("status")),
+		SourceID: q.Get("source_id"),
+	})
+	if err != nil {
+		internalError(w, r, "ListSnapshots", err)
+		return
+	}
+	if items == nil {
+		items = []repository.Snapshot{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"items": items})
+}
+
+func (h *SnapshotHandler) GetSnapshot(w http.ResponseWriter, r *http.Request) {
+	sn, err := h.Store.GetSnapshot(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		internalError(w, r, "GetSnapshot", err)
+		return
+	}
+	if sn == nil {
+		notFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sn)
+}
+
+// DeleteSnapshot deletes an available or failed snapshot and returns it
+// with its final cost; images registered from it must be deregistered first
+func (h *SnapshotHandler) DeleteSnapshot(w http.ResponseWriter, r *http.Request) {
+	sn, err := h.Store.DeleteSnapshot(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, "DeleteSnapshot", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sn)
+}
+
+type imageReq struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	SnapshotID  string `json:"snapshot_id"`
+}
+
+func (h *SnapshotHandler) RegisterImage(w http.ResponseWriter, r *http.Request) {
+	var req imageReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "invalid JSON body")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || req.SnapshotID == "" {
+		badRequest(w, r, "name and snapshot_id required")
+		return
+	}
+	im, err := h.Store.RegisterImage(r.Context(), req.Name, req.Description, req.SnapshotID)
+	if err != nil {
+		writeError(w, r, "RegisterImage", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(im)
+}
+
+// ListImages filters by region and status; deregistered images are only
+// listed with status=deregistered
+func (h *SnapshotHandler) ListImages(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	items, err := h.Store.ListImages(r.Context(), q.Get("region"), strings.TrimSpace(q.Get("status")))
+	if err != nil {
+		internalError(w, r, "ListImages", err)
+		return
+	}
+	if items == nil {
+		items = []repository.Image{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"items": items})
+}
+
+func (h *SnapshotHandler) GetImage(w http.ResponseWriter, r *http.Request) {
+	im, err := h.Store.GetImage(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		internalError(w, r, "GetImage", err)
+		return
+	}
+	if im == nil {
+		notFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(im)
+}
+
+// DeregisterImage stops new servers being created from an image
+func (h *SnapshotHandler) DeregisterImage(w http.ResponseWriter, r *http.Request) {
+	im, err := h.Store.DeregisterImage(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, "DeregisterImage", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(im)
+}
+
+// ListOperations filters by status and resource_id
+func (h *SnapshotHandler) ListOperations(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	items, err := h.Store.ListOperations(r.Context(), repository.OperationFilter{
+		Status:     strings.TrimSpace(q.Get("status")),
+		ResourceID: q.Get("resource_id"),
+		Limit:      limit,
+	})
+	if err != nil {
+		internalError(w, r, "ListOperations", err)
+		return
+	}
+	if items == nil {
+		items = []repository.Operation{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"items": items})
+}
+
+func (h *SnapshotHandler) GetOperation(w http.ResponseWriter, r *http.Request) {
+	op, err := h.Store.GetOperation(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		internalError(w, r, "GetOperation", err)
+		return
+	}
+	if op == nil {
+		notFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(op)
+}
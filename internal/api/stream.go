@@ -0,0 +1,160 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"virtualservers/internal/logging"
+	"virtualservers/internal/repository"
+	"virtualservers/internal/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	heartbeatInterval = 15 * time.Second
+	// replayBatch is how many missed events a stream loads per query
+	replayBatch = 500
+)
+
+type StreamHandler struct {
+	Store *repository.Store
+	Hub   *service.EventHub
+}
+
+// StreamEvents streams lifecycle events for all servers.
+// Filters: server_id, event (comma separated), label (key=value,...)
+func (h *StreamHandler) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	h.stream(w, r, r.URL.Query().Get("server_id"))
+}
+
+// StreamServerEvents streams lifecycle events for a single server
+func (h *StreamHandler) StreamServerEvents(w http.ResponseWriter, r *http.Request) {
+	h.stream(w, r, chi.URLParam(r, "id"))
+}
+
+func (h *StreamHandler) stream(w http.ResponseWriter, r *http.Request, serverID string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		problem(w, r, http.StatusInternalServerError, codeInternal, "streaming unsupported")
+		return
+	}
+	q := r.URL.Query()
+	labels, err := repository.ParseLabelSelector(q.Get("label"))
+	if err != nil {
+		badRequest(w, r, err.Error())
+		return
+	}
+	f := repository.EventFilter{
+		ServerID: serverID,
+		Events:   splitList(q.Get("event")),
+		Labels:   labels,
+	}
+	cur, err := eventCursor(r)
+	if err != nil {
+		badRequest(w, r, "invalid Last-Event-ID")
+		return
+	}
+
+	// Subscribe before replaying so nothing committed in between is lost;
+	// the cursor skips what both deliver.
+	sub, cancel := h.Hub.Subscribe(f)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	ctx := r.Context()
+	if after := cur.After(); after > 0 {
+		also := cur.Missing()
+		for {
+			events, err := h.Store.ListEventsAfter(ctx, f, after, also, replayBatch)
+			if err != nil {
+				logging.FromRequest(r).Error("StreamEvents replay failed", "err", err)
+				return
+			}
+			for _, ev := range events {
+				if !cur.Accept(ev.ID) {
+					continue
+				}
+				if err := writeSSE(w, ev, cur); err != nil {
+					return
+				}
+			}
+			if len(events) < replayBatch {
+				break
+			}
+			after, also = events[len(events)-1].ID, nil
+		}
+	}
+	cur.Live()
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case ev, ok := <-sub:
+			if !ok {
+				// Too slow to keep up; the client reconnects with Last-Event-ID
+				return
+			}
+			// The ids the hub filtered out go through the cursor too, so a
+			// late commit below the last id sent is still recognised
+			for _, id := range ev.Skipped {
+				cur.Accept(id)
+			}
+			if !cur.Accept(ev.ID) {
+				continue
+			}
+			if err := writeSSE(w, ev.ServerEvent, cur); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// writeSSE writes ev with the stream's cursor as its id, which the client
+// sends back as Last-Event-ID when it reconnects
+func writeSSE(w http.ResponseWriter, ev repository.ServerEvent, cur *repository.EventCursor) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", cur, ev.Event, data)
+	return err
+}
+
+// eventCursor reads the resume point from the Last-Event-ID header, falling
+// back to a last_event_id query parameter for clients that cannot set headers
+func eventCursor(r *http.Request) (*repository.EventCursor, error) {
+	v := r.Header.Get("Last-Event-ID")
+	if v == "" {
+		v = r.URL.Query().Get("last_event_id")
+	}
+	return repository.ParseEventCursor(v)
+}
+
+func splitList(v string) []string {
+	var out []string
+	for _, p := range strings.Split(v, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"virtualservers/internal/domain"
+	"virtualservers/internal/repository"
+)
+
+type VolumeHandler struct {
+	Store *repository.Store
+}
+
+type volumeReq struct {
+	Name                string            `json:"name"`
+	Region              string            `json:"region"`
+	Type                string            `json:"type"`
+	SizeGB              int               `json:"size_gb"`
+	DeleteOnTermination bool              `json:"delete_on_termination"`
+	Labels              map[string]string `json:"labels"`
+}
+
+func (h *VolumeHandler) CreateVolume(w http.ResponseWriter, r *http.Request) {
+	var req volumeReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "invalid JSON body")
+		return
+	}
+	req.Type = strings.TrimSpace(req.Type)
+	if err := domain.ValidateVolume(req.Name, req.Region, req.Type, req.SizeGB); err != nil {
+		writeError(w, r, "CreateVolume", err)
+		return
+	}
+	v, err := h.Store.CreateVolume(r.Context(), repository.Volume{
+		Name:                req.Name,
+		Region:              req.Region,
+		Type:                req.Type,
+		SizeGB:              req.SizeGB,
+		DeleteOnTermination: req.DeleteOnTermination,
+		Labels:              req.Labels,
+	})
+	if err != nil {
+		writeError(w, r, "CreateVolume", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(v)
+}
+
+// ListVolumes filters by region, status and server_id; deleted volumes
+// are only listed with status=deleted
+func (h *VolumeHandler) ListVolumes(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	items, err := h.Store.ListVolumes(r.Context(), repository.VolumeFilter{
+		Region:   q.Get("region"),
+		Status:   strings.TrimSpace(q.Get("status")),
+		ServerID: q.Get("server_id"),
+	})
+	if err != nil {
+		internalError(w, r, "ListVolumes", err)
+		return
+	}
+	if items == nil {
+		items = []repository.Volume{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"items": items})
+}
+
+func (h *VolumeHandler) GetVolume(w http.ResponseWriter, r *http.Request) {
+	v, err := h.Store.GetVolume(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		internalError(w, r, "GetVolume", err)
+		return
+	}
+	if v == nil {
+		notFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// DeleteVolume deletes an available volume and returns it with its final
+// cost; attached volumes must be detached first
+func (h *VolumeHandler) DeleteVolume(w http.ResponseWriter, r *http.Request) {
+	v, err := h.Store.DeleteVolume(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, "DeleteVolume", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+type attachReq struct {
+	ServerID            string `json:"server_id"`
+	Device              string `json:"device"`
+	DeleteOnTermination *bool  `json:"delete_on_termination"`
+}
+
+func (h *VolumeHandler) AttachVolume(w http.ResponseWriter, r *http.Request) {
+	var req attachReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "invalid JSON body")
+		return
+	}
+	if req.ServerID == "" {
+		badRequest(w, r, "server_id required")
+		return
+	}
+	v, err := h.Store.AttachVolume(eventContext(r), chi.URLParam(r, "id"), req.ServerID,
+		strings.TrimSpace(req.Device), req.DeleteOnTermination)
+	if err != nil {
+		writeError(w, r, "AttachVolume", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func (h *VolumeHandler) DetachVolume(w http.ResponseWriter, r *http.Request) {
+	v, err := h.Store.DetachVolume(eventContext(r), chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, "DetachVolume", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"virtualservers/internal/repository"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type WebhookHandler struct {
+	Store *repository.Store
+}
+
+type webhookReq struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Secret string   `json:"secret"`
+}
+
+// CreateWebhook registers a subscription. The secret is only returned here;
+// one is generated when the caller does not supply it.
+func (h *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req webhookReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "invalid JSON body")
+		return
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		badRequest(w, r, "url must be an absolute http(s) URL")
+		return
+	}
+	if req.Secret == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			internalError(w, r, "CreateWebhook", err)
+			return
+		}
+		req.Secret = hex.EncodeToString(b)
+	}
+	hook, err := h.Store.CreateWebhook(r.Context(), req.URL, req.Events, req.Secret)
+	if err != nil {
+		internalError(w, r, "CreateWebhook", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(hook)
+}
+
+func (h *WebhookHandler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	hooks, err := h.Store.ListWebhooks(r.Context())
+	if err != nil {
+		internalError(w, r, "ListWebhooks", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"items": hooks})
+}
+
+func (h *WebhookHandler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	hook, err := h.Store.GetWebhook(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		internalError(w, r, "GetWebhook", err)
+		return
+	}
+	if hook == nil {
+		notFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hook)
+}
+
+func (h *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	err := h.Store.DeleteWebhook(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			notFound(w, r)
+			return
+		}
+		internalError(w, r, "DeleteWebhook", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListDeliveries is the delivery log of one subscription (?status=pending|succeeded|dead)
+func (h *WebhookHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	items, err := h.Store.ListDeliveries(r.Context(), chi.URLParam(r, "id"), r.URL.Query().Get("status"), limit)
+	if err != nil {
+		internalError(w, r, "ListDeliveries", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"items": items})
+}
+
+func (h *WebhookHandler) ListDeliveryAttempts(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "deliveryID"), 10, 64)
+	if err != nil {
+		badRequest(w, r, "delivery id must be an integer")
+		return
+	}
+	items, err := h.Store.ListDeliveryAttempts(r.Context(), id)
+	if err != nil {
+		internalError(w, r, "ListDeliveryAttempts", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"items": items})
+}
+
+func (h *WebhookHandler) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	items, err := h.Store.ListDeadLetters(r.Context(), limit)
+	if err != nil {
+		internalError(w, r, "ListDeadLetters", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"items": items})
+}
+
+// RetryDelivery requeues a dead delivery with a fresh retry budget
+func (h *WebhookHandler) RetryDelivery(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "deliveryID"), 10, 64)
+	if err != nil {
+		badRequest(w, r, "delivery id must be an integer")
+		return
+	}
+	if err := h.Store.RetryDelivery(r.Context(), id); err != nil {
+		if err == sql.ErrNoRows {
+			notFound(w, r)
+			return
+		}
+		internalError(w, r, "RetryDelivery", err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
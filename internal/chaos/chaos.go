@@ -0,0 +1,200 @@
+// Package chaos injects simulated faults: server crashes, failed
+// provisions, stuck reboots, repository latency and HTTP errors. Every
+// fault is drawn from its own random stream seeded from Config.Seed, so a
+// run with the same seed and the same calls fails the same way.
+package chaos
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"virtualservers/internal/domain"
+)
+
+// Faults
+const (
+	FaultCrash            = "crash"
+	FaultProvisionFailure = "provision_failure"
+	FaultStuckReboot      = "stuck_reboot"
+	FaultLatency          = "latency"
+	FaultHTTPError        = "http_error"
+)
+
+// Config is the fault injection setup. Probabilities are in [0, 1]: crash
+// per RUNNING server per chaos tick, provision failure per server created,
+// stuck reboot per reboot, latency per repository statement and HTTP error
+// per request. Regions and Selector scope the server faults (crash,
+// provision failure, stuck reboot); empty matches every server.
+type Config struct {
+	Enabled                     bool              `json:"enabled"`
+	Seed                        int64             `json:"seed"`
+	CrashProbability            float64           `json:"crash_probability"`
+	ProvisionFailureProbability float64           `json:"provision_failure_probability"`
+	StuckRebootProbability      float64           `json:"stuck_reboot_probability"`
+	StuckRebootSeconds          int               `json:"stuck_reboot_seconds"`
+	LatencyProbability          float64           `json:"latency_probability"`
+	LatencyMS                   int               `json:"latency_ms"`
+	HTTPErrorProbability        float64           `json:"http_error_probability"`
+	Regions                     []string          `json:"regions"`
+	Selector                    map[string]string `json:"selector"`
+	UpdatedAt                   time.Time         `json:"updated_at"`
+}
+
+// Validate checks probabilities and durations
+func (c Config) Validate() error {
+	for name, p := range map[string]float64{
+		"crash_probability":             c.CrashProbability,
+		"provision_failure_probability": c.ProvisionFailureProbability,
+		"stuck_reboot_probability":      c.StuckRebootProbability,
+		"latency_probability":           c.LatencyProbability,
+		"http_error_probability":        c.HTTPErrorProbability,
+	} {
+		if p < 0 || p > 1 {
+			return &domain.ValidationError{Message: fmt.Sprintf("%s must be between 0 and 1", name)}
+		}
+	}
+	if c.StuckRebootSeconds < 0 || c.LatencyMS < 0 {
+		return &domain.ValidationError{Message: "stuck_reboot_seconds and latency_ms must be >= 0"}
+	}
+	if c.StuckRebootProbability > 0 && c.StuckRebootSeconds == 0 {
+		return &domain.ValidationError{Message: "stuck_reboot_seconds is required with stuck_reboot_probability"}
+	}
+	if c.LatencyProbability > 0 && c.LatencyMS == 0 {
+		return &domain.ValidationError{Message: "latency_ms is required with latency_probability"}
+	}
+	return nil
+}
+
+// InScope reports whether a server in region with labels is subject to the
+// server faults
+func (c Config) InScope(region string, labels map[string]string) bool {
+	if len(c.Regions) > 0 {
+		found := false
+		for _, r := range c.Regions {
+			if r == region {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for k, v := range c.Selector {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Config) probability(fault string) float64 {
+	switch fault {
+	case FaultCrash:
+		return c.CrashProbability
+	case FaultProvisionFailure:
+		return c.ProvisionFailureProbability
+	case FaultStuckReboot:
+		return c.StuckRebootProbability
+	case FaultLatency:
+		return c.LatencyProbability
+	case FaultHTTPError:
+		return c.HTTPErrorProbability
+	}
+	return 0
+}
+
+// Engine draws faults for the current Config. A nil Engine never injects
+// anything.
+type Engine struct {
+	// OnFault, if set, is called for every fault injected
+	OnFault func(fault string)
+
+	mu      sync.Mutex
+	cfg     Config
+	streams map[string]*rand.Rand
+}
+
+func NewEngine() *Engine {
+	return &Engine{streams: map[string]*rand.Rand{}}
+}
+
+// Config returns the configuration in effect
+func (e *Engine) Config() Config {
+	if e == nil {
+		return Config{}
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.cfg
+}
+
+// Set applies cfg. The random streams restart from the seed only when the
+// configuration changed (a new UpdatedAt), so reloading an unchanged
+// configuration does not replay faults.
+func (e *Engine) Set(cfg Config) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if cfg.Seed != e.cfg.Seed || !cfg.UpdatedAt.Equal(e.cfg.UpdatedAt) {
+		e.streams = map[string]*rand.Rand{}
+	}
+	e.cfg = cfg
+}
+
+// Inject decides whether fault hits a server in region with labels
+func (e *Engine) Inject(fault, region string, labels map[string]string) bool {
+	if e == nil {
+		return false
+	}
+	return e.roll(fault, func(c Config) bool { return c.InScope(region, labels) })
+}
+
+// Latency returns the delay to add before a repository statement, if any
+func (e *Engine) Latency() time.Duration {
+	if e == nil || !e.roll(FaultLatency, nil) {
+		return 0
+	}
+	return time.Duration(e.Config().LatencyMS) * time.Millisecond
+}
+
+// HTTPError decides whether a request fails with an injected error
+func (e *Engine) HTTPError() bool {
+	return e != nil && e.roll(FaultHTTPError, nil)
+}
+
+// StuckFor is how long a stuck reboot stays stuck
+func (e *Engine) StuckFor() time.Duration {
+	return time.Duration(e.Config().StuckRebootSeconds) * time.Second
+}
+
+func (e *Engine) roll(fault string, inScope func(Config) bool) bool {
+	e.mu.Lock()
+	c := e.cfg
+	p := c.probability(fault)
+	if !c.Enabled || p <= 0 || (inScope != nil && !inScope(c)) {
+		e.mu.Unlock()
+		return false
+	}
+	hit := e.stream(fault).Float64() < p
+	e.mu.Unlock()
+	if hit && e.OnFault != nil {
+		e.OnFault(fault)
+	}
+	return hit
+}
+
+// stream returns fault's random stream, seeded from the seed and the fault
+// name so traffic of one kind does not shift the draws of another
+func (e *Engine) stream(fault string) *rand.Rand {
+	r, ok := e.streams[fault]
+	if !ok {
+		h := fnv.New64a()
+		h.Write([]byte(fault))
+		r = rand.New(rand.NewPCG(uint64(e.cfg.Seed), h.Sum64()))
+		e.streams[fault] = r
+	}
+	return r
+}
@@ -0,0 +1,233 @@
+package chaos
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+var t0 = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// draws rolls fault n times and returns the outcomes
+func draws(e *Engine, fault string, n int) []bool {
+	out := make([]bool, n)
+	for i := range out {
+		out[i] = e.Inject(fault, "us-east-1", nil)
+	}
+	return out
+}
+
+func engine(cfg Config) *Engine {
+	e := NewEngine()
+	e.Set(cfg)
+	return e
+}
+
+func half(seed int64) Config {
+	return Config{
+		Enabled:                     true,
+		Seed:                        seed,
+		CrashProbability:            0.5,
+		ProvisionFailureProbability: 0.5,
+		UpdatedAt:                   t0,
+	}
+}
+
+func TestSeedReproducible(t *testing.T) {
+	a := draws(engine(half(42)), FaultCrash, 200)
+	b := draws(engine(half(42)), FaultCrash, 200)
+	if !slices.Equal(a, b) {
+		t.Fatal("same seed gave different draws")
+	}
+	if c := draws(engine(half(43)), FaultCrash, 200); slices.Equal(a, c) {
+		t.Fatal("different seeds gave the same 200 draws")
+	}
+	hits := 0
+	for _, hit := range a {
+		if hit {
+			hits++
+		}
+	}
+	if hits < 60 || hits > 140 {
+		t.Fatalf("%d/200 hits at p=0.5", hits)
+	}
+}
+
+func TestStreamsIndependent(t *testing.T) {
+	want := draws(engine(half(7)), FaultCrash, 100)
+
+	// Interleaving another fault's draws does not shift the crash stream
+	e := engine(half(7))
+	var got []bool
+	for range 100 {
+		e.Inject(FaultProvisionFailure, "us-east-1", nil)
+		got = append(got, e.Inject(FaultCrash, "us-east-1", nil))
+	}
+	if !slices.Equal(got, want) {
+		t.Fatal("provision_failure draws shifted the crash stream")
+	}
+	if slices.Equal(draws(engine(half(7)), FaultProvisionFailure, 100), want) {
+		t.Fatal("crash and provision_failure share a stream")
+	}
+}
+
+func TestSetResetsStreams(t *testing.T) {
+	first := draws(engine(half(1)), FaultCrash, 50)
+	for _, tc := range []struct {
+		name  string
+		next  func(Config) Config
+		reset bool
+	}{
+		{"unchanged config continues", func(c Config) Config { return c }, false},
+		{"other settings, same UpdatedAt continues", func(c Config) Config { c.ProvisionFailureProbability = 0.9; return c }, false},
+		{"new UpdatedAt restarts", func(c Config) Config { c.UpdatedAt = c.UpdatedAt.Add(time.Second); return c }, true},
+		{"new seed restarts", func(c Config) Config { c.Seed = 2; return c }, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := half(1)
+			e := engine(cfg)
+			draws(e, FaultCrash, 25)
+			next := tc.next(cfg)
+			e.Set(next)
+			got := draws(e, FaultCrash, 25)
+
+			var want []bool
+			switch {
+			case !tc.reset:
+				want = first[25:]
+			case next.Seed == cfg.Seed:
+				want = first[:25]
+			default:
+				want = draws(engine(next), FaultCrash, 25)
+			}
+			if !slices.Equal(got, want) {
+				t.Fatalf("draws after Set do not match a stream that %s", map[bool]string{true: "restarted", false: "continued"}[tc.reset])
+			}
+		})
+	}
+}
+
+func TestScope(t *testing.T) {
+	cfg := half(9)
+	cfg.Regions = []string{"eu-west-1"}
+	cfg.Selector = map[string]string{"env": "staging"}
+	for _, tc := range []struct {
+		region string
+		labels map[string]string
+		want   bool
+	}{
+		{"eu-west-1", map[string]string{"env": "staging", "team": "a"}, true},
+		{"us-east-1", map[string]string{"env": "staging"}, false},
+		{"eu-west-1", map[string]string{"env": "prod"}, false},
+		{"eu-west-1", nil, false},
+	} {
+		if got := cfg.InScope(tc.region, tc.labels); got != tc.want {
+			t.Errorf("InScope(%s, %v) = %v, want %v", tc.region, tc.labels, got, tc.want)
+		}
+	}
+	if !(Config{}).InScope("any", nil) {
+		t.Error("an empty scope does not match every server")
+	}
+
+	// Servers out of scope never fail and draw nothing, so they do not
+	// shift the draws of the servers in scope
+	staging := map[string]string{"env": "staging"}
+	e := engine(cfg)
+	var got []bool
+	for range 100 {
+		if e.Inject(FaultCrash, "us-east-1", staging) {
+			t.Fatal("crash injected out of scope")
+		}
+		got = append(got, e.Inject(FaultCrash, "eu-west-1", staging))
+	}
+	want := make([]bool, 100)
+	ref := engine(cfg)
+	for i := range want {
+		want[i] = ref.Inject(FaultCrash, "eu-west-1", staging)
+	}
+	if !slices.Equal(got, want) {
+		t.Fatal("out-of-scope rolls shifted the stream")
+	}
+}
+
+func TestProbabilityBounds(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		cfg  Config
+		want bool
+	}{
+		{"always", Config{Enabled: true, CrashProbability: 1}, true},
+		{"never", Config{Enabled: true, CrashProbability: 0}, false},
+		{"disabled", Config{Enabled: false, CrashProbability: 1}, false},
+	} {
+		e := engine(tc.cfg)
+		for _, hit := range draws(e, FaultCrash, 50) {
+			if hit != tc.want {
+				t.Fatalf("%s: got a %v draw", tc.name, hit)
+			}
+		}
+	}
+}
+
+func TestFaults(t *testing.T) {
+	e := engine(Config{
+		Enabled:                true,
+		LatencyProbability:     1,
+		LatencyMS:              250,
+		HTTPErrorProbability:   1,
+		StuckRebootProbability: 1,
+		StuckRebootSeconds:     90,
+	})
+	var seen []string
+	e.OnFault = func(fault string) { seen = append(seen, fault) }
+	if d := e.Latency(); d != 250*time.Millisecond {
+		t.Errorf("Latency() = %v", d)
+	}
+	if !e.HTTPError() {
+		t.Error("HTTPError() = false at p=1")
+	}
+	if !e.Inject(FaultStuckReboot, "us-east-1", nil) {
+		t.Error("stuck reboot not injected at p=1")
+	}
+	if d := e.StuckFor(); d != 90*time.Second {
+		t.Errorf("StuckFor() = %v", d)
+	}
+	if e.Inject(FaultCrash, "us-east-1", nil) {
+		t.Error("crash injected at p=0")
+	}
+	if want := []string{FaultLatency, FaultHTTPError, FaultStuckReboot}; !slices.Equal(seen, want) {
+		t.Errorf("OnFault saw %v, want %v", seen, want)
+	}
+}
+
+func TestNilEngine(t *testing.T) {
+	var e *Engine
+	if e.Inject(FaultCrash, "us-east-1", nil) || e.HTTPError() || e.Latency() != 0 || e.StuckFor() != 0 {
+		t.Fatal("nil engine injected a fault")
+	}
+	if e.Config().Enabled {
+		t.Fatal("nil engine reports chaos enabled")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		cfg  Config
+		ok   bool
+	}{
+		{"zero", Config{}, true},
+		{"full", Config{Enabled: true, CrashProbability: 1, StuckRebootProbability: 0.1, StuckRebootSeconds: 30,
+			LatencyProbability: 0.2, LatencyMS: 100, HTTPErrorProbability: 0.05}, true},
+		{"negative probability", Config{CrashProbability: -0.1}, false},
+		{"probability above 1", Config{HTTPErrorProbability: 1.5}, false},
+		{"negative duration", Config{LatencyMS: -1}, false},
+		{"stuck reboot without duration", Config{StuckRebootProbability: 0.5}, false},
+		{"latency without duration", Config{LatencyProbability: 0.5}, false},
+		{"duration without probability", Config{LatencyMS: 100, StuckRebootSeconds: 10}, true},
+	} {
+		if err := tc.cfg.Validate(); (err == nil) != tc.ok {
+			t.Errorf("%s: Validate() = %v", tc.name, err)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+)
+
+// ProvisionFailedError is a server creation failed by fault injection;
+// nothing was created and the request may be retried
+type ProvisionFailedError struct {
+	Region string
+}
+
+func (e *ProvisionFailedError) Error() string {
+	return fmt.Sprintf("provisioning failed in region %s (injected fault)", e.Region)
+}
+
+// RebootStuckError is returned for completing a reboot that fault
+// injection left stuck until Until
+type RebootStuckError struct {
+	Until time.Time
+}
+
+func (e *RebootStuckError) Error() string {
+	return fmt.Sprintf("reboot is stuck until %s (injected fault)", e.Until.UTC().Format(time.RFC3339))
+}
@@ -0,0 +1,207 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Machine-readable error codes returned by the API
+const (
+	CodeInvalidTransition    = "invalid_transition"
+	CodeIPPoolExhausted      = "ip_pool_exhausted"
+	CodeQuotaExceeded        = "quota_exceeded"
+	CodeTransitionInProgress = "transition_in_progress"
+	CodeVolumeState          = "invalid_volume_state"
+	CodeResourceState        = "invalid_resource_state"
+	CodeZoneImpaired         = "zone_impaired"
+	CodeInsufficientCapacity = "insufficient_capacity"
+	CodeProvisionFailed      = "provision_failed"
+	CodeRebootStuck          = "reboot_stuck"
+	CodeProtected            = "termination_protected"
+	CodeLockExists           = "lock_exists"
+)
+
+// actionTransition is an action and the status it moves a server to
+type actionTransition struct {
+	action string
+	target string
+}
+
+// serverActions lists the actions accepted in each (database) server status
+var serverActions = map[string][]actionTransition{
+	"STOPPED":    {{"start", "RUNNING"}, {"terminate", "TERMINATED"}},
+	"RUNNING":    {{"stop", "STOPPED"}, {"reboot", "REBOOTING"}, {"hibernate", "HIBERNATED"}},
+	"REBOOTING":  {{"complete-reboot", "RUNNING"}},
+	"HIBERNATED": {{"resume", "RUNNING"}, {"terminate", "TERMINATED"}},
+}
+
+// AllowedActions returns the actions a server in status accepts
+func AllowedActions(status string) []string {
+	out := []string{}
+	for _, t := range serverActions[status] {
+		out = append(out, t.action)
+	}
+	return out
+}
+
+// KnownAction reports whether action is accepted in any status
+func KnownAction(action string) bool {
+	for _, ts := range serverActions {
+		for _, t := range ts {
+			if t.action == action {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ActionTarget returns the status action moves a server in status to, or
+// an InvalidTransitionError
+func ActionTarget(status, action string) (string, error) {
+	for _, t := range serverActions[status] {
+		if t.action == action {
+			return t.target, nil
+		}
+	}
+	return "", &InvalidTransitionError{Current: status, Action: action, Allowed: AllowedActions(status)}
+}
+
+// transitionalStatuses maps the actions that can be simulated as taking
+// time to the status a server is in meanwhile
+var transitionalStatuses = map[string]string{
+	"start":     "STARTING",
+	"stop":      "STOPPING",
+	"terminate": "TERMINATING",
+}
+
+// TransitionalStatus returns the in-between status of action, or "" when
+// the action always completes at once
+func TransitionalStatus(action string) string {
+	return transitionalStatuses[action]
+}
+
+// IsTransitional reports whether status is one of the in-between statuses
+func IsTransitional(status string) bool {
+	for _, s := range transitionalStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// TransitionInProgressError is returned for an action on a server that is
+// still moving between states and can neither take nor queue it
+type TransitionInProgressError struct {
+	Current string
+	Action  string
+	Queued  string
+}
+
+func (e *TransitionInProgressError) Error() string {
+	if e.Queued != "" {
+		return fmt.Sprintf("cannot %s a %s server: transition in progress, %s already queued", e.Action, e.Current, e.Queued)
+	}
+	return fmt.Sprintf("cannot %s a %s server: transition in progress", e.Action, e.Current)
+}
+
+// InvalidTransitionError is returned when an action (or target status) is
+// not allowed from the server's current status
+type InvalidTransitionError struct {
+	Current string
+	Action  string
+	Target  string
+	Allowed []string
+}
+
+func (e *InvalidTransitionError) Error() string {
+	if e.Action != "" {
+		return fmt.Sprintf("invalid transition: cannot %s a %s server (allowed: %s)",
+			e.Action, e.Current, strings.Join(e.Allowed, ", "))
+	}
+	return fmt.Sprintf("invalid transition from %s to %s", e.Current, e.Target)
+}
+
+// ResizeTarget returns the status a resize leaves a server in: STOPPED
+// servers stay STOPPED; RUNNING servers may only be resized live, which
+// goes through REBOOTING and finishes with complete-reboot
+func ResizeTarget(status string, live bool) (string, error) {
+	switch {
+	case status == "STOPPED":
+		return "STOPPED", nil
+	case status == "RUNNING" && live:
+		return "REBOOTING", nil
+	}
+	return "", &InvalidTransitionError{Current: status, Action: "resize", Allowed: AllowedActions(status)}
+}
+
+// IPPoolExhaustedError is returned when a region's default subnet, or the
+// subnet asked for, has no free address left
+type IPPoolExhaustedError struct {
+	Region   string
+	SubnetID string
+}
+
+func (e *IPPoolExhaustedError) Error() string {
+	if e.SubnetID != "" {
+		return fmt.Sprintf("no free IPs in subnet %s", e.SubnetID)
+	}
+	return fmt.Sprintf("no free IPs in region %s", e.Region)
+}
+
+// QuotaExceededError is returned when a request would take a resource
+// over its limit
+type QuotaExceededError struct {
+	Resource  string
+	Limit     int
+	Used      int
+	Requested int
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("%s quota exceeded: %d used + %d requested > limit %d",
+		e.Resource, e.Used, e.Requested, e.Limit)
+}
+
+// ProtectedError is returned when terminating a server that has termination
+// protection enabled or holds deletion locks
+type ProtectedError struct {
+	ServerID   string
+	Protection bool
+	Locks      []ServerLock
+}
+
+func (e *ProtectedError) Error() string {
+	return "termination refused: " + e.Reason()
+}
+
+// Reason describes what is blocking termination
+func (e *ProtectedError) Reason() string {
+	var parts []string
+	if e.Protection {
+		parts = append(parts, "termination protection is enabled")
+	}
+	for _, l := range e.Locks {
+		msg := fmt.Sprintf("lock %q held by %s", l.Name, l.CreatedBy)
+		if l.Reason != "" {
+			msg += ": " + l.Reason
+		}
+		parts = append(parts, msg)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// ErrLockExists is returned when adding a lock the server already holds
+// under that name
+var ErrLockExists = errors.New("lock already exists")
+
+// ValidationError is returned for a malformed request, whatever the state
+type ValidationError struct {
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
@@ -0,0 +1,69 @@
+package domain
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Host statuses. Hosts in maintenance take no new servers.
+const (
+	HostActive      = "active"
+	HostMaintenance = "maintenance"
+)
+
+// HoldsHost reports whether a server in status occupies capacity on a
+// host: from the moment it starts until it is stopped or hibernated
+func HoldsHost(status string) bool {
+	switch status {
+	case "STARTING", "RUNNING", "REBOOTING", "STOPPING":
+		return true
+	}
+	return false
+}
+
+// HostLoad is the free capacity of one schedulable host
+type HostLoad struct {
+	ID         string
+	Name       string
+	FreeVCPUs  int
+	FreeMemory int // MiB
+}
+
+// PickHost bin-packs a server needing vcpus and memory (MiB) onto hosts:
+// the host it fits on most tightly (least vCPU left over, then least
+// memory, then first by name). ok is false when it fits nowhere.
+func PickHost(hosts []HostLoad, vcpus, memory int) (id string, ok bool) {
+	fits := make([]HostLoad, 0, len(hosts))
+	for _, h := range hosts {
+		if h.FreeVCPUs >= vcpus && h.FreeMemory >= memory {
+			fits = append(fits, h)
+		}
+	}
+	if len(fits) == 0 {
+		return "", false
+	}
+	sort.Slice(fits, func(i, j int) bool {
+		a, b := fits[i], fits[j]
+		switch {
+		case a.FreeVCPUs != b.FreeVCPUs:
+			return a.FreeVCPUs < b.FreeVCPUs
+		case a.FreeMemory != b.FreeMemory:
+			return a.FreeMemory < b.FreeMemory
+		}
+		return a.Name < b.Name
+	})
+	return fits[0].ID, true
+}
+
+// InsufficientCapacityError is returned when no active host of a zone has
+// room for a server of the instance type
+type InsufficientCapacityError struct {
+	Zone   string
+	Type   string
+	VCPUs  int
+	Memory int // MiB
+}
+
+func (e *InsufficientCapacityError) Error() string {
+	return fmt.Sprintf("insufficient capacity in zone %s for %s (%d vCPU, %d MiB)", e.Zone, e.Type, e.VCPUs, e.Memory)
+}
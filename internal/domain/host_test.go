@@ -0,0 +1,59 @@
+package domain
+
+import "testing"
+
+func TestPickHost(t *testing.T) {
+	hosts := []HostLoad{
+		{ID: "h-big", Name: "big", FreeVCPUs: 32, FreeMemory: 131072},
+		{ID: "h-snug", Name: "snug", FreeVCPUs: 4, FreeMemory: 8192},
+		{ID: "h-b", Name: "b", FreeVCPUs: 8, FreeMemory: 16384},
+		{ID: "h-a", Name: "a", FreeVCPUs: 8, FreeMemory: 16384},
+		{ID: "h-lowmem", Name: "lowmem", FreeVCPUs: 8, FreeMemory: 4096},
+	}
+	for _, tc := range []struct {
+		name          string
+		hosts         []HostLoad
+		vcpus, memory int
+		want          string
+		ok            bool
+	}{
+		{"tightest vCPU fit", hosts, 2, 4096, "h-snug", true},
+		{"exact fit", hosts, 4, 8192, "h-snug", true},
+		{"too few vCPUs on the snug host", hosts, 6, 4096, "h-lowmem", true},
+		{"vCPU tie goes to least memory left", hosts, 8, 4096, "h-lowmem", true},
+		{"not enough memory on lowmem; tie goes to the first name", hosts, 8, 8192, "h-a", true},
+		{"only the big host fits", hosts, 16, 32768, "h-big", true},
+		{"fits nowhere by vCPU", hosts, 64, 1024, "", false},
+		{"fits nowhere by memory", hosts, 1, 262144, "", false},
+		{"no hosts", nil, 1, 1024, "", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := PickHost(tc.hosts, tc.vcpus, tc.memory)
+			if got != tc.want || ok != tc.ok {
+				t.Fatalf("PickHost(%d, %d) = %q, %v; want %q, %v", tc.vcpus, tc.memory, got, ok, tc.want, tc.ok)
+			}
+		})
+	}
+}
+
+func TestPickHostKeepsInputOrder(t *testing.T) {
+	hosts := []HostLoad{
+		{ID: "h-2", Name: "2", FreeVCPUs: 16, FreeMemory: 32768},
+		{ID: "h-1", Name: "1", FreeVCPUs: 4, FreeMemory: 8192},
+	}
+	PickHost(hosts, 1, 1024)
+	if hosts[0].ID != "h-2" {
+		t.Fatal("PickHost reordered the caller's slice")
+	}
+}
+
+func TestHoldsHost(t *testing.T) {
+	for status, want := range map[string]bool{
+		"STARTING": true, "RUNNING": true, "REBOOTING": true, "STOPPING": true,
+		"PENDING": false, "STOPPED": false, "HIBERNATED": false, "TERMINATING": false, "TERMINATED": false,
+	} {
+		if got := HoldsHost(status); got != want {
+			t.Errorf("HoldsHost(%s) = %v, want %v", status, got, want)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package domain
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// VPC and subnet CIDRs are IPv4 networks between these prefix lengths
+const (
+	MinPrefixLen = 16
+	MaxPrefixLen = 28
+)
+
+// ParseNetworkCIDR validates a VPC or subnet CIDR and returns it with the
+// host bits cleared
+func ParseNetworkCIDR(cidr string) (netip.Prefix, error) {
+	p, err := netip.ParsePrefix(cidr)
+	if err != nil || !p.Addr().Is4() {
+		return netip.Prefix{}, &ValidationError{Message: fmt.Sprintf("cidr %q must be an IPv4 network like 10.0.0.0/16", cidr)}
+	}
+	if p.Bits() < MinPrefixLen || p.Bits() > MaxPrefixLen {
+		return netip.Prefix{}, &ValidationError{Message: fmt.Sprintf("cidr prefix length must be between /%d and /%d", MinPrefixLen, MaxPrefixLen)}
+	}
+	return p.Masked(), nil
+}
+
+// UsableHosts is the number of server addresses in a subnet: all but the
+// network and broadcast addresses
+func UsableHosts(p netip.Prefix) int {
+	return 1<<(32-p.Bits()) - 2
+}
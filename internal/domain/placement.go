@@ -0,0 +1,90 @@
+package domain
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Placement strategies. Spread and pack count live servers per zone (a
+// placement group's members, or the whole region without a group);
+// spread_by_label only exists on placement groups and spreads the
+// members that share a value of the group's label key.
+const (
+	PlacementSpread        = "spread"
+	PlacementPack          = "pack"
+	PlacementSpreadByLabel = "spread_by_label"
+)
+
+// ValidatePlacement checks a placement group's strategy and label key
+func ValidatePlacement(strategy, labelKey string) error {
+	switch strategy {
+	case PlacementSpread, PlacementPack:
+		if labelKey != "" {
+			return &ValidationError{Message: "label_key is only used by the spread_by_label strategy"}
+		}
+	case PlacementSpreadByLabel:
+		if labelKey == "" {
+			return &ValidationError{Message: "spread_by_label needs a label_key"}
+		}
+	default:
+		return &ValidationError{Message: fmt.Sprintf("strategy %q must be spread, pack or spread_by_label", strategy)}
+	}
+	return nil
+}
+
+// ZoneLoad is what placement knows about one zone of a region
+type ZoneLoad struct {
+	Zone     string
+	Impaired bool
+	// Servers is the number of live servers the strategy counts
+	Servers int
+	// SameLabel is how many of them share the new server's label value
+	// (spread_by_label only)
+	SameLabel int
+}
+
+// PickZone chooses the zone for a new server among the healthy ones of
+// zones; ties go to the first zone by name. ok is false when every zone
+// is impaired.
+func PickZone(strategy string, zones []ZoneLoad) (zone string, ok bool) {
+	healthy := make([]ZoneLoad, 0, len(zones))
+	for _, z := range zones {
+		if !z.Impaired {
+			healthy = append(healthy, z)
+		}
+	}
+	if len(healthy) == 0 {
+		return "", false
+	}
+	sort.Slice(healthy, func(i, j int) bool {
+		a, b := healthy[i], healthy[j]
+		switch {
+		case strategy == PlacementSpreadByLabel && a.SameLabel != b.SameLabel:
+			return a.SameLabel < b.SameLabel
+		case strategy == PlacementPack && a.Servers != b.Servers:
+			return a.Servers > b.Servers
+		case strategy != PlacementPack && a.Servers != b.Servers:
+			return a.Servers < b.Servers
+		}
+		return a.Zone < b.Zone
+	})
+	return healthy[0].Zone, true
+}
+
+// ZoneImpairedError is returned for placing or starting a server in a zone
+// marked impaired by the fault API, or when every zone of a region is
+type ZoneImpairedError struct {
+	Region string
+	Zone   string
+	Reason string
+}
+
+func (e *ZoneImpairedError) Error() string {
+	if e.Zone == "" {
+		return fmt.Sprintf("every zone of region %s is impaired", e.Region)
+	}
+	if e.Reason != "" {
+		return fmt.Sprintf("zone %s is impaired: %s", e.Zone, e.Reason)
+	}
+	return fmt.Sprintf("zone %s is impaired", e.Zone)
+}
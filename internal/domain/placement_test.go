@@ -0,0 +1,98 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPickZone(t *testing.T) {
+	zones := []ZoneLoad{
+		{Zone: "us-east-1c", Servers: 3, SameLabel: 0},
+		{Zone: "us-east-1a", Servers: 5, SameLabel: 2},
+		{Zone: "us-east-1b", Servers: 3, SameLabel: 1},
+	}
+	for _, tc := range []struct {
+		name     string
+		strategy string
+		zones    []ZoneLoad
+		want     string
+		ok       bool
+	}{
+		{"spread picks the emptiest; tie goes to the first name", PlacementSpread, zones, "us-east-1b", true},
+		{"pack picks the fullest", PlacementPack, zones, "us-east-1a", true},
+		{"spread_by_label picks the fewest sharing the label", PlacementSpreadByLabel, zones, "us-east-1c", true},
+		{"spread_by_label tie falls back to spreading servers", PlacementSpreadByLabel, []ZoneLoad{
+			{Zone: "z-a", Servers: 9, SameLabel: 1},
+			{Zone: "z-b", Servers: 1, SameLabel: 1},
+		}, "z-b", true},
+		{"spread_by_label full tie goes to the first name", PlacementSpreadByLabel, []ZoneLoad{
+			{Zone: "z-b", Servers: 4, SameLabel: 1},
+			{Zone: "z-a", Servers: 4, SameLabel: 1},
+		}, "z-a", true},
+		{"pack tie goes to the first name", PlacementPack, []ZoneLoad{
+			{Zone: "z-b", Servers: 2},
+			{Zone: "z-a", Servers: 2},
+		}, "z-a", true},
+		{"impaired zones are skipped", PlacementSpread, []ZoneLoad{
+			{Zone: "z-a", Servers: 0, Impaired: true},
+			{Zone: "z-b", Servers: 7},
+		}, "z-b", true},
+		{"pack skips an impaired fullest zone", PlacementPack, []ZoneLoad{
+			{Zone: "z-a", Servers: 9, Impaired: true},
+			{Zone: "z-b", Servers: 1},
+			{Zone: "z-c", Servers: 2},
+		}, "z-c", true},
+		{"every zone impaired", PlacementSpread, []ZoneLoad{
+			{Zone: "z-a", Impaired: true},
+			{Zone: "z-b", Impaired: true},
+		}, "", false},
+		{"no zones", PlacementSpread, nil, "", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := PickZone(tc.strategy, tc.zones)
+			if got != tc.want || ok != tc.ok {
+				t.Fatalf("PickZone(%s) = %q, %v; want %q, %v", tc.strategy, got, ok, tc.want, tc.ok)
+			}
+		})
+	}
+}
+
+func TestValidatePlacement(t *testing.T) {
+	for _, tc := range []struct {
+		strategy, labelKey string
+		ok                 bool
+	}{
+		{PlacementSpread, "", true},
+		{PlacementPack, "", true},
+		{PlacementSpreadByLabel, "rack", true},
+		{PlacementSpread, "rack", false},
+		{PlacementPack, "rack", false},
+		{PlacementSpreadByLabel, "", false},
+		{"cluster", "", false},
+		{"", "", false},
+	} {
+		err := ValidatePlacement(tc.strategy, tc.labelKey)
+		if (err == nil) != tc.ok {
+			t.Errorf("ValidatePlacement(%q, %q) = %v, want ok=%v", tc.strategy, tc.labelKey, err, tc.ok)
+		}
+		var ve *ValidationError
+		if err != nil && !errors.As(err, &ve) {
+			t.Errorf("ValidatePlacement(%q, %q) = %T, want *ValidationError", tc.strategy, tc.labelKey, err)
+		}
+	}
+}
+
+func TestZoneImpairedError(t *testing.T) {
+	for _, tc := range []struct {
+		err  ZoneImpairedError
+		want string
+	}{
+		{ZoneImpairedError{Region: "us-east-1"}, "every zone of region us-east-1 is impaired"},
+		{ZoneImpairedError{Region: "us-east-1", Zone: "us-east-1a"}, "zone us-east-1a is impaired"},
+		{ZoneImpairedError{Region: "us-east-1", Zone: "us-east-1a", Reason: "power"}, "zone us-east-1a is impaired: power"},
+	} {
+		if got := tc.err.Error(); got != tc.want {
+			t.Errorf("Error() = %q, want %q", got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Catch-up policies for schedule runs missed while the scheduler was down
+const (
+	// CatchUpSkip drops missed runs and waits for the next occurrence
+	CatchUpSkip = "skip"
+	// CatchUpOnce performs a single run for any number of missed occurrences
+	CatchUpOnce = "once"
+)
+
+// ScheduleMisfireGrace is how late a run may fire and still count as on
+// time. Older runs were missed (e.g. the service was down) and are handled
+// by the schedule's catch-up policy.
+const ScheduleMisfireGrace = 5 * time.Minute
+
+// ScheduleRunFires reports whether the run due at due is performed when the
+// scheduler gets to it at now: always while within ScheduleMisfireGrace,
+// and for a missed run only with CatchUpOnce
+func ScheduleRunFires(due, now time.Time, catchUp string) bool {
+	if now.Sub(due) <= ScheduleMisfireGrace {
+		return true
+	}
+	return catchUp == CatchUpOnce
+}
+
+// NextScheduleRun returns the first occurrence of the 5-field cron expression
+// strictly after `after`, evaluated in the given IANA timezone
+func NextScheduleRun(expr, timezone string, after time.Time) (time.Time, error) {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timezone %q: %w", timezone, err)
+	}
+	sched, err := cron.ParseStandard(expr)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+	}
+	next := sched.Next(after.In(loc))
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("cron expression %q never fires", expr)
+	}
+	return next.UTC(), nil
+}
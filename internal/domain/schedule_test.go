@@ -0,0 +1,71 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextScheduleRun(t *testing.T) {
+	at := func(s string) time.Time {
+		v, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	for _, tc := range []struct {
+		name, expr, tz, after string
+		want                  string // "" for an error
+	}{
+		{"next slot", "*/5 * * * *", "UTC", "2026-01-15T10:02:30Z", "2026-01-15T10:05:00Z"},
+		{"strictly after", "*/5 * * * *", "UTC", "2026-01-15T10:05:00Z", "2026-01-15T10:10:00Z"},
+		{"local winter time", "0 9 * * 1-5", "Europe/Berlin", "2026-01-15T00:00:00Z", "2026-01-15T08:00:00Z"},
+		{"local summer time", "0 9 * * 1-5", "Europe/Berlin", "2026-07-15T00:00:00Z", "2026-07-15T07:00:00Z"},
+		{"weekday skips the weekend", "0 9 * * 1-5", "Europe/Berlin", "2026-01-16T09:00:00Z", "2026-01-19T08:00:00Z"},
+		{"other side of the date line", "0 9 * * *", "Pacific/Auckland", "2026-01-15T00:00:00Z", "2026-01-15T20:00:00Z"},
+		{"time skipped by DST moves to the next day", "30 2 * * *", "Europe/Berlin", "2026-03-28T23:00:00Z", "2026-03-30T00:30:00Z"},
+		{"time repeated by DST fires once", "30 2 * * *", "Europe/Berlin", "2026-10-24T23:00:00Z", "2026-10-25T00:30:00Z"},
+		{"bad timezone", "0 9 * * *", "Mars/Olympus", "2026-01-15T00:00:00Z", ""},
+		{"bad expression", "0 9 * *", "UTC", "2026-01-15T00:00:00Z", ""},
+		{"seconds field not accepted", "0 0 9 * * *", "UTC", "2026-01-15T00:00:00Z", ""},
+		{"never fires", "0 0 30 2 *", "UTC", "2026-01-15T00:00:00Z", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := NextScheduleRun(tc.expr, tc.tz, at(tc.after))
+			if tc.want == "" {
+				if err == nil {
+					t.Fatalf("NextScheduleRun(%q, %s) = %v, want an error", tc.expr, tc.tz, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NextScheduleRun(%q, %s): %v", tc.expr, tc.tz, err)
+			}
+			if want := at(tc.want); !got.Equal(want) || got.Location() != time.UTC {
+				t.Fatalf("NextScheduleRun(%q, %s, %s) = %v, want %v UTC", tc.expr, tc.tz, tc.after, got, want)
+			}
+		})
+	}
+}
+
+func TestScheduleRunFires(t *testing.T) {
+	due := time.Date(2026, 1, 15, 9, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		name    string
+		late    time.Duration
+		catchUp string
+		want    bool
+	}{
+		{"on time", 0, CatchUpSkip, true},
+		{"late within the grace", ScheduleMisfireGrace, CatchUpSkip, true},
+		{"missed, skip", ScheduleMisfireGrace + time.Second, CatchUpSkip, false},
+		{"missed, once", ScheduleMisfireGrace + time.Second, CatchUpOnce, true},
+		{"missed by days, skip", 72 * time.Hour, CatchUpSkip, false},
+		{"missed by days, once", 72 * time.Hour, CatchUpOnce, true},
+		{"evaluated early", -time.Minute, CatchUpSkip, true},
+	} {
+		if got := ScheduleRunFires(due, due.Add(tc.late), tc.catchUp); got != tc.want {
+			t.Errorf("%s: ScheduleRunFires(%v late, %s) = %v, want %v", tc.name, tc.late, tc.catchUp, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package domain
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// Security group rule directions
+const (
+	DirectionIngress = "ingress"
+	DirectionEgress  = "egress"
+)
+
+// Security group rule protocols; ProtocolAll matches any traffic
+const (
+	ProtocolTCP  = "tcp"
+	ProtocolUDP  = "udp"
+	ProtocolICMP = "icmp"
+	ProtocolAll  = "all"
+)
+
+// MaxSecurityGroupsPerServer is how many groups one server can have
+const MaxSecurityGroupsPerServer = 5
+
+// Rule is one security group rule. Ports are only set for tcp and udp.
+// The peer is either CIDR or the servers of SourceGroupID: the source of
+// ingress traffic, the destination of egress traffic.
+type Rule struct {
+	Direction     string `json:"direction"`
+	Protocol      string `json:"protocol"`
+	PortFrom      int    `json:"port_from,omitempty"`
+	PortTo        int    `json:"port_to,omitempty"`
+	CIDR          string `json:"cidr,omitempty"`
+	SourceGroupID string `json:"source_group_id,omitempty"`
+}
+
+// NormalizeRule validates r and returns it lowercased, with PortTo
+// defaulting to PortFrom and CIDR in canonical form (host bits cleared)
+func NormalizeRule(r Rule) (Rule, error) {
+	r.Direction = strings.ToLower(strings.TrimSpace(r.Direction))
+	r.Protocol = strings.ToLower(strings.TrimSpace(r.Protocol))
+	if r.Direction != DirectionIngress && r.Direction != DirectionEgress {
+		return r, &ValidationError{Message: "direction must be ingress or egress"}
+	}
+	switch r.Protocol {
+	case ProtocolTCP, ProtocolUDP:
+		if r.PortTo == 0 {
+			r.PortTo = r.PortFrom
+		}
+		if r.PortFrom < 1 || r.PortTo > 65535 || r.PortFrom > r.PortTo {
+			return r, &ValidationError{Message: "port_from and port_to must be a range within 1-65535"}
+		}
+	case ProtocolICMP, ProtocolAll:
+		if r.PortFrom != 0 || r.PortTo != 0 {
+			return r, &ValidationError{Message: fmt.Sprintf("%s rules take no ports", r.Protocol)}
+		}
+	default:
+		return r, &ValidationError{Message: "protocol must be tcp, udp, icmp or all"}
+	}
+	r.CIDR = strings.TrimSpace(r.CIDR)
+	if (r.CIDR == "") == (r.SourceGroupID == "") {
+		return r, &ValidationError{Message: "exactly one of cidr and source_group_id is required"}
+	}
+	if r.CIDR != "" {
+		p, err := netip.ParsePrefix(r.CIDR)
+		if err != nil {
+			return r, &ValidationError{Message: fmt.Sprintf("invalid cidr %q", r.CIDR)}
+		}
+		r.CIDR = p.Masked().String()
+	}
+	return r, nil
+}
+
+// Covers reports whether r applies to protocol traffic on port (ignored
+// for icmp); the peer is matched separately
+func (r Rule) Covers(protocol string, port int) bool {
+	switch r.Protocol {
+	case ProtocolAll:
+		return true
+	case ProtocolICMP:
+		return protocol == ProtocolICMP
+	}
+	return r.Protocol == protocol && port >= r.PortFrom && port <= r.PortTo
+}
+
+// CoversAddr reports whether r's CIDR contains addr
+func (r Rule) CoversAddr(addr netip.Addr) bool {
+	if r.CIDR == "" || !addr.IsValid() {
+		return false
+	}
+	p, err := netip.ParsePrefix(r.CIDR)
+	return err == nil && p.Contains(addr)
+}
+
+// String describes the traffic r allows, e.g. "ingress tcp/443 from 0.0.0.0/0"
+func (r Rule) String() string {
+	traffic := r.Protocol
+	if r.PortFrom != 0 {
+		traffic += fmt.Sprintf("/%d", r.PortFrom)
+		if r.PortTo != r.PortFrom {
+			traffic += fmt.Sprintf("-%d", r.PortTo)
+		}
+	}
+	peer := r.CIDR
+	if peer == "" {
+		peer = "group " + r.SourceGroupID
+	}
+	if r.Direction == DirectionEgress {
+		return fmt.Sprintf("egress %s to %s", traffic, peer)
+	}
+	return fmt.Sprintf("ingress %s from %s", traffic, peer)
+}
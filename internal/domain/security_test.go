@@ -0,0 +1,136 @@
+package domain
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestNormalizeRule(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		in   Rule
+		want Rule
+		ok   bool
+	}{
+		{"single port defaults port_to",
+			Rule{Direction: "ingress", Protocol: "tcp", PortFrom: 22, CIDR: "10.0.0.0/8"},
+			Rule{Direction: "ingress", Protocol: "tcp", PortFrom: 22, PortTo: 22, CIDR: "10.0.0.0/8"}, true},
+		{"range kept",
+			Rule{Direction: "egress", Protocol: "udp", PortFrom: 1000, PortTo: 2000, CIDR: "0.0.0.0/0"},
+			Rule{Direction: "egress", Protocol: "udp", PortFrom: 1000, PortTo: 2000, CIDR: "0.0.0.0/0"}, true},
+		{"case and spaces normalized",
+			Rule{Direction: " Ingress ", Protocol: "TCP", PortFrom: 443, CIDR: " 192.168.1.0/24 "},
+			Rule{Direction: "ingress", Protocol: "tcp", PortFrom: 443, PortTo: 443, CIDR: "192.168.1.0/24"}, true},
+		{"host bits masked",
+			Rule{Direction: "ingress", Protocol: "tcp", PortFrom: 80, CIDR: "10.1.2.3/16"},
+			Rule{Direction: "ingress", Protocol: "tcp", PortFrom: 80, PortTo: 80, CIDR: "10.1.0.0/16"}, true},
+		{"single address",
+			Rule{Direction: "ingress", Protocol: "icmp", CIDR: "10.1.2.3/32"},
+			Rule{Direction: "ingress", Protocol: "icmp", CIDR: "10.1.2.3/32"}, true},
+		{"ipv6 masked",
+			Rule{Direction: "ingress", Protocol: "all", CIDR: "2001:db8::1/32"},
+			Rule{Direction: "ingress", Protocol: "all", CIDR: "2001:db8::/32"}, true},
+		{"source group instead of cidr",
+			Rule{Direction: "ingress", Protocol: "tcp", PortFrom: 5432, SourceGroupID: "sg-1"},
+			Rule{Direction: "ingress", Protocol: "tcp", PortFrom: 5432, PortTo: 5432, SourceGroupID: "sg-1"}, true},
+		{"bad direction", Rule{Direction: "inbound", Protocol: "tcp", PortFrom: 22, CIDR: "0.0.0.0/0"}, Rule{}, false},
+		{"bad protocol", Rule{Direction: "ingress", Protocol: "sctp", PortFrom: 22, CIDR: "0.0.0.0/0"}, Rule{}, false},
+		{"tcp without ports", Rule{Direction: "ingress", Protocol: "tcp", CIDR: "0.0.0.0/0"}, Rule{}, false},
+		{"port above range", Rule{Direction: "ingress", Protocol: "tcp", PortFrom: 22, PortTo: 70000, CIDR: "0.0.0.0/0"}, Rule{}, false},
+		{"inverted range", Rule{Direction: "ingress", Protocol: "udp", PortFrom: 2000, PortTo: 1000, CIDR: "0.0.0.0/0"}, Rule{}, false},
+		{"icmp with ports", Rule{Direction: "ingress", Protocol: "icmp", PortFrom: 8, CIDR: "0.0.0.0/0"}, Rule{}, false},
+		{"all with ports", Rule{Direction: "egress", Protocol: "all", PortTo: 80, CIDR: "0.0.0.0/0"}, Rule{}, false},
+		{"no peer", Rule{Direction: "ingress", Protocol: "tcp", PortFrom: 22}, Rule{}, false},
+		{"both peers", Rule{Direction: "ingress", Protocol: "tcp", PortFrom: 22, CIDR: "0.0.0.0/0", SourceGroupID: "sg-1"}, Rule{}, false},
+		{"bad cidr", Rule{Direction: "ingress", Protocol: "tcp", PortFrom: 22, CIDR: "10.0.0.0/33"}, Rule{}, false},
+		{"address without prefix", Rule{Direction: "ingress", Protocol: "tcp", PortFrom: 22, CIDR: "10.0.0.1"}, Rule{}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := NormalizeRule(tc.in)
+			if !tc.ok {
+				if _, ok := err.(*ValidationError); !ok {
+					t.Fatalf("NormalizeRule(%+v) err = %v, want a *ValidationError", tc.in, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NormalizeRule(%+v): %v", tc.in, err)
+			}
+			if got != tc.want {
+				t.Fatalf("NormalizeRule(%+v) = %+v, want %+v", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRuleCovers(t *testing.T) {
+	ssh := Rule{Protocol: ProtocolTCP, PortFrom: 22, PortTo: 22}
+	dns := Rule{Protocol: ProtocolUDP, PortFrom: 53, PortTo: 53}
+	high := Rule{Protocol: ProtocolTCP, PortFrom: 8000, PortTo: 8999}
+	icmp := Rule{Protocol: ProtocolICMP}
+	all := Rule{Protocol: ProtocolAll}
+	for _, tc := range []struct {
+		rule     Rule
+		protocol string
+		port     int
+		want     bool
+	}{
+		{ssh, "tcp", 22, true},
+		{ssh, "tcp", 23, false},
+		{ssh, "udp", 22, false},
+		{dns, "udp", 53, true},
+		{dns, "tcp", 53, false},
+		{high, "tcp", 8000, true},
+		{high, "tcp", 8999, true},
+		{high, "tcp", 7999, false},
+		{high, "tcp", 9000, false},
+		{icmp, "icmp", 0, true},
+		{icmp, "icmp", 8, true},
+		{icmp, "tcp", 22, false},
+		{all, "tcp", 1, true},
+		{all, "udp", 65535, true},
+		{all, "icmp", 0, true},
+	} {
+		if got := tc.rule.Covers(tc.protocol, tc.port); got != tc.want {
+			t.Errorf("%s Covers(%s, %d) = %v, want %v", tc.rule.Protocol, tc.protocol, tc.port, got, tc.want)
+		}
+	}
+}
+
+func TestRuleCoversAddr(t *testing.T) {
+	for _, tc := range []struct {
+		cidr, addr string
+		want       bool
+	}{
+		{"10.0.0.0/8", "10.20.30.40", true},
+		{"10.0.0.0/8", "11.0.0.1", false},
+		{"0.0.0.0/0", "203.0.113.9", true},
+		{"192.168.1.5/32", "192.168.1.5", true},
+		{"192.168.1.5/32", "192.168.1.6", false},
+		{"2001:db8::/32", "2001:db8::1", true},
+		{"", "10.0.0.1", false},
+	} {
+		addr, _ := netip.ParseAddr(tc.addr)
+		if got := (Rule{CIDR: tc.cidr}).CoversAddr(addr); got != tc.want {
+			t.Errorf("CoversAddr(%s, %s) = %v, want %v", tc.cidr, tc.addr, got, tc.want)
+		}
+	}
+	if (Rule{CIDR: "0.0.0.0/0"}).CoversAddr(netip.Addr{}) {
+		t.Error("CoversAddr matched an invalid address")
+	}
+}
+
+func TestRuleString(t *testing.T) {
+	for _, tc := range []struct {
+		rule Rule
+		want string
+	}{
+		{Rule{Direction: "ingress", Protocol: "tcp", PortFrom: 443, PortTo: 443, CIDR: "0.0.0.0/0"}, "ingress tcp/443 from 0.0.0.0/0"},
+		{Rule{Direction: "egress", Protocol: "udp", PortFrom: 1000, PortTo: 2000, CIDR: "10.0.0.0/8"}, "egress udp/1000-2000 to 10.0.0.0/8"},
+		{Rule{Direction: "ingress", Protocol: "icmp", SourceGroupID: "sg-1"}, "ingress icmp from group sg-1"},
+	} {
+		if got := tc.rule.String(); got != tc.want {
+			t.Errorf("String() = %q, want %q", got, tc.want)
+		}
+	}
+}
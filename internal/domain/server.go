@@ -1,7 +1,7 @@
 package domain
 
 import (
-	"fmt"
+	"strings"
 	"time"
 )
 
@@ -13,6 +13,12 @@ const (
 	StatusStopped    ServerStatus = "stopped"
 	StatusRebooting  ServerStatus = "rebooting"
 	StatusTerminated ServerStatus = "terminated"
+	StatusHibernated ServerStatus = "hibernated"
+
+	// Simulated in-between states (see TransitionalStatus)
+	StatusStarting    ServerStatus = "starting"
+	StatusStopping    ServerStatus = "stopping"
+	StatusTerminating ServerStatus = "terminating"
 )
 
 type Server struct {
@@ -25,11 +31,15 @@ type Server struct {
 
 // State transition map
 var validTransitions = map[ServerStatus][]ServerStatus{
-	StatusPending:    {StatusStopped},
-	StatusStopped:    {StatusRunning, StatusTerminated},
-	StatusRunning:    {StatusStopped, StatusRebooting},
-	StatusRebooting:  {StatusRunning},
-	StatusTerminated: {},
+	StatusPending:     {StatusStopped},
+	StatusStopped:     {StatusRunning, StatusTerminated, StatusStarting, StatusTerminating},
+	StatusRunning:     {StatusStopped, StatusRebooting, StatusHibernated, StatusStopping},
+	StatusRebooting:   {StatusRunning},
+	StatusHibernated:  {StatusRunning, StatusTerminated, StatusTerminating},
+	StatusStarting:    {StatusRunning},
+	StatusStopping:    {StatusStopped},
+	StatusTerminating: {StatusTerminated},
+	StatusTerminated:  {},
 }
 
 // Checking if a state transition is valid
@@ -50,10 +60,32 @@ func (s ServerStatus) CanTransition(target ServerStatus) bool {
 // Function attempts to change server status
 func (server *Server) TransitionTo(newStatus ServerStatus) error {
 	if !server.Status.CanTransition(newStatus) {
-		return fmt.Errorf("invalid transition from %s to %s ", server.Status, newStatus)
-
+		return &InvalidTransitionError{Current: string(server.Status), Target: string(newStatus)}
 	}
 	server.Status = newStatus
 	server.UpdatedAt = time.Now()
 	return nil
 }
+
+// ServerLock is a named deletion lock; a server holding any cannot be
+// terminated
+type ServerLock struct {
+	ServerID  string    `json:"server_id"`
+	Name      string    `json:"name"`
+	Reason    string    `json:"reason"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ValidateCreate checks the fields every new server needs
+func ValidateCreate(name, region, typ string) error {
+	if name == "" || region == "" || typ == "" {
+		return &ValidationError{Message: "missing fields (name, region, type required)"}
+	}
+	return nil
+}
+
+// NormalizeAction canonicalizes a client-supplied action name
+func NormalizeAction(action string) string {
+	return strings.ToLower(strings.TrimSpace(action))
+}
@@ -0,0 +1,45 @@
+package domain
+
+import "fmt"
+
+// Snapshot statuses
+const (
+	SnapshotPending   = "pending"
+	SnapshotAvailable = "available"
+	SnapshotFailed    = "failed"
+	SnapshotDeleted   = "deleted"
+)
+
+// Image statuses
+const (
+	ImageAvailable    = "available"
+	ImageDeregistered = "deregistered"
+)
+
+// Operation statuses
+const (
+	OperationRunning   = "running"
+	OperationSucceeded = "succeeded"
+	OperationFailed    = "failed"
+)
+
+// OpCreateSnapshot is the operation that fills a pending snapshot
+const OpCreateSnapshot = "create_snapshot"
+
+// ResourceStateError is returned when a snapshot or image is not in a
+// state that allows the operation. Reason, when set, explains it instead
+// of the status (e.g. an image still using a snapshot).
+type ResourceStateError struct {
+	Resource string
+	ID       string
+	Op       string
+	Status   string
+	Reason   string
+}
+
+func (e *ResourceStateError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("cannot %s %s %s: %s", e.Op, e.Resource, e.ID, e.Reason)
+	}
+	return fmt.Sprintf("cannot %s %s %s: %s is %s", e.Op, e.Resource, e.ID, e.Resource, e.Status)
+}
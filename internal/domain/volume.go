@@ -0,0 +1,78 @@
+package domain
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Volume statuses
+const (
+	VolumeAvailable = "available"
+	VolumeInUse     = "in-use"
+	VolumeDeleted   = "deleted"
+)
+
+// MaxVolumeSizeGB is the largest volume that can be created
+const MaxVolumeSizeGB = 16384
+
+// HoursPerMonth is the month length per-GB-month rates are prorated over
+const HoursPerMonth = 730
+
+var devicePattern = regexp.MustCompile(`^/dev/vd[b-z]$`)
+
+// ValidateVolume checks the fields every new volume needs
+func ValidateVolume(name, region, typ string, sizeGB int) error {
+	if name == "" || region == "" || typ == "" {
+		return &ValidationError{Message: "missing fields (name, region, type required)"}
+	}
+	if sizeGB < 1 || sizeGB > MaxVolumeSizeGB {
+		return &ValidationError{Message: fmt.Sprintf("size_gb must be between 1 and %d", MaxVolumeSizeGB)}
+	}
+	return nil
+}
+
+// VolumeAttachable reports whether volumes can be attached to or detached
+// from a server in status: not once it is terminated, nor mid-transition
+func VolumeAttachable(status string) bool {
+	return status != "TERMINATED" && !IsTransitional(status)
+}
+
+// NextDevice picks the device for a new attachment: want if given (it must
+// be a free /dev/vdX name), else the first free one from /dev/vdb
+func NextDevice(want string, used []string) (string, error) {
+	taken := map[string]bool{}
+	for _, d := range used {
+		taken[d] = true
+	}
+	if want != "" {
+		if !devicePattern.MatchString(want) {
+			return "", &ValidationError{Message: fmt.Sprintf("device %q must be /dev/vdb to /dev/vdz", want)}
+		}
+		if taken[want] {
+			return "", &ValidationError{Message: fmt.Sprintf("device %s is already in use on this server", want)}
+		}
+		return want, nil
+	}
+	for c := 'b'; c <= 'z'; c++ {
+		if d := "/dev/vd" + string(c); !taken[d] {
+			return d, nil
+		}
+	}
+	return "", &ValidationError{Message: "no free device names left on this server"}
+}
+
+// VolumeStateError is returned when a volume, or the server it is attached
+// to or being attached to, is not in a state that allows the operation
+type VolumeStateError struct {
+	VolumeID     string
+	Op           string
+	Status       string
+	ServerStatus string
+}
+
+func (e *VolumeStateError) Error() string {
+	if e.ServerStatus != "" {
+		return fmt.Sprintf("cannot %s volume %s: server is %s", e.Op, e.VolumeID, e.ServerStatus)
+	}
+	return fmt.Sprintf("cannot %s volume %s: volume is %s", e.Op, e.VolumeID, e.Status)
+}
@@ -0,0 +1,78 @@
+package grpcapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"virtualservers/internal/api"
+	"virtualservers/internal/domain"
+	"virtualservers/internal/logging"
+)
+
+// errorDomain is the ErrorInfo domain of every status detail we return
+const errorDomain = "virtualservers"
+
+// toStatus maps err through the HTTP API's problem mapping. The problem
+// code becomes the ErrorInfo reason and its extensions the ErrorInfo
+// metadata (non-string values JSON encoded), so gRPC clients can switch on
+// the same codes as HTTP clients. Unmapped errors are logged and hidden.
+func toStatus(ctx context.Context, op string, err error) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err).Err()
+	}
+	p, ok := api.ProblemFor(err)
+	if !ok {
+		logging.From(ctx).Error(op+" failed", "err", err)
+		return status.Error(codes.Internal, "internal error")
+	}
+	msg := p.Detail
+	if msg == "" {
+		msg = strings.ReplaceAll(p.Code, "_", " ")
+	}
+	info := &errdetails.ErrorInfo{Reason: p.Code, Domain: errorDomain, Metadata: map[string]string{}}
+	for k, v := range p.Extensions {
+		if s, ok := v.(string); ok {
+			info.Metadata[k] = s
+			continue
+		}
+		b, _ := json.Marshal(v)
+		info.Metadata[k] = string(b)
+	}
+	if id := middleware.GetReqID(ctx); id != "" {
+		info.Metadata["request_id"] = id
+	}
+	st := status.New(grpcCode(p), msg)
+	if withInfo, err := st.WithDetails(info); err == nil {
+		st = withInfo
+	}
+	return st.Err()
+}
+
+func grpcCode(p api.Problem) codes.Code {
+	switch p.Code {
+	case domain.CodeIPPoolExhausted, domain.CodeQuotaExceeded, domain.CodeInsufficientCapacity:
+		return codes.ResourceExhausted
+	case domain.CodeZoneImpaired, domain.CodeProvisionFailed:
+		return codes.Unavailable
+	}
+	switch p.Status {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.FailedPrecondition
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	default:
+		return codes.Unknown
+	}
+}
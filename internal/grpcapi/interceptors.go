@@ -0,0 +1,138 @@
+package grpcapi
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"runtime/debug"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+
+	"virtualservers/internal/logging"
+	"virtualservers/internal/repository"
+	"virtualservers/internal/service"
+	pb "virtualservers/pkg/pb/virtualservers/v1"
+)
+
+// New returns a gRPC server with ServerService, the standard health service
+// and reflection registered. Every call is traced, tagged with a request ID
+// and principal (x-request-id and x-actor metadata, as on the HTTP API),
+// logged, and recovered from panics.
+func New(store *repository.Store, hub *service.EventHub) *grpc.Server {
+	gs := grpc.NewServer(
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(unaryInterceptor),
+		grpc.ChainStreamInterceptor(streamInterceptor),
+	)
+	pb.RegisterServerServiceServer(gs, &Server{Store: store, Hub: hub})
+	healthpb.RegisterHealthServer(gs, health.NewServer())
+	reflection.Register(gs)
+	return gs
+}
+
+func unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	start := time.Now()
+	ctx = callContext(ctx, info.FullMethod)
+	_ = grpc.SetHeader(ctx, metadata.Pairs("x-request-id", middleware.GetReqID(ctx)))
+	defer func() {
+		if p := recover(); p != nil {
+			err = recovered(ctx, p)
+		}
+		logCall(ctx, start, err)
+	}()
+	return handler(ctx, req)
+}
+
+func streamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	start := time.Now()
+	ctx := callContext(ss.Context(), info.FullMethod)
+	_ = ss.SetHeader(metadata.Pairs("x-request-id", middleware.GetReqID(ctx)))
+	defer func() {
+		if p := recover(); p != nil {
+			err = recovered(ctx, p)
+		}
+		logCall(ctx, start, err)
+	}()
+	return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+}
+
+// contextStream overrides the context of a server stream
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context { return s.ctx }
+
+// callContext carries what the HTTP middleware chain provides: the request
+// ID (shared with chi's middleware so SQL spans and events pick it up), the
+// event actor and operation ID, and a call logger
+func callContext(ctx context.Context, method string) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	reqID := firstValue(md, "x-request-id")
+	if reqID == "" {
+		reqID = newRequestID()
+	}
+	principal := logging.PrincipalOf("grpc", firstValue(md, "x-actor"))
+
+	ctx = context.WithValue(ctx, middleware.RequestIDKey, reqID)
+	ctx = repository.WithActor(ctx, principal)
+	ctx = repository.WithOperationID(ctx, reqID)
+	l := slog.Default().With(
+		"request_id", reqID,
+		"rpc", method,
+		"principal", principal,
+	)
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		l = l.With("trace_id", sc.TraceID().String())
+	}
+	return logging.With(ctx, l)
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return "grpc-" + hex.EncodeToString(b)
+}
+
+func firstValue(md metadata.MD, key string) string {
+	if v := md.Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func recovered(ctx context.Context, p any) error {
+	logging.From(ctx).Error("panic", "panic", p, "stack", string(debug.Stack()))
+	return status.Error(codes.Internal, "internal error")
+}
+
+// logCall writes one access log line per call, like the HTTP "request" line
+func logCall(ctx context.Context, start time.Time, err error) {
+	code := status.Code(err)
+	level := slog.LevelInfo
+	switch code {
+	case codes.Internal, codes.Unknown, codes.DataLoss:
+		level = slog.LevelError
+	}
+	attrs := []any{
+		"code", code.String(),
+		"latency_ms", float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		attrs = append(attrs, "remote_addr", p.Addr.String())
+	}
+	logging.From(ctx).Log(ctx, level, "rpc", attrs...)
+}
@@ -0,0 +1,291 @@
+// Package grpcapi serves the server lifecycle operations over gRPC. It is
+// backed by the same repository as the HTTP API and shares its principal
+// handling, validation and error mapping.
+package grpcapi
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"virtualservers/internal/domain"
+	"virtualservers/internal/repository"
+	"virtualservers/internal/service"
+	pb "virtualservers/pkg/pb/virtualservers/v1"
+)
+
+// replayBatch is how many missed events WatchEvents loads per query
+const replayBatch = 500
+
+type Server struct {
+	pb.UnimplementedServerServiceServer
+	Store *repository.Store
+	Hub   *service.EventHub
+}
+
+func (s *Server) Create(ctx context.Context, req *pb.CreateRequest) (*pb.CreateResponse, error) {
+	if err := domain.ValidateCreate(req.GetName(), req.GetRegion(), req.GetType()); err != nil {
+		return nil, toStatus(ctx, "Create", err)
+	}
+	id, err := s.Store.CreateServer(ctx, repository.NewServer{
+		Name:             req.GetName(),
+		Region:           req.GetRegion(),
+		Type:             req.GetType(),
+		ImageID:          req.GetImageId(),
+		SubnetID:         req.GetSubnetId(),
+		SecurityGroupIDs: req.GetSecurityGroupIds(),
+		Labels:           req.GetLabels(),
+		Zone:             req.GetZone(),
+		Placement:        strings.ToLower(req.GetPlacement()),
+		PlacementGroupID: req.GetPlacementGroupId(),
+	})
+	if err != nil {
+		return nil, toStatus(ctx, "Create", err)
+	}
+	return &pb.CreateResponse{Id: id, Status: "STOPPED"}, nil
+}
+
+func (s *Server) Get(ctx context.Context, req *pb.GetRequest) (*pb.ServerDetail, error) {
+	srv, err := s.Store.GetServerByID(ctx, req.GetId())
+	if err != nil {
+		return nil, toStatus(ctx, "Get", err)
+	}
+	if srv == nil {
+		return nil, status.Error(codes.NotFound, "server not found")
+	}
+	out := &pb.ServerDetail{
+		Server: &pb.Server{
+			Id:        srv.ID,
+			Name:      srv.Name,
+			Region:    srv.Region,
+			Type:      srv.Type,
+			Status:    srv.Status,
+			Ip:        srv.IP,
+			Labels:    srv.Labels,
+			CreatedAt: timestamppb.New(srv.CreatedAt),
+			UpdatedAt: timestamppb.New(srv.UpdatedAt),
+		},
+		AccruedSeconds:        srv.AccruedSeconds,
+		AccruedCost:           srv.AccruedCost,
+		LastStartedAt:         optionalTime(srv.LastStartedAt),
+		HourlyRate:            srv.HourlyRate,
+		StorageHourlyRate:     srv.StorageHourlyRate,
+		LiveUptimeSeconds:     srv.LiveUptime,
+		LiveCost:              srv.LiveCost,
+		TerminationProtection: srv.TerminationProtection,
+	}
+	if t := srv.Transition; t != nil {
+		out.Transition = &pb.Transition{
+			Action:       t.Action,
+			TargetStatus: t.TargetStatus,
+			StartedAt:    timestamppb.New(t.StartedAt),
+			DueAt:        timestamppb.New(t.DueAt),
+			QueuedAction: t.QueuedAction,
+		}
+	}
+	if srv.ImageID != nil {
+		out.ImageId = *srv.ImageID
+	}
+	out.SecurityGroupIds = srv.SecurityGroupIDs
+	if srv.SubnetID != nil {
+		out.SubnetId = *srv.SubnetID
+	}
+	if srv.VPCID != nil {
+		out.VpcId = *srv.VPCID
+	}
+	if srv.Zone != nil {
+		out.Server.Zone = *srv.Zone
+	}
+	if srv.PlacementGroupID != nil {
+		out.PlacementGroupId = *srv.PlacementGroupID
+	}
+	if srv.HostID != nil {
+		out.HostId = *srv.HostID
+	}
+	return out, nil
+}
+
+func (s *Server) List(ctx context.Context, req *pb.ListRequest) (*pb.ListResponse, error) {
+	f := repository.ListFilters{
+		Region: req.GetRegion(),
+		Zone:   req.GetZone(),
+		Status: req.GetStatus(),
+		Type:   req.GetType(),
+		Labels: req.GetLabels(),
+		Limit:  int(req.GetLimit()),
+		Offset: int(req.GetOffset()),
+	}
+	items, total, err := s.Store.ListServers(ctx, f)
+	if err != nil {
+		return nil, toStatus(ctx, "List", err)
+	}
+	resp := &pb.ListResponse{Total: int32(total), Limit: req.GetLimit(), Offset: req.GetOffset()}
+	for _, it := range items {
+		var zone string
+		if it.Zone != nil {
+			zone = *it.Zone
+		}
+		resp.Items = append(resp.Items, &pb.Server{
+			Id:        it.ID,
+			Name:      it.Name,
+			Region:    it.Region,
+			Type:      it.Type,
+			Status:    it.Status,
+			Ip:        it.IP,
+			Labels:    it.Labels,
+			CreatedAt: timestamppb.New(it.CreatedAt),
+			UpdatedAt: timestamppb.New(it.UpdatedAt),
+			Zone:      zone,
+		})
+	}
+	return resp, nil
+}
+
+func (s *Server) Action(ctx context.Context, req *pb.ActionRequest) (*pb.ActionResponse, error) {
+	newStatus, err := s.Store.ApplyAction(ctx, req.GetId(), domain.NormalizeAction(req.GetAction()))
+	if err != nil {
+		return nil, toStatus(ctx, "Action", err)
+	}
+	return &pb.ActionResponse{Id: req.GetId(), Status: newStatus}, nil
+}
+
+func (s *Server) Resize(ctx context.Context, req *pb.ResizeRequest) (*pb.ResizeResponse, error) {
+	typ := strings.TrimSpace(req.GetType())
+	if typ == "" {
+		return nil, toStatus(ctx, "Resize", &domain.ValidationError{Message: "type required"})
+	}
+	res, err := s.Store.Resize(ctx, req.GetId(), typ, req.GetLive())
+	if err != nil {
+		return nil, toStatus(ctx, "Resize", err)
+	}
+	return &pb.ResizeResponse{Id: res.ID, Status: res.Status, PreviousType: res.PreviousType, Type: res.Type}, nil
+}
+
+func (s *Server) Logs(ctx context.Context, req *pb.LogsRequest) (*pb.LogsResponse, error) {
+	f := repository.LogFilter{
+		Events: req.GetEvents(),
+		Limit:  int(req.GetLimit()),
+	}
+	if req.Since != nil {
+		f.Since = req.GetSince().AsTime()
+	}
+	if req.Until != nil {
+		f.Until = req.GetUntil().AsTime()
+	}
+	events, err := s.Store.GetServerLogs(ctx, req.GetId(), f)
+	if err != nil {
+		return nil, toStatus(ctx, "Logs", err)
+	}
+	resp := &pb.LogsResponse{}
+	for _, ev := range events {
+		resp.Items = append(resp.Items, toEvent(ev))
+	}
+	return resp, nil
+}
+
+// WatchEvents replays events after cursor (or last_event_id), then streams new ones
+// until the client goes away. Like the SSE stream, it subscribes before
+// replaying and skips duplicates by id.
+func (s *Server) WatchEvents(req *pb.WatchEventsRequest, stream grpc.ServerStreamingServer[pb.ServerEvent]) error {
+	ctx := stream.Context()
+	f := repository.EventFilter{
+		ServerID: req.GetServerId(),
+		Events:   req.GetEvents(),
+		Labels:   req.GetLabels(),
+	}
+	sub, cancel := s.Hub.Subscribe(f)
+	defer cancel()
+
+	cursor := req.GetCursor()
+	if cursor == "" && req.GetLastEventId() > 0 {
+		cursor = strconv.FormatInt(req.GetLastEventId(), 10)
+	}
+	cur, err := repository.ParseEventCursor(cursor)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if after := cur.After(); after > 0 {
+		also := cur.Missing()
+		for {
+			events, err := s.Store.ListEventsAfter(ctx, f, after, also, replayBatch)
+			if err != nil {
+				return toStatus(ctx, "WatchEvents", err)
+			}
+			for _, ev := range events {
+				if !cur.Accept(ev.ID) {
+					continue
+				}
+				if err := stream.Send(toStreamEvent(ev, cur)); err != nil {
+					return err
+				}
+			}
+			if len(events) < replayBatch {
+				break
+			}
+			after, also = events[len(events)-1].ID, nil
+		}
+	}
+	cur.Live()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-sub:
+			if !ok {
+				return status.Error(codes.Unavailable, "subscriber fell behind; resume with cursor")
+			}
+			// The ids the hub filtered out go through the cursor too, so a
+			// late commit below the last id sent is still recognised
+			for _, id := range ev.Skipped {
+				cur.Accept(id)
+			}
+			if !cur.Accept(ev.ID) {
+				continue
+			}
+			if err := stream.Send(toStreamEvent(ev.ServerEvent, cur)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// toStreamEvent is toEvent with the stream position to resume from
+func toStreamEvent(ev repository.ServerEvent, cur *repository.EventCursor) *pb.ServerEvent {
+	out := toEvent(ev)
+	out.Cursor = cur.String()
+	return out
+}
+
+func toEvent(ev repository.ServerEvent) *pb.ServerEvent {
+	out := &pb.ServerEvent{
+		Id:        ev.ID,
+		ServerId:  ev.ServerID,
+		Timestamp: timestamppb.New(ev.Timestamp),
+		Event:     ev.Event,
+		Message:   ev.Message,
+		Labels:    ev.Labels,
+	}
+	if len(ev.Data) > 0 {
+		var data map[string]any
+		if err := json.Unmarshal(ev.Data, &data); err == nil {
+			// Decoded JSON always converts
+			out.Data, _ = structpb.NewStruct(data)
+		}
+	}
+	return out
+}
+
+func optionalTime(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
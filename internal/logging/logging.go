@@ -0,0 +1,126 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type ctxKey struct{}
+
+// Setup builds the process logger from LOG_LEVEL (debug, info, warn, error;
+// default info) and LOG_FORMAT (json or text; default json) and installs it
+// as the slog default, which also routes the standard log package through it.
+func Setup() (*slog.Logger, error) {
+	var level slog.Level
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		if err := level.UnmarshalText([]byte(v)); err != nil {
+			return nil, fmt.Errorf("LOG_LEVEL: %w", err)
+		}
+	}
+	opts := &slog.HandlerOptions{Level: level}
+
+	var h slog.Handler
+	switch f := os.Getenv("LOG_FORMAT"); f {
+	case "", "json":
+		h = slog.NewJSONHandler(os.Stdout, opts)
+	case "text":
+		h = slog.NewTextHandler(os.Stdout, opts)
+	default:
+		return nil, fmt.Errorf("LOG_FORMAT: unknown format %q", f)
+	}
+	l := slog.New(h)
+	slog.SetDefault(l)
+	return l, nil
+}
+
+// With returns a copy of ctx carrying l
+func With(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// From returns the logger carried by ctx, or the default logger
+func From(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(ctxKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// FromRequest returns the request logger with the matched route and, on
+// /servers/{id} routes, the server ID added
+func FromRequest(r *http.Request) *slog.Logger {
+	return From(r.Context()).With(routeAttrs(r)...)
+}
+
+// Principal names the API caller: "api", or "api:<name>" when the client
+// identifies itself with the X-Actor header
+func Principal(r *http.Request) string {
+	return PrincipalOf("api", r.Header.Get("X-Actor"))
+}
+
+// PrincipalOf names a caller of the given transport ("api", "grpc") that
+// may identify itself as actor
+func PrincipalOf(transport, actor string) string {
+	if a := strings.TrimSpace(actor); a != "" {
+		return transport + ":" + a
+	}
+	return transport
+}
+
+func routeAttrs(r *http.Request) []any {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil || rctx.RoutePattern() == "" {
+		return nil
+	}
+	route := rctx.RoutePattern()
+	attrs := []any{"route", route}
+	if strings.HasPrefix(route, "/servers/{id}") {
+		attrs = append(attrs, "server_id", rctx.URLParam("id"))
+	}
+	return attrs
+}
+
+// Middleware puts a request logger (request ID, method, principal and trace
+// ID) in the request context and writes one access log line per request. It
+// must run after middleware.RequestID and telemetry.Middleware.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		l := slog.Default().With(
+			"request_id", middleware.GetReqID(r.Context()),
+			"method", r.Method,
+			"principal", Principal(r),
+		)
+		if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+			l = l.With("trace_id", sc.TraceID().String())
+		}
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(With(r.Context(), l)))
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		level := slog.LevelInfo
+		if status >= 500 {
+			level = slog.LevelError
+		}
+		attrs := append(routeAttrs(r),
+			"path", r.URL.Path,
+			"status", status,
+			"bytes", ww.BytesWritten(),
+			"latency_ms", float64(time.Since(start).Microseconds())/1000,
+			"remote_addr", r.RemoteAddr,
+		)
+		l.Log(r.Context(), level, "request", attrs...)
+	})
+}
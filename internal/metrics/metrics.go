@@ -0,0 +1,218 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"virtualservers/internal/domain"
+	"virtualservers/internal/repository"
+)
+
+const namespace = "virt"
+
+// Metrics updated by handlers and daemons
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, chi route pattern and status code.",
+	}, []string{"method", "route", "code"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method and chi route pattern.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	BillingLastSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "billing_last_success_timestamp_seconds",
+		Help:      "Unix time of the last successful billing daemon tick.",
+	})
+
+	BillingRowsUpdated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "billing_rows_updated_total",
+		Help:      "Server rows updated by the billing daemon.",
+	})
+
+	BillingErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "billing_errors_total",
+		Help:      "Failed billing daemon ticks.",
+	})
+
+	ReaperTerminations = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reaper_terminations_total",
+		Help:      "Servers terminated by the idle reaper.",
+	})
+
+	ReaperWarnings = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reaper_warnings_total",
+		Help:      "Pre-termination warnings sent by the idle reaper.",
+	})
+
+	ReaperLastRun = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "reaper_last_run_timestamp_seconds",
+		Help:      "Unix time of the last successful idle reaper run.",
+	})
+
+	TransitionsCompleted = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transitions_completed_total",
+		Help:      "Simulated STARTING/STOPPING/TERMINATING transitions completed.",
+	})
+
+	ChaosFaults = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "chaos_faults_total",
+		Help:      "Faults injected by chaos mode, by fault.",
+	}, []string{"fault"})
+
+	OperationsCompleted = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "operations_completed_total",
+		Help:      "Long-running operations (e.g. snapshots) completed, successfully or not.",
+	})
+
+	IsLeader = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "leader_is_leader",
+		Help:      "1 if this replica holds the daemons leader lease.",
+	})
+
+	LeaderToken = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "leader_fencing_token",
+		Help:      "Fencing token of the lease while this replica leads, else 0.",
+	})
+)
+
+// Handler registers every collector on a fresh registry and returns the
+// /metrics handler
+func Handler(store *repository.Store, db *sql.DB) http.Handler {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewDBStatsCollector(db, "virt"),
+		httpRequests, httpDuration,
+		BillingLastSuccess, BillingRowsUpdated, BillingErrors,
+		ReaperTerminations, ReaperWarnings, ReaperLastRun,
+		TransitionsCompleted, OperationsCompleted, ChaosFaults,
+		IsLeader, LeaderToken,
+		&inventoryCollector{store: store},
+	)
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+}
+
+// Middleware counts requests and observes latency per chi route pattern.
+// Unrouted requests are labelled "unmatched" to keep cardinality bounded.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		httpRequests.WithLabelValues(r.Method, route, strconv.Itoa(status)).Inc()
+		httpDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+var (
+	serversDesc = prometheus.NewDesc(namespace+"_servers",
+		"Servers by status, region and type.", []string{"status", "region", "type"}, nil)
+	ipPoolDesc = prometheus.NewDesc(namespace+"_ip_pool_addresses",
+		"IP pool addresses per region and state (allocated/free).", []string{"region", "state"}, nil)
+	zoneImpairedDesc = prometheus.NewDesc(namespace+"_zone_impaired",
+		"1 while an availability zone is marked impaired, else 0.", []string{"region", "zone"}, nil)
+	hostVCPUsDesc = prometheus.NewDesc(namespace+"_host_vcpus",
+		"Host vCPUs by state (used/free); hosts in maintenance have none free.", []string{"zone", "host", "state"}, nil)
+	hostMemoryDesc = prometheus.NewDesc(namespace+"_host_memory_mib",
+		"Host memory in MiB by state (used/free); hosts in maintenance have none free.", []string{"zone", "host", "state"}, nil)
+)
+
+// inventoryCollector queries server and IP pool counts, zone health and host
+// capacity at scrape time
+type inventoryCollector struct {
+	store *repository.Store
+}
+
+func (c *inventoryCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- serversDesc
+	ch <- ipPoolDesc
+	ch <- zoneImpairedDesc
+	ch <- hostVCPUsDesc
+	ch <- hostMemoryDesc
+}
+
+func (c *inventoryCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	servers, err := c.store.ServerCounts(ctx)
+	if err != nil {
+		slog.Error("metrics: server counts failed", "err", err)
+	}
+	for _, s := range servers {
+		ch <- prometheus.MustNewConstMetric(serversDesc, prometheus.GaugeValue, float64(s.Count), s.Status, s.Region, s.Type)
+	}
+
+	pools, err := c.store.IPPoolCounts(ctx)
+	if err != nil {
+		slog.Error("metrics: ip pool counts failed", "err", err)
+	}
+	for _, p := range pools {
+		ch <- prometheus.MustNewConstMetric(ipPoolDesc, prometheus.GaugeValue, float64(p.Allocated), p.Region, "allocated")
+		ch <- prometheus.MustNewConstMetric(ipPoolDesc, prometheus.GaugeValue, float64(p.Free), p.Region, "free")
+	}
+
+	zones, err := c.store.ListZones(ctx, "")
+	if err != nil {
+		slog.Error("metrics: zones failed", "err", err)
+	}
+	for _, z := range zones {
+		v := 0.0
+		if z.Impaired {
+			v = 1
+		}
+		ch <- prometheus.MustNewConstMetric(zoneImpairedDesc, prometheus.GaugeValue, v, z.Region, z.Name)
+	}
+
+	hosts, err := c.store.ListHosts(ctx, repository.HostFilter{})
+	if err != nil {
+		slog.Error("metrics: hosts failed", "err", err)
+	}
+	for _, h := range hosts {
+		freeVCPUs, freeMemory := h.VCPUs-h.UsedVCPUs, h.MemoryMiB-h.UsedMemoryMiB
+		if h.Status != domain.HostActive {
+			freeVCPUs, freeMemory = 0, 0
+		}
+		ch <- prometheus.MustNewConstMetric(hostVCPUsDesc, prometheus.GaugeValue, float64(h.UsedVCPUs), h.Zone, h.Name, "used")
+		ch <- prometheus.MustNewConstMetric(hostVCPUsDesc, prometheus.GaugeValue, float64(freeVCPUs), h.Zone, h.Name, "free")
+		ch <- prometheus.MustNewConstMetric(hostMemoryDesc, prometheus.GaugeValue, float64(h.UsedMemoryMiB), h.Zone, h.Name, "used")
+		ch <- prometheus.MustNewConstMetric(hostMemoryDesc, prometheus.GaugeValue, float64(freeMemory), h.Zone, h.Name, "free")
+	}
+}
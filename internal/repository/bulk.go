@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"virtualservers/internal/domain"
+)
+
+// BulkTarget is a server selected for a bulk action, with its status at
+// selection time
+type BulkTarget struct {
+	ID     string
+	Status string
+}
+
+// BulkTargetsByID loads the given servers, keyed by ID. Unknown IDs are
+// absent from the map.
+func (s *Store) BulkTargetsByID(ctx context.Context, ids []string) (map[string]BulkTarget, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+	SELECT id::text, status::text
+	FROM servers
+	WHERE id::text = ANY($1)
+	`, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[string]BulkTarget{}
+	for rows.Next() {
+		var t BulkTarget
+		if err := rows.Scan(&t.ID, &t.Status); err != nil {
+			return nil, err
+		}
+		out[t.ID] = t
+	}
+	return out, rows.Err()
+}
+
+// BulkTargetsMatching returns the servers matching f (Limit and Offset are
+// ignored), oldest first. Terminated servers are skipped unless f.Status
+// asks for them. More than max matches is a *domain.ValidationError.
+func (s *Store) BulkTargetsMatching(ctx context.Context, f ListFilters, max int) ([]BulkTarget, error) {
+	where, args := listConds(f)
+	if f.Status == "" {
+		if where == "" {
+			where = " WHERE s.status <> 'TERMINATED'"
+		} else {
+			where += " AND s.status <> 'TERMINATED'"
+		}
+	}
+	args = append(args, max+1)
+	rows, err := s.DB.QueryContext(ctx, `
+	SELECT s.id::text, s.status::text
+	FROM servers s`+where+`
+	ORDER BY s.created_at, s.id
+	LIMIT `+fmt.Sprintf("$%d", len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []BulkTarget
+	for rows.Next() {
+		var t BulkTarget
+		if err := rows.Scan(&t.ID, &t.Status); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(out) > max {
+		return nil, &domain.ValidationError{Message: fmt.Sprintf("filter matches more than %d servers; narrow it down", max)}
+	}
+	return out, nil
+}
+
+// PreviewAction reports what ApplyAction(id, action) would do right now
+// without changing anything: the resulting status, or the error ApplyAction
+// would return. Whether a server fits on a host of its zone is checked
+// without locking the hosts, so a concurrent placement may still take the
+// room the preview saw.
+func (s *Store) PreviewAction(ctx context.Context, id, action string) (string, error) {
+	var current, target, queued, host, zone, typ string
+	err := s.DB.QueryRowContext(ctx, `
+	SELECT status::text,COALESCE(transition_target,''),COALESCE(queued_action,''),
+	COALESCE(host_id::text,''),COALESCE(zone,''),type
+	FROM servers WHERE id=$1`, id).Scan(&current, &target, &queued, &host, &zone, &typ)
+	if err != nil {
+		return "", err
+	}
+	status, err := s.previewStatus(current, target, queued, action)
+	if err != nil {
+		return "", err
+	}
+	if err := checkAction(ctx, s.DB, id, action); err != nil {
+		return "", err
+	}
+	// A queued action is only placed once the transition completes
+	if !domain.IsTransitional(current) && host == "" && domain.HoldsHost(status) {
+		if _, err := pickHost(ctx, s.DB, zone, typ, id, ""); err != nil {
+			return "", err
+		}
+	}
+	return status, nil
+}
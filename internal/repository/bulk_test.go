@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"virtualservers/internal/domain"
+)
+
+func TestPreviewActionCapacity(t *testing.T) {
+	s := testStore(t)
+	ctx := context.Background()
+	newZone(t, s, "us-east-1t", [2]int{1, 1024})
+	a := newServer(t, s, "fits", "us-east-1t")
+	b := newServer(t, s, "does-not-fit", "us-east-1t")
+
+	if status, err := s.PreviewAction(ctx, a, "start"); err != nil || status != "RUNNING" {
+		t.Fatalf("preview start on a free host = %s, %v", status, err)
+	}
+	if _, err := s.ApplyAction(ctx, a, "start"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := s.PreviewAction(ctx, b, "start")
+	var ice *domain.InsufficientCapacityError
+	if !errors.As(err, &ice) {
+		t.Fatalf("preview start on a full zone = %v, want insufficient capacity", err)
+	}
+	if _, err := s.ApplyAction(ctx, b, "start"); !errors.As(err, &ice) {
+		t.Fatalf("start on a full zone = %v, want insufficient capacity", err)
+	}
+	// The running server keeps its host, so rebooting it needs no room
+	if status, err := s.PreviewAction(ctx, a, "reboot"); err != nil || status != "REBOOTING" {
+		t.Fatalf("preview reboot = %s, %v", status, err)
+	}
+	if d := server(t, s, b); d.Status != "STOPPED" || d.HostID != nil {
+		t.Fatalf("preview changed the server: %s on %v", d.Status, d.HostID)
+	}
+}
@@ -0,0 +1,158 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"virtualservers/internal/chaos"
+	"virtualservers/internal/domain"
+)
+
+// ChaosTarget is a RUNNING server the chaos monkey may crash
+type ChaosTarget struct {
+	ID     string
+	Region string
+	Labels map[string]string
+}
+
+// GetChaosConfig returns the stored fault injection settings; the zero
+// Config (disabled) when none were saved
+func (s *Store) GetChaosConfig(ctx context.Context) (chaos.Config, error) {
+	cfg := chaos.Config{Regions: []string{}, Selector: map[string]string{}}
+	var raw []byte
+	var updated time.Time
+	err := s.DB.QueryRowContext(ctx, `SELECT config, updated_at FROM chaos_config`).Scan(&raw, &updated)
+	if err == sql.ErrNoRows {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return cfg, err
+	}
+	cfg.UpdatedAt = updated
+	return cfg, nil
+}
+
+// SaveChaosConfig replaces the fault injection settings and returns them
+// with their new UpdatedAt
+func (s *Store) SaveChaosConfig(ctx context.Context, cfg chaos.Config) (chaos.Config, error) {
+	raw, err := json.Marshal(cfg)
+	if err != nil {
+		return cfg, err
+	}
+	err = s.DB.QueryRowContext(ctx, `
+	INSERT INTO chaos_config (config) VALUES ($1::jsonb)
+	ON CONFLICT (id) DO UPDATE SET config = EXCLUDED.config, updated_at = now()
+	RETURNING updated_at
+	`, string(raw)).Scan(&cfg.UpdatedAt)
+	return cfg, err
+}
+
+// RunningServers lists RUNNING servers in creation order, the order the
+// chaos monkey draws crashes in
+func (s *Store) RunningServers(ctx context.Context) ([]ChaosTarget, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+	SELECT id, region, labels FROM servers WHERE status = 'RUNNING' ORDER BY created_at, id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []ChaosTarget
+	for rows.Next() {
+		var t ChaosTarget
+		var labels []byte
+		if err := rows.Scan(&t.ID, &t.Region, &labels); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(labels, &t.Labels); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// CrashServer stops a RUNNING server at once, as if it had crashed, and
+// records a crash event; false means it was no longer RUNNING
+func (s *Store) CrashServer(ctx context.Context, id string) (bool, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	if err := checkFence(ctx, tx); err != nil {
+		return false, err
+	}
+	cur, err := lockServer(ctx, tx, id)
+	if err != nil {
+		return false, err
+	}
+	if cur.status != "RUNNING" {
+		return false, nil
+	}
+	updates := append(s.billingUpdates(cur.status, "STOPPED"), arrivalUpdates("stop")...)
+	updates = append(updates, clearTransitionSQL)
+	data, err := cur.update(ctx, tx, "STOPPED", updates)
+	if err != nil {
+		return false, err
+	}
+	data["previous_status"] = "RUNNING"
+	data["new_status"] = "STOPPED"
+	data["reason"] = "chaos"
+	if err := recordEvent(ctx, tx, id, "crash", "server crashed (RUNNING -> STOPPED)", data); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// checkRebootStuck refuses to complete a reboot fault injection left stuck
+func checkRebootStuck(ctx context.Context, q querier, id string) error {
+	var until sql.NullTime
+	err := q.QueryRowContext(ctx, `
+	SELECT reboot_stuck_until FROM servers WHERE id=$1 AND reboot_stuck_until > now()
+	`, id).Scan(&until)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return &domain.RebootStuckError{Until: until.Time}
+}
+
+// injectStuckReboot draws whether a reboot just applied gets stuck and, if
+// so, records until when
+func (s *Store) injectStuckReboot(ctx context.Context, tx *sql.Tx, id string) error {
+	if !s.Chaos.Config().Enabled {
+		return nil
+	}
+	var region string
+	var raw []byte
+	if err := tx.QueryRowContext(ctx, `SELECT region, labels FROM servers WHERE id=$1`, id).Scan(&region, &raw); err != nil {
+		return err
+	}
+	var labels map[string]string
+	if err := json.Unmarshal(raw, &labels); err != nil {
+		return err
+	}
+	if !s.Chaos.Inject(chaos.FaultStuckReboot, region, labels) {
+		return nil
+	}
+	var until time.Time
+	err := tx.QueryRowContext(ctx, `
+	UPDATE servers SET reboot_stuck_until = now() + $2 * interval '1 second' WHERE id=$1
+	RETURNING reboot_stuck_until
+	`, id, int64(s.Chaos.StuckFor().Seconds())).Scan(&until)
+	if err != nil {
+		return err
+	}
+	return recordEvent(ctx, tx, id, "reboot_stuck", "reboot stuck (injected fault)", map[string]any{
+		"stuck_until": until,
+		"reason":      "chaos",
+	})
+}
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"virtualservers/internal/chaos"
+	"virtualservers/internal/domain"
+)
+
+// withChaos makes s inject faults by cfg
+func withChaos(s *Store, cfg chaos.Config) {
+	cfg.Enabled = true
+	s.Chaos = chaos.NewEngine()
+	s.Chaos.Set(cfg)
+}
+
+func TestLiveResizeStuckReboot(t *testing.T) {
+	s := testStore(t)
+	ctx := context.Background()
+	id := newServer(t, s, "stuck", "")
+	if _, err := s.ApplyAction(ctx, id, "start"); err != nil {
+		t.Fatal(err)
+	}
+	withChaos(s, chaos.Config{StuckRebootProbability: 1, StuckRebootSeconds: 300})
+
+	res, err := s.Resize(ctx, id, "t2.small", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != "REBOOTING" {
+		t.Fatalf("live resize left the server %s", res.Status)
+	}
+	var rse *domain.RebootStuckError
+	if _, err := s.ApplyAction(ctx, id, "complete-reboot"); !errors.As(err, &rse) {
+		t.Fatalf("complete-reboot after a stuck live resize = %v, want reboot stuck", err)
+	}
+	logs, err := s.GetServerLogs(ctx, id, LogFilter{Events: []string{"reboot_stuck"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 1 {
+		t.Fatalf("%d reboot_stuck events, want 1", len(logs))
+	}
+}
+
+func TestCrashServer(t *testing.T) {
+	s := testStore(t)
+	ctx := context.Background()
+	hosts := newZone(t, s, "us-east-1t", [2]int{16, 65536})
+	id := newServer(t, s, "crash", "us-east-1t")
+	if crashed, err := s.CrashServer(ctx, id); err != nil || crashed {
+		t.Fatalf("crashing a stopped server = %v, %v", crashed, err)
+	}
+	if _, err := s.ApplyAction(ctx, id, "start"); err != nil {
+		t.Fatal(err)
+	}
+	if crashed, err := s.CrashServer(ctx, id); err != nil || !crashed {
+		t.Fatalf("CrashServer = %v, %v", crashed, err)
+	}
+	if d := server(t, s, id); d.Status != "STOPPED" || d.HostID != nil {
+		t.Fatalf("crashed server is %s on %v", d.Status, d.HostID)
+	}
+	h, err := s.GetHost(ctx, hosts[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.ServerIDs) != 0 || h.UsedVCPUs != 0 {
+		t.Fatalf("host still holds %v (%d vCPUs)", h.ServerIDs, h.UsedVCPUs)
+	}
+	logs, err := s.GetServerLogs(ctx, id, LogFilter{Events: []string{"crash"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 1 {
+		t.Fatalf("%d crash events, want 1", len(logs))
+	}
+}
+
+func TestProvisionFailure(t *testing.T) {
+	s := testStore(t)
+	ctx := context.Background()
+	withChaos(s, chaos.Config{ProvisionFailureProbability: 1, Regions: []string{"us-east-1"}})
+
+	counts := func() (servers, allocated int) {
+		t.Helper()
+		if err := s.DB.QueryRow(`SELECT (SELECT count(*) FROM servers), (SELECT count(*) FROM ip_pool WHERE allocated)`).Scan(&servers, &allocated); err != nil {
+			t.Fatal(err)
+		}
+		return servers, allocated
+	}
+	servers, allocated := counts()
+	var pfe *domain.ProvisionFailedError
+	if _, err := s.CreateServer(ctx, NewServer{Name: "doomed", Region: "us-east-1", Type: "t2.micro"}); !errors.As(err, &pfe) {
+		t.Fatalf("create = %v, want provision failed", err)
+	}
+	if n, a := counts(); n != servers || a != allocated {
+		t.Fatalf("failed provision left %d servers and %d addresses behind", n-servers, a-allocated)
+	}
+	// Out of scope regions provision as usual
+	if _, err := s.CreateServer(ctx, NewServer{Name: "fine", Region: "eu-west-1", Type: "t2.micro"}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,160 @@
+package repository
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	// cursorWindow is how far below the highest id an event can still
+	// commit and be streamed. Ids are taken from a sequence at insert time,
+	// so a transaction that commits late lands below events already sent.
+	cursorWindow = 10000
+	// maxCursorGaps bounds the missing ids carried in an encoded cursor
+	maxCursorGaps = 64
+)
+
+// EventCursor tracks a stream's position. Rather than a strictly
+// increasing id it keeps the ids sent within a window below the highest
+// one, so a late commit is still sent and a duplicate is not, and the ids
+// not yet seen below the highest, so a resumed stream replays those too.
+//
+// Encoded (String) as the highest id, followed by the missing ids when
+// there are any: "1042" or "1042:1039,1040".
+type EventCursor struct {
+	high int64
+	// floor is the resume point: ids at or below it were handled by the
+	// previous stream unless listed in missing
+	floor   int64
+	seen    map[int64]struct{}
+	missing map[int64]struct{}
+	// live is set once replay is done; gaps are only tracked between ids
+	// observed live, since replay only returns the ids matching the filter
+	live, started bool
+}
+
+// ParseEventCursor decodes a cursor from String, or a plain event id. An
+// empty string starts from the live stream.
+func ParseEventCursor(s string) (*EventCursor, error) {
+	c := &EventCursor{seen: map[int64]struct{}{}, missing: map[int64]struct{}{}}
+	if s == "" {
+		return c, nil
+	}
+	head, gaps, _ := strings.Cut(s, ":")
+	high, err := strconv.ParseInt(head, 10, 64)
+	if err != nil || high < 0 {
+		return nil, fmt.Errorf("invalid event cursor %q", s)
+	}
+	c.high, c.floor = high, high
+	for _, g := range splitCursorGaps(gaps) {
+		id, err := strconv.ParseInt(g, 10, 64)
+		if err != nil || id >= high {
+			return nil, fmt.Errorf("invalid event cursor %q", s)
+		}
+		if id > high-cursorWindow {
+			c.missing[id] = struct{}{}
+		}
+	}
+	return c, nil
+}
+
+func splitCursorGaps(v string) []string {
+	if v == "" {
+		return nil
+	}
+	return strings.Split(v, ",")
+}
+
+// After is the id to replay from; zero means nothing to replay
+func (c *EventCursor) After() int64 {
+	return c.floor
+}
+
+// Missing returns the ids below After still to be replayed, ascending
+func (c *EventCursor) Missing() []int64 {
+	out := make([]int64, 0, len(c.missing))
+	for id := range c.missing {
+		if id <= c.floor {
+			out = append(out, id)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+// Live marks the end of replay
+func (c *EventCursor) Live() {
+	c.live = true
+}
+
+// Accept records id and reports whether the stream has not seen it yet.
+// Live streams pass every event, matching or not, so that ids skipped by
+// the filter are not mistaken for gaps.
+func (c *EventCursor) Accept(id int64) bool {
+	if id <= c.high-cursorWindow {
+		return false
+	}
+	if _, ok := c.seen[id]; ok {
+		return false
+	}
+	if _, ok := c.missing[id]; ok {
+		delete(c.missing, id)
+	} else if id <= c.floor {
+		return false
+	}
+	c.seen[id] = struct{}{}
+	if id > c.high {
+		if c.started {
+			for g := max(c.high, id-cursorWindow) + 1; g < id; g++ {
+				c.missing[g] = struct{}{}
+			}
+		}
+		c.high = id
+		if len(c.seen)+len(c.missing) > 2*cursorWindow {
+			c.prune()
+		}
+	}
+	if c.live {
+		c.started = true
+	}
+	return true
+}
+
+// prune forgets ids that fell out of the window
+func (c *EventCursor) prune() {
+	low := c.high - cursorWindow
+	for id := range c.seen {
+		if id <= low {
+			delete(c.seen, id)
+		}
+	}
+	for id := range c.missing {
+		if id <= low {
+			delete(c.missing, id)
+		}
+	}
+}
+
+func (c *EventCursor) String() string {
+	s := strconv.FormatInt(c.high, 10)
+	var gaps []int64
+	for id := range c.missing {
+		if id > c.high-cursorWindow {
+			gaps = append(gaps, id)
+		}
+	}
+	if len(gaps) == 0 {
+		return s
+	}
+	slices.Sort(gaps)
+	if len(gaps) > maxCursorGaps {
+		gaps = gaps[len(gaps)-maxCursorGaps:]
+	}
+	parts := make([]string, len(gaps))
+	for i, id := range gaps {
+		parts[i] = strconv.FormatInt(id, 10)
+	}
+	return s + ":" + strings.Join(parts, ",")
+}
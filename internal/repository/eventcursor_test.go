@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// accept feeds ids to c and returns the ones it lets through
+func accept(c *EventCursor, ids ...int64) []int64 {
+	var out []int64
+	for _, id := range ids {
+		if c.Accept(id) {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+func TestEventCursorLateCommit(t *testing.T) {
+	c, err := ParseEventCursor("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Live()
+	// 12 commits after 13 and 14; 13 is delivered twice
+	got := accept(c, 10, 11, 13, 14, 13, 12, 14)
+	if want := []int64{10, 11, 13, 14, 12}; !slices.Equal(got, want) {
+		t.Fatalf("accepted %v, want %v", got, want)
+	}
+	if s := c.String(); s != "14" {
+		t.Fatalf("cursor = %q, want 14", s)
+	}
+}
+
+func TestEventCursorGaps(t *testing.T) {
+	c, _ := ParseEventCursor("")
+	c.Live()
+	accept(c, 100, 101, 104, 106)
+	if s := c.String(); s != "106:102,103,105" {
+		t.Fatalf("cursor = %q", s)
+	}
+	accept(c, 103)
+	if s := c.String(); s != "106:102,105" {
+		t.Fatalf("cursor = %q after a late commit", s)
+	}
+}
+
+func TestEventCursorResume(t *testing.T) {
+	c, err := ParseEventCursor("106:102,105")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.After() != 106 || !slices.Equal(c.Missing(), []int64{102, 105}) {
+		t.Fatalf("After = %d, Missing = %v", c.After(), c.Missing())
+	}
+	// Replay returns the late commit 105 and what came after; everything
+	// else at or below 106 was sent by the previous stream
+	if got := accept(c, 105, 107); !slices.Equal(got, []int64{105, 107}) {
+		t.Fatalf("replay accepted %v", got)
+	}
+	c.Live()
+	if got := accept(c, 101, 104, 106, 107, 102, 108); !slices.Equal(got, []int64{102, 108}) {
+		t.Fatalf("live accepted %v", got)
+	}
+	if s := c.String(); s != "108" {
+		t.Fatalf("cursor = %q", s)
+	}
+}
+
+func TestEventCursorReplayNoGaps(t *testing.T) {
+	// A filtered replay skips ids; they are not gaps
+	c, _ := ParseEventCursor("10")
+	accept(c, 15, 40)
+	c.Live()
+	accept(c, 41, 43)
+	if s := c.String(); s != "43:42" {
+		t.Fatalf("cursor = %q", s)
+	}
+}
+
+func TestEventCursorWindow(t *testing.T) {
+	c, _ := ParseEventCursor("")
+	c.Live()
+	accept(c, 1, 2, 2+cursorWindow+5)
+	if c.Accept(3) {
+		t.Fatal("accepted an id below the window")
+	}
+	_, gaps, _ := strings.Cut(c.String(), ":")
+	if n := len(strings.Split(gaps, ",")); n != maxCursorGaps {
+		t.Fatalf("cursor carries %d gaps, want %d", n, maxCursorGaps)
+	}
+}
+
+func TestParseEventCursor(t *testing.T) {
+	for _, tc := range []struct {
+		in string
+		ok bool
+	}{
+		{"", true},
+		{"42", true},
+		{"42:40,41", true},
+		{"x", false},
+		{"-1", false},
+		{"42:43", false},
+		{"42:a", false},
+	} {
+		_, err := ParseEventCursor(tc.in)
+		if (err == nil) != tc.ok {
+			t.Errorf("ParseEventCursor(%q) err = %v", tc.in, err)
+		}
+	}
+}
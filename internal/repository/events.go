@@ -0,0 +1,243 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// EventChannel is the LISTEN/NOTIFY channel fed by the server_events trigger
+const EventChannel = "server_events"
+
+type ctxKey int
+
+const (
+	actorKey ctxKey = iota
+	operationKey
+	fenceKey
+)
+
+// WithActor records who is performing the changes made with ctx, e.g.
+// "api:alice", "reaper" or "schedule:<id>". It ends up in event data.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey, actor)
+}
+
+// ActorFrom returns the actor set by WithActor, or "system"
+func ActorFrom(ctx context.Context) string {
+	if a, ok := ctx.Value(actorKey).(string); ok && a != "" {
+		return a
+	}
+	return "system"
+}
+
+// WithOperationID tags the changes made with ctx with an operation ID
+// (the request ID for API calls) so related events can be grouped.
+func WithOperationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, operationKey, id)
+}
+
+func OperationIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(operationKey).(string)
+	return id
+}
+
+// LogFilter narrows GetServerLogs; zero values mean no restriction
+type LogFilter struct {
+	Events []string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+}
+
+type EventFilter struct {
+	ServerID string
+	Events   []string
+	Labels   map[string]string
+}
+
+// Match reports whether ev passes the filter. Labels are compared against
+// the labels of the server the event belongs to.
+func (f EventFilter) Match(ev ServerEvent) bool {
+	if f.ServerID != "" && ev.ServerID != f.ServerID {
+		return false
+	}
+	if len(f.Events) > 0 {
+		found := false
+		for _, e := range f.Events {
+			if e == ev.Event {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for k, v := range f.Labels {
+		if ev.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseLabelSelector parses "key=value,key2=value2" into a map
+func ParseLabelSelector(sel string) (map[string]string, error) {
+	sel = strings.TrimSpace(sel)
+	if sel == "" {
+		return nil, nil
+	}
+	labels := map[string]string{}
+	for _, part := range strings.Split(sel, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid label selector %q", part)
+		}
+		labels[k] = strings.TrimSpace(v)
+	}
+	return labels, nil
+}
+
+// ListEventsAfter returns events with id > afterID, and those among also
+// (ids below afterID that committed late), in ascending id order. Used to
+// replay a stream from an EventCursor.
+func (s *Store) ListEventsAfter(ctx context.Context, f EventFilter, afterID int64, also []int64, limit int) ([]ServerEvent, error) {
+	if limit <= 0 || limit > 1000 {
+		limit = 500
+	}
+	conds := []string{"e.id > $1"}
+	args := []any{afterID}
+	argn := 2
+	if len(also) > 0 {
+		conds[0] = "(e.id > $1 OR e.id = ANY($2))"
+		args = append(args, also)
+		argn++
+	}
+
+	if f.ServerID != "" {
+		conds = append(conds, fmt.Sprintf("e.server_id=$%d", argn))
+		args = append(args, f.ServerID)
+		argn++
+	}
+	if len(f.Events) > 0 {
+		conds = append(conds, fmt.Sprintf("e.event = ANY($%d)", argn))
+		args = append(args, f.Events)
+		argn++
+	}
+	if len(f.Labels) > 0 {
+		b, _ := json.Marshal(f.Labels)
+		conds = append(conds, fmt.Sprintf("s.labels @> $%d::jsonb", argn))
+		args = append(args, string(b))
+		argn++
+	}
+	query := `
+	SELECT e.id, e.server_id, e.ts, e.event, COALESCE(e.message,''), e.data, s.labels
+	FROM server_events e
+	JOIN servers s ON s.id = e.server_id
+	WHERE ` + strings.Join(conds, " AND ") + `
+	ORDER BY e.id
+	LIMIT ` + fmt.Sprintf("$%d", argn)
+	args = append(args, limit)
+
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []ServerEvent
+	for rows.Next() {
+		ev, err := scanStreamEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, *ev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// GetEvent loads a single event together with its server's labels.
+// Returns nil when the event does not exist.
+func (s *Store) GetEvent(ctx context.Context, id int64) (*ServerEvent, error) {
+	row := s.DB.QueryRowContext(ctx, `
+	SELECT e.id, e.server_id, e.ts, e.event, COALESCE(e.message,''), e.data, s.labels
+	FROM server_events e
+	JOIN servers s ON s.id = e.server_id
+	WHERE e.id=$1
+	`, id)
+	ev, err := scanStreamEvent(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return ev, err
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanStreamEvent(row rowScanner) (*ServerEvent, error) {
+	var ev ServerEvent
+	var data, labels []byte
+	if err := row.Scan(&ev.ID, &ev.ServerID, &ev.Timestamp, &ev.Event, &ev.Message, &data, &labels); err != nil {
+		return nil, err
+	}
+	ev.Data = data
+	if err := json.Unmarshal(labels, &ev.Labels); err != nil {
+		return nil, err
+	}
+	return &ev, nil
+}
+
+// ListenEvents holds a dedicated connection LISTENing on EventChannel and
+// calls fn with the id of every committed event. It blocks until ctx is
+// cancelled or the connection fails.
+func (s *Store) ListenEvents(ctx context.Context, fn func(id int64)) error {
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		// Instrumented drivers (otelsql) wrap the pgx connection
+		for {
+			w, ok := driverConn.(interface{ Raw() driver.Conn })
+			if !ok {
+				break
+			}
+			driverConn = w.Raw()
+		}
+		sc, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("listen: unsupported driver connection %T", driverConn)
+		}
+		pc := sc.Conn()
+		if _, err := pc.Exec(ctx, "LISTEN "+EventChannel); err != nil {
+			return err
+		}
+		for {
+			n, err := pc.WaitForNotification(ctx)
+			if err != nil {
+				return err
+			}
+			id, err := strconv.ParseInt(n.Payload, 10, 64)
+			if err != nil {
+				continue
+			}
+			fn(id)
+		}
+	})
+}
@@ -0,0 +1,394 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"virtualservers/internal/domain"
+)
+
+type Host struct {
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	Region        string `json:"region"`
+	Zone          string `json:"zone"`
+	Status        string `json:"status"`
+	VCPUs         int    `json:"vcpus"`
+	MemoryMiB     int    `json:"memory_mib"`
+	UsedVCPUs     int    `json:"used_vcpus"`
+	UsedMemoryMiB int    `json:"used_memory_mib"`
+	// ServerIDs are the servers holding capacity on the host
+	ServerIDs         []string   `json:"server_ids"`
+	MaintenanceReason string     `json:"maintenance_reason,omitempty"`
+	MaintenanceAt     *time.Time `json:"maintenance_at,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+type HostFilter struct {
+	Region string
+	Zone   string
+	Status string
+}
+
+// HostMove is a server live-migrated off a drained host
+type HostMove struct {
+	ServerID string `json:"server_id"`
+	Status   string `json:"status"`
+	HostID   string `json:"host_id"`
+}
+
+// DrainReport is the outcome of putting a host into maintenance
+type DrainReport struct {
+	Host     *Host      `json:"host"`
+	Migrated []HostMove `json:"migrated"`
+	Stopped  []string   `json:"stopped"`
+}
+
+const hostSelect = `
+	SELECT h.id, h.name, h.region, h.zone, h.status, h.vcpus, h.memory_mib,
+	       COALESCE(u.vcpus, 0), COALESCE(u.memory_mib, 0),
+	       ARRAY(SELECT id::text FROM servers WHERE host_id = h.id ORDER BY id),
+	       COALESCE(h.maintenance_reason,''), h.maintenance_at, h.created_at, h.updated_at
+	FROM hosts h
+	LEFT JOIN LATERAL (
+	  SELECT sum(it.vcpus) AS vcpus, sum(it.memory_mib) AS memory_mib
+	  FROM servers s JOIN instance_types it ON it.type = s.type
+	  WHERE s.host_id = h.id
+	) u ON TRUE
+`
+
+func scanHost(row rowScanner) (*Host, error) {
+	var h Host
+	var at sql.NullTime
+	if err := row.Scan(&h.ID, &h.Name, &h.Region, &h.Zone, &h.Status, &h.VCPUs, &h.MemoryMiB,
+		&h.UsedVCPUs, &h.UsedMemoryMiB, textArray(&h.ServerIDs),
+		&h.MaintenanceReason, &at, &h.CreatedAt, &h.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if at.Valid {
+		h.MaintenanceAt = &at.Time
+	}
+	return &h, nil
+}
+
+// CreateHost adds an active host to a zone; names are unique
+func (s *Store) CreateHost(ctx context.Context, h Host) (*Host, error) {
+	if h.VCPUs <= 0 || h.MemoryMiB <= 0 {
+		return nil, &domain.ValidationError{Message: "vcpus and memory_mib must be positive"}
+	}
+	var region string
+	err := s.DB.QueryRowContext(ctx, `SELECT region FROM zones WHERE name=$1`, h.Zone).Scan(&region)
+	if err == sql.ErrNoRows {
+		return nil, &domain.ValidationError{Message: fmt.Sprintf("unknown zone %q", h.Zone)}
+	}
+	if err != nil {
+		return nil, err
+	}
+	var id string
+	err = s.DB.QueryRowContext(ctx, `
+	INSERT INTO hosts (name, region, zone, vcpus, memory_mib)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT DO NOTHING
+	RETURNING id
+	`, h.Name, region, h.Zone, h.VCPUs, h.MemoryMiB).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, &domain.ValidationError{Message: fmt.Sprintf("host %q already exists", h.Name)}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.GetHost(ctx, id)
+}
+
+// ListHosts returns hosts by zone and name with their usage
+func (s *Store) ListHosts(ctx context.Context, f HostFilter) ([]Host, error) {
+	conds := []string{"TRUE"}
+	var args []any
+	add := func(cond string, v any) {
+		args = append(args, v)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if f.Region != "" {
+		add("h.region = $%d", f.Region)
+	}
+	if f.Zone != "" {
+		add("h.zone = $%d", f.Zone)
+	}
+	if f.Status != "" {
+		add("h.status = $%d", strings.ToLower(f.Status))
+	}
+	rows, err := s.DB.QueryContext(ctx, hostSelect+` WHERE `+strings.Join(conds, " AND ")+` ORDER BY h.zone, h.name`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Host
+	for rows.Next() {
+		h, err := scanHost(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *h)
+	}
+	return out, rows.Err()
+}
+
+// GetHost returns nil when the host does not exist
+func (s *Store) GetHost(ctx context.Context, id string) (*Host, error) {
+	h, err := scanHost(s.DB.QueryRowContext(ctx, hostSelect+` WHERE h.id=$1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return h, err
+}
+
+// DeleteHost deletes a host no server is on. Returns sql.ErrNoRows when
+// not found.
+func (s *Store) DeleteHost(ctx context.Context, id string) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var servers int
+	err = tx.QueryRowContext(ctx, `
+	SELECT (SELECT count(*) FROM servers WHERE host_id = h.id) FROM hosts h WHERE id=$1 FOR UPDATE
+	`, id).Scan(&servers)
+	if err != nil {
+		return err
+	}
+	if servers > 0 {
+		return &domain.ResourceStateError{Resource: "host", ID: id, Op: "delete",
+			Reason: fmt.Sprintf("%d server(s) are on it; drain it first", servers)}
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM hosts WHERE id=$1`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DrainHost puts a host into maintenance and empties it: each server is
+// live-migrated to another active host of its zone where it fits (largest
+// first) or, failing that, stopped, all in one transaction. Returns
+// sql.ErrNoRows when the host does not exist.
+func (s *Store) DrainHost(ctx context.Context, id, reason string) (*DrainReport, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	// Maintenance and the drain commit together, so a failed drain leaves
+	// the host as it was. The zone's hosts are locked first, in the order
+	// placement locks them (lockZoneHosts), so no server is placed on this
+	// host meanwhile and a concurrent start cannot deadlock with the drain.
+	var zone string
+	if err := tx.QueryRowContext(ctx, `SELECT zone FROM hosts WHERE id=$1`, id).Scan(&zone); err != nil {
+		return nil, err
+	}
+	if _, err := lockZoneHosts(ctx, tx, zone); err != nil {
+		return nil, err
+	}
+	var hostName string
+	err = tx.QueryRowContext(ctx, `
+	UPDATE hosts
+	SET status='maintenance', maintenance_reason=NULLIF($2,''),
+	    maintenance_at=COALESCE(maintenance_at, now()), updated_at=now()
+	WHERE id=$1
+	RETURNING name
+	`, id, reason).Scan(&hostName)
+	if err != nil {
+		return nil, err
+	}
+	// The servers are locked in id order and then moved largest first
+	rows, err := tx.QueryContext(ctx, `
+	SELECT s.id, it.vcpus, it.memory_mib FROM servers s JOIN instance_types it ON it.type = s.type
+	WHERE s.host_id=$1
+	ORDER BY s.id
+	FOR UPDATE OF s
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	type hosted struct {
+		id            string
+		vcpus, memory int
+	}
+	var servers []hosted
+	for rows.Next() {
+		var h hosted
+		if err := rows.Scan(&h.id, &h.vcpus, &h.memory); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		servers = append(servers, h)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(servers, func(a, b hosted) int {
+		if c := cmp.Compare(b.vcpus, a.vcpus); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.memory, a.memory)
+	})
+
+	report := &DrainReport{Migrated: []HostMove{}, Stopped: []string{}}
+	for _, h := range servers {
+		sid := h.id
+		cur, err := lockServer(ctx, tx, sid)
+		if err != nil {
+			return nil, err
+		}
+		to, err := scheduleHost(ctx, tx, cur.zone, cur.typ, cur.id, "")
+		var ice *domain.InsufficientCapacityError
+		switch {
+		case errors.As(err, &ice):
+			if err := s.stopForMaintenance(ctx, tx, cur, hostName); err != nil {
+				return nil, err
+			}
+			report.Stopped = append(report.Stopped, sid)
+			continue
+		case err != nil:
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE servers SET host_id=$2, updated_at=now() WHERE id=$1`, sid, to); err != nil {
+			return nil, err
+		}
+		msg := fmt.Sprintf("server live-migrated off host %s for maintenance", hostName)
+		if err := recordEvent(ctx, tx, sid, "live_migrated", msg, map[string]any{
+			"previous_host_id": id,
+			"host_id":          to,
+			"status":           cur.status,
+			"reason":           "host_maintenance",
+		}); err != nil {
+			return nil, err
+		}
+		report.Migrated = append(report.Migrated, HostMove{ServerID: sid, Status: cur.status, HostID: to})
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	if report.Host, err = s.GetHost(ctx, id); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// stopForMaintenance stops a server that fits on no other host at once,
+// cutting short any transition it is in
+func (s *Store) stopForMaintenance(ctx context.Context, tx *sql.Tx, cur *lockedServer, hostName string) error {
+	from := cur.status
+	updates := append(s.billingUpdates(from, "STOPPED"), arrivalUpdates("stop")...)
+	updates = append(updates, clearTransitionSQL)
+	data, err := cur.update(ctx, tx, "STOPPED", updates)
+	if err != nil {
+		return err
+	}
+	data["previous_status"] = from
+	data["new_status"] = "STOPPED"
+	data["reason"] = "host_maintenance"
+	msg := fmt.Sprintf("server stop (%s -> STOPPED): no capacity left to migrate it off host %s", from, hostName)
+	return recordEvent(ctx, tx, cur.id, "stop", msg, data)
+}
+
+// ActivateHost ends maintenance; the host takes new servers again
+func (s *Store) ActivateHost(ctx context.Context, id string) (*Host, error) {
+	res, err := s.DB.ExecContext(ctx, `
+	UPDATE hosts
+	SET status='active', maintenance_reason=NULL, maintenance_at=NULL, updated_at=now()
+	WHERE id=$1
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return s.GetHost(ctx, id)
+}
+
+// lockZoneHosts locks every host of zone in id order and returns how many
+// there are. Host locks come before server locks: a drain takes its zone's
+// hosts before the servers on the host, and the paths that may schedule a
+// server still holding a host (a live resize, a transition completing into
+// a queued action) lock the hosts before the server. Start and resume
+// schedule servers that hold no host, which no drain waits for.
+func lockZoneHosts(ctx context.Context, tx *sql.Tx, zone string) (int, error) {
+	var n int
+	err := tx.QueryRowContext(ctx, `
+	SELECT count(*) FROM (SELECT id FROM hosts WHERE zone=$1 ORDER BY id FOR UPDATE) h
+	`, zone).Scan(&n)
+	return n, err
+}
+
+// scheduleHost bin-packs a server of type typ onto an active host of zone,
+// not counting serverID's own usage; prefer, when set and the server still
+// fits there, is kept. The zone's hosts stay locked until the transaction
+// ends so concurrent placements see each other.
+func scheduleHost(ctx context.Context, tx *sql.Tx, zone, typ, serverID, prefer string) (string, error) {
+	if _, err := lockZoneHosts(ctx, tx, zone); err != nil {
+		return "", err
+	}
+	return pickHost(ctx, tx, zone, typ, serverID, prefer)
+}
+
+// pickHost is scheduleHost without the locks. A zone with no hosts at all
+// (a region without zones, or one whose hosts were never added) does not
+// track capacity: its servers run on no host and "" is returned.
+func pickHost(ctx context.Context, q querier, zone, typ, serverID, prefer string) (string, error) {
+	var vcpus, memory int
+	if err := q.QueryRowContext(ctx, `SELECT vcpus, memory_mib FROM instance_types WHERE type=$1`, typ).Scan(&vcpus, &memory); err != nil {
+		return "", err
+	}
+	rows, err := q.QueryContext(ctx, `
+	SELECT h.id, h.name, h.status = 'active',
+	       h.vcpus - COALESCE(sum(it.vcpus), 0),
+	       h.memory_mib - COALESCE(sum(it.memory_mib), 0)
+	FROM hosts h
+	LEFT JOIN servers s ON s.host_id = h.id AND s.id::text <> $2
+	LEFT JOIN instance_types it ON it.type = s.type
+	WHERE h.zone = $1
+	GROUP BY h.id
+	`, zone, serverID)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	hosts := 0
+	var loads []domain.HostLoad
+	for rows.Next() {
+		var l domain.HostLoad
+		var active bool
+		if err := rows.Scan(&l.ID, &l.Name, &active, &l.FreeVCPUs, &l.FreeMemory); err != nil {
+			return "", err
+		}
+		hosts++
+		if !active {
+			continue
+		}
+		if l.ID == prefer && l.FreeVCPUs >= vcpus && l.FreeMemory >= memory {
+			return prefer, nil
+		}
+		loads = append(loads, l)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if hosts == 0 {
+		return "", nil
+	}
+	id, ok := domain.PickHost(loads, vcpus, memory)
+	if !ok {
+		return "", &domain.InsufficientCapacityError{Zone: zone, Type: typ, VCPUs: vcpus, Memory: memory}
+	}
+	return id, nil
+}
@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestDrainHost(t *testing.T) {
+	s := testStore(t)
+	ctx := context.Background()
+	hosts := newZone(t, s, "us-east-1t", [2]int{4, 8192})
+	for i := range 2 {
+		id := newServer(t, s, fmt.Sprintf("drain-%d", i), "us-east-1t")
+		if _, err := s.ApplyAction(ctx, id, "start"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Room for one of the two servers only
+	small, err := s.CreateHost(ctx, Host{Name: "us-east-1t-small", Zone: "us-east-1t", VCPUs: 1, MemoryMiB: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := s.DrainHost(ctx, hosts[0], "firmware")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Migrated) != 1 || len(report.Stopped) != 1 {
+		t.Fatalf("migrated %v, stopped %v; want one of each", report.Migrated, report.Stopped)
+	}
+	if m := report.Migrated[0]; m.HostID != small.ID || m.Status != "RUNNING" {
+		t.Errorf("migrated = %+v, want RUNNING on %s", m, small.ID)
+	}
+	if d := server(t, s, report.Stopped[0]); d.Status != "STOPPED" || d.HostID != nil {
+		t.Errorf("stopped server is %s on %v", d.Status, d.HostID)
+	}
+	if h := report.Host; h.Status != "maintenance" || h.MaintenanceReason != "firmware" || len(h.ServerIDs) != 0 {
+		t.Errorf("host after drain = %+v", h)
+	}
+	if _, err := s.ApplyAction(ctx, report.Stopped[0], "start"); err == nil {
+		t.Error("started a server with its zone's only free host in maintenance")
+	}
+}
+
+// A drain and starts in the same zone lock the zone's hosts in the same
+// order, so neither fails with a deadlock
+func TestDrainHostConcurrentStart(t *testing.T) {
+	s := testStore(t)
+	ctx := context.Background()
+	hosts := newZone(t, s, "us-east-1t", [2]int{16, 65536}, [2]int{16, 65536})
+	for round := range 10 {
+		var running, stopped []string
+		for i := range 3 {
+			running = append(running, newServer(t, s, fmt.Sprintf("up-%d-%d", round, i), "us-east-1t"))
+			stopped = append(stopped, newServer(t, s, fmt.Sprintf("down-%d-%d", round, i), "us-east-1t"))
+		}
+		for _, id := range running {
+			if _, err := s.ApplyAction(ctx, id, "start"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := s.ActivateHost(ctx, hosts[0]); err != nil {
+			t.Fatal(err)
+		}
+
+		var wg sync.WaitGroup
+		errs := make(chan error, len(stopped)+1)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.DrainHost(ctx, hosts[0], "")
+			errs <- err
+		}()
+		for _, id := range stopped {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := s.ApplyAction(ctx, id, "start")
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Fatalf("round %d: %v", round, err)
+			}
+		}
+		h, err := s.GetHost(ctx, hosts[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(h.ServerIDs) != 0 {
+			t.Fatalf("round %d: drained host still holds %v", round, h.ServerIDs)
+		}
+		for _, id := range append(running, stopped...) {
+			if d := server(t, s, id); d.Status != "RUNNING" || d.HostID == nil || *d.HostID != hosts[1] {
+				t.Fatalf("round %d: %s is %s on %v", round, id, d.Status, d.HostID)
+			}
+			if _, err := s.ApplyAction(ctx, id, "terminate"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+// Servers in a zone without hosts do not track capacity but still start
+func TestStartInZoneWithoutHosts(t *testing.T) {
+	s := testStore(t)
+	ctx := context.Background()
+	newZone(t, s, "us-east-1x")
+	id := newServer(t, s, "hostless", "us-east-1x")
+	for _, step := range []struct{ action, want string }{
+		{"start", "RUNNING"},
+		{"hibernate", "HIBERNATED"},
+		{"resume", "RUNNING"},
+	} {
+		status, err := s.ApplyAction(ctx, id, step.action)
+		if err != nil {
+			t.Fatalf("%s: %v", step.action, err)
+		}
+		if status != step.want {
+			t.Fatalf("%s: status %s, want %s", step.action, status, step.want)
+		}
+	}
+	if _, err := s.Resize(ctx, id, "t2.medium", true); err != nil {
+		t.Fatalf("live resize: %v", err)
+	}
+	if d := server(t, s, id); d.HostID != nil {
+		t.Fatalf("server is on host %s", *d.HostID)
+	}
+}
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// IdempotencyRecord is the stored outcome of a request made with an
+// Idempotency-Key. StatusCode is nil while that request is still running.
+type IdempotencyRecord struct {
+	Method      string
+	Path        string
+	RequestHash string
+	StatusCode  *int
+	ContentType string
+	Body        []byte
+	CreatedAt   time.Time
+}
+
+// ClaimIdempotencyKey reserves key for a new request. Keys older than ttl
+// are reused. When the key is already taken, claimed is false and the
+// existing record is returned.
+func (s *Store) ClaimIdempotencyKey(ctx context.Context, principal, key, method, path, hash string, ttl time.Duration) (rec *IdempotencyRecord, claimed bool, err error) {
+	var one int
+	err = s.DB.QueryRowContext(ctx, `
+	INSERT INTO idempotency_keys (principal, key, method, path, request_hash)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (principal, key) DO UPDATE
+	SET method       = EXCLUDED.method,
+	    path         = EXCLUDED.path,
+	    request_hash = EXCLUDED.request_hash,
+	    status_code  = NULL,
+	    content_type = NULL,
+	    body         = NULL,
+	    created_at   = now()
+	WHERE idempotency_keys.created_at <= now() - make_interval(secs => $6)
+	RETURNING 1
+	`, principal, key, method, path, hash, ttl.Seconds()).Scan(&one)
+	if err == nil {
+		return nil, true, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, false, err
+	}
+
+	var r IdempotencyRecord
+	var status sql.NullInt64
+	var ctype sql.NullString
+	err = s.DB.QueryRowContext(ctx, `
+	SELECT method, path, request_hash, status_code, content_type, body, created_at
+	FROM idempotency_keys
+	WHERE principal=$1 AND key=$2
+	`, principal, key).Scan(&r.Method, &r.Path, &r.RequestHash, &status, &ctype, &r.Body, &r.CreatedAt)
+	if err == sql.ErrNoRows {
+		// Released between the two statements; let the caller retry
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if status.Valid {
+		code := int(status.Int64)
+		r.StatusCode = &code
+	}
+	r.ContentType = ctype.String
+	return &r, false, nil
+}
+
+// CompleteIdempotencyKey stores the response to replay for key
+func (s *Store) CompleteIdempotencyKey(ctx context.Context, principal, key string, status int, contentType string, body []byte) error {
+	_, err := s.DB.ExecContext(ctx, `
+	UPDATE idempotency_keys
+	SET status_code=$3, content_type=$4, body=$5
+	WHERE principal=$1 AND key=$2
+	`, principal, key, status, contentType, body)
+	return err
+}
+
+// ReleaseIdempotencyKey forgets key so the request can be retried, e.g.
+// after a server error
+func (s *Store) ReleaseIdempotencyKey(ctx context.Context, principal, key string) error {
+	_, err := s.DB.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE principal=$1 AND key=$2`, principal, key)
+	return err
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrFenced is returned by writes made with a fenced context after the
+// lease behind the fence was lost to another holder
+var ErrFenced = errors.New("leader lease lost (fencing token is stale)")
+
+type Lease struct {
+	Name       string    `json:"name"`
+	Holder     string    `json:"holder"`
+	Token      int64     `json:"token"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// Fence identifies the lease a leader-only write is made under
+type Fence struct {
+	Name  string
+	Token int64
+}
+
+// WithFence makes fenced writes issued with ctx fail with ErrFenced once the
+// lease no longer carries f.Token
+func WithFence(ctx context.Context, f Fence) context.Context {
+	return context.WithValue(ctx, fenceKey, f)
+}
+
+// checkFence validates the fence carried by ctx, if any. The FOR SHARE lock
+// makes a concurrent takeover wait until the caller's transaction ends.
+func checkFence(ctx context.Context, q querier) error {
+	f, ok := ctx.Value(fenceKey).(Fence)
+	if !ok {
+		return nil
+	}
+	var one int
+	err := q.QueryRowContext(ctx, `
+	SELECT 1 FROM leader_leases
+	WHERE name=$1 AND token=$2 AND expires_at > now()
+	FOR SHARE
+	`, f.Name, f.Token).Scan(&one)
+	if err == sql.ErrNoRows {
+		return ErrFenced
+	}
+	return err
+}
+
+// AcquireLease takes or renews the named lease for holder. The fencing token
+// is bumped whenever the lease changes hands. Returns nil when another
+// holder owns an unexpired lease.
+func (s *Store) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (*Lease, error) {
+	var l Lease
+	err := s.DB.QueryRowContext(ctx, `
+	INSERT INTO leader_leases (name, holder, token, acquired_at, renewed_at, expires_at)
+	VALUES ($1, $2, 1, now(), now(), now() + make_interval(secs => $3))
+	ON CONFLICT (name) DO UPDATE
+	SET holder      = EXCLUDED.holder,
+	    token       = CASE WHEN leader_leases.holder = EXCLUDED.holder
+	                       THEN leader_leases.token ELSE leader_leases.token + 1 END,
+	    acquired_at = CASE WHEN leader_leases.holder = EXCLUDED.holder
+	                       THEN leader_leases.acquired_at ELSE now() END,
+	    renewed_at  = now(),
+	    expires_at  = EXCLUDED.expires_at
+	WHERE leader_leases.holder = EXCLUDED.holder
+	   OR leader_leases.expires_at <= now()
+	RETURNING name, holder, token, acquired_at, expires_at
+	`, name, holder, ttl.Seconds()).Scan(&l.Name, &l.Holder, &l.Token, &l.AcquiredAt, &l.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// ReleaseLease expires the lease immediately so another replica can take
+// over without waiting for the TTL
+func (s *Store) ReleaseLease(ctx context.Context, name, holder string, token int64) error {
+	_, err := s.DB.ExecContext(ctx, `
+	UPDATE leader_leases
+	SET expires_at = now()
+	WHERE name=$1 AND holder=$2 AND token=$3
+	`, name, holder, token)
+	return err
+}
+
+// GetLease returns nil when the lease was never taken
+func (s *Store) GetLease(ctx context.Context, name string) (*Lease, error) {
+	var l Lease
+	err := s.DB.QueryRowContext(ctx, `
+	SELECT name, holder, token, acquired_at, expires_at
+	FROM leader_leases
+	WHERE name=$1
+	`, name).Scan(&l.Name, &l.Holder, &l.Token, &l.AcquiredAt, &l.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
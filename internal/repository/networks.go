@@ -0,0 +1,339 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"virtualservers/internal/domain"
+)
+
+type VPC struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Region    string    `json:"region"`
+	CIDR      string    `json:"cidr"`
+	Default   bool      `json:"default"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type Subnet struct {
+	ID           string    `json:"id"`
+	VPCID        string    `json:"vpc_id"`
+	Name         string    `json:"name"`
+	Region       string    `json:"region"`
+	Zone         string    `json:"zone,omitempty"`
+	CIDR         string    `json:"cidr"`
+	Default      bool      `json:"default"`
+	TotalIPs     int       `json:"total_ips"`
+	AvailableIPs int       `json:"available_ips"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+type SubnetFilter struct {
+	VPCID  string
+	Region string
+	Zone   string
+}
+
+const vpcSelect = `
+	SELECT id, name, region, cidr::text, is_default, created_at, updated_at
+	FROM vpcs
+`
+
+func scanVPC(row rowScanner) (*VPC, error) {
+	var v VPC
+	if err := row.Scan(&v.ID, &v.Name, &v.Region, &v.CIDR, &v.Default, &v.CreatedAt, &v.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+const subnetSelect = `
+	SELECT sn.id, sn.vpc_id, sn.name, sn.region, COALESCE(sn.zone,''), sn.cidr::text, sn.is_default,
+	       (SELECT count(*) FROM ip_pool WHERE subnet_id = sn.id),
+	       (SELECT count(*) FROM ip_pool WHERE subnet_id = sn.id AND NOT allocated),
+	       sn.created_at, sn.updated_at
+	FROM subnets sn
+`
+
+func scanSubnet(row rowScanner) (*Subnet, error) {
+	var sn Subnet
+	if err := row.Scan(&sn.ID, &sn.VPCID, &sn.Name, &sn.Region, &sn.Zone, &sn.CIDR, &sn.Default,
+		&sn.TotalIPs, &sn.AvailableIPs, &sn.CreatedAt, &sn.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &sn, nil
+}
+
+// CreateVPC creates a VPC in a known region. Its CIDR may not overlap any
+// other VPC's.
+func (s *Store) CreateVPC(ctx context.Context, v VPC) (*VPC, error) {
+	p, err := domain.ParseNetworkCIDR(v.CIDR)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	var known bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM ip_pool WHERE region=$1)`, v.Region).Scan(&known); err != nil {
+		return nil, err
+	}
+	if !known {
+		return nil, &domain.ValidationError{Message: fmt.Sprintf("unknown region %q", v.Region)}
+	}
+	// Serializes the overlap check against concurrent creates
+	if _, err := tx.ExecContext(ctx, `LOCK TABLE vpcs IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return nil, err
+	}
+	var overlap, overlapCIDR string
+	err = tx.QueryRowContext(ctx, `SELECT id, cidr::text FROM vpcs WHERE cidr && $1::cidr LIMIT 1`, p.String()).Scan(&overlap, &overlapCIDR)
+	if err == nil {
+		return nil, &domain.ValidationError{Message: fmt.Sprintf("cidr %s overlaps VPC %s (%s)", p, overlap, overlapCIDR)}
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+	out, err := scanVPC(tx.QueryRowContext(ctx, `
+	INSERT INTO vpcs (name, region, cidr)
+	VALUES ($1, $2, $3::cidr)
+	RETURNING id, name, region, cidr::text, is_default, created_at, updated_at
+	`, v.Name, v.Region, p.String()))
+	if err != nil {
+		return nil, err
+	}
+	return out, tx.Commit()
+}
+
+// ListVPCs returns VPCs by region and name, optionally in one region
+func (s *Store) ListVPCs(ctx context.Context, region string) ([]VPC, error) {
+	rows, err := s.DB.QueryContext(ctx, vpcSelect+` WHERE ($1 = '' OR region = $1) ORDER BY region, is_default DESC, name`, region)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []VPC
+	for rows.Next() {
+		v, err := scanVPC(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *v)
+	}
+	return out, rows.Err()
+}
+
+// GetVPC returns nil when the VPC does not exist
+func (s *Store) GetVPC(ctx context.Context, id string) (*VPC, error) {
+	v, err := scanVPC(s.DB.QueryRowContext(ctx, vpcSelect+` WHERE id=$1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return v, err
+}
+
+// DeleteVPC deletes a VPC without subnets; default VPCs are kept. Returns
+// sql.ErrNoRows when not found.
+func (s *Store) DeleteVPC(ctx context.Context, id string) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var isDefault bool
+	var subnets int
+	err = tx.QueryRowContext(ctx, `
+	SELECT is_default, (SELECT count(*) FROM subnets WHERE vpc_id = v.id)
+	FROM vpcs v WHERE id=$1
+	FOR UPDATE
+	`, id).Scan(&isDefault, &subnets)
+	if err != nil {
+		return err
+	}
+	switch {
+	case isDefault:
+		return &domain.ResourceStateError{Resource: "vpc", ID: id, Op: "delete", Reason: "it is the region's default VPC"}
+	case subnets > 0:
+		return &domain.ResourceStateError{Resource: "vpc", ID: id, Op: "delete", Reason: fmt.Sprintf("it has %d subnet(s)", subnets)}
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM vpcs WHERE id=$1`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CreateSubnet carves a subnet out of its VPC (without overlapping the
+// VPC's other subnets) and adds its usable addresses to the IP pool
+func (s *Store) CreateSubnet(ctx context.Context, sn Subnet) (*Subnet, error) {
+	p, err := domain.ParseNetworkCIDR(sn.CIDR)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	var region string
+	var inside bool
+	err = tx.QueryRowContext(ctx, `
+	SELECT region, $2::cidr <<= cidr FROM vpcs WHERE id=$1 FOR UPDATE
+	`, sn.VPCID, p.String()).Scan(&region, &inside)
+	if err == sql.ErrNoRows {
+		return nil, &domain.ValidationError{Message: "vpc not found"}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !inside {
+		return nil, &domain.ValidationError{Message: fmt.Sprintf("cidr %s is not within the VPC's range", p)}
+	}
+	if sn.Zone = strings.TrimSpace(sn.Zone); sn.Zone != "" {
+		var zoneRegion string
+		err := tx.QueryRowContext(ctx, `SELECT region FROM zones WHERE name=$1`, sn.Zone).Scan(&zoneRegion)
+		if err == sql.ErrNoRows || (err == nil && zoneRegion != region) {
+			return nil, &domain.ValidationError{Message: fmt.Sprintf("zone %q is not a zone of %s", sn.Zone, region)}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	var overlap string
+	err = tx.QueryRowContext(ctx, `SELECT id FROM subnets WHERE vpc_id=$1 AND cidr && $2::cidr LIMIT 1`, sn.VPCID, p.String()).Scan(&overlap)
+	if err == nil {
+		return nil, &domain.ValidationError{Message: fmt.Sprintf("cidr %s overlaps subnet %s", p, overlap)}
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+	var id string
+	if err := tx.QueryRowContext(ctx, `
+	INSERT INTO subnets (vpc_id, name, region, zone, cidr)
+	VALUES ($1, $2, $3, NULLIF($4,''), $5::cidr)
+	RETURNING id
+	`, sn.VPCID, sn.Name, region, sn.Zone, p.String()).Scan(&id); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+	INSERT INTO ip_pool (region, ip, subnet_id)
+	SELECT $1, host(network($2::cidr) + g)::inet, $3
+	FROM generate_series(1, $4::int) g
+	`, region, p.String(), id, domain.UsableHosts(p)); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetSubnet(ctx, id)
+}
+
+// ListSubnets returns subnets with their address usage
+func (s *Store) ListSubnets(ctx context.Context, f SubnetFilter) ([]Subnet, error) {
+	conds := []string{"TRUE"}
+	args := []any{}
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if f.VPCID != "" {
+		add("sn.vpc_id = $%d", f.VPCID)
+	}
+	if f.Region != "" {
+		add("sn.region = $%d", f.Region)
+	}
+	if f.Zone != "" {
+		add("sn.zone = $%d", f.Zone)
+	}
+	rows, err := s.DB.QueryContext(ctx, subnetSelect+" WHERE "+strings.Join(conds, " AND ")+
+		" ORDER BY sn.region, sn.is_default DESC, sn.cidr", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Subnet
+	for rows.Next() {
+		sn, err := scanSubnet(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *sn)
+	}
+	return out, rows.Err()
+}
+
+// GetSubnet returns nil when the subnet does not exist
+func (s *Store) GetSubnet(ctx context.Context, id string) (*Subnet, error) {
+	sn, err := scanSubnet(s.DB.QueryRowContext(ctx, subnetSelect+` WHERE sn.id=$1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return sn, err
+}
+
+// DeleteSubnet deletes a subnet none of whose addresses were ever handed
+// out, with its addresses; default subnets are kept. Returns
+// sql.ErrNoRows when not found.
+func (s *Store) DeleteSubnet(ctx context.Context, id string) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var isDefault bool
+	var allocated int
+	err = tx.QueryRowContext(ctx, `
+	SELECT is_default, (SELECT count(*) FROM ip_pool WHERE subnet_id = sn.id AND (allocated OR server_id IS NOT NULL))
+	FROM subnets sn WHERE id=$1
+	FOR UPDATE
+	`, id).Scan(&isDefault, &allocated)
+	if err != nil {
+		return err
+	}
+	switch {
+	case isDefault:
+		return &domain.ResourceStateError{Resource: "subnet", ID: id, Op: "delete", Reason: "it is the region's default subnet"}
+	case allocated > 0:
+		return &domain.ResourceStateError{Resource: "subnet", ID: id, Op: "delete",
+			Reason: fmt.Sprintf("%d of its addresses belong to servers", allocated)}
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM ip_pool WHERE subnet_id=$1`, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM subnets WHERE id=$1`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// serverSubnet resolves the subnet a new server in region gets its IP
+// from: subnetID, which must be in the region, or the region's default
+func serverSubnet(ctx context.Context, tx *sql.Tx, subnetID, region string) (string, error) {
+	if subnetID == "" {
+		err := tx.QueryRowContext(ctx, `SELECT id FROM subnets WHERE region=$1 AND is_default`, region).Scan(&subnetID)
+		if err == sql.ErrNoRows {
+			return "", &domain.IPPoolExhaustedError{Region: region}
+		}
+		return subnetID, err
+	}
+	var subnetRegion string
+	err := tx.QueryRowContext(ctx, `SELECT region FROM subnets WHERE id=$1`, subnetID).Scan(&subnetRegion)
+	if err == sql.ErrNoRows {
+		return "", &domain.ValidationError{Message: "subnet not found"}
+	}
+	if err != nil {
+		return "", err
+	}
+	if subnetRegion != region {
+		return "", &domain.ValidationError{Message: fmt.Sprintf("subnet is in %s, not %s", subnetRegion, region)}
+	}
+	return subnetID, nil
+}
@@ -0,0 +1,234 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"virtualservers/internal/domain"
+)
+
+// Operation tracks a long-running change (e.g. filling a snapshot). Its
+// progress is simulated from its start and duration.
+type Operation struct {
+	ID           string     `json:"id"`
+	Type         string     `json:"type"`
+	ResourceType string     `json:"resource_type"`
+	ResourceID   string     `json:"resource_id"`
+	Status       string     `json:"status"`
+	Progress     int        `json:"progress"`
+	Error        string     `json:"error,omitempty"`
+	Actor        string     `json:"actor,omitempty"`
+	StartedAt    time.Time  `json:"started_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	DoneAt       *time.Time `json:"done_at,omitempty"`
+}
+
+type OperationFilter struct {
+	Status     string
+	ResourceID string
+	Limit      int
+}
+
+const operationSelect = `
+	SELECT id, type, resource_type, resource_id, status, progress, COALESCE(error,''), COALESCE(actor,''),
+	       started_at, updated_at, done_at
+	FROM operations
+`
+
+// operationDueSQL matches running operations whose simulated time is up
+const operationDueSQL = "status = 'running' AND started_at + duration_ms * interval '1 millisecond' <= now()"
+
+func scanOperation(row rowScanner) (*Operation, error) {
+	var op Operation
+	var done sql.NullTime
+	if err := row.Scan(&op.ID, &op.Type, &op.ResourceType, &op.ResourceID, &op.Status, &op.Progress,
+		&op.Error, &op.Actor, &op.StartedAt, &op.UpdatedAt, &done); err != nil {
+		return nil, err
+	}
+	if done.Valid {
+		op.DoneAt = &done.Time
+	}
+	return &op, nil
+}
+
+// startOperation records a running operation on a resource taking d
+func startOperation(ctx context.Context, tx *sql.Tx, typ, resourceType, resourceID string, d time.Duration) (string, error) {
+	var id string
+	err := tx.QueryRowContext(ctx, `
+	INSERT INTO operations (type, resource_type, resource_id, duration_ms, actor)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id
+	`, typ, resourceType, resourceID, d.Milliseconds(), ActorFrom(ctx)).Scan(&id)
+	return id, err
+}
+
+// GetOperation returns nil when the operation does not exist
+func (s *Store) GetOperation(ctx context.Context, id string) (*Operation, error) {
+	op, err := scanOperation(s.DB.QueryRowContext(ctx, operationSelect+` WHERE id=$1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return op, err
+}
+
+// ListOperations returns operations newest first (at most 100 unless
+// f.Limit says otherwise)
+func (s *Store) ListOperations(ctx context.Context, f OperationFilter) ([]Operation, error) {
+	limit := f.Limit
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	conds := []string{}
+	args := []any{}
+	if f.Status != "" {
+		args = append(args, strings.ToLower(f.Status))
+		conds = append(conds, fmt.Sprintf("status = $%d", len(args)))
+	}
+	if f.ResourceID != "" {
+		args = append(args, f.ResourceID)
+		conds = append(conds, fmt.Sprintf("resource_id = $%d", len(args)))
+	}
+	query := operationSelect
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	args = append(args, limit)
+	rows, err := s.DB.QueryContext(ctx, query+fmt.Sprintf(" ORDER BY started_at DESC LIMIT $%d", len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Operation
+	for rows.Next() {
+		op, err := scanOperation(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *op)
+	}
+	return out, rows.Err()
+}
+
+// AdvanceOperations updates the progress of running operations and
+// completes up to limit whose time is up, returning how many it completed
+func (s *Store) AdvanceOperations(ctx context.Context, limit int) (int, error) {
+	if err := s.updateProgress(ctx); err != nil {
+		return 0, err
+	}
+	rows, err := s.DB.QueryContext(ctx, `
+	SELECT id FROM operations WHERE `+operationDueSQL+`
+	ORDER BY started_at
+	LIMIT $1
+	`, limit)
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	done := 0
+	for _, id := range ids {
+		ok, err := s.completeOperation(ctx, id)
+		if err != nil {
+			return done, fmt.Errorf("operation %s: %w", id, err)
+		}
+		if ok {
+			done++
+		}
+	}
+	return done, nil
+}
+
+// updateProgress moves running operations (and their snapshots) to the
+// share of their duration that has elapsed; 100 is left for completion
+func (s *Store) updateProgress(ctx context.Context) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := checkFence(ctx, tx); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+	UPDATE operations
+	SET progress = LEAST(99, floor(EXTRACT(EPOCH FROM (now()-started_at)) * 100000 / GREATEST(duration_ms, 1)))::int,
+	    updated_at = now()
+	WHERE status = 'running'
+	`); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+	UPDATE snapshots
+	SET progress = o.progress, updated_at = now()
+	FROM operations o
+	WHERE o.resource_type = 'snapshot' AND o.resource_id = snapshots.id
+	  AND o.status = 'running' AND snapshots.status = 'pending'
+	  AND snapshots.progress <> o.progress
+	`); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// completeOperation finishes one due operation; false means it was no
+// longer running (finished elsewhere)
+func (s *Store) completeOperation(ctx context.Context, id string) (bool, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	if err := checkFence(ctx, tx); err != nil {
+		return false, err
+	}
+	var typ, resourceID string
+	err = tx.QueryRowContext(ctx, `
+	SELECT type, resource_id FROM operations WHERE id=$1 AND `+operationDueSQL+` FOR UPDATE
+	`, id).Scan(&typ, &resourceID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var failure string
+	switch typ {
+	case domain.OpCreateSnapshot:
+		failure, err = finishSnapshot(ctx, tx, resourceID, id)
+	default:
+		failure = fmt.Sprintf("unknown operation type %q", typ)
+	}
+	if err != nil {
+		return false, err
+	}
+	if failure != "" {
+		_, err = tx.ExecContext(ctx, `
+		UPDATE operations SET status='failed', error=$2, updated_at=now(), done_at=now() WHERE id=$1
+		`, id, failure)
+	} else {
+		_, err = tx.ExecContext(ctx, `
+		UPDATE operations SET status='succeeded', progress=100, updated_at=now(), done_at=now() WHERE id=$1
+		`, id)
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
@@ -0,0 +1,390 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"virtualservers/internal/domain"
+)
+
+type Zone struct {
+	Name           string     `json:"name"`
+	Region         string     `json:"region"`
+	Impaired       bool       `json:"impaired"`
+	ImpairedReason string     `json:"impaired_reason,omitempty"`
+	ImpairedAt     *time.Time `json:"impaired_at,omitempty"`
+	// Servers counts the zone's live (not terminated) servers
+	Servers   int       `json:"servers"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type PlacementGroup struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Region   string `json:"region"`
+	Strategy string `json:"strategy"`
+	LabelKey string `json:"label_key,omitempty"`
+	// Members counts live servers in the group, Zones breaks them down
+	Members   int            `json:"members"`
+	Zones     map[string]int `json:"zones"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+const zoneSelect = `
+	SELECT z.name, z.region, z.impaired, COALESCE(z.impaired_reason,''), z.impaired_at,
+	       (SELECT count(*) FROM servers s WHERE s.zone = z.name AND s.status <> 'TERMINATED'),
+	       z.updated_at
+	FROM zones z
+`
+
+func scanZone(row rowScanner) (*Zone, error) {
+	var z Zone
+	var at sql.NullTime
+	if err := row.Scan(&z.Name, &z.Region, &z.Impaired, &z.ImpairedReason, &at, &z.Servers, &z.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if at.Valid {
+		z.ImpairedAt = &at.Time
+	}
+	return &z, nil
+}
+
+// ListZones returns zones by region and name, optionally in one region
+func (s *Store) ListZones(ctx context.Context, region string) ([]Zone, error) {
+	rows, err := s.DB.QueryContext(ctx, zoneSelect+` WHERE ($1 = '' OR z.region = $1) ORDER BY z.region, z.name`, region)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Zone
+	for rows.Next() {
+		z, err := scanZone(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *z)
+	}
+	return out, rows.Err()
+}
+
+// GetZone returns nil when the zone does not exist
+func (s *Store) GetZone(ctx context.Context, name string) (*Zone, error) {
+	z, err := scanZone(s.DB.QueryRowContext(ctx, zoneSelect+` WHERE z.name=$1`, name))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return z, err
+}
+
+// SetZoneImpaired simulates a zone outage (or its end) and records
+// zone_impaired / zone_recovered on each live server of the zone. Setting
+// the state the zone is already in changes nothing. Returns sql.ErrNoRows
+// when the zone does not exist.
+func (s *Store) SetZoneImpaired(ctx context.Context, name string, impaired bool, reason string) (*Zone, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	var was bool
+	if err := tx.QueryRowContext(ctx, `SELECT impaired FROM zones WHERE name=$1 FOR UPDATE`, name).Scan(&was); err != nil {
+		return nil, err
+	}
+	if was != impaired {
+		if _, err := tx.ExecContext(ctx, `
+		UPDATE zones
+		SET impaired=$2,
+		    impaired_reason=CASE WHEN $2 THEN NULLIF($3,'') END,
+		    impaired_at=CASE WHEN $2 THEN now() END,
+		    updated_at=now()
+		WHERE name=$1
+		`, name, impaired, reason); err != nil {
+			return nil, err
+		}
+		if err := recordZoneEvents(ctx, tx, name, impaired, reason); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetZone(ctx, name)
+}
+
+func recordZoneEvents(ctx context.Context, tx *sql.Tx, zone string, impaired bool, reason string) error {
+	rows, err := tx.QueryContext(ctx, `SELECT id FROM servers WHERE zone=$1 AND status <> 'TERMINATED' FOR UPDATE`, zone)
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	event, msg := "zone_recovered", fmt.Sprintf("zone %s recovered", zone)
+	data := map[string]any{"zone": zone}
+	if impaired {
+		event, msg = "zone_impaired", fmt.Sprintf("zone %s impaired", zone)
+		if reason != "" {
+			data["reason"] = reason
+		}
+	}
+	for _, id := range ids {
+		if err := recordEvent(ctx, tx, id, event, msg, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkZoneHealthy refuses to bring a server up in an impaired zone
+func checkZoneHealthy(ctx context.Context, q querier, serverID string) error {
+	var zone, region, reason string
+	var impaired bool
+	err := q.QueryRowContext(ctx, `
+	SELECT z.name, z.region, z.impaired, COALESCE(z.impaired_reason,'')
+	FROM servers s JOIN zones z ON z.name = s.zone
+	WHERE s.id=$1
+	`, serverID).Scan(&zone, &region, &impaired, &reason)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if impaired {
+		return &domain.ZoneImpairedError{Region: region, Zone: zone, Reason: reason}
+	}
+	return nil
+}
+
+const placementGroupSelect = `
+	SELECT g.id, g.name, g.region, g.strategy, COALESCE(g.label_key,''),
+	       COALESCE((SELECT jsonb_object_agg(zone, n) FROM (
+	         SELECT s.zone, count(*) AS n FROM servers s
+	         WHERE s.placement_group_id = g.id AND s.status <> 'TERMINATED' AND s.zone IS NOT NULL
+	         GROUP BY s.zone) m), '{}'),
+	       g.created_at, g.updated_at
+	FROM placement_groups g
+`
+
+func scanPlacementGroup(row rowScanner) (*PlacementGroup, error) {
+	var g PlacementGroup
+	var zones []byte
+	if err := row.Scan(&g.ID, &g.Name, &g.Region, &g.Strategy, &g.LabelKey, &zones, &g.CreatedAt, &g.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(zones, &g.Zones); err != nil {
+		return nil, err
+	}
+	for _, n := range g.Zones {
+		g.Members += n
+	}
+	return &g, nil
+}
+
+// CreatePlacementGroup creates a group in a region with zones; names are
+// unique per region
+func (s *Store) CreatePlacementGroup(ctx context.Context, g PlacementGroup) (*PlacementGroup, error) {
+	if err := domain.ValidatePlacement(g.Strategy, g.LabelKey); err != nil {
+		return nil, err
+	}
+	var known bool
+	if err := s.DB.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM zones WHERE region=$1)`, g.Region).Scan(&known); err != nil {
+		return nil, err
+	}
+	if !known {
+		return nil, &domain.ValidationError{Message: fmt.Sprintf("unknown region %q", g.Region)}
+	}
+	var id string
+	err := s.DB.QueryRowContext(ctx, `
+	INSERT INTO placement_groups (name, region, strategy, label_key)
+	VALUES ($1, $2, $3, NULLIF($4,''))
+	ON CONFLICT DO NOTHING
+	RETURNING id
+	`, g.Name, g.Region, g.Strategy, g.LabelKey).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, &domain.ValidationError{Message: fmt.Sprintf("placement group %q already exists in %s", g.Name, g.Region)}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.GetPlacementGroup(ctx, id)
+}
+
+// ListPlacementGroups returns groups by region and name, optionally in one
+// region
+func (s *Store) ListPlacementGroups(ctx context.Context, region string) ([]PlacementGroup, error) {
+	rows, err := s.DB.QueryContext(ctx, placementGroupSelect+` WHERE ($1 = '' OR g.region = $1) ORDER BY g.region, g.name`, region)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []PlacementGroup
+	for rows.Next() {
+		g, err := scanPlacementGroup(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *g)
+	}
+	return out, rows.Err()
+}
+
+// GetPlacementGroup returns nil when the group does not exist
+func (s *Store) GetPlacementGroup(ctx context.Context, id string) (*PlacementGroup, error) {
+	g, err := scanPlacementGroup(s.DB.QueryRowContext(ctx, placementGroupSelect+` WHERE g.id=$1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return g, err
+}
+
+// DeletePlacementGroup deletes a group without live members; terminated
+// members are detached from it. Returns sql.ErrNoRows when not found.
+func (s *Store) DeletePlacementGroup(ctx context.Context, id string) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var members int
+	err = tx.QueryRowContext(ctx, `
+	SELECT (SELECT count(*) FROM servers WHERE placement_group_id = g.id AND status <> 'TERMINATED')
+	FROM placement_groups g WHERE id=$1
+	FOR UPDATE
+	`, id).Scan(&members)
+	if err != nil {
+		return err
+	}
+	if members > 0 {
+		return &domain.ResourceStateError{Resource: "placement group", ID: id, Op: "delete",
+			Reason: fmt.Sprintf("it has %d live server(s)", members)}
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE servers SET placement_group_id=NULL WHERE placement_group_id=$1`, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM placement_groups WHERE id=$1`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// placeServer picks the zone of a new server in region: the zone asked
+// for or its subnet's zone, otherwise the one the placement group's
+// strategy (or n.Placement, over the region's live servers) chooses.
+// Returns "" for a region without zones.
+func placeServer(ctx context.Context, tx *sql.Tx, n NewServer, subnetID string) (string, error) {
+	strategy, labelKey := n.Placement, ""
+	if n.PlacementGroupID != "" {
+		if n.Placement != "" {
+			return "", &domain.ValidationError{Message: "placement comes from the placement group; omit placement"}
+		}
+		var groupRegion string
+		err := tx.QueryRowContext(ctx, `
+		SELECT region, strategy, COALESCE(label_key,'') FROM placement_groups WHERE id=$1 FOR UPDATE
+		`, n.PlacementGroupID).Scan(&groupRegion, &strategy, &labelKey)
+		if err == sql.ErrNoRows {
+			return "", &domain.ValidationError{Message: "placement group not found"}
+		}
+		if err != nil {
+			return "", err
+		}
+		if groupRegion != n.Region {
+			return "", &domain.ValidationError{Message: fmt.Sprintf("placement group is in %s, not %s", groupRegion, n.Region)}
+		}
+		if strategy == domain.PlacementSpreadByLabel && n.Labels[labelKey] == "" {
+			return "", &domain.ValidationError{Message: fmt.Sprintf("placement group spreads by label %q, which the server lacks", labelKey)}
+		}
+	}
+	switch strategy {
+	case "":
+		strategy = domain.PlacementSpread
+	case domain.PlacementSpread, domain.PlacementPack:
+	case domain.PlacementSpreadByLabel:
+		if n.PlacementGroupID == "" {
+			return "", &domain.ValidationError{Message: "spread_by_label needs a placement group"}
+		}
+	default:
+		return "", &domain.ValidationError{Message: fmt.Sprintf("placement %q must be spread or pack", strategy)}
+	}
+
+	zone := n.Zone
+	var subnetZone string
+	if err := tx.QueryRowContext(ctx, `SELECT COALESCE(zone,'') FROM subnets WHERE id=$1`, subnetID).Scan(&subnetZone); err != nil {
+		return "", err
+	}
+	if subnetZone != "" {
+		if zone != "" && zone != subnetZone {
+			return "", &domain.ValidationError{Message: fmt.Sprintf("subnet is in zone %s, not %s", subnetZone, zone)}
+		}
+		zone = subnetZone
+	}
+	if zone != "" {
+		var region, reason string
+		var impaired bool
+		err := tx.QueryRowContext(ctx, `
+		SELECT region, impaired, COALESCE(impaired_reason,'') FROM zones WHERE name=$1
+		`, zone).Scan(&region, &impaired, &reason)
+		if err == sql.ErrNoRows {
+			return "", &domain.ValidationError{Message: fmt.Sprintf("unknown zone %q", zone)}
+		}
+		if err != nil {
+			return "", err
+		}
+		if region != n.Region {
+			return "", &domain.ValidationError{Message: fmt.Sprintf("zone %s is in %s, not %s", zone, region, n.Region)}
+		}
+		if impaired {
+			return "", &domain.ZoneImpairedError{Region: region, Zone: zone, Reason: reason}
+		}
+		return zone, nil
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+	SELECT z.name, z.impaired, count(s.id),
+	       count(s.id) FILTER (WHERE $3 <> '' AND s.labels->>$3 = $4)
+	FROM zones z
+	LEFT JOIN servers s ON s.zone = z.name AND s.status <> 'TERMINATED'
+	     AND ($2 = '' OR s.placement_group_id = NULLIF($2,'')::uuid)
+	WHERE z.region = $1
+	GROUP BY z.name, z.impaired
+	`, n.Region, n.PlacementGroupID, labelKey, n.Labels[labelKey])
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	var loads []domain.ZoneLoad
+	for rows.Next() {
+		var l domain.ZoneLoad
+		if err := rows.Scan(&l.Zone, &l.Impaired, &l.Servers, &l.SameLabel); err != nil {
+			return "", err
+		}
+		loads = append(loads, l)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if len(loads) == 0 {
+		return "", nil
+	}
+	zone, ok := domain.PickZone(strategy, loads)
+	if !ok {
+		return "", &domain.ZoneImpairedError{Region: n.Region}
+	}
+	return zone, nil
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"virtualservers/internal/domain"
+)
+
+func TestStartInImpairedZone(t *testing.T) {
+	s := testStore(t)
+	ctx := context.Background()
+	newZone(t, s, "us-east-1t", [2]int{16, 65536})
+	id := newServer(t, s, "impaired", "us-east-1t")
+	if _, err := s.SetZoneImpaired(ctx, "us-east-1t", true, "power"); err != nil {
+		t.Fatal(err)
+	}
+
+	var zie *domain.ZoneImpairedError
+	if _, err := s.ApplyAction(ctx, id, "start"); !errors.As(err, &zie) || zie.Zone != "us-east-1t" || zie.Reason != "power" {
+		t.Fatalf("start in an impaired zone = %v", err)
+	}
+	if d := server(t, s, id); d.Status != "STOPPED" || d.HostID != nil {
+		t.Fatalf("server is %s on %v", d.Status, d.HostID)
+	}
+	if _, err := s.CreateServer(ctx, NewServer{Name: "new", Region: "us-east-1", Type: "t2.micro", Zone: "us-east-1t"}); !errors.As(err, &zie) {
+		t.Fatalf("create in an impaired zone = %v", err)
+	}
+
+	if _, err := s.SetZoneImpaired(ctx, "us-east-1t", false, ""); err != nil {
+		t.Fatal(err)
+	}
+	if status, err := s.ApplyAction(ctx, id, "start"); err != nil || status != "RUNNING" {
+		t.Fatalf("start after recovery = %s, %v", status, err)
+	}
+	logs, err := s.GetServerLogs(ctx, id, LogFilter{Events: []string{"zone_impaired", "zone_recovered"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 2 {
+		t.Fatalf("%d zone events, want impaired and recovered", len(logs))
+	}
+}
+
+func TestPlacementSkipsImpairedZones(t *testing.T) {
+	s := testStore(t)
+	ctx := context.Background()
+	for _, zone := range []string{"us-east-1a", "us-east-1b"} {
+		if _, err := s.SetZoneImpaired(ctx, zone, true, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for range 3 {
+		if d := server(t, s, newServer(t, s, "placed", "")); d.Zone == nil || *d.Zone != "us-east-1c" {
+			t.Fatalf("placed in %v with only us-east-1c healthy", d.Zone)
+		}
+	}
+	if _, err := s.SetZoneImpaired(ctx, "us-east-1c", true, ""); err != nil {
+		t.Fatal(err)
+	}
+	var zie *domain.ZoneImpairedError
+	_, err := s.CreateServer(ctx, NewServer{Name: "nowhere", Region: "us-east-1", Type: "t2.micro"})
+	if !errors.As(err, &zie) || zie.Region != "us-east-1" || zie.Zone != "" {
+		t.Fatalf("create with every zone impaired = %v", err)
+	}
+}
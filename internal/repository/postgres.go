@@ -3,55 +3,92 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
+
+	"virtualservers/internal/chaos"
+	"virtualservers/internal/domain"
 )
 
 type Store struct {
 	DB *sql.DB
+	// Transitions simulates start/stop/terminate taking time; the zero
+	// value keeps them instantaneous
+	Transitions Transitions
+	// Chaos injects failed provisions and stuck reboots; nil injects none
+	Chaos *chaos.Engine
 }
 
 type ServerListItem struct {
-	ID        string    `json:"id"`
-	Name      string    `json:"name"`
-	Region    string    `json:"region"`
-	Type      string    `json:"type"`
-	Status    string    `json:"status"`
-	IP        *string   `json:"ip,omitempty"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	Region    string            `json:"region"`
+	Type      string            `json:"type"`
+	Status    string            `json:"status"`
+	Zone      *string           `json:"zone,omitempty"`
+	IP        *string           `json:"ip,omitempty"`
+	Labels    map[string]string `json:"labels"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
 }
 
 type ListFilters struct {
 	Region string
+	Zone   string
 	Status string
 	Type   string
+	Labels map[string]string
 	Limit  int
 	Offset int
 }
 
 type ServerDetail struct {
-	ID             string     `json:"id"`
-	Name           string     `json:"name"`
-	Region         string     `json:"region"`
-	Type           string     `json:"type"`
-	Status         string     `json:"status"`
-	IP             *string    `json:"ip,omitempty"`
-	CreatedAt      time.Time  `json:"created_at"`
-	UpdatedAt      time.Time  `json:"updated_at"`
-	AccruedSeconds int64      `json:"accrued_seconds"`
-	AccruedCost    float64    `json:"accrued_cost"`
-	LastStartedAt  *time.Time `json:"last_started_at,omitempty"`
-	HourlyRate     float64    `json:"hourly_rate"`
-	LiveUptime     int64      `json:"live_uptime_seconds"`
-	LiveCost       float64    `json:"live_cost"`
+	ID                    string            `json:"id"`
+	Name                  string            `json:"name"`
+	Region                string            `json:"region"`
+	Type                  string            `json:"type"`
+	Status                string            `json:"status"`
+	IP                    *string           `json:"ip,omitempty"`
+	Labels                map[string]string `json:"labels"`
+	CreatedAt             time.Time         `json:"created_at"`
+	UpdatedAt             time.Time         `json:"updated_at"`
+	AccruedSeconds        int64             `json:"accrued_seconds"`
+	AccruedCost           float64           `json:"accrued_cost"`
+	LastStartedAt         *time.Time        `json:"last_started_at,omitempty"`
+	HourlyRate            float64           `json:"hourly_rate"`
+	StorageHourlyRate     float64           `json:"storage_hourly_rate"`
+	LiveUptime            int64             `json:"live_uptime_seconds"`
+	LiveCost              float64           `json:"live_cost"`
+	TerminationProtection bool              `json:"termination_protection"`
+	Transition            *Transition       `json:"transition,omitempty"`
+	ImageID               *string           `json:"image_id,omitempty"`
+	SecurityGroupIDs      []string          `json:"security_group_ids"`
+	SubnetID              *string           `json:"subnet_id,omitempty"`
+	VPCID                 *string           `json:"vpc_id,omitempty"`
+	Zone                  *string           `json:"zone,omitempty"`
+	PlacementGroupID      *string           `json:"placement_group_id,omitempty"`
+	HostID                *string           `json:"host_id,omitempty"`
+}
+
+// Transition is a simulated start/stop/terminate in progress
+type Transition struct {
+	Action       string    `json:"action"`
+	TargetStatus string    `json:"target_status"`
+	StartedAt    time.Time `json:"started_at"`
+	DueAt        time.Time `json:"due_at"`
+	QueuedAction string    `json:"queued_action,omitempty"`
 }
 
 type ServerEvent struct {
-	Timestamp time.Time `json:"timestamp"`
-	Event     string    `json:"event"`
-	Message   string    `json:"message"`
+	ID        int64             `json:"id"`
+	ServerID  string            `json:"server_id"`
+	Timestamp time.Time         `json:"timestamp"`
+	Event     string            `json:"event"`
+	Message   string            `json:"message"`
+	Data      json.RawMessage   `json:"data,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
 }
 
 func (s *Store) ListServers(ctx context.Context, f ListFilters) ([]ServerListItem, int, error) {
@@ -63,29 +100,8 @@ func (s *Store) ListServers(ctx context.Context, f ListFilters) ([]ServerListIte
 	if offset < 0 {
 		offset = 0
 	}
-	conds := []string{}
-	args := []any{}
-	argn := 1
-
-	if f.Region != "" {
-		conds = append(conds, fmt.Sprintf("s.region=$%d", argn))
-		args = append(args, f.Region)
-		argn++
-	}
-	if f.Status != "" {
-		conds = append(conds, fmt.Sprintf("s.status=$%d::server_status", argn))
-		args = append(args, strings.ToUpper(f.Status))
-		argn++
-	}
-	if f.Type != "" {
-		conds = append(conds, fmt.Sprintf("s.type=$%d", argn))
-		args = append(args, f.Type)
-		argn++
-	}
-	where := ""
-	if len(conds) > 0 {
-		where = "WHERE" + strings.Join(conds, "AND")
-	}
+	where, args := listConds(f)
+	argn := len(args) + 1
 	countSQL := "SELECT COUNT(*) FROM servers s" + where
 	var total int
 	if err := s.DB.QueryRowContext(ctx, countSQL, args...).Scan(&total); err != nil {
@@ -99,9 +115,11 @@ SELECT
   s.id,
   s.name,
   s.region,
+  s.zone,
   s.type,
   s.status::text AS status,
   (SELECT ip_pool.ip::text FROM ip_pool WHERE ip_pool.id = s.ip_id) AS ip,
+  s.labels,
   s.created_at,
   s.updated_at
 FROM servers s
@@ -120,15 +138,18 @@ LIMIT ` + limitPlaceholder + ` OFFSET ` + offsetPlaceholder
 	var items []ServerListItem
 	for rows.Next() {
 		var it ServerListItem
-		var ip sql.NullString // <-- temp holder for possibly-NULL ip
+		var ip, zone sql.NullString // <-- temp holder for possibly-NULL ip
+		var labels []byte
 
 		if err := rows.Scan(
 			&it.ID,
 			&it.Name,
 			&it.Region,
+			&zone,
 			&it.Type,
 			&it.Status,
 			&ip, // <-- scan into NullString, not &it.IP
+			&labels,
 			&it.CreatedAt,
 			&it.UpdatedAt,
 		); err != nil {
@@ -139,6 +160,12 @@ LIMIT ` + limitPlaceholder + ` OFFSET ` + offsetPlaceholder
 			s := ip.String
 			it.IP = &s // set pointer only when non-null
 		} // else leave it.IP = nil
+		if zone.Valid {
+			it.Zone = &zone.String
+		}
+		if err := json.Unmarshal(labels, &it.Labels); err != nil {
+			return nil, 0, err
+		}
 
 		items = append(items, it)
 	}
@@ -148,6 +175,45 @@ LIMIT ` + limitPlaceholder + ` OFFSET ` + offsetPlaceholder
 	return items, total, nil
 }
 
+// listConds builds the WHERE clause (and its args) for the filter fields
+// of f; servers are aliased s
+func listConds(f ListFilters) (string, []any) {
+	conds := []string{}
+	args := []any{}
+	argn := 1
+
+	if f.Region != "" {
+		conds = append(conds, fmt.Sprintf("s.region=$%d", argn))
+		args = append(args, f.Region)
+		argn++
+	}
+	if f.Zone != "" {
+		conds = append(conds, fmt.Sprintf("s.zone=$%d", argn))
+		args = append(args, f.Zone)
+		argn++
+	}
+	if f.Status != "" {
+		conds = append(conds, fmt.Sprintf("s.status=$%d::server_status", argn))
+		args = append(args, strings.ToUpper(f.Status))
+		argn++
+	}
+	if f.Type != "" {
+		conds = append(conds, fmt.Sprintf("s.type=$%d", argn))
+		args = append(args, f.Type)
+		argn++
+	}
+	if len(f.Labels) > 0 {
+		b, _ := json.Marshal(f.Labels)
+		conds = append(conds, fmt.Sprintf("s.labels @> $%d::jsonb", argn))
+		args = append(args, string(b))
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+	return where, args
+}
+
 func (s *Store) GetServerByID(ctx context.Context, id string) (*ServerDetail, error) {
 	query := `
 	SELECT
@@ -157,13 +223,29 @@ func (s *Store) GetServerByID(ctx context.Context, id string) (*ServerDetail, er
 	s.type,
 	s.status::text,
 	(SELECT ip_pool.ip::text FROM ip_pool WHERE ip_pool.id=s.ip_id)AS ip,
+	s.labels,
 	s.created_at,
 	s.updated_at,
 	s.accrued_seconds,
 	s.accrued_cost,
 	s.last_started_at,
-	it.hourly_rate
-	
+	it.hourly_rate,
+	it.storage_hourly_rate,
+	s.billing_last_at,
+	s.termination_protection,
+	s.transition_action,
+	COALESCE(s.transition_target,''),
+	s.transition_started_at,
+	s.transition_due_at,
+	COALESCE(s.queued_action,''),
+	s.image_id::text,
+	ARRAY(SELECT group_id::text FROM server_security_groups WHERE server_id = s.id ORDER BY attached_at),
+	s.subnet_id::text,
+	(SELECT vpc_id::text FROM subnets WHERE id = s.subnet_id),
+	s.zone,
+	s.placement_group_id::text,
+	s.host_id::text
+
 FROM servers s
 JOIN instance_types it ON it.type =s.type
 WHERE s.id=$1
@@ -171,14 +253,21 @@ WHERE s.id=$1
 	row := s.DB.QueryRowContext(ctx, query, id)
 
 	var d ServerDetail
-	var ip sql.NullString
-	var lastStarted sql.NullTime
+	var ip, imageID, subnetID, vpcID, zone, groupID, hostID sql.NullString
+	var lastStarted, billingLast sql.NullTime
+	var labels []byte
+	var transAction sql.NullString
+	var trans Transition
+	var transStarted, transDue sql.NullTime
 
 	err := row.Scan(
-		&d.ID, &d.Name, &d.Region, &d.Type, &d.Status, &ip,
+		&d.ID, &d.Name, &d.Region, &d.Type, &d.Status, &ip, &labels,
 		&d.CreatedAt, &d.UpdatedAt,
 		&d.AccruedSeconds, &d.AccruedCost, &lastStarted,
-		&d.HourlyRate,
+		&d.HourlyRate, &d.StorageHourlyRate, &billingLast, &d.TerminationProtection,
+		&transAction, &trans.TargetStatus, &transStarted, &transDue, &trans.QueuedAction,
+		&imageID, textArray(&d.SecurityGroupIDs), &subnetID, &vpcID,
+		&zone, &groupID, &hostID,
 	)
 
 	if err != nil {
@@ -195,14 +284,47 @@ WHERE s.id=$1
 		t := lastStarted.Time
 		d.LastStartedAt = &t
 	}
+	if imageID.Valid {
+		d.ImageID = &imageID.String
+	}
+	if subnetID.Valid {
+		d.SubnetID = &subnetID.String
+	}
+	if vpcID.Valid {
+		d.VPCID = &vpcID.String
+	}
+	if zone.Valid {
+		d.Zone = &zone.String
+	}
+	if groupID.Valid {
+		d.PlacementGroupID = &groupID.String
+	}
+	if hostID.Valid {
+		d.HostID = &hostID.String
+	}
+	if err := json.Unmarshal(labels, &d.Labels); err != nil {
+		return nil, err
+	}
+	if transAction.Valid {
+		trans.Action = transAction.String
+		trans.StartedAt, trans.DueAt = transStarted.Time, transDue.Time
+		d.Transition = &trans
+	}
 
-	//Computing live uptime/cost
+	//Computing live uptime/cost: accrued totals plus the time since the
+	//last billing tick, at the rate of the current status
 	d.LiveUptime = d.AccruedSeconds
-	if d.Status == "RUNNING" && d.LastStartedAt != nil {
-		d.LiveUptime += int64(time.Since(*d.LastStartedAt).Seconds())
-
+	d.LiveCost = d.AccruedCost
+	if billingLast.Valid {
+		unbilled := time.Since(billingLast.Time)
+		switch {
+		case s.Transitions.computeBilled(d.Status):
+			d.LiveUptime += int64(unbilled.Seconds())
+			d.LiveCost += unbilled.Hours() * d.HourlyRate
+		case d.Status == "HIBERNATED":
+			d.LiveCost += unbilled.Hours() * d.StorageHourlyRate
+		}
 	}
-	d.LiveCost = float64(d.LiveUptime) / 3600.0 * d.HourlyRate
 	return &d, nil
 }
 
@@ -216,7 +338,18 @@ WHERE id=$2
 	return err
 }
 
-//ApplyAction applies a lifecycle action,updates server state+timestamps, and logs event
+// Billing close-out assignments for UPDATE servers, covering the time since
+// billing_last_at: compute time is billed at the type's hourly_rate and
+// counts as uptime, hibernated time only costs the storage_hourly_rate
+const (
+	billSecondsSQL = "accrued_seconds = COALESCE(accrued_seconds,0) + EXTRACT(EPOCH FROM (now()-billing_last_at))::bigint"
+	billComputeSQL = "accrued_cost = COALESCE(accrued_cost,0) + (EXTRACT(EPOCH FROM (now() - billing_last_at)) / 3600.0 * (SELECT hourly_rate FROM instance_types it WHERE it.type = servers.type))"
+	billStorageSQL = "accrued_cost = COALESCE(accrued_cost,0) + (EXTRACT(EPOCH FROM (now() - billing_last_at)) / 3600.0 * (SELECT storage_hourly_rate FROM instance_types it WHERE it.type = servers.type))"
+)
+
+//ApplyAction applies a lifecycle action,updates server state+timestamps, and logs event.
+//With simulated transitions the returned status is STARTING, STOPPING or
+//TERMINATING (or, for a queued action, the transition still in progress)
 
 func (s *Store) ApplyAction(ctx context.Context, id string, action string) (string, error) {
 	tx, err := s.DB.BeginTx(ctx, nil)
@@ -224,100 +357,133 @@ func (s *Store) ApplyAction(ctx context.Context, id string, action string) (stri
 		return "", err
 	}
 	defer tx.Rollback()
+	if err := checkFence(ctx, tx); err != nil {
+		return "", err
+	}
 
 	//Getting current state
-	row := tx.QueryRowContext(ctx, `
-	SELECT status::text,last_started_at,last_stopped_at
-	FROM servers
-	WHERE id = $1
-	FOR UPDATE
-	`, id)
-	var current string
-	var lastStarted, lastStopped sql.NullTime
-	if err := row.Scan(&current, &lastStarted, &lastStopped); err != nil {
-		if err == sql.ErrNoRows {
-			return "", sql.ErrNoRows
-		}
+	cur, err := lockServer(ctx, tx, id)
+	if err != nil {
 		return "", err
 	}
-	var target string
-	var updates []string
-	var args []any
-	argn := 1
-	//FSM transitions and timestamp handling
-	switch current {
-	case "STOPPED":
-		if action == "start" {
-			target = "RUNNING"
-			updates = append(updates, fmt.Sprint("status=$%d::server_status", argn))
-			args = append(args, target)
-			argn++
-			updates = append(updates, fmt.Sprintf("last_started_at=now(),billing_last_at=now()"))
-		} else if action == "TERMINATED" {
-			target = "TERMINATED"
-			updates = append(updates, fmt.Sprintf("status=$%d::server_status", argn))
-			args = append(args, target)
-			argn++
-			updates = append(updates, "terminated_at=now()")
-		}
-	case "RUNNING":
-		if action == "stop" {
-			target = "STOPPED"
-			updates = append(updates, fmt.Sprintf("status=$%d::server_status", argn))
-			args = append(args, target)
-			argn++
-			updates = append(updates, "last_stopped_at=now(),stopped_since=now()")
-			//billing data handle
-			updates = append(updates, "accrued_seconds = COALESCE(accrued_seconds,0) + EXTRACT(EPOCH FROM (now()-billing_last_at))::bigint")
-			updates = append(updates, "accrued_cost = COALESCE(accrued_cost,0) + (EXTRACT(EPOCH FROM (now() - billing_last_at)) / 3600.0 * (SELECT hourly_rate FROM instance_types it WHERE it.type = servers.type))")
-
-		} else if action == "reboot" {
-			target = "REBOOTING"
-			updates = append(updates, fmt.Sprintf("status=$%d::server_status", argn))
-			args = append(args, target)
-			argn++
-		}
-	case "REBOOTING":
-		if action == "complete-reboot" {
-			target = "RUNNING"
-			updates = append(updates, fmt.Sprintf("status=$%d::server_status", argn))
-			args = append(args, target)
-			argn++
-			updates = append(updates, "last_started_at=now(),billing_last_at=now()")
-		}
+	var status string
+	if domain.IsTransitional(cur.status) {
+		status, err = s.queueAction(ctx, tx, cur, action)
+	} else {
+		status, err = s.applyAction(ctx, tx, cur, action)
 	}
-	if target == "" {
-		return "", fmt.Errorf("invalid transition")
+	if err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
 	}
-	updates = append(updates, "updated_at=now()")
-	setClause := strings.Join(updates, ",")
+	return status, nil
+}
+
+// checkAction runs the preconditions action has beyond the status machine:
+// termination protection, an impaired zone and a stuck reboot. Applying,
+// queueing and previewing an action all go through it.
+func checkAction(ctx context.Context, q querier, id, action string) error {
+	switch action {
+	case "terminate":
+		return checkTerminable(ctx, q, id)
+	case "start", "reboot", "resume":
+		return checkZoneHealthy(ctx, q, id)
+	case "complete-reboot":
+		return checkRebootStuck(ctx, q, id)
+	}
+	return nil
+}
 
-	//Updating Server
-	updateSQL := fmt.Sprintf("UPDATE servers SET %s WHERE id = $%d", setClause, argn)
-	args = append(args, id)
-	if _, err := tx.ExecContext(ctx, updateSQL, args...); err != nil {
+// applyAction moves a locked, settled server on by action: straight to the
+// action's target, or into its transitional status when one is configured
+func (s *Store) applyAction(ctx context.Context, tx *sql.Tx, cur *lockedServer, action string) (string, error) {
+	target, err := domain.ActionTarget(cur.status, action)
+	if err != nil {
 		return "", err
 	}
-	//Inserting event
-	if _, err := tx.ExecContext(ctx,
-		`INSERT INTO server_events (server_id, event, message) VALUES ($1, $2, $3)`,
-		id, action, fmt.Sprintf("server %s", action)); err != nil {
+	if err := checkAction(ctx, tx, cur.id, action); err != nil {
 		return "", err
 	}
-	if err := tx.Commit(); err != nil {
+	status := target
+	d := s.Transitions.duration(action)
+	if d > 0 {
+		status = domain.TransitionalStatus(action)
+	}
+	updates := s.billingUpdates(cur.status, status)
+	var args []any
+	data := map[string]any{
+		"previous_status": cur.status,
+		"new_status":      status,
+	}
+	if d > 0 {
+		updates = append(updates,
+			"transition_action=$3,transition_target=$4,transition_started_at=now(),transition_due_at=now()+$5*interval '1 millisecond'")
+		args = append(args, action, target, d.Milliseconds())
+		data["target_status"] = target
+		data["duration_ms"] = d.Milliseconds()
+	} else {
+		updates = append(updates, arrivalUpdates(action)...)
+	}
+	billing, err := cur.update(ctx, tx, status, updates, args...)
+	if err != nil {
 		return "", err
 	}
-	return target, nil
+	for k, v := range billing {
+		data[k] = v
+	}
+	//Inserting event (+ webhook outbox row in the same transaction)
+	msg := fmt.Sprintf("server %s (%s -> %s)", action, cur.status, status)
+	if err := recordEvent(ctx, tx, cur.id, action, msg, data); err != nil {
+		return "", err
+	}
+	switch {
+	case status == "TERMINATED":
+		if err := releaseVolumes(ctx, tx, cur.id); err != nil {
+			return "", err
+		}
+	case action == "reboot":
+		if err := s.injectStuckReboot(ctx, tx, cur.id); err != nil {
+			return "", err
+		}
+	}
+	return status, nil
 }
 
-func (s *Store) GetServerLogs(ctx context.Context, id string) ([]ServerEvent, error) {
+// GetServerLogs returns the newest events of a server (at most 100 unless
+// f.Limit says otherwise), newest first
+func (s *Store) GetServerLogs(ctx context.Context, id string, f LogFilter) ([]ServerEvent, error) {
+	limit := f.Limit
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	conds := []string{"server_id=$1"}
+	args := []any{id}
+	argn := 2
+	if len(f.Events) > 0 {
+		conds = append(conds, fmt.Sprintf("event = ANY($%d)", argn))
+		args = append(args, f.Events)
+		argn++
+	}
+	if !f.Since.IsZero() {
+		conds = append(conds, fmt.Sprintf("ts >= $%d", argn))
+		args = append(args, f.Since)
+		argn++
+	}
+	if !f.Until.IsZero() {
+		conds = append(conds, fmt.Sprintf("ts < $%d", argn))
+		args = append(args, f.Until)
+		argn++
+	}
+	args = append(args, limit)
+
 	rows, err := s.DB.QueryContext(ctx, `
-	SELECT ts,event,message 
+	SELECT id,server_id,ts,event,COALESCE(message,''),data
 	FROM server_events
-	WHERE server_id=$1
-	ORDER BY ts DESC
-	LIMIT 100
-	`, id)
+	WHERE `+strings.Join(conds, " AND ")+`
+	ORDER BY ts DESC, id DESC
+	LIMIT `+fmt.Sprintf("$%d", argn), args...)
 	if err != nil {
 		return nil, err
 	}
@@ -326,9 +492,11 @@ func (s *Store) GetServerLogs(ctx context.Context, id string) ([]ServerEvent, er
 	var events []ServerEvent
 	for rows.Next() {
 		var ev ServerEvent
-		if err := rows.Scan(&ev.Timestamp, &ev.Event, &ev.Message); err != nil {
+		var data []byte
+		if err := rows.Scan(&ev.ID, &ev.ServerID, &ev.Timestamp, &ev.Event, &ev.Message, &data); err != nil {
 			return nil, err
 		}
+		ev.Data = data
 		events = append(events, ev)
 	}
 	if err := rows.Err(); err != nil {
@@ -337,87 +505,116 @@ func (s *Store) GetServerLogs(ctx context.Context, id string) ([]ServerEvent, er
 	return events, nil
 }
 
-//AccrueBilling updates accrued_seconds/costs for all running serverss
+//AccrueBilling updates accrued_seconds/costs for all running (or billed
+//transitional) and hibernated servers
 
 func (s *Store) AccrueBilling(ctx context.Context) (int64, error) {
-	res, err := s.DB.ExecContext(ctx, `
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	if err := checkFence(ctx, tx); err != nil {
+		return 0, err
+	}
+	// RUNNING servers accrue uptime at the compute rate, HIBERNATED ones
+	// only the storage rate
+	res, err := tx.ExecContext(ctx, `
 	UPDATE servers
-	SET accrued_seconds =COALESCE(accrued_seconds,0)+
-	EXTRACT (EPOCH FROM (now()-billing_last_at))::bigint,
-	accrued_cost=COALESCE(accrued_cost,0)+
-	(EXTRACT(EPOCH FROM (now()-billing_last_at))/ 3600.0 *
-	(SELECT hourly_rate FROM instance_types it WHERE it.type=servers.type)),
+	SET accrued_seconds = COALESCE(accrued_seconds,0) +
+	CASE WHEN status = 'HIBERNATED' THEN 0 ELSE EXTRACT(EPOCH FROM (now()-billing_last_at))::bigint END,
+	accrued_cost = COALESCE(accrued_cost,0) +
+	(EXTRACT(EPOCH FROM (now()-billing_last_at)) / 3600.0 *
+	(SELECT CASE WHEN servers.status = 'HIBERNATED' THEN it.storage_hourly_rate ELSE it.hourly_rate END
+	 FROM instance_types it WHERE it.type=servers.type)),
 	billing_last_at=now(),
 	updated_at=now()
-	WHERE status ='RUNNING'
+	WHERE (status::text = ANY($1) OR status = 'HIBERNATED')
 	AND billing_last_at IS NOT NULL
-	`)
+	`, s.Transitions.computeStatuses())
 	if err != nil {
 		return 0, err
 	}
 	rows, _ := res.RowsAffected()
-	return rows, nil
+	return rows, tx.Commit()
 }
 
-// ReapIdleServers terminates servers stopped for >30 minutes
-// Returns number of servers stopped
-func (s *Store) ReapIdleServers(ctx context.Context) (int64, error) {
-	res, err := s.DB.ExecContext(ctx, `
-UPDATE servers
-SET status = 'TERMINATED',
-    terminated_at = now(),
-    updated_at = now()
-WHERE status = 'STOPPED'
-  AND stopped_since IS NOT NULL
-  AND stopped_since < now() - interval '30 minutes'
-`)
+// NewServer is what CreateServer provisions; all but Name, Region and
+// Type are optional. Zone pins the zone; otherwise PlacementGroupID's
+// strategy or Placement (spread by default) picks it.
+type NewServer struct {
+	Name             string
+	Region           string
+	Type             string
+	ImageID          string
+	SubnetID         string
+	SecurityGroupIDs []string
+	Labels           map[string]string
+	Zone             string
+	Placement        string
+	PlacementGroupID string
+}
 
+// CreateServer provisons a new server wwith a free ip from the pool
+func (s *Store) CreateServer(ctx context.Context, n NewServer) (string, error) {
+	name, region, stype, labels := n.Name, n.Region, n.Type, n.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labelsJSON, err := json.Marshal(labels)
 	if err != nil {
-		return 0, err
+		return "", err
+	}
+	if s.Chaos.Inject(chaos.FaultProvisionFailure, region, labels) {
+		return "", &domain.ProvisionFailedError{Region: region}
 	}
-	rows, _ := res.RowsAffected()
-	if rows > 0 {
-		//Inserting event rows for reaped servers
-		_, _ = s.DB.ExecContext(ctx, `
-	INSERT INTO server_events(server_id,event,message)
-	SELECT id,'reaped','server auto-termianted after 30m idle'
-	FROM servers
-	WHERE status='TERMINATED'
-	AND terminated_at >now()-interval '1 minute'
-	`)
-	}
-	return rows, nil
-}
 
-// CreateServer provisons a new server wwith a free ip from the pool
-func (s *Store) CreateServer(ctx context.Context, name, region, stype string) (string, error) {
 	tx, err := s.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return "", err
 	}
 	defer tx.Rollback()
 
+	if n.ImageID != "" {
+		if err := checkImage(ctx, tx, n.ImageID, region, stype); err != nil {
+			return "", err
+		}
+	}
+
+	subnetID, err := serverSubnet(ctx, tx, n.SubnetID, region)
+	if err != nil {
+		return "", err
+	}
+	zone, err := placeServer(ctx, tx, n, subnetID)
+	if err != nil {
+		return "", err
+	}
+
 	//Allocating IP atomically
 	var ipID int64
+	var ip string
 	err = tx.QueryRowContext(ctx, `
-	SELECT id
+	SELECT id, ip::text
 	FROM ip_pool
-	WHERE region =$1 AND allocated =FALSE
+	WHERE subnet_id =$1 AND allocated =FALSE
 	ORDER BY id
 	FOR UPDATE SKIP LOCKED
 	LIMIT 1
-	`, region).Scan(&ipID)
+	`, subnetID).Scan(&ipID, &ip)
+	if err == sql.ErrNoRows {
+		return "", &domain.IPPoolExhaustedError{Region: region, SubnetID: n.SubnetID}
+	}
 	if err != nil {
-		return "", fmt.Errorf("no free IPs in region %s:%w", region, err)
+		return "", err
 	}
 
 	//Insert INTO servers
 	var serverID string
 	err = tx.QueryRowContext(ctx, `
-INSERT INTO servers (id, name, region, type, status, ip_id, stopped_since, billing_last_at)
-VALUES (gen_random_uuid(), $1, $2, $3, 'STOPPED', $4, now(), now())
+INSERT INTO servers (id, name, region, type, status, ip_id, subnet_id, labels, image_id, zone, placement_group_id, stopped_since, billing_last_at)
+VALUES (gen_random_uuid(), $1, $2, $3, 'STOPPED', $4, $5, $6::jsonb, NULLIF($7,'')::uuid, NULLIF($8,''), NULLIF($9,'')::uuid, now(), now())
 RETURNING id
-`, name, region, stype, ipID).Scan(&serverID)
+`, name, region, stype, ipID, subnetID, string(labelsJSON), n.ImageID, zone, n.PlacementGroupID).Scan(&serverID)
 
 	if err != nil {
 		return "", err
@@ -434,14 +631,30 @@ RETURNING id
 		return "", err
 	}
 	//Inserting lifecycle events
-	_, err = tx.ExecContext(ctx, `
-	INSERT INTO server_events(server_id,event,message)VALUES
-	($1,'created','server created'),
-	($1,'ip_allocated','private IP assigned'),
-	($1,'stopped','server is stopped and ready')
-	`, serverID)
-
-	if err != nil {
+	created := map[string]any{"name": name, "region": region, "type": stype, "labels": labels}
+	if n.ImageID != "" {
+		created["image_id"] = n.ImageID
+	}
+	if zone != "" {
+		created["zone"] = zone
+	}
+	if n.PlacementGroupID != "" {
+		created["placement_group_id"] = n.PlacementGroupID
+	}
+	events := []struct {
+		event, message string
+		data           map[string]any
+	}{
+		{"created", "server created", created},
+		{"ip_allocated", "private IP assigned", map[string]any{"ip": ip, "subnet_id": subnetID}},
+		{"stopped", "server is stopped and ready", map[string]any{"previous_status": "PENDING", "new_status": "STOPPED"}},
+	}
+	for _, ev := range events {
+		if err := recordEvent(ctx, tx, serverID, ev.event, ev.message, ev.data); err != nil {
+			return "", err
+		}
+	}
+	if err := attachSecurityGroups(ctx, tx, serverID, region, n.SecurityGroupIDs); err != nil {
 		return "", err
 	}
 
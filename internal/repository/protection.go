@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"virtualservers/internal/domain"
+)
+
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// checkTerminable returns a *domain.ProtectedError when the server may not be
+// terminated. Call it inside the transaction that holds the server row lock.
+func checkTerminable(ctx context.Context, q querier, id string) error {
+	var protected bool
+	if err := q.QueryRowContext(ctx, `SELECT termination_protection FROM servers WHERE id=$1`, id).Scan(&protected); err != nil {
+		return err
+	}
+	locks, err := listLocks(ctx, q, id)
+	if err != nil {
+		return err
+	}
+	if !protected && len(locks) == 0 {
+		return nil
+	}
+	return &domain.ProtectedError{ServerID: id, Protection: protected, Locks: locks}
+}
+
+// lockServerRow takes the row lock ApplyAction also takes, so protection
+// changes and terminations serialize. Returns sql.ErrNoRows if missing.
+func lockServerRow(ctx context.Context, tx *sql.Tx, id string) error {
+	var one int
+	return tx.QueryRowContext(ctx, `SELECT 1 FROM servers WHERE id=$1 FOR UPDATE`, id).Scan(&one)
+}
+
+// SetTerminationProtection turns the flag on or off and audits the change.
+// Returns sql.ErrNoRows when the server does not exist.
+func (s *Store) SetTerminationProtection(ctx context.Context, id string, enabled bool) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockServerRow(ctx, tx, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+	UPDATE servers SET termination_protection=$2, updated_at=now() WHERE id=$1
+	`, id, enabled); err != nil {
+		return err
+	}
+	event, msg := "protection_disabled", "termination protection disabled"
+	if enabled {
+		event, msg = "protection_enabled", "termination protection enabled"
+	}
+	if err := recordEvent(ctx, tx, id, event, msg, map[string]any{"termination_protection": enabled}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListLocks returns the deletion locks of a server, oldest first
+func (s *Store) ListLocks(ctx context.Context, id string) ([]domain.ServerLock, error) {
+	return listLocks(ctx, s.DB, id)
+}
+
+func listLocks(ctx context.Context, q querier, id string) ([]domain.ServerLock, error) {
+	rows, err := q.QueryContext(ctx, `
+	SELECT server_id, name, reason, created_by, created_at
+	FROM server_locks
+	WHERE server_id=$1
+	ORDER BY created_at
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	locks := []domain.ServerLock{}
+	for rows.Next() {
+		var l domain.ServerLock
+		if err := rows.Scan(&l.ServerID, &l.Name, &l.Reason, &l.CreatedBy, &l.CreatedAt); err != nil {
+			return nil, err
+		}
+		locks = append(locks, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return locks, nil
+}
+
+// AddLock places a named deletion lock held by the ctx actor. Returns
+// sql.ErrNoRows when the server does not exist and domain.ErrLockExists on a
+// duplicate name.
+func (s *Store) AddLock(ctx context.Context, id, name, reason string) (*domain.ServerLock, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := lockServerRow(ctx, tx, id); err != nil {
+		return nil, err
+	}
+	l := domain.ServerLock{ServerID: id, Name: name, Reason: reason, CreatedBy: ActorFrom(ctx)}
+	err = tx.QueryRowContext(ctx, `
+	INSERT INTO server_locks (server_id, name, reason, created_by)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT DO NOTHING
+	RETURNING created_at
+	`, id, name, reason, l.CreatedBy).Scan(&l.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrLockExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	data := map[string]any{"lock": name, "reason": reason}
+	if err := recordEvent(ctx, tx, id, "lock_added", fmt.Sprintf("deletion lock %q added", name), data); err != nil {
+		return nil, err
+	}
+	return &l, tx.Commit()
+}
+
+// RemoveLock clears a named lock and audits it. Returns sql.ErrNoRows when
+// the server or lock does not exist.
+func (s *Store) RemoveLock(ctx context.Context, id, name string) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockServerRow(ctx, tx, id); err != nil {
+		return err
+	}
+	var reason, owner string
+	err = tx.QueryRowContext(ctx, `
+	DELETE FROM server_locks WHERE server_id=$1 AND name=$2
+	RETURNING reason, created_by
+	`, id, name).Scan(&reason, &owner)
+	if err != nil {
+		return err
+	}
+	data := map[string]any{"lock": name, "reason": reason, "held_by": owner}
+	if err := recordEvent(ctx, tx, id, "lock_removed", fmt.Sprintf("deletion lock %q removed", name), data); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
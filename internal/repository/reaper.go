@@ -0,0 +1,282 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+type ReaperPolicy struct {
+	ID                    string            `json:"id"`
+	Name                  string            `json:"name"`
+	Project               *string           `json:"project,omitempty"`
+	Selector              map[string]string `json:"selector"`
+	IdleSeconds           int               `json:"idle_seconds"`
+	HibernatedIdleSeconds *int              `json:"hibernated_idle_seconds,omitempty"` // nil: HIBERNATED servers are never reaped
+	WarnBeforeSeconds     int               `json:"warn_before_seconds"`
+	ExcludeServerIDs      []string          `json:"exclude_server_ids"`
+	DryRun                bool              `json:"dry_run"`
+	Priority              int               `json:"priority"`
+	Enabled               bool              `json:"enabled"`
+	CreatedAt             time.Time         `json:"created_at"`
+	UpdatedAt             time.Time         `json:"updated_at"`
+}
+
+// Matches reports whether a server with the given labels falls under p
+func (p ReaperPolicy) Matches(labels map[string]string) bool {
+	if p.Project != nil && labels["project"] != *p.Project {
+		return false
+	}
+	for k, v := range p.Selector {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Excludes reports whether the server is on the policy's exclude list
+func (p ReaperPolicy) Excludes(serverID string) bool {
+	for _, id := range p.ExcludeServerIDs {
+		if id == serverID {
+			return true
+		}
+	}
+	return false
+}
+
+// IdleServer is a STOPPED or HIBERNATED server the reaper may act on
+type IdleServer struct {
+	ID     string
+	Name   string
+	Status string
+	Labels map[string]string
+	// StoppedSince is when the server was stopped or hibernated
+	StoppedSince time.Time
+	WarnedAt     *time.Time // only set when warned during the current stop
+}
+
+// idleSinceSQL is when a STOPPED or HIBERNATED server went idle
+const idleSinceSQL = `CASE status WHEN 'HIBERNATED' THEN hibernated_at ELSE stopped_since END`
+
+const reaperPolicySelect = `
+	SELECT id, name, project, selector, idle_seconds, hibernated_idle_seconds, warn_before_seconds,
+	       exclude_server_ids::text[], dry_run, priority, enabled, created_at, updated_at
+	FROM reaper_policies
+`
+
+func scanReaperPolicy(row rowScanner) (*ReaperPolicy, error) {
+	var p ReaperPolicy
+	var project sql.NullString
+	var hibernatedIdle sql.NullInt64
+	var selector []byte
+	if err := row.Scan(&p.ID, &p.Name, &project, &selector, &p.IdleSeconds, &hibernatedIdle, &p.WarnBeforeSeconds,
+		textArray(&p.ExcludeServerIDs), &p.DryRun, &p.Priority, &p.Enabled, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if project.Valid {
+		v := project.String
+		p.Project = &v
+	}
+	if hibernatedIdle.Valid {
+		v := int(hibernatedIdle.Int64)
+		p.HibernatedIdleSeconds = &v
+	}
+	if err := json.Unmarshal(selector, &p.Selector); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (s *Store) CreateReaperPolicy(ctx context.Context, p ReaperPolicy) (*ReaperPolicy, error) {
+	if p.Selector == nil {
+		p.Selector = map[string]string{}
+	}
+	if p.ExcludeServerIDs == nil {
+		p.ExcludeServerIDs = []string{}
+	}
+	selector, err := json.Marshal(p.Selector)
+	if err != nil {
+		return nil, err
+	}
+	row := s.DB.QueryRowContext(ctx, `
+	INSERT INTO reaper_policies
+	  (name, project, selector, idle_seconds, hibernated_idle_seconds, warn_before_seconds, exclude_server_ids, dry_run, priority, enabled)
+	VALUES ($1, $2, $3::jsonb, $4, $5, $6, $7::uuid[], $8, $9, $10)
+	RETURNING id, name, project, selector, idle_seconds, hibernated_idle_seconds, warn_before_seconds,
+	          exclude_server_ids::text[], dry_run, priority, enabled, created_at, updated_at
+	`, p.Name, p.Project, string(selector), p.IdleSeconds, p.HibernatedIdleSeconds, p.WarnBeforeSeconds,
+		p.ExcludeServerIDs, p.DryRun, p.Priority, p.Enabled)
+	return scanReaperPolicy(row)
+}
+
+// ListReaperPolicies returns all policies, highest priority first
+func (s *Store) ListReaperPolicies(ctx context.Context) ([]ReaperPolicy, error) {
+	rows, err := s.DB.QueryContext(ctx, reaperPolicySelect+` ORDER BY priority DESC, created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []ReaperPolicy
+	for rows.Next() {
+		p, err := scanReaperPolicy(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetReaperPolicy returns nil when the policy does not exist
+func (s *Store) GetReaperPolicy(ctx context.Context, id string) (*ReaperPolicy, error) {
+	p, err := scanReaperPolicy(s.DB.QueryRowContext(ctx, reaperPolicySelect+` WHERE id=$1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return p, err
+}
+
+// DeleteReaperPolicy returns sql.ErrNoRows when the policy does not exist
+func (s *Store) DeleteReaperPolicy(ctx context.Context, id string) error {
+	res, err := s.DB.ExecContext(ctx, `DELETE FROM reaper_policies WHERE id=$1`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ListIdleServers returns every STOPPED or HIBERNATED server with a known
+// stop time that is not termination protected or locked
+func (s *Store) ListIdleServers(ctx context.Context) ([]IdleServer, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+	SELECT id, COALESCE(name,''), status::text, labels, idle_since,
+	       CASE WHEN reaper_warned_at >= idle_since THEN reaper_warned_at END
+	FROM (SELECT *, `+idleSinceSQL+` AS idle_since FROM servers) s
+	WHERE status IN ('STOPPED','HIBERNATED')
+	  AND idle_since IS NOT NULL
+	  AND NOT termination_protection
+	  AND NOT EXISTS (SELECT 1 FROM server_locks l WHERE l.server_id = s.id)
+	ORDER BY idle_since
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []IdleServer
+	for rows.Next() {
+		var sv IdleServer
+		var labels []byte
+		var warned sql.NullTime
+		if err := rows.Scan(&sv.ID, &sv.Name, &sv.Status, &labels, &sv.StoppedSince, &warned); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(labels, &sv.Labels); err != nil {
+			return nil, err
+		}
+		if warned.Valid {
+			t := warned.Time
+			sv.WarnedAt = &t
+		}
+		out = append(out, sv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// WarnIdleServer records the pre-termination warning for the server's
+// current stop period. Returns false if the server is no longer that idle.
+func (s *Store) WarnIdleServer(ctx context.Context, sv IdleServer, policy string, terminateAt time.Time) (bool, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	if err := checkFence(ctx, tx); err != nil {
+		return false, err
+	}
+
+	res, err := tx.ExecContext(ctx, `
+	UPDATE servers
+	SET reaper_warned_at = now()
+	WHERE id = $1 AND status = $3::server_status AND `+idleSinceSQL+` = $2
+	`, sv.ID, sv.StoppedSince, sv.Status)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	data := map[string]any{
+		"policy":       policy,
+		"idle_since":   sv.StoppedSince,
+		"terminate_at": terminateAt,
+	}
+	msg := "server will be auto-terminated at " + terminateAt.UTC().Format(time.RFC3339)
+	if err := recordEvent(ctx, tx, sv.ID, "reap_warning", msg, data); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// reapBillingSQL closes out the storage billing of a hibernated server
+// being reaped; stopped servers have nothing left to bill
+const reapBillingSQL = `accrued_cost = CASE WHEN status = 'HIBERNATED'
+	    THEN COALESCE(accrued_cost,0) + (EXTRACT(EPOCH FROM (now() - billing_last_at)) / 3600.0 *
+	         (SELECT storage_hourly_rate FROM instance_types it WHERE it.type = servers.type))
+	    ELSE accrued_cost END`
+
+// ReapServer terminates an idle server on behalf of policy. Returns false if
+// it was started, protected or locked since it was selected.
+func (s *Store) ReapServer(ctx context.Context, sv IdleServer, policy string) (bool, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	if err := checkFence(ctx, tx); err != nil {
+		return false, err
+	}
+
+	res, err := tx.ExecContext(ctx, `
+	UPDATE servers
+	SET `+reapBillingSQL+`,
+	    status = 'TERMINATED',
+	    terminated_at = now(),
+	    updated_at = now()
+	WHERE id = $1 AND status = $3::server_status AND `+idleSinceSQL+` = $2
+	  AND NOT termination_protection
+	  AND NOT EXISTS (SELECT 1 FROM server_locks l WHERE l.server_id = servers.id)
+	`, sv.ID, sv.StoppedSince, sv.Status)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	data := map[string]any{
+		"previous_status": sv.Status,
+		"new_status":      "TERMINATED",
+		"policy":          policy,
+		"idle_since":      sv.StoppedSince,
+	}
+	msg := "server auto-terminated by reaper policy " + policy
+	if err := recordEvent(ctx, tx, sv.ID, "reaped", msg, data); err != nil {
+		return false, err
+	}
+	if err := releaseVolumes(ctx, tx, sv.ID); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"virtualservers/internal/domain"
+)
+
+// ResizeResult describes a completed resize
+type ResizeResult struct {
+	ID           string `json:"id"`
+	Status       string `json:"status"`
+	PreviousType string `json:"previous_type"`
+	Type         string `json:"type"`
+}
+
+// Resize changes a server's instance type. STOPPED servers are resized in
+// place. With live set, RUNNING servers are resized too: billing up to now
+// is closed out at the old rate and the server goes to REBOOTING; the
+// complete-reboot action restarts billing at the new rate. A live resize
+// keeps the server's host while the new type fits there and moves it to
+// another host of its zone otherwise. The new type must allow as many
+// volumes as the server has attached.
+func (s *Store) Resize(ctx context.Context, id, newType string, live bool) (*ResizeResult, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if err := checkFence(ctx, tx); err != nil {
+		return nil, err
+	}
+
+	// A live resize may move the server off the host it holds, so the zone's
+	// hosts are locked before the server (lockZoneHosts)
+	var zone string
+	if err := tx.QueryRowContext(ctx, `SELECT COALESCE(zone,'') FROM servers WHERE id=$1`, id).Scan(&zone); err != nil {
+		return nil, err
+	}
+	if live {
+		if _, err := lockZoneHosts(ctx, tx, zone); err != nil {
+			return nil, err
+		}
+	}
+
+	var current, oldType, host string
+	var prevSeconds int64
+	var prevCost, oldRate float64
+	err = tx.QueryRowContext(ctx, `
+	SELECT s.status::text, s.type, s.accrued_seconds, s.accrued_cost, it.hourly_rate,
+	       COALESCE(s.host_id::text,'')
+	FROM servers s
+	JOIN instance_types it ON it.type = s.type
+	WHERE s.id = $1
+	FOR UPDATE OF s
+	`, id).Scan(&current, &oldType, &prevSeconds, &prevCost, &oldRate, &host)
+	if err != nil {
+		return nil, err
+	}
+	target, err := domain.ResizeTarget(current, live)
+	if err != nil {
+		return nil, err
+	}
+	if newType == oldType {
+		return nil, &domain.ValidationError{Message: fmt.Sprintf("server is already of type %s", newType)}
+	}
+	var newRate float64
+	var maxVolumes int
+	err = tx.QueryRowContext(ctx, `SELECT hourly_rate, max_volumes FROM instance_types WHERE type=$1`, newType).Scan(&newRate, &maxVolumes)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, &domain.ValidationError{Message: fmt.Sprintf("unknown instance type %q", newType)}
+	}
+	if err != nil {
+		return nil, err
+	}
+	// The server lock serializes this against attachments (AttachVolume)
+	var attached int
+	if err := tx.QueryRowContext(ctx, `SELECT count(*) FROM volumes WHERE server_id=$1`, id).Scan(&attached); err != nil {
+		return nil, err
+	}
+	if attached > maxVolumes {
+		return nil, &domain.QuotaExceededError{Resource: "volume_attachments", Limit: maxVolumes, Used: attached}
+	}
+	newHost := host
+	if domain.HoldsHost(target) {
+		if newHost, err = scheduleHost(ctx, tx, zone, newType, id, host); err != nil {
+			return nil, err
+		}
+	}
+
+	// Close out billing at the old type's rate in the same statement that
+	// switches the type
+	var newSeconds int64
+	var newCost float64
+	err = tx.QueryRowContext(ctx, `
+	UPDATE servers SET
+	  accrued_seconds = CASE WHEN status='RUNNING' THEN COALESCE(accrued_seconds,0) + EXTRACT(EPOCH FROM (now()-billing_last_at))::bigint ELSE accrued_seconds END,
+	  accrued_cost = CASE WHEN status='RUNNING' THEN COALESCE(accrued_cost,0) + (EXTRACT(EPOCH FROM (now() - billing_last_at)) / 3600.0 * (SELECT hourly_rate FROM instance_types WHERE type=$3)) ELSE accrued_cost END,
+	  billing_last_at = CASE WHEN status='RUNNING' THEN now() ELSE billing_last_at END,
+	  type = $2,
+	  status = $4::server_status,
+	  host_id = NULLIF($5,'')::uuid,
+	  updated_at = now()
+	WHERE id = $1
+	RETURNING accrued_seconds, accrued_cost
+	`, id, newType, oldType, target, newHost).Scan(&newSeconds, &newCost)
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string]any{
+		"previous_type":   oldType,
+		"new_type":        newType,
+		"previous_rate":   oldRate,
+		"new_rate":        newRate,
+		"previous_status": current,
+		"new_status":      target,
+		"live":            current == "RUNNING",
+	}
+	if newSeconds != prevSeconds || newCost != prevCost {
+		data["billed_seconds"] = newSeconds - prevSeconds
+		data["cost_delta"] = newCost - prevCost
+	}
+	if newHost != host {
+		data["previous_host_id"] = host
+		data["host_id"] = newHost
+	}
+	msg := fmt.Sprintf("server resized (%s -> %s)", oldType, newType)
+	if err := recordEvent(ctx, tx, id, "resize", msg, data); err != nil {
+		return nil, err
+	}
+	// A live resize reboots the server, which may get stuck like any reboot
+	if target == "REBOOTING" {
+		if err := s.injectStuckReboot(ctx, tx, id); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &ResizeResult{ID: id, Status: target, PreviousType: oldType, Type: newType}, nil
+}
@@ -0,0 +1,213 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+type Schedule struct {
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	CronExpr  string            `json:"cron"`
+	Timezone  string            `json:"timezone"`
+	Action    string            `json:"action"`
+	ServerID  *string           `json:"server_id,omitempty"`
+	Selector  map[string]string `json:"selector,omitempty"`
+	CatchUp   string            `json:"catch_up"`
+	Enabled   bool              `json:"enabled"`
+	NextRunAt time.Time         `json:"next_run_at"`
+	LastRunAt *time.Time        `json:"last_run_at,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+const scheduleSelect = `
+	SELECT id, name, cron_expr, timezone, action, server_id, selector, catch_up,
+	       enabled, next_run_at, last_run_at, created_at, updated_at
+	FROM schedules
+`
+
+func scanSchedule(row rowScanner) (*Schedule, error) {
+	var sc Schedule
+	var serverID sql.NullString
+	var selector []byte
+	var lastRun sql.NullTime
+	if err := row.Scan(&sc.ID, &sc.Name, &sc.CronExpr, &sc.Timezone, &sc.Action, &serverID, &selector,
+		&sc.CatchUp, &sc.Enabled, &sc.NextRunAt, &lastRun, &sc.CreatedAt, &sc.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if serverID.Valid {
+		id := serverID.String
+		sc.ServerID = &id
+	}
+	if selector != nil {
+		if err := json.Unmarshal(selector, &sc.Selector); err != nil {
+			return nil, err
+		}
+	}
+	if lastRun.Valid {
+		t := lastRun.Time
+		sc.LastRunAt = &t
+	}
+	return &sc, nil
+}
+
+// CreateSchedule stores sc; exactly one of ServerID and Selector must be set
+// and NextRunAt must already be computed
+func (s *Store) CreateSchedule(ctx context.Context, sc Schedule) (*Schedule, error) {
+	var selector any
+	if sc.ServerID == nil {
+		b, err := json.Marshal(sc.Selector)
+		if err != nil {
+			return nil, err
+		}
+		selector = string(b)
+	}
+	row := s.DB.QueryRowContext(ctx, `
+	INSERT INTO schedules (name, cron_expr, timezone, action, server_id, selector, catch_up, next_run_at)
+	VALUES ($1, $2, $3, $4, $5, $6::jsonb, $7, $8)
+	RETURNING id, name, cron_expr, timezone, action, server_id, selector, catch_up,
+	          enabled, next_run_at, last_run_at, created_at, updated_at
+	`, sc.Name, sc.CronExpr, sc.Timezone, sc.Action, sc.ServerID, selector, sc.CatchUp, sc.NextRunAt)
+	return scanSchedule(row)
+}
+
+func (s *Store) ListSchedules(ctx context.Context) ([]Schedule, error) {
+	return s.querySchedules(ctx, scheduleSelect+` ORDER BY created_at DESC`)
+}
+
+// DueSchedules returns enabled schedules whose next run is not in the future
+func (s *Store) DueSchedules(ctx context.Context, limit int) ([]Schedule, error) {
+	return s.querySchedules(ctx, scheduleSelect+`
+	WHERE enabled AND next_run_at <= now()
+	ORDER BY next_run_at
+	LIMIT $1`, limit)
+}
+
+func (s *Store) querySchedules(ctx context.Context, query string, args ...any) ([]Schedule, error) {
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Schedule
+	for rows.Next() {
+		sc, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *sc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetSchedule returns nil when the schedule does not exist
+func (s *Store) GetSchedule(ctx context.Context, id string) (*Schedule, error) {
+	sc, err := scanSchedule(s.DB.QueryRowContext(ctx, scheduleSelect+` WHERE id=$1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return sc, err
+}
+
+// DeleteSchedule returns sql.ErrNoRows when the schedule does not exist
+func (s *Store) DeleteSchedule(ctx context.Context, id string) error {
+	res, err := s.DB.ExecContext(ctx, `DELETE FROM schedules WHERE id=$1`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetScheduleEnabled pauses or resumes a schedule. Resuming sets a fresh
+// next run so paused time is not caught up. Returns nil when not found.
+func (s *Store) SetScheduleEnabled(ctx context.Context, id string, enabled bool, nextRun time.Time) (*Schedule, error) {
+	row := s.DB.QueryRowContext(ctx, `
+	UPDATE schedules
+	SET enabled=$2,
+	    next_run_at=CASE WHEN $2 AND NOT enabled THEN $3 ELSE next_run_at END,
+	    updated_at=now()
+	WHERE id=$1
+	RETURNING id, name, cron_expr, timezone, action, server_id, selector, catch_up,
+	          enabled, next_run_at, last_run_at, created_at, updated_at
+	`, id, enabled, nextRun)
+	sc, err := scanSchedule(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return sc, err
+}
+
+// AdvanceSchedule moves a schedule from run prev to next. It only succeeds
+// if next_run_at still equals prev, so concurrent schedulers cannot both
+// claim the same run, nor a scheduler that lost the lease (ErrFenced). ran
+// marks whether the run was executed or skipped.
+func (s *Store) AdvanceSchedule(ctx context.Context, id string, prev, next time.Time, ran bool) (bool, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	if err := checkFence(ctx, tx); err != nil {
+		return false, err
+	}
+	res, err := tx.ExecContext(ctx, `
+	UPDATE schedules
+	SET next_run_at=$3,
+	    last_run_at=CASE WHEN $4 THEN now() ELSE last_run_at END,
+	    updated_at=now()
+	WHERE id=$1 AND next_run_at=$2
+	`, id, prev, next, ran)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	if n != 1 {
+		return false, nil
+	}
+	return true, tx.Commit()
+}
+
+// ScheduleTargets resolves the servers a schedule applies to, skipping
+// terminated ones
+func (s *Store) ScheduleTargets(ctx context.Context, sc Schedule) ([]string, error) {
+	if sc.ServerID != nil {
+		return []string{*sc.ServerID}, nil
+	}
+	b, err := json.Marshal(sc.Selector)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.DB.QueryContext(ctx, `
+	SELECT id
+	FROM servers
+	WHERE labels @> $1::jsonb AND status <> 'TERMINATED'
+	ORDER BY id
+	`, string(b))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
@@ -0,0 +1,529 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"virtualservers/internal/domain"
+)
+
+type SecurityGroup struct {
+	ID          string              `json:"id"`
+	Name        string              `json:"name"`
+	Description string              `json:"description,omitempty"`
+	Region      string              `json:"region"`
+	Rules       []SecurityGroupRule `json:"rules"`
+	CreatedAt   time.Time           `json:"created_at"`
+	UpdatedAt   time.Time           `json:"updated_at"`
+}
+
+type SecurityGroupRule struct {
+	ID      int64  `json:"id"`
+	GroupID string `json:"group_id"`
+	domain.Rule
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+const securityGroupSelect = `
+	SELECT id, name, description, region, created_at, updated_at
+	FROM security_groups
+`
+
+const ruleSelect = `
+	SELECT id, group_id, direction, protocol, COALESCE(port_from,0), COALESCE(port_to,0),
+	       COALESCE(cidr::text,''), COALESCE(source_group_id::text,''), description, created_at
+	FROM security_group_rules
+`
+
+func scanRule(row rowScanner) (*SecurityGroupRule, error) {
+	var r SecurityGroupRule
+	if err := row.Scan(&r.ID, &r.GroupID, &r.Direction, &r.Protocol, &r.PortFrom, &r.PortTo,
+		&r.CIDR, &r.SourceGroupID, &r.Description, &r.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// queryRules returns the rules matching where, oldest first
+func queryRules(ctx context.Context, q querier, where string, args ...any) ([]SecurityGroupRule, error) {
+	rows, err := q.QueryContext(ctx, ruleSelect+" WHERE "+where+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []SecurityGroupRule{}
+	for rows.Next() {
+		r, err := scanRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *r)
+	}
+	return out, rows.Err()
+}
+
+// insertRule validates and adds a rule to a group in region; a source
+// group must be in the same region
+func insertRule(ctx context.Context, tx *sql.Tx, groupID, region string, r SecurityGroupRule) (*SecurityGroupRule, error) {
+	rule, err := domain.NormalizeRule(r.Rule)
+	if err != nil {
+		return nil, err
+	}
+	if rule.SourceGroupID != "" && rule.SourceGroupID != groupID {
+		var sourceRegion string
+		err := tx.QueryRowContext(ctx, `SELECT region FROM security_groups WHERE id=$1`, rule.SourceGroupID).Scan(&sourceRegion)
+		if err == sql.ErrNoRows {
+			return nil, &domain.ValidationError{Message: "source security group not found"}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if sourceRegion != region {
+			return nil, &domain.ValidationError{Message: fmt.Sprintf("source security group is in %s, not %s", sourceRegion, region)}
+		}
+	}
+	return scanRule(tx.QueryRowContext(ctx, `
+	INSERT INTO security_group_rules (group_id, direction, protocol, port_from, port_to, cidr, source_group_id, description)
+	VALUES ($1, $2, $3, NULLIF($4,0), NULLIF($5,0), NULLIF($6,'')::cidr, NULLIF($7,'')::uuid, $8)
+	RETURNING id, group_id, direction, protocol, COALESCE(port_from,0), COALESCE(port_to,0),
+	          COALESCE(cidr::text,''), COALESCE(source_group_id::text,''), description, created_at
+	`, groupID, rule.Direction, rule.Protocol, rule.PortFrom, rule.PortTo, rule.CIDR, rule.SourceGroupID, r.Description))
+}
+
+// CreateSecurityGroup creates a group with its initial rules in a known
+// region; names are unique per region
+func (s *Store) CreateSecurityGroup(ctx context.Context, g SecurityGroup) (*SecurityGroup, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	var known bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM ip_pool WHERE region=$1)`, g.Region).Scan(&known); err != nil {
+		return nil, err
+	}
+	if !known {
+		return nil, &domain.ValidationError{Message: fmt.Sprintf("unknown region %q", g.Region)}
+	}
+	var id string
+	err = tx.QueryRowContext(ctx, `
+	INSERT INTO security_groups (name, description, region)
+	VALUES ($1, $2, $3)
+	ON CONFLICT DO NOTHING
+	RETURNING id
+	`, g.Name, g.Description, g.Region).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, &domain.ValidationError{Message: fmt.Sprintf("security group %q already exists in %s", g.Name, g.Region)}
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range g.Rules {
+		if _, err := insertRule(ctx, tx, id, g.Region, r); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetSecurityGroup(ctx, id)
+}
+
+// ListSecurityGroups returns groups (with their rules) by name, optionally
+// in one region
+func (s *Store) ListSecurityGroups(ctx context.Context, region string) ([]SecurityGroup, error) {
+	rows, err := s.DB.QueryContext(ctx, securityGroupSelect+` WHERE ($1 = '' OR region = $1) ORDER BY region, name`, region)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []SecurityGroup
+	byID := map[string]int{}
+	for rows.Next() {
+		var g SecurityGroup
+		if err := rows.Scan(&g.ID, &g.Name, &g.Description, &g.Region, &g.CreatedAt, &g.UpdatedAt); err != nil {
+			return nil, err
+		}
+		g.Rules = []SecurityGroupRule{}
+		byID[g.ID] = len(out)
+		out = append(out, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rules, err := queryRules(ctx, s.DB, `group_id IN (SELECT id FROM security_groups WHERE $1 = '' OR region = $1)`, region)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rules {
+		if i, ok := byID[r.GroupID]; ok {
+			out[i].Rules = append(out[i].Rules, r)
+		}
+	}
+	return out, nil
+}
+
+// GetSecurityGroup returns nil when the group does not exist
+func (s *Store) GetSecurityGroup(ctx context.Context, id string) (*SecurityGroup, error) {
+	var g SecurityGroup
+	err := s.DB.QueryRowContext(ctx, securityGroupSelect+` WHERE id=$1`, id).
+		Scan(&g.ID, &g.Name, &g.Description, &g.Region, &g.CreatedAt, &g.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if g.Rules, err = queryRules(ctx, s.DB, `group_id = $1`, id); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// DeleteSecurityGroup deletes a group and its rules. Groups attached to
+// servers that are not terminated, or that other groups' rules name as
+// their source, are kept. Returns sql.ErrNoRows when not found.
+func (s *Store) DeleteSecurityGroup(ctx context.Context, id string) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var attached int
+	var referencedBy string
+	err = tx.QueryRowContext(ctx, `
+	SELECT
+	  (SELECT count(*) FROM server_security_groups ssg JOIN servers s ON s.id = ssg.server_id
+	   WHERE ssg.group_id = g.id AND s.status <> 'TERMINATED'),
+	  COALESCE((SELECT min(r.group_id::text) FROM security_group_rules r
+	   WHERE r.source_group_id = g.id AND r.group_id <> g.id), '')
+	FROM security_groups g
+	WHERE g.id = $1
+	FOR UPDATE OF g
+	`, id).Scan(&attached, &referencedBy)
+	if err != nil {
+		return err
+	}
+	switch {
+	case attached > 0:
+		return &domain.ResourceStateError{Resource: "security group", ID: id, Op: "delete",
+			Reason: fmt.Sprintf("it is attached to %d server(s)", attached)}
+	case referencedBy != "":
+		return &domain.ResourceStateError{Resource: "security group", ID: id, Op: "delete",
+			Reason: "rules of security group " + referencedBy + " refer to it"}
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM security_groups WHERE id=$1`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// AddSecurityGroupRule adds a rule to a group. Returns sql.ErrNoRows when
+// the group does not exist.
+func (s *Store) AddSecurityGroupRule(ctx context.Context, groupID string, r SecurityGroupRule) (*SecurityGroupRule, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	var region string
+	if err := tx.QueryRowContext(ctx, `
+	UPDATE security_groups SET updated_at=now() WHERE id=$1 RETURNING region
+	`, groupID).Scan(&region); err != nil {
+		return nil, err
+	}
+	rule, err := insertRule(ctx, tx, groupID, region, r)
+	if err != nil {
+		return nil, err
+	}
+	return rule, tx.Commit()
+}
+
+// DeleteSecurityGroupRule removes a rule from a group. Returns
+// sql.ErrNoRows when either does not exist.
+func (s *Store) DeleteSecurityGroupRule(ctx context.Context, groupID string, ruleID int64) error {
+	res, err := s.DB.ExecContext(ctx, `DELETE FROM security_group_rules WHERE id=$1 AND group_id=$2`, ruleID, groupID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	_, err = s.DB.ExecContext(ctx, `UPDATE security_groups SET updated_at=now() WHERE id=$1`, groupID)
+	return err
+}
+
+// ListServerSecurityGroups returns the groups attached to a server.
+// Returns sql.ErrNoRows when the server does not exist.
+func (s *Store) ListServerSecurityGroups(ctx context.Context, serverID string) ([]SecurityGroup, error) {
+	var exists bool
+	if err := s.DB.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM servers WHERE id=$1)`, serverID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, sql.ErrNoRows
+	}
+	rows, err := s.DB.QueryContext(ctx, `
+	SELECT g.id FROM security_groups g
+	JOIN server_security_groups ssg ON ssg.group_id = g.id
+	WHERE ssg.server_id = $1
+	ORDER BY ssg.attached_at
+	`, serverID)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	out := []SecurityGroup{}
+	for _, id := range ids {
+		g, err := s.GetSecurityGroup(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if g != nil {
+			out = append(out, *g)
+		}
+	}
+	return out, nil
+}
+
+// attachSecurityGroups attaches groups in region to a locked server,
+// skipping ones already attached, within the per-server limit
+func attachSecurityGroups(ctx context.Context, tx *sql.Tx, serverID, region string, groupIDs []string) error {
+	var used int
+	if err := tx.QueryRowContext(ctx, `SELECT count(*) FROM server_security_groups WHERE server_id=$1`, serverID).Scan(&used); err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	var attach []string
+	for _, id := range groupIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		var groupRegion string
+		var attached bool
+		err := tx.QueryRowContext(ctx, `
+		SELECT region, EXISTS (SELECT 1 FROM server_security_groups WHERE server_id=$2 AND group_id=$1)
+		FROM security_groups WHERE id=$1
+		FOR SHARE
+		`, id, serverID).Scan(&groupRegion, &attached)
+		if err == sql.ErrNoRows {
+			return &domain.ValidationError{Message: fmt.Sprintf("security group %s not found", id)}
+		}
+		if err != nil {
+			return err
+		}
+		if groupRegion != region {
+			return &domain.ValidationError{Message: fmt.Sprintf("security group %s is in %s, not %s", id, groupRegion, region)}
+		}
+		if !attached {
+			attach = append(attach, id)
+		}
+	}
+	if used+len(attach) > domain.MaxSecurityGroupsPerServer {
+		return &domain.QuotaExceededError{Resource: "security_groups", Limit: domain.MaxSecurityGroupsPerServer,
+			Used: used, Requested: len(attach)}
+	}
+	for _, id := range attach {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO server_security_groups (server_id, group_id) VALUES ($1, $2)`, serverID, id); err != nil {
+			return err
+		}
+		if err := recordEvent(ctx, tx, serverID, "security_group_attached", "security group "+id+" attached",
+			map[string]any{"security_group_id": id}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AttachSecurityGroup attaches a group in the server's region (a no-op if
+// it already is). Returns sql.ErrNoRows when the server does not exist.
+func (s *Store) AttachSecurityGroup(ctx context.Context, serverID, groupID string) ([]SecurityGroup, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	var status, region string
+	if err := tx.QueryRowContext(ctx, `
+	SELECT status::text, region FROM servers WHERE id=$1 FOR UPDATE
+	`, serverID).Scan(&status, &region); err != nil {
+		return nil, err
+	}
+	if status == "TERMINATED" {
+		return nil, &domain.ResourceStateError{Resource: "server", ID: serverID, Op: "attach a security group to", Status: status}
+	}
+	if err := attachSecurityGroups(ctx, tx, serverID, region, []string{groupID}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.ListServerSecurityGroups(ctx, serverID)
+}
+
+// DetachSecurityGroup detaches a group from a server. Returns
+// sql.ErrNoRows when it is not attached.
+func (s *Store) DetachSecurityGroup(ctx context.Context, serverID, groupID string) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, `DELETE FROM server_security_groups WHERE server_id=$1 AND group_id=$2`, serverID, groupID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	if err := recordEvent(ctx, tx, serverID, "security_group_detached", "security group "+groupID+" detached",
+		map[string]any{"security_group_id": groupID}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Reachability is the answer to "can Source reach a server on
+// Protocol/Port", computed from the security groups involved
+type Reachability struct {
+	ServerID string `json:"server_id"`
+	Source   string `json:"source"`
+	Protocol string `json:"protocol"`
+	Port     int    `json:"port,omitempty"`
+	Allowed  bool   `json:"allowed"`
+	Reason   string `json:"reason"`
+	// SourceServerID is the server holding the source address, whose egress
+	// rules are checked as well
+	SourceServerID string             `json:"source_server_id,omitempty"`
+	IngressRule    *SecurityGroupRule `json:"ingress_rule,omitempty"`
+	EgressRule     *SecurityGroupRule `json:"egress_rule,omitempty"`
+}
+
+// CheckReachability evaluates whether traffic from source reaches a
+// server: an ingress rule of the server's groups must match it and, when
+// source is the address of another server in the region, an egress rule
+// of that server's groups as well. Nothing reaches a server, or leaves
+// one, in an impaired zone. Returns nil when the server does not exist.
+func (s *Store) CheckReachability(ctx context.Context, serverID string, source netip.Addr, protocol string, port int) (*Reachability, error) {
+	var region, ip, impairedZone string
+	err := s.DB.QueryRowContext(ctx, `
+	SELECT s.region, COALESCE((SELECT ip::text FROM ip_pool WHERE id = s.ip_id), ''),
+	       COALESCE((SELECT name FROM zones WHERE name = s.zone AND impaired), '')
+	FROM servers s WHERE s.id=$1
+	`, serverID).Scan(&region, &ip, &impairedZone)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := &Reachability{ServerID: serverID, Source: source.String(), Protocol: protocol, Port: port}
+	traffic := protocol
+	if port != 0 {
+		traffic += fmt.Sprintf("/%d", port)
+	}
+
+	if impairedZone != "" {
+		out.Reason = fmt.Sprintf("the server's zone %s is impaired", impairedZone)
+		return out, nil
+	}
+
+	var sourceImpairedZone string
+	err = s.DB.QueryRowContext(ctx, `
+	SELECT s.id, COALESCE((SELECT name FROM zones WHERE name = s.zone AND impaired), '')
+	FROM ip_pool p JOIN servers s ON s.id = p.server_id
+	WHERE p.region=$1 AND p.ip=$2::inet AND s.status <> 'TERMINATED' AND s.id <> $3
+	`, region, source.String(), serverID).Scan(&out.SourceServerID, &sourceImpairedZone)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if sourceImpairedZone != "" {
+		out.Reason = fmt.Sprintf("source server %s's zone %s is impaired", out.SourceServerID, sourceImpairedZone)
+		return out, nil
+	}
+
+	groupsOf := func(id string) (map[string]bool, error) {
+		rows, err := s.DB.QueryContext(ctx, `SELECT group_id FROM server_security_groups WHERE server_id=$1`, id)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		groups := map[string]bool{}
+		for rows.Next() {
+			var g string
+			if err := rows.Scan(&g); err != nil {
+				return nil, err
+			}
+			groups[g] = true
+		}
+		return groups, rows.Err()
+	}
+	// match finds the first rule of id's groups in direction that allows
+	// the traffic to or from peer (an address and the peer server's groups)
+	match := func(id, direction string, peer netip.Addr, peerGroups map[string]bool) (*SecurityGroupRule, error) {
+		rules, err := queryRules(ctx, s.DB, `direction = $2 AND group_id IN (SELECT group_id FROM server_security_groups WHERE server_id = $1)`,
+			id, direction)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rules {
+			if r.Covers(protocol, port) && (r.CoversAddr(peer) || peerGroups[r.SourceGroupID]) {
+				return &r, nil
+			}
+		}
+		return nil, nil
+	}
+
+	sourceGroups := map[string]bool{}
+	if out.SourceServerID != "" {
+		if sourceGroups, err = groupsOf(out.SourceServerID); err != nil {
+			return nil, err
+		}
+	}
+	if out.IngressRule, err = match(serverID, domain.DirectionIngress, source, sourceGroups); err != nil {
+		return nil, err
+	}
+	if out.IngressRule == nil {
+		out.Reason = fmt.Sprintf("no ingress rule of the server's security groups allows %s from %s", traffic, source)
+		return out, nil
+	}
+	if out.SourceServerID != "" {
+		serverGroups, err := groupsOf(serverID)
+		if err != nil {
+			return nil, err
+		}
+		dest, _ := netip.ParseAddr(ip)
+		if out.EgressRule, err = match(out.SourceServerID, domain.DirectionEgress, dest, serverGroups); err != nil {
+			return nil, err
+		}
+		if out.EgressRule == nil {
+			out.Reason = fmt.Sprintf("no egress rule of source server %s's security groups allows %s to the server", out.SourceServerID, traffic)
+			return out, nil
+		}
+	}
+	out.Allowed = true
+	out.Reason = "allowed by " + out.IngressRule.String()
+	if out.EgressRule != nil {
+		out.Reason += " and " + out.EgressRule.String()
+	}
+	return out, nil
+}
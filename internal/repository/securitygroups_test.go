@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+
+	"virtualservers/internal/domain"
+)
+
+func rule(direction, protocol string, port int, cidr, source string) SecurityGroupRule {
+	return SecurityGroupRule{Rule: domain.Rule{Direction: direction, Protocol: protocol, PortFrom: port, CIDR: cidr, SourceGroupID: source}}
+}
+
+func TestSecurityGroupRulesApplied(t *testing.T) {
+	s := testStore(t)
+	ctx := context.Background()
+	web, err := s.CreateSecurityGroup(ctx, SecurityGroup{Name: "web", Region: "us-east-1", Rules: []SecurityGroupRule{
+		rule("ingress", "tcp", 22, "203.0.113.7/24", ""),
+		rule("egress", "all", 0, "0.0.0.0/0", ""),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Stored normalized: host bits masked and a single port filled in
+	if r := web.Rules[0]; r.CIDR != "203.0.113.0/24" || r.PortTo != 22 {
+		t.Fatalf("stored rule %s", r.String())
+	}
+	db, err := s.CreateSecurityGroup(ctx, SecurityGroup{Name: "db", Region: "us-east-1", Rules: []SecurityGroupRule{
+		rule("ingress", "tcp", 5432, "", web.ID),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app, err := s.CreateServer(ctx, NewServer{Name: "app", Region: "us-east-1", Type: "t2.micro", SecurityGroupIDs: []string{web.ID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pg, err := s.CreateServer(ctx, NewServer{Name: "pg", Region: "us-east-1", Type: "t2.micro", SecurityGroupIDs: []string{db.ID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	appIP := netip.MustParseAddr(*server(t, s, app).IP)
+
+	check := func(id string, source netip.Addr, protocol string, port int) *Reachability {
+		t.Helper()
+		r, err := s.CheckReachability(ctx, id, source, protocol, port)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	outside := netip.MustParseAddr("203.0.113.200")
+	if r := check(app, outside, "tcp", 22); !r.Allowed || r.IngressRule == nil || r.IngressRule.ID != web.Rules[0].ID {
+		t.Errorf("ssh from %s: %+v", outside, r)
+	}
+	if r := check(app, outside, "tcp", 80); r.Allowed {
+		t.Errorf("port 80 allowed by %v", r.IngressRule)
+	}
+	if r := check(app, netip.MustParseAddr("198.51.100.1"), "tcp", 22); r.Allowed {
+		t.Errorf("ssh from outside the cidr allowed by %v", r.IngressRule)
+	}
+
+	// A source group rule admits the group's servers, whose egress rules
+	// must let the traffic out too
+	r := check(pg, appIP, "tcp", 5432)
+	if !r.Allowed || r.SourceServerID != app || r.EgressRule == nil {
+		t.Fatalf("app to pg: %+v", r)
+	}
+	if _, err := s.AddSecurityGroupRule(ctx, db.ID, rule("ingress", "tcp", 6432, "", web.ID)); err != nil {
+		t.Fatal(err)
+	}
+	if r := check(pg, appIP, "tcp", 6432); !r.Allowed {
+		t.Errorf("rule added to a group not applied: %s", r.Reason)
+	}
+	if err := s.DeleteSecurityGroupRule(ctx, db.ID, db.Rules[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if r := check(pg, appIP, "tcp", 5432); r.Allowed {
+		t.Errorf("deleted rule still applied: %s", r.Reason)
+	}
+	if err := s.DetachSecurityGroup(ctx, app, web.ID); err != nil {
+		t.Fatal(err)
+	}
+	if r := check(pg, appIP, "tcp", 6432); r.Allowed {
+		t.Errorf("server detached from the source group still allowed: %s", r.Reason)
+	}
+}
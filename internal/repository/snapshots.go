@@ -0,0 +1,428 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"virtualservers/internal/domain"
+)
+
+type Snapshot struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	SourceType  string            `json:"source_type"`
+	SourceID    string            `json:"source_id"`
+	Region      string            `json:"region"`
+	SizeGB      int               `json:"size_gb"`
+	Status      string            `json:"status"`
+	Progress    int               `json:"progress"`
+	Labels      map[string]string `json:"labels"`
+	GBMonthRate float64           `json:"gb_month_rate"`
+	AccruedCost float64           `json:"accrued_cost"`
+	LiveCost    float64           `json:"live_cost"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	CompletedAt *time.Time        `json:"completed_at,omitempty"`
+	DeletedAt   *time.Time        `json:"deleted_at,omitempty"`
+}
+
+type SnapshotFilter struct {
+	Region   string
+	Status   string
+	SourceID string
+}
+
+// snapshotBillingSQL bills a snapshot's storage since billing_last_at at
+// its per-GB-month rate
+var snapshotBillingSQL = fmt.Sprintf(`accrued_cost = accrued_cost +
+	(EXTRACT(EPOCH FROM (now()-billing_last_at)) / 3600.0 / %d * size_gb * gb_month_rate),
+	billing_last_at = now()`, domain.HoursPerMonth)
+
+const snapshotSelect = `
+	SELECT id, name, source_type, source_id, region, size_gb, status, progress, labels,
+	       gb_month_rate, accrued_cost, billing_last_at, created_at, updated_at, completed_at, deleted_at
+	FROM snapshots
+`
+
+func scanSnapshot(row rowScanner) (*Snapshot, error) {
+	var sn Snapshot
+	var labels []byte
+	var billingLast time.Time
+	var completed, deleted sql.NullTime
+	if err := row.Scan(&sn.ID, &sn.Name, &sn.SourceType, &sn.SourceID, &sn.Region, &sn.SizeGB, &sn.Status,
+		&sn.Progress, &labels, &sn.GBMonthRate, &sn.AccruedCost, &billingLast,
+		&sn.CreatedAt, &sn.UpdatedAt, &completed, &deleted); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(labels, &sn.Labels); err != nil {
+		return nil, err
+	}
+	if completed.Valid {
+		sn.CompletedAt = &completed.Time
+	}
+	if deleted.Valid {
+		sn.DeletedAt = &deleted.Time
+	}
+	sn.LiveCost = sn.AccruedCost
+	if sn.Status == domain.SnapshotPending || sn.Status == domain.SnapshotAvailable {
+		sn.LiveCost += time.Since(billingLast).Hours() / domain.HoursPerMonth * float64(sn.SizeGB) * sn.GBMonthRate
+	}
+	return &sn, nil
+}
+
+// CreateSnapshot starts a snapshot of a server's root disk (sourceType
+// "server") or of a volume. The snapshot is pending until the returned
+// operation completes, after perGB for every GB.
+func (s *Store) CreateSnapshot(ctx context.Context, name, sourceType, sourceID string, labels map[string]string, perGB time.Duration) (*Operation, error) {
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labelsJSON, err := json.Marshal(labels)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var status, region string
+	var sizeGB int
+	switch sourceType {
+	case "server":
+		err = tx.QueryRowContext(ctx, `
+		SELECT s.status::text, s.region, it.root_gb
+		FROM servers s JOIN instance_types it ON it.type = s.type
+		WHERE s.id=$1
+		`, sourceID).Scan(&status, &region, &sizeGB)
+		if err == nil && status == "TERMINATED" {
+			return nil, &domain.ResourceStateError{Resource: "server", ID: sourceID, Op: "snapshot", Status: status}
+		}
+	case "volume":
+		err = tx.QueryRowContext(ctx, `SELECT status, region, size_gb FROM volumes WHERE id=$1`, sourceID).
+			Scan(&status, &region, &sizeGB)
+		if err == nil && status == domain.VolumeDeleted {
+			return nil, &domain.ResourceStateError{Resource: "volume", ID: sourceID, Op: "snapshot", Status: status}
+		}
+	default:
+		return nil, &domain.ValidationError{Message: "source_type must be server or volume"}
+	}
+	if err == sql.ErrNoRows {
+		return nil, &domain.ValidationError{Message: sourceType + " not found"}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var id string
+	err = tx.QueryRowContext(ctx, `
+	INSERT INTO snapshots (name, source_type, source_id, region, size_gb, labels)
+	VALUES ($1, $2, $3, $4, $5, $6::jsonb)
+	RETURNING id
+	`, name, sourceType, sourceID, region, sizeGB, string(labelsJSON)).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	opID, err := startOperation(ctx, tx, domain.OpCreateSnapshot, "snapshot", id, perGB*time.Duration(sizeGB))
+	if err != nil {
+		return nil, err
+	}
+	if sourceType == "server" {
+		if err := recordEvent(ctx, tx, sourceID, "snapshot_started", "snapshot "+id+" started", map[string]any{
+			"snapshot_id": id, "operation_id": opID, "size_gb": sizeGB,
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetOperation(ctx, opID)
+}
+
+// finishSnapshot makes a pending snapshot available once its operation is
+// done. A non-empty result is the reason the operation failed.
+func finishSnapshot(ctx context.Context, tx *sql.Tx, id, opID string) (string, error) {
+	var sourceType, sourceID string
+	err := tx.QueryRowContext(ctx, `
+	UPDATE snapshots
+	SET status='available', progress=100, completed_at=now(), updated_at=now()
+	WHERE id=$1 AND status='pending'
+	RETURNING source_type, source_id
+	`, id).Scan(&sourceType, &sourceID)
+	if err == sql.ErrNoRows {
+		return "snapshot is no longer pending", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if sourceType == "server" {
+		if err := recordEvent(ctx, tx, sourceID, "snapshot_completed", "snapshot "+id+" available", map[string]any{
+			"snapshot_id": id, "operation_id": opID,
+		}); err != nil {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+// ListSnapshots returns snapshots newest first; deleted ones only when
+// asked for by status
+func (s *Store) ListSnapshots(ctx context.Context, f SnapshotFilter) ([]Snapshot, error) {
+	conds := []string{}
+	args := []any{}
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if f.Region != "" {
+		add("region = $%d", f.Region)
+	}
+	if f.Status != "" {
+		add("status = $%d", strings.ToLower(f.Status))
+	} else {
+		conds = append(conds, "status <> 'deleted'")
+	}
+	if f.SourceID != "" {
+		add("source_id = $%d", f.SourceID)
+	}
+	rows, err := s.DB.QueryContext(ctx, snapshotSelect+" WHERE "+strings.Join(conds, " AND ")+" ORDER BY created_at DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Snapshot
+	for rows.Next() {
+		sn, err := scanSnapshot(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *sn)
+	}
+	return out, rows.Err()
+}
+
+// GetSnapshot returns nil when the snapshot does not exist
+func (s *Store) GetSnapshot(ctx context.Context, id string) (*Snapshot, error) {
+	sn, err := scanSnapshot(s.DB.QueryRowContext(ctx, snapshotSelect+` WHERE id=$1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return sn, err
+}
+
+// DeleteSnapshot closes out the billing of an available or failed snapshot
+// and marks it deleted. Snapshots backing an available image are kept.
+// Returns sql.ErrNoRows when not found.
+func (s *Store) DeleteSnapshot(ctx context.Context, id string) (*Snapshot, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	var status string
+	if err := tx.QueryRowContext(ctx, `SELECT status FROM snapshots WHERE id=$1 FOR UPDATE`, id).Scan(&status); err != nil {
+		return nil, err
+	}
+	if status != domain.SnapshotAvailable && status != domain.SnapshotFailed {
+		return nil, &domain.ResourceStateError{Resource: "snapshot", ID: id, Op: "delete", Status: status}
+	}
+	var imageID string
+	err = tx.QueryRowContext(ctx, `SELECT id FROM images WHERE snapshot_id=$1 AND status='available' LIMIT 1`, id).Scan(&imageID)
+	if err == nil {
+		return nil, &domain.ResourceStateError{Resource: "snapshot", ID: id, Op: "delete", Status: status,
+			Reason: "image " + imageID + " is registered from it"}
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+	UPDATE snapshots SET `+snapshotBillingSQL+`, status='deleted', deleted_at=now(), updated_at=now()
+	WHERE id=$1`, id); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetSnapshot(ctx, id)
+}
+
+// AccrueSnapshotBilling bills the storage of pending and available
+// snapshots
+func (s *Store) AccrueSnapshotBilling(ctx context.Context) (int64, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	if err := checkFence(ctx, tx); err != nil {
+		return 0, err
+	}
+	res, err := tx.ExecContext(ctx, `UPDATE snapshots SET `+snapshotBillingSQL+` WHERE status IN ('pending','available')`)
+	if err != nil {
+		return 0, err
+	}
+	rows, _ := res.RowsAffected()
+	return rows, tx.Commit()
+}
+
+type Image struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	SnapshotID  string    `json:"snapshot_id"`
+	Region      string    `json:"region"`
+	SizeGB      int       `json:"size_gb"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+const imageSelect = `
+	SELECT i.id, i.name, i.description, i.snapshot_id, i.region, sn.size_gb, i.status, i.created_at, i.updated_at
+	FROM images i
+	JOIN snapshots sn ON sn.id = i.snapshot_id
+`
+
+func scanImage(row rowScanner) (*Image, error) {
+	var im Image
+	if err := row.Scan(&im.ID, &im.Name, &im.Description, &im.SnapshotID, &im.Region, &im.SizeGB,
+		&im.Status, &im.CreatedAt, &im.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &im, nil
+}
+
+// RegisterImage registers an image from an available snapshot, in the
+// snapshot's region
+func (s *Store) RegisterImage(ctx context.Context, name, description, snapshotID string) (*Image, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	var status, region string
+	err = tx.QueryRowContext(ctx, `SELECT status, region FROM snapshots WHERE id=$1 FOR SHARE`, snapshotID).Scan(&status, &region)
+	if err == sql.ErrNoRows {
+		return nil, &domain.ValidationError{Message: "snapshot not found"}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if status != domain.SnapshotAvailable {
+		return nil, &domain.ResourceStateError{Resource: "snapshot", ID: snapshotID, Op: "register an image from", Status: status}
+	}
+	var id string
+	if err := tx.QueryRowContext(ctx, `
+	INSERT INTO images (name, description, snapshot_id, region)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id
+	`, name, description, snapshotID, region).Scan(&id); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetImage(ctx, id)
+}
+
+// ListImages returns images newest first; deregistered ones only when
+// asked for by status
+func (s *Store) ListImages(ctx context.Context, region, status string) ([]Image, error) {
+	conds := []string{}
+	args := []any{}
+	if region != "" {
+		args = append(args, region)
+		conds = append(conds, fmt.Sprintf("i.region = $%d", len(args)))
+	}
+	if status != "" {
+		args = append(args, strings.ToLower(status))
+		conds = append(conds, fmt.Sprintf("i.status = $%d", len(args)))
+	} else {
+		conds = append(conds, "i.status = 'available'")
+	}
+	rows, err := s.DB.QueryContext(ctx, imageSelect+" WHERE "+strings.Join(conds, " AND ")+" ORDER BY i.created_at DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Image
+	for rows.Next() {
+		im, err := scanImage(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *im)
+	}
+	return out, rows.Err()
+}
+
+// GetImage returns nil when the image does not exist
+func (s *Store) GetImage(ctx context.Context, id string) (*Image, error) {
+	im, err := scanImage(s.DB.QueryRowContext(ctx, imageSelect+` WHERE i.id=$1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return im, err
+}
+
+// DeregisterImage stops an image from being used for new servers (servers
+// already created from it keep their image_id). Returns sql.ErrNoRows when
+// not found.
+func (s *Store) DeregisterImage(ctx context.Context, id string) (*Image, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	var status string
+	if err := tx.QueryRowContext(ctx, `SELECT status FROM images WHERE id=$1 FOR UPDATE`, id).Scan(&status); err != nil {
+		return nil, err
+	}
+	if status != domain.ImageAvailable {
+		return nil, &domain.ResourceStateError{Resource: "image", ID: id, Op: "deregister", Status: status}
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE images SET status='deregistered', updated_at=now() WHERE id=$1`, id); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetImage(ctx, id)
+}
+
+// checkImage validates the image a new server of type stype in region is
+// created from
+func checkImage(ctx context.Context, tx *sql.Tx, imageID, region, stype string) error {
+	var status, imageRegion string
+	var sizeGB, rootGB int
+	err := tx.QueryRowContext(ctx, `
+	SELECT i.status, i.region, sn.size_gb, (SELECT root_gb FROM instance_types WHERE type=$2)
+	FROM images i JOIN snapshots sn ON sn.id = i.snapshot_id
+	WHERE i.id=$1
+	FOR SHARE OF i
+	`, imageID, stype).Scan(&status, &imageRegion, &sizeGB, &rootGB)
+	if err == sql.ErrNoRows {
+		return &domain.ValidationError{Message: "image not found"}
+	}
+	if err != nil {
+		return err
+	}
+	if status != domain.ImageAvailable {
+		return &domain.ResourceStateError{Resource: "image", ID: imageID, Op: "create a server from", Status: status}
+	}
+	if imageRegion != region {
+		return &domain.ValidationError{Message: fmt.Sprintf("image is in %s, not %s", imageRegion, region)}
+	}
+	if sizeGB > rootGB {
+		return &domain.ValidationError{Message: fmt.Sprintf("image needs a %d GB root disk; %s has %d GB", sizeGB, stype, rootGB)}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package repository
+
+import "context"
+
+type ServerCount struct {
+	Status string
+	Region string
+	Type   string
+	Count  int64
+}
+
+type IPPoolCount struct {
+	Region    string
+	Allocated int64
+	Free      int64
+}
+
+// ServerCounts groups servers by status, region and type
+func (s *Store) ServerCounts(ctx context.Context) ([]ServerCount, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+	SELECT status::text, region, type, COUNT(*)
+	FROM servers
+	GROUP BY status, region, type
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []ServerCount
+	for rows.Next() {
+		var c ServerCount
+		if err := rows.Scan(&c.Status, &c.Region, &c.Type, &c.Count); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// IPPoolCounts returns allocated/free addresses per region
+func (s *Store) IPPoolCounts(ctx context.Context) ([]IPPoolCount, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+	SELECT region,
+	       COUNT(*) FILTER (WHERE allocated),
+	       COUNT(*) FILTER (WHERE NOT allocated)
+	FROM ip_pool
+	GROUP BY region
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []IPPoolCount
+	for rows.Next() {
+		var c IPPoolCount
+		if err := rows.Scan(&c.Region, &c.Allocated, &c.Free); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// testStore returns a Store on a throwaway schema of the database in
+// TEST_DATABASE_URL, with db/init applied (so the seed zones, hosts and
+// instance types exist). Tests that need it are skipped without one.
+func testStore(t *testing.T) *Store {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	admin, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		admin.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`)
+		admin.Close()
+	})
+
+	db, err := sql.Open("pgx", withSearchPath(dsn, schema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	files, err := filepath.Glob("../../db/init/*.sql")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no schema files: %v", err)
+	}
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(string(b)); err != nil {
+			t.Fatalf("%s: %v", filepath.Base(f), err)
+		}
+	}
+	return &Store{DB: db}
+}
+
+// withSearchPath points every connection of dsn at schema
+func withSearchPath(dsn, schema string) string {
+	if u, err := url.Parse(dsn); err == nil && strings.HasPrefix(u.Scheme, "postgres") {
+		q := u.Query()
+		q.Set("search_path", schema)
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+	return dsn + " search_path=" + schema
+}
+
+// mustExec runs a statement the test depends on
+func mustExec(t *testing.T, s *Store, query string, args ...any) {
+	t.Helper()
+	if _, err := s.DB.Exec(query, args...); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+}
+
+// newServer creates a stopped t2.micro in zone of us-east-1
+func newServer(t *testing.T, s *Store, name, zone string) string {
+	t.Helper()
+	id, err := s.CreateServer(context.Background(), NewServer{Name: name, Region: "us-east-1", Type: "t2.micro", Zone: zone})
+	if err != nil {
+		t.Fatalf("create %s: %v", name, err)
+	}
+	return id
+}
+
+// server reads a server back, failing the test when it is gone
+func server(t *testing.T, s *Store, id string) *ServerDetail {
+	t.Helper()
+	d, err := s.GetServerByID(context.Background(), id)
+	if err != nil || d == nil {
+		t.Fatalf("get %s: %v, %v", id, d, err)
+	}
+	return d
+}
+
+// newZone adds an empty zone to us-east-1 with a host of each size
+// ({vcpus, memory_mib}) and returns the host ids in order
+func newZone(t *testing.T, s *Store, zone string, sizes ...[2]int) []string {
+	t.Helper()
+	mustExec(t, s, `INSERT INTO zones (name, region) VALUES ($1, 'us-east-1')`, zone)
+	var ids []string
+	for i, size := range sizes {
+		h, err := s.CreateHost(context.Background(), Host{Name: fmt.Sprintf("%s-h%d", zone, i+1), Zone: zone, VCPUs: size[0], MemoryMiB: size[1]})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, h.ID)
+	}
+	return ids
+}
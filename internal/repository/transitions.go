@@ -0,0 +1,334 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"virtualservers/internal/domain"
+)
+
+// Transitions configures the simulated STARTING, STOPPING and TERMINATING
+// states. While a server is in one of them it takes no actions; the
+// transition worker moves it on once the duration has passed.
+type Transitions struct {
+	// Durations by transitional status; missing or zero completes the
+	// action at once
+	Durations map[string]time.Duration
+	// Billed transitional statuses are billed like RUNNING (compute rate,
+	// counted as uptime); the others are free
+	Billed map[string]bool
+	// Queue accepts one action during a transition and applies it when the
+	// transition completes, instead of rejecting it
+	Queue bool
+}
+
+func (t Transitions) duration(action string) time.Duration {
+	return t.Durations[domain.TransitionalStatus(action)]
+}
+
+// computeBilled reports whether time in status is billed at the compute rate
+func (t Transitions) computeBilled(status string) bool {
+	return status == "RUNNING" || t.Billed[status]
+}
+
+// computeStatuses lists the statuses billed at the compute rate
+func (t Transitions) computeStatuses() []string {
+	out := []string{"RUNNING"}
+	for status, billed := range t.Billed {
+		if billed {
+			out = append(out, status)
+		}
+	}
+	return out
+}
+
+// billingUpdates closes out the billing of a server leaving status from and
+// starts the clock for status to, if that is billed
+func (s *Store) billingUpdates(from, to string) []string {
+	var updates []string
+	switch {
+	case s.Transitions.computeBilled(from):
+		updates = append(updates, billSecondsSQL, billComputeSQL)
+	case from == "HIBERNATED":
+		updates = append(updates, billStorageSQL)
+	}
+	if s.Transitions.computeBilled(to) || to == "HIBERNATED" {
+		updates = append(updates, "billing_last_at=now()")
+	}
+	return updates
+}
+
+// arrivalUpdates are the timestamps set when a server reaches the target of
+// action
+func arrivalUpdates(action string) []string {
+	switch action {
+	case "start", "complete-reboot":
+		return []string{"last_started_at=now(),reboot_stuck_until=NULL"}
+	case "resume":
+		return []string{"last_started_at=now(),hibernated_at=NULL"}
+	case "stop":
+		return []string{"last_stopped_at=now(),stopped_since=now(),reaper_warned_at=NULL"}
+	case "hibernate":
+		return []string{"hibernated_at=now(),last_stopped_at=now(),reaper_warned_at=NULL"}
+	case "terminate":
+		return []string{"terminated_at=now()"}
+	}
+	return nil
+}
+
+// clearTransitionSQL ends a transition and drops any queued action
+const clearTransitionSQL = "transition_action=NULL,transition_target=NULL,transition_started_at=NULL,transition_due_at=NULL,queued_action=NULL"
+
+// lockedServer is a server row held FOR UPDATE by the current transaction
+type lockedServer struct {
+	id      string
+	status  string
+	action  string // transition in progress, if any
+	target  string
+	queued  string
+	seconds int64
+	cost    float64
+	host    string // host holding the server's capacity, if any
+	zone    string
+	typ     string
+}
+
+func lockServer(ctx context.Context, tx *sql.Tx, id string) (*lockedServer, error) {
+	cur := &lockedServer{id: id}
+	err := tx.QueryRowContext(ctx, `
+	SELECT status::text,COALESCE(transition_action,''),COALESCE(transition_target,''),
+	COALESCE(queued_action,''),accrued_seconds,accrued_cost,
+	COALESCE(host_id::text,''),COALESCE(zone,''),type
+	FROM servers
+	WHERE id = $1
+	FOR UPDATE
+	`, id).Scan(&cur.status, &cur.action, &cur.target, &cur.queued, &cur.seconds, &cur.cost,
+		&cur.host, &cur.zone, &cur.typ)
+	if err != nil {
+		return nil, err
+	}
+	return cur, nil
+}
+
+// update sets status and updates ($1 is the status, $2 the id, args follow)
+// and returns the billing it closed out, and any host it was scheduled on
+// or released, as event data
+func (cur *lockedServer) update(ctx context.Context, tx *sql.Tx, status string, updates []string, args ...any) (map[string]any, error) {
+	host, err := cur.hostFor(ctx, tx, status)
+	if err != nil {
+		return nil, err
+	}
+	set := append([]string{"status=$1::server_status"}, updates...)
+	set = append(set, "updated_at=now()")
+	var seconds int64
+	var cost float64
+	err = tx.QueryRowContext(ctx,
+		"UPDATE servers SET "+strings.Join(set, ",")+" WHERE id = $2 RETURNING accrued_seconds, accrued_cost",
+		append([]any{status, cur.id}, args...)...).Scan(&seconds, &cost)
+	if err != nil {
+		return nil, err
+	}
+	data := map[string]any{}
+	if seconds != cur.seconds || cost != cur.cost {
+		data["billed_seconds"] = seconds - cur.seconds
+		data["cost_delta"] = cost - cur.cost
+	}
+	if host != cur.host {
+		if _, err := tx.ExecContext(ctx, `UPDATE servers SET host_id=NULLIF($2,'')::uuid WHERE id=$1`, cur.id, host); err != nil {
+			return nil, err
+		}
+		if host != "" {
+			data["host_id"] = host
+		} else {
+			data["released_host_id"] = cur.host
+		}
+	}
+	cur.status, cur.seconds, cur.cost, cur.host = status, seconds, cost, host
+	return data, nil
+}
+
+// hostFor returns the host a server entering status is on: the one it
+// holds, a newly scheduled one, or none once it stops holding capacity or
+// when its zone has no hosts
+func (cur *lockedServer) hostFor(ctx context.Context, tx *sql.Tx, status string) (string, error) {
+	switch {
+	case !domain.HoldsHost(status):
+		return "", nil
+	case cur.host != "":
+		return cur.host, nil
+	}
+	return scheduleHost(ctx, tx, cur.zone, cur.typ, cur.id, "")
+}
+
+// queueAction handles an action on a server in transition: it is queued
+// when the policy allows it, nothing else is queued yet and the action
+// will be valid once the transition completes
+func (s *Store) queueAction(ctx context.Context, tx *sql.Tx, cur *lockedServer, action string) (string, error) {
+	if !s.Transitions.Queue || cur.queued != "" {
+		return "", &domain.TransitionInProgressError{Current: cur.status, Action: action, Queued: cur.queued}
+	}
+	if _, err := domain.ActionTarget(cur.target, action); err != nil {
+		return "", err
+	}
+	if err := checkAction(ctx, tx, cur.id, action); err != nil {
+		return "", err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE servers SET queued_action=$1,updated_at=now() WHERE id=$2`, action, cur.id); err != nil {
+		return "", err
+	}
+	msg := fmt.Sprintf("%s queued until the server is %s", action, cur.target)
+	if err := recordEvent(ctx, tx, cur.id, "action_queued", msg, map[string]any{
+		"action":        action,
+		"status":        cur.status,
+		"target_status": cur.target,
+	}); err != nil {
+		return "", err
+	}
+	return cur.status, nil
+}
+
+// previewStatus returns the status action would leave a server in
+// without changing it: the action's target, its transitional status, or
+// the current transitional status when the action would be queued
+func (s *Store) previewStatus(current, target, queued, action string) (string, error) {
+	if domain.IsTransitional(current) {
+		if !s.Transitions.Queue || queued != "" {
+			return "", &domain.TransitionInProgressError{Current: current, Action: action, Queued: queued}
+		}
+		if _, err := domain.ActionTarget(target, action); err != nil {
+			return "", err
+		}
+		return current, nil
+	}
+	next, err := domain.ActionTarget(current, action)
+	if err != nil {
+		return "", err
+	}
+	if s.Transitions.duration(action) > 0 {
+		return domain.TransitionalStatus(action), nil
+	}
+	return next, nil
+}
+
+// CompleteTransitions finishes up to limit transitions whose time has
+// come, applying any queued action, and returns how many it completed. A
+// server that fails does not hold up the rest of the batch: its error is
+// joined into the one returned. Losing the lease or ctx stops the batch.
+func (s *Store) CompleteTransitions(ctx context.Context, limit int) (int, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+	SELECT id FROM servers
+	WHERE transition_due_at <= now()
+	ORDER BY transition_due_at
+	LIMIT $1
+	`, limit)
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	done := 0
+	var errs []error
+	for _, id := range ids {
+		ok, err := s.completeTransition(ctx, id)
+		if errors.Is(err, ErrFenced) || ctx.Err() != nil {
+			errs = append(errs, err)
+			break
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("server %s: %w", id, err))
+			continue
+		}
+		if ok {
+			done++
+		}
+	}
+	return done, errors.Join(errs...)
+}
+
+// completeTransition moves one server to its transition target; false means
+// the transition was no longer due (completed elsewhere)
+func (s *Store) completeTransition(ctx context.Context, id string) (bool, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	if err := checkFence(ctx, tx); err != nil {
+		return false, err
+	}
+	// A queued action may schedule the server while it still holds a host,
+	// so the zone's hosts are locked before it (lockZoneHosts)
+	var zone string
+	if err := tx.QueryRowContext(ctx, `SELECT COALESCE(zone,'') FROM servers WHERE id=$1`, id).Scan(&zone); err != nil {
+		return false, err
+	}
+	if _, err := lockZoneHosts(ctx, tx, zone); err != nil {
+		return false, err
+	}
+	cur, err := lockServer(ctx, tx, id)
+	if err != nil {
+		return false, err
+	}
+	if cur.action == "" || !domain.IsTransitional(cur.status) {
+		return false, nil
+	}
+	from, action, queued := cur.status, cur.action, cur.queued
+	updates := append(s.billingUpdates(from, cur.target), arrivalUpdates(action)...)
+	updates = append(updates, clearTransitionSQL)
+	data, err := cur.update(ctx, tx, cur.target, updates)
+	if err != nil {
+		return false, err
+	}
+	data["action"] = action
+	data["previous_status"] = from
+	data["new_status"] = cur.status
+	msg := fmt.Sprintf("server %s completed (%s -> %s)", action, from, cur.status)
+	if err := recordEvent(ctx, tx, id, "transition_completed", msg, data); err != nil {
+		return false, err
+	}
+	if cur.status == "TERMINATED" {
+		if err := releaseVolumes(ctx, tx, id); err != nil {
+			return false, err
+		}
+	}
+
+	if queued != "" {
+		// The queued action runs as its own step; if the server no longer
+		// accepts it (e.g. protection was enabled meanwhile) that is recorded
+		// rather than holding up the transition
+		cur.action, cur.target, cur.queued = "", "", ""
+		if _, err := s.applyAction(ctx, tx, cur, queued); err != nil {
+			var ite *domain.InvalidTransitionError
+			var pe *domain.ProtectedError
+			var ice *domain.InsufficientCapacityError
+			var zie *domain.ZoneImpairedError
+			if !errors.As(err, &ite) && !errors.As(err, &pe) && !errors.As(err, &ice) && !errors.As(err, &zie) {
+				return false, err
+			}
+			if err := recordEvent(ctx, tx, id, "queued_action_failed", fmt.Sprintf("queued %s failed: %v", queued, err), map[string]any{
+				"action": queued,
+				"status": cur.status,
+				"error":  err.Error(),
+			}); err != nil {
+				return false, err
+			}
+		}
+	}
+	return true, tx.Commit()
+}
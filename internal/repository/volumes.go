@@ -0,0 +1,410 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"virtualservers/internal/domain"
+)
+
+type Volume struct {
+	ID                  string            `json:"id"`
+	Name                string            `json:"name"`
+	Region              string            `json:"region"`
+	Type                string            `json:"type"`
+	SizeGB              int               `json:"size_gb"`
+	Status              string            `json:"status"`
+	ServerID            *string           `json:"server_id,omitempty"`
+	Device              *string           `json:"device,omitempty"`
+	DeleteOnTermination bool              `json:"delete_on_termination"`
+	Labels              map[string]string `json:"labels"`
+	GBMonthRate         float64           `json:"gb_month_rate"`
+	AccruedCost         float64           `json:"accrued_cost"`
+	LiveCost            float64           `json:"live_cost"`
+	CreatedAt           time.Time         `json:"created_at"`
+	UpdatedAt           time.Time         `json:"updated_at"`
+	AttachedAt          *time.Time        `json:"attached_at,omitempty"`
+	DeletedAt           *time.Time        `json:"deleted_at,omitempty"`
+}
+
+type VolumeFilter struct {
+	Region   string
+	Status   string
+	ServerID string
+}
+
+// volumeBillingSQL bills a volume's storage since billing_last_at at its
+// type's per-GB-month rate
+var volumeBillingSQL = fmt.Sprintf(`accrued_cost = accrued_cost +
+	(EXTRACT(EPOCH FROM (now()-billing_last_at)) / 3600.0 / %d * size_gb *
+	(SELECT gb_month_rate FROM volume_types vt WHERE vt.type = volumes.type)),
+	billing_last_at = now()`, domain.HoursPerMonth)
+
+const volumeSelect = `
+	SELECT v.id, v.name, v.region, v.type, v.size_gb, v.status, v.server_id::text, v.device,
+	       v.delete_on_termination, v.labels, vt.gb_month_rate, v.accrued_cost, v.billing_last_at,
+	       v.created_at, v.updated_at, v.attached_at, v.deleted_at
+	FROM volumes v
+	JOIN volume_types vt ON vt.type = v.type
+`
+
+func scanVolume(row rowScanner) (*Volume, error) {
+	var v Volume
+	var serverID, device sql.NullString
+	var labels []byte
+	var billingLast time.Time
+	var attached, deleted sql.NullTime
+	if err := row.Scan(&v.ID, &v.Name, &v.Region, &v.Type, &v.SizeGB, &v.Status, &serverID, &device,
+		&v.DeleteOnTermination, &labels, &v.GBMonthRate, &v.AccruedCost, &billingLast,
+		&v.CreatedAt, &v.UpdatedAt, &attached, &deleted); err != nil {
+		return nil, err
+	}
+	if serverID.Valid {
+		v.ServerID = &serverID.String
+	}
+	if device.Valid {
+		v.Device = &device.String
+	}
+	if err := json.Unmarshal(labels, &v.Labels); err != nil {
+		return nil, err
+	}
+	if attached.Valid {
+		v.AttachedAt = &attached.Time
+	}
+	if deleted.Valid {
+		v.DeletedAt = &deleted.Time
+	}
+	v.LiveCost = v.AccruedCost
+	if v.Status != domain.VolumeDeleted {
+		v.LiveCost += time.Since(billingLast).Hours() / domain.HoursPerMonth * float64(v.SizeGB) * v.GBMonthRate
+	}
+	return &v, nil
+}
+
+// CreateVolume stores a new, unattached volume. The type must exist and
+// the region must be one servers can be created in.
+func (s *Store) CreateVolume(ctx context.Context, v Volume) (*Volume, error) {
+	if v.Labels == nil {
+		v.Labels = map[string]string{}
+	}
+	labelsJSON, err := json.Marshal(v.Labels)
+	if err != nil {
+		return nil, err
+	}
+	var known bool
+	if err := s.DB.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM volume_types WHERE type=$1)`, v.Type).Scan(&known); err != nil {
+		return nil, err
+	}
+	if !known {
+		return nil, &domain.ValidationError{Message: fmt.Sprintf("unknown volume type %q", v.Type)}
+	}
+	if err := s.DB.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM ip_pool WHERE region=$1)`, v.Region).Scan(&known); err != nil {
+		return nil, err
+	}
+	if !known {
+		return nil, &domain.ValidationError{Message: fmt.Sprintf("unknown region %q", v.Region)}
+	}
+	var id string
+	err = s.DB.QueryRowContext(ctx, `
+	INSERT INTO volumes (name, region, type, size_gb, delete_on_termination, labels)
+	VALUES ($1, $2, $3, $4, $5, $6::jsonb)
+	RETURNING id
+	`, v.Name, v.Region, v.Type, v.SizeGB, v.DeleteOnTermination, string(labelsJSON)).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetVolume(ctx, id)
+}
+
+// ListVolumes returns volumes newest first; deleted ones only when asked
+// for by status
+func (s *Store) ListVolumes(ctx context.Context, f VolumeFilter) ([]Volume, error) {
+	conds := []string{}
+	args := []any{}
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if f.Region != "" {
+		add("v.region = $%d", f.Region)
+	}
+	if f.Status != "" {
+		add("v.status = $%d", strings.ToLower(f.Status))
+	} else {
+		conds = append(conds, "v.status <> 'deleted'")
+	}
+	if f.ServerID != "" {
+		add("v.server_id = $%d", f.ServerID)
+	}
+	query := volumeSelect
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	rows, err := s.DB.QueryContext(ctx, query+" ORDER BY v.created_at DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Volume
+	for rows.Next() {
+		v, err := scanVolume(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *v)
+	}
+	return out, rows.Err()
+}
+
+// GetVolume returns nil when the volume does not exist
+func (s *Store) GetVolume(ctx context.Context, id string) (*Volume, error) {
+	v, err := scanVolume(s.DB.QueryRowContext(ctx, volumeSelect+` WHERE v.id=$1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return v, err
+}
+
+// lockedVolume is a volume row held FOR UPDATE by the current transaction
+type lockedVolume struct {
+	status   string
+	region   string
+	typ      string
+	sizeGB   int
+	serverID sql.NullString
+	device   sql.NullString
+}
+
+func lockVolume(ctx context.Context, tx *sql.Tx, id string) (*lockedVolume, error) {
+	var v lockedVolume
+	err := tx.QueryRowContext(ctx, `
+	SELECT status, region, type, size_gb, server_id::text, device
+	FROM volumes
+	WHERE id=$1
+	FOR UPDATE
+	`, id).Scan(&v.status, &v.region, &v.typ, &v.sizeGB, &v.serverID, &v.device)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// DeleteVolume closes out a volume's billing and marks it deleted. Attached
+// volumes must be detached first. Returns sql.ErrNoRows when not found.
+func (s *Store) DeleteVolume(ctx context.Context, id string) (*Volume, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	vol, err := lockVolume(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if vol.status != domain.VolumeAvailable {
+		return nil, &domain.VolumeStateError{VolumeID: id, Op: "delete", Status: vol.status}
+	}
+	if _, err := tx.ExecContext(ctx, `
+	UPDATE volumes SET `+volumeBillingSQL+`, status='deleted', deleted_at=now(), updated_at=now()
+	WHERE id=$1`, id); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetVolume(ctx, id)
+}
+
+// AttachVolume attaches an available volume to a server in the same
+// region, at device (or the first free one). The server's instance type
+// limits how many volumes it can have attached. deleteOnTermination, when
+// set, overrides the volume's flag. Returns sql.ErrNoRows when the volume
+// does not exist.
+func (s *Store) AttachVolume(ctx context.Context, id, serverID, device string, deleteOnTermination *bool) (*Volume, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	vol, err := lockVolume(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if vol.status != domain.VolumeAvailable {
+		return nil, &domain.VolumeStateError{VolumeID: id, Op: "attach", Status: vol.status}
+	}
+
+	// Locking the server serializes attachments against its limit
+	var srvStatus, srvRegion string
+	var maxVolumes int
+	err = tx.QueryRowContext(ctx, `
+	SELECT s.status::text, s.region, it.max_volumes
+	FROM servers s
+	JOIN instance_types it ON it.type = s.type
+	WHERE s.id = $1
+	FOR UPDATE OF s
+	`, serverID).Scan(&srvStatus, &srvRegion, &maxVolumes)
+	if err == sql.ErrNoRows {
+		return nil, &domain.ValidationError{Message: "server not found"}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !domain.VolumeAttachable(srvStatus) {
+		return nil, &domain.VolumeStateError{VolumeID: id, Op: "attach", Status: vol.status, ServerStatus: srvStatus}
+	}
+	if vol.region != srvRegion {
+		return nil, &domain.ValidationError{Message: fmt.Sprintf("volume is in %s but the server is in %s", vol.region, srvRegion)}
+	}
+
+	var used []string
+	rows, err := tx.QueryContext(ctx, `SELECT device FROM volumes WHERE server_id=$1`, serverID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var d string
+		if err := rows.Scan(&d); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		used = append(used, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(used) >= maxVolumes {
+		return nil, &domain.QuotaExceededError{Resource: "volume_attachments", Limit: maxVolumes, Used: len(used), Requested: 1}
+	}
+	device, err = domain.NextDevice(device, used)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+	UPDATE volumes
+	SET status='in-use', server_id=$2::uuid, device=$3, attached_at=now(), updated_at=now(),
+	    delete_on_termination=COALESCE($4, delete_on_termination)
+	WHERE id=$1
+	`, id, serverID, device, deleteOnTermination); err != nil {
+		return nil, err
+	}
+	msg := fmt.Sprintf("volume %s attached as %s", id, device)
+	if err := recordEvent(ctx, tx, serverID, "volume_attached", msg, map[string]any{
+		"volume_id": id, "device": device, "size_gb": vol.sizeGB, "volume_type": vol.typ,
+	}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetVolume(ctx, id)
+}
+
+// DetachVolume detaches an attached volume, leaving it available. Returns
+// sql.ErrNoRows when the volume does not exist.
+func (s *Store) DetachVolume(ctx context.Context, id string) (*Volume, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	vol, err := lockVolume(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if vol.status != domain.VolumeInUse {
+		return nil, &domain.VolumeStateError{VolumeID: id, Op: "detach", Status: vol.status}
+	}
+	var srvStatus string
+	if err := tx.QueryRowContext(ctx, `SELECT status::text FROM servers WHERE id=$1 FOR UPDATE`, vol.serverID.String).
+		Scan(&srvStatus); err != nil {
+		return nil, err
+	}
+	if !domain.VolumeAttachable(srvStatus) {
+		return nil, &domain.VolumeStateError{VolumeID: id, Op: "detach", Status: vol.status, ServerStatus: srvStatus}
+	}
+	if _, err := tx.ExecContext(ctx, `
+	UPDATE volumes
+	SET status='available', server_id=NULL, device=NULL, attached_at=NULL, updated_at=now()
+	WHERE id=$1
+	`, id); err != nil {
+		return nil, err
+	}
+	msg := fmt.Sprintf("volume %s detached from %s", id, vol.device.String)
+	if err := recordEvent(ctx, tx, vol.serverID.String, "volume_detached", msg, map[string]any{
+		"volume_id": id, "device": vol.device.String,
+	}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetVolume(ctx, id)
+}
+
+// releaseVolumes detaches every volume of a server being terminated,
+// deleting (and billing up to now) those flagged delete_on_termination
+func releaseVolumes(ctx context.Context, tx *sql.Tx, serverID string) error {
+	rows, err := tx.QueryContext(ctx, `
+	UPDATE volumes
+	SET `+volumeBillingSQL+`,
+	    status = CASE WHEN delete_on_termination THEN 'deleted' ELSE 'available' END,
+	    deleted_at = CASE WHEN delete_on_termination THEN now() END,
+	    server_id = NULL, device = NULL, attached_at = NULL, updated_at = now()
+	FROM (SELECT id AS volume_id, device AS old_device FROM volumes WHERE server_id = $1) old
+	WHERE volumes.id = old.volume_id
+	RETURNING volumes.id::text, old.old_device, volumes.status
+	`, serverID)
+	if err != nil {
+		return err
+	}
+	type released struct{ id, device, status string }
+	var out []released
+	for rows.Next() {
+		var r released
+		if err := rows.Scan(&r.id, &r.device, &r.status); err != nil {
+			rows.Close()
+			return err
+		}
+		out = append(out, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, r := range out {
+		event, msg := "volume_detached", fmt.Sprintf("volume %s detached from %s on termination", r.id, r.device)
+		if r.status == domain.VolumeDeleted {
+			event, msg = "volume_deleted", fmt.Sprintf("volume %s deleted on termination", r.id)
+		}
+		if err := recordEvent(ctx, tx, serverID, event, msg, map[string]any{"volume_id": r.id, "device": r.device}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AccrueVolumeBilling bills the storage of every volume not yet deleted
+func (s *Store) AccrueVolumeBilling(ctx context.Context) (int64, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	if err := checkFence(ctx, tx); err != nil {
+		return 0, err
+	}
+	res, err := tx.ExecContext(ctx, `UPDATE volumes SET `+volumeBillingSQL+` WHERE status <> 'deleted'`)
+	if err != nil {
+		return 0, err
+	}
+	rows, _ := res.RowsAffected()
+	return rows, tx.Commit()
+}
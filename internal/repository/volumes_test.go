@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"virtualservers/internal/domain"
+)
+
+// newVolume creates an available 10 GB standard volume in us-east-1
+func newVolume(t *testing.T, s *Store, name string, deleteOnTermination bool) string {
+	t.Helper()
+	v, err := s.CreateVolume(context.Background(), Volume{Name: name, Region: "us-east-1", Type: "standard", SizeGB: 10,
+		DeleteOnTermination: deleteOnTermination})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v.ID
+}
+
+func TestVolumeAttachmentLimit(t *testing.T) {
+	s := testStore(t)
+	ctx := context.Background()
+	id := newServer(t, s, "vols", "")
+	attach := func(name string) error {
+		_, err := s.AttachVolume(ctx, newVolume(t, s, name, false), id, "", nil)
+		return err
+	}
+	quota := func(err error, limit, used int) {
+		t.Helper()
+		var qe *domain.QuotaExceededError
+		if !errors.As(err, &qe) || qe.Resource != "volume_attachments" || qe.Limit != limit || qe.Used != used {
+			t.Fatalf("err = %v, want volume_attachments quota %d/%d", err, used, limit)
+		}
+	}
+
+	// t2.micro takes 2 volumes
+	for i := range 2 {
+		if err := attach(fmt.Sprintf("micro-%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	quota(attach("micro-2"), 2, 2)
+
+	// t2.small takes 4; resizing back down needs volumes detached first
+	if _, err := s.Resize(ctx, id, "t2.small", false); err != nil {
+		t.Fatal(err)
+	}
+	for i := range 2 {
+		if err := attach(fmt.Sprintf("small-%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := s.Resize(ctx, id, "t2.micro", false)
+	quota(err, 2, 4)
+	if d := server(t, s, id); d.Type != "t2.small" {
+		t.Fatalf("refused resize changed the type to %s", d.Type)
+	}
+}
+
+func TestReleaseVolumesOnTermination(t *testing.T) {
+	s := testStore(t)
+	ctx := context.Background()
+	id := newServer(t, s, "doomed", "")
+	keep := newVolume(t, s, "keep", false)
+	drop := newVolume(t, s, "drop", false)
+	if _, err := s.AttachVolume(ctx, keep, id, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	// The attachment's flag overrides the volume's
+	yes := true
+	if _, err := s.AttachVolume(ctx, drop, id, "", &yes); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ApplyAction(ctx, id, "terminate"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		id, status string
+	}{
+		{keep, domain.VolumeAvailable},
+		{drop, domain.VolumeDeleted},
+	} {
+		v, err := s.GetVolume(ctx, tc.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.Status != tc.status || v.ServerID != nil || v.Device != nil {
+			t.Errorf("volume %s after termination: %s on %v as %v, want %s and detached", tc.id, v.Status, v.ServerID, v.Device, tc.status)
+		}
+	}
+	logs, err := s.GetServerLogs(ctx, id, LogFilter{Events: []string{"volume_detached", "volume_deleted"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 2 {
+		t.Fatalf("%d volume events on termination, want 2", len(logs))
+	}
+}
@@ -0,0 +1,428 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type Webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	SubscriptionID string          `json:"subscription_id"`
+	EventID        int64           `json:"event_id"`
+	Event          string          `json:"event"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastStatusCode *int            `json:"last_status_code,omitempty"`
+	LastError      *string         `json:"last_error,omitempty"`
+	Payload        json.RawMessage `json:"payload"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
+
+type WebhookAttempt struct {
+	ID          int64     `json:"id"`
+	AttemptedAt time.Time `json:"attempted_at"`
+	StatusCode  *int      `json:"status_code,omitempty"`
+	Error       *string   `json:"error,omitempty"`
+	DurationMs  int       `json:"duration_ms"`
+}
+
+// DueDelivery is a claimed delivery ready to be sent
+type DueDelivery struct {
+	ID       int64
+	Attempts int
+	URL      string
+	Secret   string
+	Event    string
+	Payload  []byte
+	// ClaimToken identifies this claim; CompleteDelivery checks it
+	ClaimToken string
+}
+
+// ErrClaimLost is returned when completing a delivery whose claim ran out
+// and was taken over by another claim
+var ErrClaimLost = errors.New("webhook delivery claim lost")
+
+// DeliveryResult is the outcome of one HTTP attempt
+type DeliveryResult struct {
+	DeliveryID  int64
+	ClaimToken  string
+	StatusCode  int // 0 when no response was received
+	Error       string
+	Duration    time.Duration
+	Succeeded   bool
+	Dead        bool
+	NextAttempt time.Time
+}
+
+// textArray adapts a Postgres TEXT[] column for database/sql scanning
+func textArray(dst *[]string) sql.Scanner {
+	return pgtype.NewMap().SQLScanner(dst)
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// outboxPayload is the webhook body built from an inserted server_events row
+const outboxPayload = `jsonb_build_object(
+	'id', ev.id,
+	'server_id', ev.server_id,
+	'event', ev.event,
+	'message', ev.message,
+	'data', ev.data,
+	'timestamp', ev.ts)`
+
+// recordEvent inserts a lifecycle event and its outbox row. Pass the
+// surrounding transaction so both commit atomically with the state change.
+// The actor and operation ID from ctx are added to data.
+func recordEvent(ctx context.Context, q execer, serverID, event, message string, data map[string]any) error {
+	payload := map[string]any{}
+	for k, v := range data {
+		payload[k] = v
+	}
+	payload["actor"] = ActorFrom(ctx)
+	if op := OperationIDFrom(ctx); op != "" {
+		payload["operation_id"] = op
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = q.ExecContext(ctx, `
+	WITH ev AS (
+		INSERT INTO server_events (server_id, event, message, data) VALUES ($1, $2, $3, $4::jsonb)
+		RETURNING id, server_id, ts, event, message, data
+	)
+	INSERT INTO event_outbox (event_id, server_id, event, payload)
+	SELECT ev.id, ev.server_id, ev.event, `+outboxPayload+`
+	FROM ev
+	`, serverID, event, message, string(b))
+	return err
+}
+
+func (s *Store) CreateWebhook(ctx context.Context, url string, events []string, secret string) (*Webhook, error) {
+	if events == nil {
+		events = []string{}
+	}
+	w := Webhook{URL: url, Events: events, Secret: secret, Active: true}
+	err := s.DB.QueryRowContext(ctx, `
+	INSERT INTO webhook_subscriptions (url, events, secret)
+	VALUES ($1, $2, $3)
+	RETURNING id, created_at
+	`, url, events, secret).Scan(&w.ID, &w.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+func (s *Store) ListWebhooks(ctx context.Context) ([]Webhook, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+	SELECT id, url, events, active, created_at
+	FROM webhook_subscriptions
+	ORDER BY created_at DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hooks []Webhook
+	for rows.Next() {
+		var w Webhook
+		if err := rows.Scan(&w.ID, &w.URL, textArray(&w.Events), &w.Active, &w.CreatedAt); err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return hooks, nil
+}
+
+// GetWebhook returns nil when the subscription does not exist
+func (s *Store) GetWebhook(ctx context.Context, id string) (*Webhook, error) {
+	var w Webhook
+	err := s.DB.QueryRowContext(ctx, `
+	SELECT id, url, events, active, created_at
+	FROM webhook_subscriptions
+	WHERE id=$1
+	`, id).Scan(&w.ID, &w.URL, textArray(&w.Events), &w.Active, &w.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &w, nil
+}
+
+// DeleteWebhook returns sql.ErrNoRows when the subscription does not exist
+func (s *Store) DeleteWebhook(ctx context.Context, id string) error {
+	res, err := s.DB.ExecContext(ctx, `DELETE FROM webhook_subscriptions WHERE id=$1`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+const deliverySelect = `
+	SELECT d.id, d.subscription_id, o.event_id, o.event, d.status, d.attempts,
+	       d.next_attempt_at, d.last_status_code, d.last_error, o.payload,
+	       d.created_at, d.updated_at
+	FROM webhook_deliveries d
+	JOIN event_outbox o ON o.id = d.outbox_id
+`
+
+// ListDeliveries returns the newest deliveries of a subscription, optionally
+// filtered by status
+func (s *Store) ListDeliveries(ctx context.Context, subscriptionID, status string, limit int) ([]WebhookDelivery, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	return s.queryDeliveries(ctx, deliverySelect+`
+	WHERE d.subscription_id=$1 AND ($2 = '' OR d.status=$2)
+	ORDER BY d.id DESC
+	LIMIT $3`, subscriptionID, status, limit)
+}
+
+// ListDeadLetters returns deliveries that exhausted their retries
+func (s *Store) ListDeadLetters(ctx context.Context, limit int) ([]WebhookDelivery, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	return s.queryDeliveries(ctx, deliverySelect+`
+	WHERE d.status='dead'
+	ORDER BY d.updated_at DESC
+	LIMIT $1`, limit)
+}
+
+func (s *Store) queryDeliveries(ctx context.Context, query string, args ...any) ([]WebhookDelivery, error) {
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []WebhookDelivery
+	for rows.Next() {
+		var d WebhookDelivery
+		var code sql.NullInt64
+		var lastErr sql.NullString
+		if err := rows.Scan(&d.ID, &d.SubscriptionID, &d.EventID, &d.Event, &d.Status, &d.Attempts,
+			&d.NextAttemptAt, &code, &lastErr, &d.Payload, &d.CreatedAt, &d.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if code.Valid {
+			c := int(code.Int64)
+			d.LastStatusCode = &c
+		}
+		if lastErr.Valid {
+			e := lastErr.String
+			d.LastError = &e
+		}
+		out = append(out, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *Store) ListDeliveryAttempts(ctx context.Context, deliveryID int64) ([]WebhookAttempt, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+	SELECT id, attempted_at, status_code, error, duration_ms
+	FROM webhook_delivery_attempts
+	WHERE delivery_id=$1
+	ORDER BY id DESC
+	`, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []WebhookAttempt
+	for rows.Next() {
+		var a WebhookAttempt
+		var code sql.NullInt64
+		var msg sql.NullString
+		if err := rows.Scan(&a.ID, &a.AttemptedAt, &code, &msg, &a.DurationMs); err != nil {
+			return nil, err
+		}
+		if code.Valid {
+			c := int(code.Int64)
+			a.StatusCode = &c
+		}
+		if msg.Valid {
+			m := msg.String
+			a.Error = &m
+		}
+		out = append(out, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RetryDelivery puts a dead (or pending) delivery back in the queue with a
+// fresh attempt budget. Returns sql.ErrNoRows when it does not exist.
+func (s *Store) RetryDelivery(ctx context.Context, id int64) error {
+	res, err := s.DB.ExecContext(ctx, `
+	UPDATE webhook_deliveries
+	SET status='pending', attempts=0, next_attempt_at=now(), claim_token=NULL, updated_at=now()
+	WHERE id=$1 AND status <> 'succeeded'
+	`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// FanOutOutbox turns undispatched outbox rows into one delivery per matching
+// active subscription. Returns the number of outbox rows consumed.
+func (s *Store) FanOutOutbox(ctx context.Context, limit int) (int64, error) {
+	res, err := s.DB.ExecContext(ctx, `
+	WITH picked AS (
+		SELECT id, event
+		FROM event_outbox
+		WHERE dispatched_at IS NULL
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	), fan AS (
+		INSERT INTO webhook_deliveries (subscription_id, outbox_id)
+		SELECT w.id, p.id
+		FROM picked p
+		JOIN webhook_subscriptions w
+		  ON w.active AND (cardinality(w.events) = 0 OR p.event = ANY(w.events))
+		ON CONFLICT DO NOTHING
+	)
+	UPDATE event_outbox o
+	SET dispatched_at = now()
+	FROM picked p
+	WHERE o.id = p.id
+	`, limit)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
+
+// ClaimDueDeliveries locks up to limit due deliveries by pushing their
+// next_attempt_at forward by lease, so concurrent dispatchers skip them.
+// Each claim gets a new token; once the lease runs out the delivery can be
+// claimed again and the earlier claim can no longer complete it.
+func (s *Store) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]DueDelivery, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+	WITH due AS (
+		SELECT id
+		FROM webhook_deliveries
+		WHERE status='pending' AND next_attempt_at <= now()
+		ORDER BY next_attempt_at
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	), claimed AS (
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = now() + make_interval(secs => $2), claim_token = gen_random_uuid(), updated_at = now()
+		FROM due
+		WHERE d.id = due.id
+		RETURNING d.id, d.attempts, d.subscription_id, d.outbox_id, d.claim_token
+	)
+	SELECT c.id, c.attempts, w.url, w.secret, o.event, o.payload, c.claim_token::text
+	FROM claimed c
+	JOIN webhook_subscriptions w ON w.id = c.subscription_id
+	JOIN event_outbox o ON o.id = c.outbox_id
+	`, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []DueDelivery
+	for rows.Next() {
+		var d DueDelivery
+		if err := rows.Scan(&d.ID, &d.Attempts, &d.URL, &d.Secret, &d.Event, &d.Payload, &d.ClaimToken); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CompleteDelivery logs an attempt and moves the delivery to its next
+// state. Returns ErrClaimLost, recording nothing, when the delivery was
+// claimed again (or retried) since r's claim.
+func (s *Store) CompleteDelivery(ctx context.Context, r DeliveryResult) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var code sql.NullInt64
+	if r.StatusCode > 0 {
+		code = sql.NullInt64{Int64: int64(r.StatusCode), Valid: true}
+	}
+	var msg sql.NullString
+	if r.Error != "" {
+		msg = sql.NullString{String: r.Error, Valid: true}
+	}
+	status := "pending"
+	if r.Succeeded {
+		status = "succeeded"
+	} else if r.Dead {
+		status = "dead"
+	}
+	res, err := tx.ExecContext(ctx, `
+	UPDATE webhook_deliveries
+	SET status=$2,
+	    attempts=attempts+1,
+	    next_attempt_at=$3,
+	    last_status_code=$4,
+	    last_error=$5,
+	    claim_token=NULL,
+	    updated_at=now()
+	WHERE id=$1 AND status='pending' AND claim_token=$6::uuid
+	`, r.DeliveryID, status, r.NextAttempt, code, msg, r.ClaimToken)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrClaimLost
+	}
+	if _, err := tx.ExecContext(ctx, `
+	INSERT INTO webhook_delivery_attempts (delivery_id, status_code, error, duration_ms)
+	VALUES ($1, $2, $3, $4)
+	`, r.DeliveryID, code, msg, r.Duration.Milliseconds()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
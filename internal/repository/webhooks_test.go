@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCompleteDeliveryClaimToken(t *testing.T) {
+	s := testStore(t)
+	ctx := context.Background()
+	if _, err := s.CreateWebhook(ctx, "http://receiver.invalid/hook", nil, "s3cret"); err != nil {
+		t.Fatal(err)
+	}
+	newServer(t, s, "hooked", "")
+	if _, err := s.FanOutOutbox(ctx, 500); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first claim's lease runs out at once, so the second claim takes
+	// the same deliveries over
+	first, err := s.ClaimDueDeliveries(ctx, 500, 0)
+	if err != nil || len(first) == 0 {
+		t.Fatalf("first claim: %d deliveries, %v", len(first), err)
+	}
+	second, err := s.ClaimDueDeliveries(ctx, 500, time.Minute)
+	if err != nil || len(second) != len(first) {
+		t.Fatalf("second claim: %d deliveries, %v; want %d", len(second), err, len(first))
+	}
+	if again, err := s.ClaimDueDeliveries(ctx, 500, time.Minute); err != nil || len(again) != 0 {
+		t.Fatalf("claimed %d leased deliveries, %v", len(again), err)
+	}
+
+	d := second[0]
+	stale := DeliveryResult{DeliveryID: d.ID, StatusCode: 200, Succeeded: true, NextAttempt: time.Now()}
+	for _, f := range first {
+		if f.ID == d.ID {
+			stale.ClaimToken = f.ClaimToken
+		}
+	}
+	if stale.ClaimToken == "" || stale.ClaimToken == d.ClaimToken {
+		t.Fatalf("claims share token %q", d.ClaimToken)
+	}
+	if err := s.CompleteDelivery(ctx, stale); !errors.Is(err, ErrClaimLost) {
+		t.Fatalf("completing with the expired claim = %v, want ErrClaimLost", err)
+	}
+	current := stale
+	current.ClaimToken = d.ClaimToken
+	if err := s.CompleteDelivery(ctx, current); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CompleteDelivery(ctx, current); !errors.Is(err, ErrClaimLost) {
+		t.Fatalf("completing twice = %v, want ErrClaimLost", err)
+	}
+	attempts, err := s.ListDeliveryAttempts(ctx, d.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attempts) != 1 {
+		t.Fatalf("%d attempts recorded, want 1", len(attempts))
+	}
+}
@@ -2,27 +2,44 @@ package service
 
 import (
 	"context"
-	"log"
 	"time"
 
+	"virtualservers/internal/logging"
+	"virtualservers/internal/metrics"
 	"virtualservers/internal/repository"
+	"virtualservers/internal/telemetry"
 )
 
 // StartBillingDaemon runs in background untill ctx is cancelled
 func StartBillingDaemon(ctx context.Context, store *repository.Store, interval time.Duration) {
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
+	ctx = logging.With(ctx, logging.From(ctx).With("daemon", "billing"))
 	for {
 		select {
 		case <-ctx.Done():
-			log.Println("billing daemon stopped")
+			logging.From(ctx).Info("billing daemon stopped")
 			return
 		case <-ticker.C:
-			updated, err := store.AccrueBilling(ctx)
+			tickCtx, span := telemetry.StartTick(ctx, "billing")
+			updated, err := store.AccrueBilling(tickCtx)
+			var volumes, snapshots int64
+			if err == nil {
+				volumes, err = store.AccrueVolumeBilling(tickCtx)
+			}
+			if err == nil {
+				snapshots, err = store.AccrueSnapshotBilling(tickCtx)
+			}
+			telemetry.EndSpan(span, err)
 			if err != nil {
-				log.Printf("billing daemon error:%v", err)
-			} else if updated > 0 {
-				log.Printf("billing daemon updated %d servers", updated)
+				metrics.BillingErrors.Inc()
+				logging.From(ctx).Error("billing tick failed", "err", err)
+				continue
+			}
+			metrics.BillingLastSuccess.SetToCurrentTime()
+			metrics.BillingRowsUpdated.Add(float64(updated + volumes + snapshots))
+			if updated > 0 || volumes > 0 || snapshots > 0 {
+				logging.From(ctx).Info("billing accrued", "servers", updated, "volumes", volumes, "snapshots", snapshots)
 			}
 		}
 	}
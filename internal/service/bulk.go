@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+
+	"virtualservers/internal/repository"
+)
+
+// BulkResult is the outcome of a bulk action for one server. Err is nil on
+// success; Status is the new status, or the would-be status of a dry run.
+type BulkResult struct {
+	ID             string
+	PreviousStatus string
+	Status         string
+	Err            error
+}
+
+// RunBulkAction applies action to every target through ApplyAction (or
+// PreviewAction when dryRun is set) with at most concurrency calls in
+// flight. One server failing does not stop the others; targets without a
+// status (unknown IDs) fail with sql.ErrNoRows. Results are in target order.
+func RunBulkAction(ctx context.Context, store *repository.Store, targets []repository.BulkTarget, action string, concurrency int, dryRun bool) []BulkResult {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	results := make([]BulkResult, len(targets))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		results[i] = BulkResult{ID: t.ID, PreviousStatus: t.Status}
+		if t.Status == "" {
+			results[i].Err = sql.ErrNoRows
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(res *BulkResult) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := ctx.Err(); err != nil {
+				res.Err = err
+				return
+			}
+			if dryRun {
+				res.Status, res.Err = store.PreviewAction(ctx, res.ID, action)
+			} else {
+				res.Status, res.Err = store.ApplyAction(ctx, res.ID, action)
+			}
+		}(&results[i])
+	}
+	wg.Wait()
+	return results
+}
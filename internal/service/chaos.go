@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"virtualservers/internal/chaos"
+	"virtualservers/internal/logging"
+	"virtualservers/internal/repository"
+	"virtualservers/internal/telemetry"
+)
+
+// StartChaosSync loads the stored chaos configuration into engine every
+// interval until ctx is cancelled, so every replica injects the faults
+// configured through any of them
+func StartChaosSync(ctx context.Context, store *repository.Store, engine *chaos.Engine, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	ctx = logging.With(ctx, logging.From(ctx).With("daemon", "chaos-sync"))
+	for {
+		cfg, err := store.GetChaosConfig(ctx)
+		if err != nil {
+			logging.From(ctx).Error("loading chaos config failed", "err", err)
+		} else {
+			engine.Set(cfg)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// StartChaosMonkey crashes RUNNING servers every interval, each in scope
+// with the configured crash probability, until ctx is cancelled
+func StartChaosMonkey(ctx context.Context, store *repository.Store, engine *chaos.Engine, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	ctx = repository.WithActor(ctx, "chaos")
+	ctx = logging.With(ctx, logging.From(ctx).With("daemon", "chaos"))
+	for {
+		select {
+		case <-ctx.Done():
+			logging.From(ctx).Info("chaos monkey stopped")
+			return
+		case <-ticker.C:
+			cfg := engine.Config()
+			if !cfg.Enabled || cfg.CrashProbability == 0 {
+				continue
+			}
+			tickCtx, span := telemetry.StartTick(ctx, "chaos")
+			n, err := crashServers(tickCtx, store, engine)
+			telemetry.EndSpan(span, err)
+			if err != nil {
+				logging.From(ctx).Error("chaos tick failed", "err", err)
+				continue
+			}
+			if n > 0 {
+				logging.From(ctx).Info("servers crashed", "servers", n)
+			}
+		}
+	}
+}
+
+func crashServers(ctx context.Context, store *repository.Store, engine *chaos.Engine) (int, error) {
+	servers, err := store.RunningServers(ctx)
+	if err != nil {
+		return 0, err
+	}
+	crashed := 0
+	for _, sv := range servers {
+		if !engine.Inject(chaos.FaultCrash, sv.Region, sv.Labels) {
+			continue
+		}
+		ok, err := store.CrashServer(ctx, sv.ID)
+		if err != nil {
+			return crashed, err
+		}
+		if ok {
+			crashed++
+		}
+	}
+	return crashed, nil
+}
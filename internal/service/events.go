@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"virtualservers/internal/logging"
+	"virtualservers/internal/repository"
+)
+
+const (
+	// subscriberBuffer is how many matching events a slow subscriber may lag
+	// behind before it is dropped. Dropped subscribers resume via
+	// Last-Event-ID.
+	subscriberBuffer = 256
+	// maxSkipped bounds the ids of non-matching events held for a
+	// subscriber until its next event; a cursor forgets older ones anyway
+	maxSkipped = 10000
+)
+
+// HubEvent is an event matching a subscriber's filter
+type HubEvent struct {
+	repository.ServerEvent
+	// Skipped are the ids of the events published since the previous one
+	// sent that did not match; cursors record them so they are not taken
+	// for gaps
+	Skipped []int64
+}
+
+// EventHub fans out committed lifecycle events to stream subscribers
+type EventHub struct {
+	mu   sync.Mutex
+	subs map[*subscriber]struct{}
+}
+
+type subscriber struct {
+	ch      chan HubEvent
+	filter  repository.EventFilter
+	skipped []int64
+}
+
+func NewEventHub() *EventHub {
+	return &EventHub{subs: map[*subscriber]struct{}{}}
+}
+
+// Subscribe registers a new subscriber for the events matching f. The
+// returned channel is closed when the subscriber falls too far behind;
+// cancel must be called when done.
+func (h *EventHub) Subscribe(f repository.EventFilter) (<-chan HubEvent, func()) {
+	sub := &subscriber{ch: make(chan HubEvent, subscriberBuffer), filter: f}
+	h.mu.Lock()
+	h.subs[sub] = struct{}{}
+	h.mu.Unlock()
+
+	cancel := func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := h.subs[sub]; ok {
+			delete(h.subs, sub)
+			close(sub.ch)
+		}
+	}
+	return sub.ch, cancel
+}
+
+// active reports whether anyone is subscribed
+func (h *EventHub) active() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs) > 0
+}
+
+func (h *EventHub) publish(ev repository.ServerEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subs {
+		if !sub.filter.Match(ev) {
+			sub.skipped = append(sub.skipped, ev.ID)
+			if n := len(sub.skipped); n > maxSkipped {
+				sub.skipped = append(sub.skipped[:0], sub.skipped[n-maxSkipped:]...)
+			}
+			continue
+		}
+		select {
+		case sub.ch <- HubEvent{ServerEvent: ev, Skipped: sub.skipped}:
+			sub.skipped = nil
+		default:
+			delete(h.subs, sub)
+			close(sub.ch)
+		}
+	}
+}
+
+// StartEventListener feeds the hub from Postgres LISTEN/NOTIFY until ctx is
+// cancelled, reconnecting with backoff when the connection drops
+func StartEventListener(ctx context.Context, store *repository.Store, hub *EventHub) {
+	backoff := time.Second
+	ctx = logging.With(ctx, logging.From(ctx).With("daemon", "event-listener"))
+	for {
+		started := time.Now()
+		err := store.ListenEvents(ctx, func(id int64) {
+			if !hub.active() {
+				return
+			}
+			ev, err := store.GetEvent(ctx, id)
+			if err != nil {
+				logging.From(ctx).Error("event listener load failed", "event_id", id, "err", err)
+				return
+			}
+			if ev != nil {
+				hub.publish(*ev)
+			}
+		})
+		if ctx.Err() != nil {
+			logging.From(ctx).Info("event listener stopped")
+			return
+		}
+		if time.Since(started) > time.Minute {
+			backoff = time.Second
+		}
+		logging.From(ctx).Error("event listener failed", "err", err, "retry_in", backoff.String())
+		select {
+		case <-ctx.Done():
+			logging.From(ctx).Info("event listener stopped")
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
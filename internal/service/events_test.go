@@ -0,0 +1,85 @@
+package service
+
+import (
+	"slices"
+	"testing"
+
+	"virtualservers/internal/repository"
+)
+
+func event(id int64, server string) repository.ServerEvent {
+	return repository.ServerEvent{ID: id, ServerID: server, Event: "start"}
+}
+
+func TestEventHubFilter(t *testing.T) {
+	h := NewEventHub()
+	if h.active() {
+		t.Fatal("empty hub reports subscribers")
+	}
+	sub, cancel := h.Subscribe(repository.EventFilter{ServerID: "a"})
+	defer cancel()
+	if !h.active() {
+		t.Fatal("hub with a subscriber reports none")
+	}
+
+	for _, ev := range []repository.ServerEvent{event(1, "b"), event(2, "a"), event(3, "b"), event(4, "b"), event(5, "a")} {
+		h.publish(ev)
+	}
+	for _, want := range []struct {
+		id      int64
+		skipped []int64
+	}{
+		{2, []int64{1}},
+		{5, []int64{3, 4}},
+	} {
+		ev := <-sub
+		if ev.ID != want.id || !slices.Equal(ev.Skipped, want.skipped) {
+			t.Fatalf("got event %d skipping %v, want %d skipping %v", ev.ID, ev.Skipped, want.id, want.skipped)
+		}
+	}
+	if len(sub) != 0 {
+		t.Fatalf("%d more events queued", len(sub))
+	}
+}
+
+// A burst of events the subscriber does not want takes no buffer space
+func TestEventHubBurst(t *testing.T) {
+	h := NewEventHub()
+	sub, cancel := h.Subscribe(repository.EventFilter{ServerID: "a"})
+	defer cancel()
+	for id := range int64(maxSkipped + 100) {
+		h.publish(event(id+1, "b"))
+	}
+	h.publish(event(maxSkipped+101, "a"))
+	ev, ok := <-sub
+	if !ok {
+		t.Fatal("subscriber dropped by events it does not match")
+	}
+	if len(ev.Skipped) != maxSkipped || ev.Skipped[0] != 101 || ev.Skipped[maxSkipped-1] != maxSkipped+100 {
+		t.Fatalf("skipped %d ids from %d, want the last %d", len(ev.Skipped), ev.Skipped[0], maxSkipped)
+	}
+}
+
+func TestEventHubDropsSlowSubscriber(t *testing.T) {
+	h := NewEventHub()
+	slow, cancel := h.Subscribe(repository.EventFilter{})
+	defer cancel()
+	other, cancelOther := h.Subscribe(repository.EventFilter{ServerID: "none"})
+	defer cancelOther()
+	for id := range int64(subscriberBuffer + 1) {
+		h.publish(event(id+1, "a"))
+	}
+	n := 0
+	for range slow {
+		n++
+	}
+	if n != subscriberBuffer {
+		t.Fatalf("slow subscriber got %d events before it was dropped, want %d", n, subscriberBuffer)
+	}
+	select {
+	case _, ok := <-other:
+		t.Fatalf("subscriber matching nothing received (open=%v)", ok)
+	default:
+	}
+	cancel() // a no-op once dropped
+}
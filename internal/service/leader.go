@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"virtualservers/internal/logging"
+	"virtualservers/internal/metrics"
+	"virtualservers/internal/repository"
+)
+
+// LeaderElector runs leader-only work (billing, reaper, scheduler) in exactly
+// one replica, using a lease row in Postgres.
+//
+// The lease is renewed every TTL/3. Leadership is given up as soon as a
+// renewal is refused or the lease would expire before the next renewal, and
+// the lease is released on shutdown so a follower takes over within TTL/3.
+// Work runs with a fenced context, so writes from a leader that lost its
+// lease (e.g. after a long GC pause) are rejected by the database.
+type LeaderElector struct {
+	Store  *repository.Store
+	Name   string
+	Holder string
+	TTL    time.Duration
+
+	mu     sync.RWMutex
+	status LeaderStatus
+}
+
+type LeaderStatus struct {
+	Name     string    `json:"name"`
+	Holder   string    `json:"holder"`
+	IsLeader bool      `json:"is_leader"`
+	Token    int64     `json:"token,omitempty"`
+	Since    time.Time `json:"since,omitempty"`
+}
+
+func (e *LeaderElector) Status() LeaderStatus {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	st := e.status
+	st.Name = e.Name
+	st.Holder = e.Holder
+	return st
+}
+
+func (e *LeaderElector) setStatus(st LeaderStatus) {
+	e.mu.Lock()
+	e.status = st
+	e.mu.Unlock()
+	if st.IsLeader {
+		metrics.IsLeader.Set(1)
+	} else {
+		metrics.IsLeader.Set(0)
+	}
+	metrics.LeaderToken.Set(float64(st.Token))
+}
+
+// Run campaigns until ctx is cancelled. Each time this replica is elected,
+// onElected is started in a goroutine with a context that is cancelled when
+// leadership is lost.
+func (e *LeaderElector) Run(ctx context.Context, onElected func(ctx context.Context)) {
+	interval := e.TTL / 3
+	lg := logging.From(ctx).With("lease", e.Name, "holder", e.Holder)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var (
+		lease       *repository.Lease
+		stopLeading context.CancelFunc
+		done        chan struct{}
+	)
+	stepDown := func(reason string) {
+		if stopLeading == nil {
+			return
+		}
+		stopLeading()
+		<-done
+		stopLeading = nil
+		lg.Warn("leader election: lost leadership", "reason", reason)
+		e.setStatus(LeaderStatus{})
+	}
+
+	for {
+		l, err := e.Store.AcquireLease(ctx, e.Name, e.Holder, e.TTL)
+		switch {
+		case ctx.Err() != nil:
+		case err != nil:
+			lg.Error("leader election failed", "err", err)
+			// Keep leading only while the last lease is certainly still ours
+			if lease != nil && time.Until(lease.ExpiresAt) < interval {
+				stepDown("lease renewal failing")
+				lease = nil
+			}
+		case l == nil:
+			stepDown("lease taken by another replica")
+			lease = nil
+		default:
+			if stopLeading != nil && lease != nil && l.Token != lease.Token {
+				stepDown("fencing token changed")
+			}
+			lease = l
+			if stopLeading == nil {
+				lg.Info("leader election: elected leader", "token", l.Token)
+				e.setStatus(LeaderStatus{IsLeader: true, Token: l.Token, Since: time.Now()})
+				leaderCtx, cancel := context.WithCancel(ctx)
+				stopLeading = cancel
+				leaderCtx = repository.WithFence(leaderCtx, repository.Fence{Name: e.Name, Token: l.Token})
+				done = make(chan struct{})
+				go func(done chan struct{}) {
+					defer close(done)
+					onElected(leaderCtx)
+				}(done)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			stepDown("shutting down")
+			if lease != nil {
+				releaseCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+				if err := e.Store.ReleaseLease(releaseCtx, e.Name, e.Holder, lease.Token); err != nil {
+					lg.Error("leader election: release failed", "err", err)
+				}
+				cancel()
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"virtualservers/internal/logging"
+	"virtualservers/internal/metrics"
+	"virtualservers/internal/repository"
+	"virtualservers/internal/telemetry"
+)
+
+// operationBatch bounds the operations completed per tick
+const operationBatch = 500
+
+// StartOperationWorker advances the progress of long-running operations
+// and completes those whose time is up every interval until ctx is
+// cancelled
+func StartOperationWorker(ctx context.Context, store *repository.Store, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	ctx = repository.WithActor(ctx, "operations")
+	ctx = logging.With(ctx, logging.From(ctx).With("daemon", "operations"))
+	for {
+		select {
+		case <-ctx.Done():
+			logging.From(ctx).Info("operation worker stopped")
+			return
+		case <-ticker.C:
+			tickCtx, span := telemetry.StartTick(ctx, "operations")
+			n, err := store.AdvanceOperations(tickCtx, operationBatch)
+			telemetry.EndSpan(span, err)
+			metrics.OperationsCompleted.Add(float64(n))
+			if err != nil {
+				logging.From(ctx).Error("operation tick failed", "err", err)
+				continue
+			}
+			if n > 0 {
+				logging.From(ctx).Info("operations completed", "operations", n)
+			}
+		}
+	}
+}
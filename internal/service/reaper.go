@@ -2,28 +2,221 @@ package service
 
 import (
 	"context"
-	"log"
 	"time"
+
+	"virtualservers/internal/logging"
+	"virtualservers/internal/metrics"
 	"virtualservers/internal/repository"
+	"virtualservers/internal/telemetry"
+)
+
+// Reaper decisions
+const (
+	ReapTerminate      = "terminate"
+	ReapWarn           = "warn"
+	ReapWouldTerminate = "would_terminate" // dry-run policy or preview
+	ReapWouldWarn      = "would_warn"
 )
 
-func StartIdleReaper(ctx context.Context, store *repository.Store, interval time.Duration) {
+type ReapDecision struct {
+	ServerID    string    `json:"server_id"`
+	Name        string    `json:"name"`
+	Status      string    `json:"status"`
+	Policy      string    `json:"policy"`
+	Action      string    `json:"action"`
+	IdleSince   time.Time `json:"idle_since"`
+	TerminateAt time.Time `json:"terminate_at"`
+}
+
+type ReapReport struct {
+	Terminated int            `json:"terminated"`
+	Warned     int            `json:"warned"`
+	Decisions  []ReapDecision `json:"decisions"`
+}
+
+// StartIdleReaper evaluates reaper policies every interval until ctx is
+// cancelled. def applies to servers no stored policy matches; a disabled
+// def means such servers are never reaped.
+func StartIdleReaper(ctx context.Context, store *repository.Store, interval time.Duration, def repository.ReaperPolicy) {
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
+	ctx = repository.WithActor(ctx, "reaper")
+	ctx = logging.With(ctx, logging.From(ctx).With("daemon", "reaper"))
 
 	for {
 		select {
 		case <-ctx.Done():
-			log.Println("idle reaper stopped")
+			logging.From(ctx).Info("idle reaper stopped")
 			return
 		case <-ticker.C:
-			reaped, err := store.ReapIdleServers(ctx)
+			tickCtx, span := telemetry.StartTick(ctx, "reaper")
+			report, err := RunReaper(tickCtx, store, def, false)
+			telemetry.EndSpan(span, err)
+			if err != nil {
+				logging.From(ctx).Error("idle reaper run failed", "err", err)
+				continue
+			}
+			metrics.ReaperLastRun.SetToCurrentTime()
+			metrics.ReaperTerminations.Add(float64(report.Terminated))
+			metrics.ReaperWarnings.Add(float64(report.Warned))
+			if report.Terminated > 0 {
+				logging.From(ctx).Info("idle reaper terminated servers", "servers", report.Terminated)
+			}
+			if report.Warned > 0 {
+				logging.From(ctx).Info("idle reaper warned servers", "servers", report.Warned)
+			}
+			if n := countDecisions(report, ReapWouldTerminate); n > 0 {
+				logging.From(ctx).Info("idle reaper would terminate servers", "servers", n, "dry_run", true)
+			}
+		}
+	}
+}
+
+// RunReaper evaluates every idle (STOPPED or HIBERNATED) server against the
+// policies; hibernated servers use the hibernated_idle_seconds threshold. Dry-run
+// policies, and every policy when preview is set, only report would_*
+// decisions and change nothing.
+//
+// A server is never terminated before warn_before_seconds have passed since
+// its warning, so a policy that is created with servers already past its
+// threshold warns first and terminates later.
+func RunReaper(ctx context.Context, store *repository.Store, def repository.ReaperPolicy, preview bool) (ReapReport, error) {
+	report := ReapReport{Decisions: []ReapDecision{}}
+	policies, err := store.ListReaperPolicies(ctx)
+	if err != nil {
+		return report, err
+	}
+	idle, err := store.ListIdleServers(ctx)
+	if err != nil {
+		return report, err
+	}
+	now := time.Now()
+
+	for _, sv := range idle {
+		p, ok := selectReaperPolicy(policies, def, sv)
+		if !ok {
+			continue
+		}
+		idle, ok := idleThreshold(p, sv.Status)
+		if !ok {
+			continue
+		}
+		warnBefore := time.Duration(p.WarnBeforeSeconds) * time.Second
+		terminateAt := sv.StoppedSince.Add(idle)
+		if sv.WarnedAt != nil && sv.WarnedAt.Add(warnBefore).After(terminateAt) {
+			terminateAt = sv.WarnedAt.Add(warnBefore)
+		}
+		d := ReapDecision{
+			ServerID:    sv.ID,
+			Name:        sv.Name,
+			Status:      sv.Status,
+			Policy:      p.Name,
+			IdleSince:   sv.StoppedSince,
+			TerminateAt: terminateAt,
+		}
+		needsWarning := warnBefore > 0 && sv.WarnedAt == nil
+
+		if preview || p.DryRun {
+			switch {
+			case !now.Before(terminateAt):
+				d.Action = ReapWouldTerminate
+			case needsWarning && !now.Before(terminateAt.Add(-warnBefore)):
+				d.Action = ReapWouldWarn
+			default:
+				continue
+			}
+			report.Decisions = append(report.Decisions, d)
+			continue
+		}
+
+		switch {
+		case needsWarning && !now.Before(terminateAt.Add(-warnBefore)):
+			if terminateAt.Before(now.Add(warnBefore)) {
+				d.TerminateAt = now.Add(warnBefore)
+			}
+			d.Action = ReapWarn
+			warned, err := store.WarnIdleServer(ctx, sv, p.Name, d.TerminateAt)
 			if err != nil {
-				log.Printf("idle reaper error:%v", err)
-			} else if reaped > 0 {
-				log.Printf("idle reaper terminated %d servers", reaped)
+				logging.From(ctx).Error("idle reaper warn failed", "server_id", sv.ID, "policy", p.Name, "err", err)
+				continue
+			}
+			if !warned {
+				continue
+			}
+			report.Warned++
+		case !needsWarning && !now.Before(terminateAt):
+			d.Action = ReapTerminate
+			reaped, err := store.ReapServer(ctx, sv, p.Name)
+			if err != nil {
+				logging.From(ctx).Error("idle reaper terminate failed", "server_id", sv.ID, "policy", p.Name, "err", err)
+				continue
+			}
+			if !reaped {
+				continue
 			}
+			report.Terminated++
+		default:
+			continue
 		}
+		report.Decisions = append(report.Decisions, d)
+	}
+	return report, nil
+}
 
+// selectReaperPolicy picks the policy governing sv: the enabled match with
+// the highest priority, then the most specific one. A matching policy that
+// excludes the server protects it; no fallback to def happens then.
+func selectReaperPolicy(policies []repository.ReaperPolicy, def repository.ReaperPolicy, sv repository.IdleServer) (repository.ReaperPolicy, bool) {
+	var best *repository.ReaperPolicy
+	for i := range policies {
+		p := &policies[i]
+		if !p.Enabled || !p.Matches(sv.Labels) {
+			continue
+		}
+		if best == nil || p.Priority > best.Priority ||
+			(p.Priority == best.Priority && policySpecificity(*p) > policySpecificity(*best)) {
+			best = p
+		}
+	}
+	if best == nil {
+		if !def.Enabled || def.Excludes(sv.ID) {
+			return def, false
+		}
+		return def, true
+	}
+	if best.Excludes(sv.ID) {
+		return *best, false
+	}
+	return *best, true
+}
+
+// idleThreshold is how long a server in status may stay idle under p; ok is
+// false when p does not reap servers in that status
+func idleThreshold(p repository.ReaperPolicy, status string) (time.Duration, bool) {
+	secs := p.IdleSeconds
+	if status == "HIBERNATED" {
+		if p.HibernatedIdleSeconds == nil {
+			return 0, false
+		}
+		secs = *p.HibernatedIdleSeconds
+	}
+	return time.Duration(secs) * time.Second, secs > 0
+}
+
+func policySpecificity(p repository.ReaperPolicy) int {
+	n := len(p.Selector)
+	if p.Project != nil {
+		n++
+	}
+	return n
+}
+
+func countDecisions(r ReapReport, action string) int {
+	n := 0
+	for _, d := range r.Decisions {
+		if d.Action == action {
+			n++
+		}
 	}
+	return n
 }
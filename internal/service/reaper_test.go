@@ -0,0 +1,99 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"virtualservers/internal/repository"
+)
+
+func TestSelectReaperPolicy(t *testing.T) {
+	ptr := func(s string) *string { return &s }
+	policy := func(name string, priority int, project *string, selector map[string]string, exclude ...string) repository.ReaperPolicy {
+		return repository.ReaperPolicy{Name: name, Priority: priority, Project: project, Selector: selector,
+			ExcludeServerIDs: exclude, IdleSeconds: 60, Enabled: true}
+	}
+	def := repository.ReaperPolicy{Name: "default", IdleSeconds: 1800, Enabled: true}
+	ci := map[string]string{"project": "ci", "env": "test", "team": "infra"}
+
+	for _, tc := range []struct {
+		name     string
+		policies []repository.ReaperPolicy
+		def      repository.ReaperPolicy
+		server   repository.IdleServer
+		want     string
+		reap     bool
+	}{
+		{"no policy matches: default", []repository.ReaperPolicy{
+			policy("prod", 0, ptr("prod"), nil),
+		}, def, repository.IdleServer{ID: "s-1", Labels: ci}, "default", true},
+		{"disabled default reaps nothing", nil,
+			repository.ReaperPolicy{Name: "default", Enabled: false}, repository.IdleServer{ID: "s-1", Labels: ci}, "default", false},
+		{"excluded by the default", nil,
+			repository.ReaperPolicy{Name: "default", Enabled: true, ExcludeServerIDs: []string{"s-1"}},
+			repository.IdleServer{ID: "s-1", Labels: ci}, "default", false},
+		{"higher priority wins over more specific", []repository.ReaperPolicy{
+			policy("specific", 0, ptr("ci"), map[string]string{"env": "test", "team": "infra"}),
+			policy("broad", 10, nil, map[string]string{"env": "test"}),
+		}, def, repository.IdleServer{ID: "s-1", Labels: ci}, "broad", true},
+		{"same priority: more specific wins", []repository.ReaperPolicy{
+			policy("env", 5, nil, map[string]string{"env": "test"}),
+			policy("project+env", 5, ptr("ci"), map[string]string{"env": "test"}),
+			policy("team", 5, nil, map[string]string{"team": "infra"}),
+		}, def, repository.IdleServer{ID: "s-1", Labels: ci}, "project+env", true},
+		{"full tie: first listed wins", []repository.ReaperPolicy{
+			policy("first", 5, nil, map[string]string{"env": "test"}),
+			policy("second", 5, nil, map[string]string{"team": "infra"}),
+		}, def, repository.IdleServer{ID: "s-1", Labels: ci}, "first", true},
+		{"disabled policies are skipped", []repository.ReaperPolicy{
+			func() repository.ReaperPolicy { p := policy("off", 99, nil, nil); p.Enabled = false; return p }(),
+			policy("on", 1, nil, nil),
+		}, def, repository.IdleServer{ID: "s-1", Labels: ci}, "on", true},
+		{"non-matching selector is skipped", []repository.ReaperPolicy{
+			policy("staging", 99, nil, map[string]string{"env": "staging"}),
+			policy("any", 0, nil, nil),
+		}, def, repository.IdleServer{ID: "s-1", Labels: ci}, "any", true},
+		{"exclusion by the winning policy blocks the default", []repository.ReaperPolicy{
+			policy("ci", 5, ptr("ci"), nil, "s-1"),
+		}, def, repository.IdleServer{ID: "s-1", Labels: ci}, "ci", false},
+		{"exclusion by the winner blocks lower policies too", []repository.ReaperPolicy{
+			policy("low", 0, nil, nil),
+			policy("high", 9, nil, nil, "s-1"),
+		}, def, repository.IdleServer{ID: "s-1", Labels: ci}, "high", false},
+		{"exclusion by a losing policy does not protect", []repository.ReaperPolicy{
+			policy("low", 0, nil, nil, "s-1"),
+			policy("high", 9, nil, nil),
+		}, def, repository.IdleServer{ID: "s-1", Labels: ci}, "high", true},
+		{"exclusion of another server", []repository.ReaperPolicy{
+			policy("ci", 5, ptr("ci"), nil, "s-2"),
+		}, def, repository.IdleServer{ID: "s-1", Labels: ci}, "ci", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, reap := selectReaperPolicy(tc.policies, tc.def, tc.server)
+			if got.Name != tc.want || reap != tc.reap {
+				t.Fatalf("selected %s (reap %v), want %s (reap %v)", got.Name, reap, tc.want, tc.reap)
+			}
+		})
+	}
+}
+
+func TestIdleThreshold(t *testing.T) {
+	day := 86400
+	for _, tc := range []struct {
+		name   string
+		policy repository.ReaperPolicy
+		status string
+		want   time.Duration
+		ok     bool
+	}{
+		{"stopped", repository.ReaperPolicy{IdleSeconds: 600}, "STOPPED", 10 * time.Minute, true},
+		{"stopped, reaping off", repository.ReaperPolicy{IdleSeconds: 0}, "STOPPED", 0, false},
+		{"hibernated without a threshold is kept", repository.ReaperPolicy{IdleSeconds: 600}, "HIBERNATED", 0, false},
+		{"hibernated", repository.ReaperPolicy{IdleSeconds: 600, HibernatedIdleSeconds: &day}, "HIBERNATED", 24 * time.Hour, true},
+	} {
+		got, ok := idleThreshold(tc.policy, tc.status)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("%s: idleThreshold = %v, %v; want %v, %v", tc.name, got, ok, tc.want, tc.ok)
+		}
+	}
+}
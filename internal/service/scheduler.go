@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"virtualservers/internal/domain"
+	"virtualservers/internal/logging"
+	"virtualservers/internal/repository"
+	"virtualservers/internal/telemetry"
+)
+
+// StartScheduler evaluates due schedules every interval until ctx is cancelled.
+//
+// Catch-up policy: whatever happens, next_run_at is always advanced to the
+// first occurrence after now, so a long outage never replays a backlog of
+// runs. A run later than domain.ScheduleMisfireGrace is executed once with
+// catch_up=once and dropped with catch_up=skip (domain.ScheduleRunFires).
+func StartScheduler(ctx context.Context, store *repository.Store, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	ctx = logging.With(ctx, logging.From(ctx).With("daemon", "scheduler"))
+	for {
+		select {
+		case <-ctx.Done():
+			logging.From(ctx).Info("scheduler stopped")
+			return
+		case <-ticker.C:
+			tickCtx, span := telemetry.StartTick(ctx, "scheduler")
+			due, err := store.DueSchedules(tickCtx, 100)
+			if err != nil {
+				telemetry.EndSpan(span, err)
+				logging.From(ctx).Error("scheduler tick failed", "err", err)
+				continue
+			}
+			for _, sc := range due {
+				runSchedule(tickCtx, store, sc, time.Now())
+			}
+			telemetry.EndSpan(span, nil)
+		}
+	}
+}
+
+func runSchedule(ctx context.Context, store *repository.Store, sc repository.Schedule, now time.Time) {
+	lg := logging.From(ctx).With("schedule_id", sc.ID, "action", sc.Action)
+	next, err := domain.NextScheduleRun(sc.CronExpr, sc.Timezone, now)
+	if err != nil {
+		lg.Error("schedule run failed", "err", err)
+		return
+	}
+	run := domain.ScheduleRunFires(sc.NextRunAt, now, sc.CatchUp)
+
+	claimed, err := store.AdvanceSchedule(ctx, sc.ID, sc.NextRunAt, next, run)
+	if err != nil {
+		lg.Error("schedule run failed", "err", err)
+		return
+	}
+	if !claimed {
+		return // another scheduler got it
+	}
+	if !run {
+		lg.Warn("schedule skipped missed run", "missed_run", sc.NextRunAt)
+		return
+	}
+
+	targets, err := store.ScheduleTargets(ctx, sc)
+	if err != nil {
+		lg.Error("schedule targets failed", "err", err)
+		return
+	}
+	actx := repository.WithActor(ctx, "schedule:"+sc.ID)
+	actx = repository.WithOperationID(actx, fmt.Sprintf("schedule:%s:%d", sc.ID, sc.NextRunAt.Unix()))
+	applied := 0
+	for _, id := range targets {
+		if _, err := store.ApplyAction(actx, id, sc.Action); err != nil {
+			// Already in the desired state, or busy rebooting or in a
+			// transition: an expected skip
+			var ite *domain.InvalidTransitionError
+			var tbe *domain.TransitionInProgressError
+			if errors.As(err, &ite) || errors.As(err, &tbe) {
+				lg.Info("schedule skipped server", "server_id", id, "reason", err.Error())
+				continue
+			}
+			lg.Error("schedule action failed", "server_id", id, "err", err)
+			continue
+		}
+		applied++
+	}
+	if applied > 0 {
+		lg.Info("schedule applied", "servers", applied)
+	}
+}
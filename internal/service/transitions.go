@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"virtualservers/internal/logging"
+	"virtualservers/internal/metrics"
+	"virtualservers/internal/repository"
+	"virtualservers/internal/telemetry"
+)
+
+// transitionBatch bounds the transitions completed per tick
+const transitionBatch = 500
+
+// StartTransitionWorker completes simulated STARTING/STOPPING/TERMINATING
+// transitions (and runs queued actions) every interval until ctx is
+// cancelled
+func StartTransitionWorker(ctx context.Context, store *repository.Store, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	ctx = repository.WithActor(ctx, "transitions")
+	ctx = logging.With(ctx, logging.From(ctx).With("daemon", "transitions"))
+	for {
+		select {
+		case <-ctx.Done():
+			logging.From(ctx).Info("transition worker stopped")
+			return
+		case <-ticker.C:
+			tickCtx, span := telemetry.StartTick(ctx, "transitions")
+			n, err := store.CompleteTransitions(tickCtx, transitionBatch)
+			telemetry.EndSpan(span, err)
+			metrics.TransitionsCompleted.Add(float64(n))
+			if err != nil {
+				// Failed servers are retried next tick; the rest still completed
+				logging.From(ctx).Error("transition tick failed", "err", err)
+			}
+			if n > 0 {
+				logging.From(ctx).Info("transitions completed", "servers", n)
+			}
+		}
+	}
+}
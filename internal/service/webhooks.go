@@ -0,0 +1,152 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"virtualservers/internal/logging"
+	"virtualservers/internal/repository"
+	"virtualservers/internal/telemetry"
+)
+
+// Retry policy for webhook deliveries
+const (
+	webhookMaxAttempts  = 8
+	webhookBaseBackoff  = 10 * time.Second
+	webhookMaxBackoff   = time.Hour
+	webhookTimeout      = 10 * time.Second
+	webhookBatchSize    = 50
+	webhookWorkers      = 8
+	webhookOutboxFanout = 500
+	// A claimed batch must be sent before its lease runs out: workers take
+	// the deliveries in waves, each wave at most one timeout long. The margin
+	// covers recording the results.
+	webhookClaimLease = (webhookBatchSize+webhookWorkers-1)/webhookWorkers*webhookTimeout + time.Minute
+)
+
+// SignWebhook returns the X-Webhook-Signature header value for body:
+// "t=<unix>,v1=<hex HMAC-SHA256(secret, "<unix>.<body>")>".
+// Receivers recompute it with their secret and compare in constant time.
+func SignWebhook(secret string, ts time.Time, body []byte) string {
+	t := strconv.FormatInt(ts.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoff returns the delay before the given (1-based) retry
+func webhookBackoff(attempt int) time.Duration {
+	d := webhookBaseBackoff
+	for i := 1; i < attempt && d < webhookMaxBackoff; i++ {
+		d *= 2
+	}
+	if d > webhookMaxBackoff {
+		d = webhookMaxBackoff
+	}
+	return d
+}
+
+// StartWebhookDispatcher drains the event outbox into webhook deliveries and
+// sends due deliveries until ctx is cancelled
+func StartWebhookDispatcher(ctx context.Context, store *repository.Store, interval time.Duration) {
+	client := &http.Client{Timeout: webhookTimeout}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	ctx = logging.With(ctx, logging.From(ctx).With("daemon", "webhooks"))
+	for {
+		select {
+		case <-ctx.Done():
+			logging.From(ctx).Info("webhook dispatcher stopped")
+			return
+		case <-ticker.C:
+			tickCtx, span := telemetry.StartTick(ctx, "webhooks")
+			if _, err := store.FanOutOutbox(tickCtx, webhookOutboxFanout); err != nil {
+				logging.From(ctx).Error("webhook outbox fan-out failed", "err", err)
+			}
+			due, err := store.ClaimDueDeliveries(tickCtx, webhookBatchSize, webhookClaimLease)
+			if err != nil {
+				telemetry.EndSpan(span, err)
+				logging.From(ctx).Error("webhook delivery claim failed", "err", err)
+				continue
+			}
+			sendDeliveries(tickCtx, store, client, due)
+			telemetry.EndSpan(span, nil)
+		}
+	}
+}
+
+func sendDeliveries(ctx context.Context, store *repository.Store, client *http.Client, due []repository.DueDelivery) {
+	sem := make(chan struct{}, webhookWorkers)
+	var wg sync.WaitGroup
+	for _, d := range due {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(d repository.DueDelivery) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			res := deliverWebhook(ctx, client, d)
+			err := store.CompleteDelivery(ctx, res)
+			switch {
+			case errors.Is(err, repository.ErrClaimLost):
+				logging.From(ctx).Warn("webhook delivery claimed again before it was recorded", "delivery_id", d.ID)
+			case err != nil:
+				logging.From(ctx).Error("webhook delivery record failed", "delivery_id", d.ID, "err", err)
+			}
+		}(d)
+	}
+	wg.Wait()
+}
+
+func deliverWebhook(ctx context.Context, client *http.Client, d repository.DueDelivery) repository.DeliveryResult {
+	res := repository.DeliveryResult{DeliveryID: d.ID, ClaimToken: d.ClaimToken}
+	start := time.Now()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err == nil {
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "virtualservers-webhooks/1")
+		req.Header.Set("X-Webhook-Event", d.Event)
+		req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(d.ID, 10))
+		req.Header.Set("X-Webhook-Signature", SignWebhook(d.Secret, start, d.Payload))
+
+		var resp *http.Response
+		resp, err = client.Do(req)
+		if err == nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+			res.StatusCode = resp.StatusCode
+			if resp.StatusCode < 200 || resp.StatusCode > 299 {
+				err = fmt.Errorf("unexpected status %d", resp.StatusCode)
+			}
+		}
+	}
+	res.Duration = time.Since(start)
+
+	if err == nil {
+		res.Succeeded = true
+		res.NextAttempt = time.Now()
+		return res
+	}
+	res.Error = err.Error()
+	attempt := d.Attempts + 1
+	if attempt >= webhookMaxAttempts {
+		res.Dead = true
+		res.NextAttempt = time.Now()
+		logging.From(ctx).Warn("webhook delivery dead", "delivery_id", d.ID, "attempts", attempt, "err", err)
+		return res
+	}
+	res.NextAttempt = time.Now().Add(webhookBackoff(attempt))
+	return res
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"virtualservers/internal/repository"
+)
+
+// receiver is a local webhook endpoint answering status and keeping the
+// last request
+type receiver struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.header = r.Header.Clone()
+	rc.body, _ = io.ReadAll(r.Body)
+	w.WriteHeader(rc.status)
+}
+
+func newReceiver(t *testing.T, status int) (*receiver, *httptest.Server) {
+	rc := &receiver{status: status}
+	srv := httptest.NewServer(rc)
+	t.Cleanup(srv.Close)
+	return rc, srv
+}
+
+func delivery(url string, attempts int) repository.DueDelivery {
+	return repository.DueDelivery{
+		ID:       42,
+		URL:      url,
+		Secret:   "s3cret",
+		Event:    "start",
+		Payload:  []byte(`{"event":"start","server_id":"abc"}`),
+		Attempts: attempts,
+		// A real claim token is a UUID; any string round-trips here
+		ClaimToken: "claim-1",
+	}
+}
+
+// verify recomputes the signature the way a receiver does
+func verify(secret, header string, body []byte) bool {
+	var ts, sig string
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(part, "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			sig = v
+		}
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "." + string(body)))
+	want := hex.EncodeToString(mac.Sum(nil))
+	return ts != "" && hmac.Equal([]byte(sig), []byte(want))
+}
+
+func TestSignWebhook(t *testing.T) {
+	body := []byte(`{"a":1}`)
+	ts := time.Unix(1700000000, 0)
+	got := SignWebhook("key", ts, body)
+	if !strings.HasPrefix(got, "t=1700000000,v1=") {
+		t.Fatalf("signature %q", got)
+	}
+	if !verify("key", got, body) {
+		t.Error("signature does not verify")
+	}
+	if verify("other", got, body) {
+		t.Error("signature verifies with the wrong secret")
+	}
+	if verify("key", got, []byte(`{"a":2}`)) {
+		t.Error("signature verifies for another body")
+	}
+}
+
+func TestDeliverWebhookSuccess(t *testing.T) {
+	rc, srv := newReceiver(t, http.StatusNoContent)
+	d := delivery(srv.URL, 0)
+
+	res := deliverWebhook(context.Background(), srv.Client(), d)
+	if !res.Succeeded || res.Dead || res.Error != "" {
+		t.Fatalf("result %+v, want succeeded", res)
+	}
+	if res.StatusCode != http.StatusNoContent || res.DeliveryID != d.ID || res.ClaimToken != d.ClaimToken {
+		t.Errorf("result %+v", res)
+	}
+	if string(rc.body) != string(d.Payload) {
+		t.Errorf("body %s, want %s", rc.body, d.Payload)
+	}
+	if got := rc.header.Get("X-Webhook-Event"); got != "start" {
+		t.Errorf("X-Webhook-Event %q", got)
+	}
+	if got := rc.header.Get("X-Webhook-Delivery"); got != strconv.FormatInt(d.ID, 10) {
+		t.Errorf("X-Webhook-Delivery %q", got)
+	}
+	if !verify(d.Secret, rc.header.Get("X-Webhook-Signature"), rc.body) {
+		t.Errorf("signature %q does not verify on the receiver", rc.header.Get("X-Webhook-Signature"))
+	}
+}
+
+func TestDeliverWebhookRetry(t *testing.T) {
+	tests := []struct {
+		status   int
+		attempts int // before this one
+	}{
+		{http.StatusInternalServerError, 0},
+		{http.StatusBadRequest, 1},
+		{http.StatusMovedPermanently, 3},
+		{http.StatusServiceUnavailable, webhookMaxAttempts - 2},
+	}
+	for _, tt := range tests {
+		_, srv := newReceiver(t, tt.status)
+		before := time.Now()
+		res := deliverWebhook(context.Background(), srv.Client(), delivery(srv.URL, tt.attempts))
+		if res.Succeeded || res.Dead {
+			t.Fatalf("status %d: result %+v, want a retry", tt.status, res)
+		}
+		if res.StatusCode != tt.status || res.Error == "" {
+			t.Errorf("status %d: result %+v", tt.status, res)
+		}
+		backoff := webhookBackoff(tt.attempts + 1)
+		if res.NextAttempt.Before(before.Add(backoff)) || res.NextAttempt.After(time.Now().Add(backoff)) {
+			t.Errorf("status %d, attempt %d: next attempt in %v, want %v",
+				tt.status, tt.attempts+1, res.NextAttempt.Sub(before), backoff)
+		}
+	}
+}
+
+func TestDeliverWebhookDeadLetter(t *testing.T) {
+	_, srv := newReceiver(t, http.StatusBadGateway)
+	res := deliverWebhook(context.Background(), srv.Client(), delivery(srv.URL, webhookMaxAttempts-1))
+	if !res.Dead || res.Succeeded {
+		t.Fatalf("result %+v, want dead after %d attempts", res, webhookMaxAttempts)
+	}
+
+	// Unreachable receivers are dead-lettered the same way
+	srv.Close()
+	res = deliverWebhook(context.Background(), http.DefaultClient, delivery(srv.URL, webhookMaxAttempts-1))
+	if !res.Dead || res.StatusCode != 0 || res.Error == "" {
+		t.Fatalf("result %+v, want dead without a status", res)
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, webhookBaseBackoff},
+		{2, 2 * webhookBaseBackoff},
+		{3, 4 * webhookBaseBackoff},
+		{7, 64 * webhookBaseBackoff},
+		{9, 256 * webhookBaseBackoff},
+		{10, webhookMaxBackoff},
+		{50, webhookMaxBackoff},
+	}
+	for _, tt := range tests {
+		if got := webhookBackoff(tt.attempt); got != tt.want {
+			t.Errorf("webhookBackoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+// A claimed batch is sent in waves of webhookWorkers, each up to
+// webhookTimeout; the lease has to outlast all of them
+func TestWebhookClaimLease(t *testing.T) {
+	waves := (webhookBatchSize + webhookWorkers - 1) / webhookWorkers
+	if need := time.Duration(waves) * webhookTimeout; webhookClaimLease <= need {
+		t.Fatalf("claim lease %v does not outlast a full batch (%v)", webhookClaimLease, need)
+	}
+}
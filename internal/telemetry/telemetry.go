@@ -0,0 +1,175 @@
+package telemetry
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/XSAM/otelsql"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "virtualservers"
+
+// Setup installs the global tracer provider. The exporter is chosen by
+// OTEL_TRACES_EXPORTER: "otlp" (OTLP/HTTP, configured by the standard
+// OTEL_EXPORTER_OTLP_* variables), "stdout" or "none". It defaults to otlp
+// when OTEL_EXPORTER_OTLP_ENDPOINT is set and to none otherwise.
+// The returned shutdown flushes buffered spans.
+func Setup(ctx context.Context, serviceName string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+
+	exporter := os.Getenv("OTEL_TRACES_EXPORTER")
+	if exporter == "" {
+		exporter = "none"
+		if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" {
+			exporter = "otlp"
+		}
+	}
+
+	var exp sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case "none":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		exp, err = otlptracehttp.New(ctx)
+	case "stdout":
+		exp, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	default:
+		return nil, fmt.Errorf("OTEL_TRACES_EXPORTER: unknown exporter %q", exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// OTEL_SERVICE_NAME, read by resource.Default, wins over serviceName
+	res := resource.Default()
+	if os.Getenv("OTEL_SERVICE_NAME") == "" {
+		res, err = resource.Merge(res, resource.NewSchemaless(attribute.String("service.name", serviceName)))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var opts []sdktrace.TracerProviderOption
+	if exporter == "stdout" {
+		// Export synchronously so spans show up in order in test output
+		opts = append(opts, sdktrace.WithSyncer(exp))
+	} else {
+		opts = append(opts, sdktrace.WithBatcher(exp))
+	}
+	tp := sdktrace.NewTracerProvider(append(opts, sdktrace.WithResource(res))...)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// Tracer returns the application tracer from the global provider
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// StartTick starts the root span of one daemon tick
+func StartTick(ctx context.Context, daemon string) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, daemon+".tick",
+		trace.WithNewRoot(),
+		trace.WithAttributes(attribute.String("daemon", daemon)))
+}
+
+// EndSpan records err (if any) on span and ends it
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Middleware starts a server span per request, continuing any incoming
+// trace context. It must run after middleware.RequestID so the chi request
+// ID can be attached. The span is renamed to the route pattern once routing
+// is done.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := Tracer().Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("url.path", r.URL.Path),
+				attribute.String("request_id", middleware.GetReqID(r.Context())),
+			))
+		defer span.End()
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			span.SetName(r.Method + " " + rctx.RoutePattern())
+			span.SetAttributes(attribute.String("http.route", rctx.RoutePattern()))
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
+
+// OpenDB opens an instrumented database/sql pool. Every query gets a span
+// carrying the sanitized statement and the request ID of the HTTP request
+// that issued it; argument values are never recorded.
+func OpenDB(driverName, dsn string) (*sql.DB, error) {
+	return otelsql.Open(driverName, dsn,
+		otelsql.WithAttributes(attribute.String("db.system", "postgresql")),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			DisableQuery:         true,
+			DisableErrSkip:       true,
+			OmitRows:             true,
+			OmitConnResetSession: true,
+		}),
+		otelsql.WithAttributesGetter(func(ctx context.Context, _ otelsql.Method, query string, _ []driver.NamedValue) []attribute.KeyValue {
+			var attrs []attribute.KeyValue
+			if query != "" {
+				attrs = append(attrs, attribute.String("db.statement", SanitizeSQL(query)))
+			}
+			if id := middleware.GetReqID(ctx); id != "" {
+				attrs = append(attrs, attribute.String("request_id", id))
+			}
+			return attrs
+		}),
+	)
+}
+
+var (
+	sqlString = regexp.MustCompile(`'(?:[^']|'')*'`)
+	// numbers not part of an identifier or a $n placeholder
+	sqlNumber = regexp.MustCompile(`(^|[^\w$.])\d+(?:\.\d+)?`)
+)
+
+// SanitizeSQL collapses whitespace and replaces string and numeric literals
+// with ? so statements can be exported without leaking data
+func SanitizeSQL(query string) string {
+	q := strings.Join(strings.Fields(query), " ")
+	q = sqlString.ReplaceAllString(q, "?")
+	return sqlNumber.ReplaceAllString(q, "${1}?")
+}
@@ -0,0 +1,235 @@
+package telemetry
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// record installs an in-memory tracer provider for the test
+func record(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	rec := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	return rec
+}
+
+// attrs flattens a span's attributes for lookups
+func attrs(s sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	out := map[attribute.Key]attribute.Value{}
+	for _, kv := range s.Attributes() {
+		out[kv.Key] = kv.Value
+	}
+	return out
+}
+
+func TestMiddlewareSpan(t *testing.T) {
+	rec := record(t)
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID, Middleware)
+	r.Get("/servers/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	r.Get("/boom", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	for _, tc := range []struct {
+		path, name, route string
+		status            int64
+		code              codes.Code
+	}{
+		{"/servers/abc", "GET /servers/{id}", "/servers/{id}", 404, codes.Unset},
+		{"/boom", "GET /boom", "/boom", 500, codes.Error},
+	} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tc.path, nil))
+		spans := rec.Ended()
+		s := spans[len(spans)-1]
+		if s.Name() != tc.name {
+			t.Errorf("span name = %q, want %q", s.Name(), tc.name)
+		}
+		if s.SpanKind() != trace.SpanKindServer {
+			t.Errorf("%s: kind = %v", tc.name, s.SpanKind())
+		}
+		a := attrs(s)
+		if got := a["http.request.method"].AsString(); got != "GET" {
+			t.Errorf("%s: http.request.method = %q", tc.name, got)
+		}
+		if got := a["url.path"].AsString(); got != tc.path {
+			t.Errorf("%s: url.path = %q", tc.name, got)
+		}
+		if got := a["http.route"].AsString(); got != tc.route {
+			t.Errorf("%s: http.route = %q", tc.name, got)
+		}
+		if got := a["http.response.status_code"].AsInt64(); got != tc.status {
+			t.Errorf("%s: status = %d, want %d", tc.name, got, tc.status)
+		}
+		if a["request_id"].AsString() == "" {
+			t.Errorf("%s: no request_id", tc.name)
+		}
+		if s.Status().Code != tc.code {
+			t.Errorf("%s: status code = %v, want %v", tc.name, s.Status().Code, tc.code)
+		}
+	}
+}
+
+func TestMiddlewareContinuesTrace(t *testing.T) {
+	rec := record(t)
+	prev := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(prev) })
+	h := Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	s := rec.Ended()[0]
+	if got := s.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("trace id = %s, want the incoming one", got)
+	}
+	if got := s.Parent().SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Fatalf("parent = %s", got)
+	}
+}
+
+func TestOpenDBSpans(t *testing.T) {
+	rec := record(t)
+	db, err := OpenDB("telemetrytest", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.WithValue(context.Background(), middleware.RequestIDKey, "req-1")
+	if _, err := db.ExecContext(ctx, "UPDATE servers\n  SET name='secret' WHERE id=$1 AND n > 42", "x"); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := db.QueryContext(ctx, "SELECT id FROM servers WHERE region = 'eu-west-1'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+
+	want := map[string]string{
+		"sql.conn.exec":  "UPDATE servers SET name=? WHERE id=$1 AND n > ?",
+		"sql.conn.query": "SELECT id FROM servers WHERE region = ?",
+	}
+	for _, s := range rec.Ended() {
+		stmt, ok := want[s.Name()]
+		if !ok {
+			continue
+		}
+		delete(want, s.Name())
+		a := attrs(s)
+		if got := a["db.statement"].AsString(); got != stmt {
+			t.Errorf("%s: db.statement = %q, want %q", s.Name(), got, stmt)
+		}
+		if got := a["db.system"].AsString(); got != "postgresql" {
+			t.Errorf("%s: db.system = %q", s.Name(), got)
+		}
+		if got := a["request_id"].AsString(); got != "req-1" {
+			t.Errorf("%s: request_id = %q", s.Name(), got)
+		}
+		for _, kv := range s.Attributes() {
+			if kv.Value.AsString() == "x" {
+				t.Errorf("%s: argument value recorded as %s", s.Name(), kv.Key)
+			}
+		}
+	}
+	for name := range want {
+		t.Errorf("no %s span", name)
+	}
+}
+
+func TestStartTick(t *testing.T) {
+	rec := record(t)
+	parent, ps := Tracer().Start(context.Background(), "caller")
+	ctx, span := StartTick(parent, "reaper")
+	_, child := Tracer().Start(ctx, "work")
+	child.End()
+	EndSpan(span, errors.New("db down"))
+	ps.End()
+
+	var tick sdktrace.ReadOnlySpan
+	for _, s := range rec.Ended() {
+		if s.Name() == "reaper.tick" {
+			tick = s
+		}
+	}
+	if tick == nil {
+		t.Fatal("no reaper.tick span")
+	}
+	if got := attrs(tick)["daemon"].AsString(); got != "reaper" {
+		t.Errorf("daemon = %q", got)
+	}
+	if tick.Parent().IsValid() {
+		t.Error("tick span is not a root span")
+	}
+	if tick.Status().Code != codes.Error || tick.Status().Description != "db down" {
+		t.Errorf("status = %+v", tick.Status())
+	}
+	if len(tick.Events()) != 1 || tick.Events()[0].Name != "exception" {
+		t.Errorf("events = %+v, want the recorded error", tick.Events())
+	}
+	if c := rec.Ended()[0]; c.Name() != "work" || c.Parent().SpanID() != tick.SpanContext().SpanID() {
+		t.Errorf("work span not parented to the tick")
+	}
+}
+
+func TestSanitizeSQL(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"SELECT 1", "SELECT ?"},
+		{"SELECT * FROM t WHERE a=$1 AND b='it''s' AND c=3.5", "SELECT * FROM t WHERE a=$1 AND b=? AND c=?"},
+		{"SELECT v2.id\n\tFROM t1", "SELECT v2.id FROM t1"},
+	} {
+		if got := SanitizeSQL(tc.in); got != tc.want {
+			t.Errorf("SanitizeSQL(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func init() {
+	sql.Register("telemetrytest", stubDriver{})
+}
+
+// stubDriver accepts every statement and returns no rows
+type stubDriver struct{}
+
+func (stubDriver) Open(string) (driver.Conn, error) { return stubConn{}, nil }
+
+type stubConn struct{}
+
+func (stubConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (stubConn) Close() error                        { return nil }
+func (stubConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (stubConn) ExecContext(context.Context, string, []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+
+func (stubConn) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	return stubRows{}, nil
+}
+
+type stubRows struct{}
+
+func (stubRows) Columns() []string         { return []string{"id"} }
+func (stubRows) Close() error              { return nil }
+func (stubRows) Next([]driver.Value) error { return io.EOF }
@@ -0,0 +1,66 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Chaos faults, as counted in virt_chaos_faults_total
+const (
+	FaultCrash            = "crash"
+	FaultProvisionFailure = "provision_failure"
+	FaultStuckReboot      = "stuck_reboot"
+	FaultLatency          = "latency"
+	FaultHTTPError        = "http_error"
+)
+
+type ChaosConfig struct {
+	Enabled                     bool              `json:"enabled"`
+	Seed                        int64             `json:"seed"`
+	CrashProbability            float64           `json:"crash_probability"`
+	ProvisionFailureProbability float64           `json:"provision_failure_probability"`
+	StuckRebootProbability      float64           `json:"stuck_reboot_probability"`
+	StuckRebootSeconds          int               `json:"stuck_reboot_seconds"`
+	LatencyProbability          float64           `json:"latency_probability"`
+	LatencyMS                   int               `json:"latency_ms"`
+	HTTPErrorProbability        float64           `json:"http_error_probability"`
+	Regions                     []string          `json:"regions"`
+	Selector                    map[string]string `json:"selector"`
+	UpdatedAt                   time.Time         `json:"updated_at"`
+}
+
+// ChaosConfigRequest replaces the chaos settings. Seed and
+// StuckRebootSeconds are optional: without a seed the server picks one,
+// stuck reboots default to 300s.
+type ChaosConfigRequest struct {
+	Enabled                     bool              `json:"enabled"`
+	Seed                        *int64            `json:"seed,omitempty"`
+	CrashProbability            float64           `json:"crash_probability,omitempty"`
+	ProvisionFailureProbability float64           `json:"provision_failure_probability,omitempty"`
+	StuckRebootProbability      float64           `json:"stuck_reboot_probability,omitempty"`
+	StuckRebootSeconds          *int              `json:"stuck_reboot_seconds,omitempty"`
+	LatencyProbability          float64           `json:"latency_probability,omitempty"`
+	LatencyMS                   int               `json:"latency_ms,omitempty"`
+	HTTPErrorProbability        float64           `json:"http_error_probability,omitempty"`
+	Regions                     []string          `json:"regions,omitempty"`
+	Selector                    map[string]string `json:"selector,omitempty"`
+}
+
+func (c *Client) GetChaosConfig(ctx context.Context) (*ChaosConfig, error) {
+	var out ChaosConfig
+	if err := c.do(ctx, http.MethodGet, "/chaos", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SetChaosConfig replaces the chaos settings; the result carries the seed
+// in effect
+func (c *Client) SetChaosConfig(ctx context.Context, req ChaosConfigRequest) (*ChaosConfig, error) {
+	var out ChaosConfig
+	if err := c.do(ctx, http.MethodPut, "/chaos", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
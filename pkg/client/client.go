@@ -0,0 +1,272 @@
+// Package client is a typed Go client for the Virtual Servers API described
+// by /openapi.json.
+//
+// Requests are retried on network errors, 429 and 502-504 with exponential
+// backoff (honouring Retry-After). POST requests carry an Idempotency-Key,
+// generated per call unless set with WithIdempotencyKey, so retries never
+// create a second server or apply an action twice.
+package client
+
+import (
+	"bytes"
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Client struct {
+	baseURL    string
+	http       *http.Client
+	actor      string
+	maxRetries int
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+type Option func(*Client)
+
+// WithHTTPClient replaces the default client (30s timeout)
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.http = hc }
+}
+
+// WithActor sends X-Actor so audit events name the caller ("api:<actor>")
+func WithActor(actor string) Option {
+	return func(c *Client) { c.actor = actor }
+}
+
+// WithRetries sets the number of retries (default 3) and the initial backoff
+// (default 200ms), which doubles per attempt up to 5s
+func WithRetries(n int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = n
+		c.backoff = backoff
+	}
+}
+
+// New returns a client for the API at baseURL, e.g. "http://localhost:8080"
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		http:       &http.Client{Timeout: 30 * time.Second},
+		maxRetries: 3,
+		backoff:    200 * time.Millisecond,
+		maxBackoff: 5 * time.Second,
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+type idempotencyKey struct{}
+
+// WithIdempotencyKey makes POST requests issued with ctx use key, so a
+// caller can safely repeat a whole operation (e.g. after a crash)
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+// Error is an API error decoded from an RFC 7807 problem+json body
+type Error struct {
+	StatusCode int    `json:"status"`
+	Type       string `json:"type"`
+	Title      string `json:"title"`
+	Detail     string `json:"detail"`
+	Code       string `json:"code"`
+	RequestID  string `json:"request_id"`
+	// Extensions holds the problem's error-specific members, e.g.
+	// current_status and allowed_actions for invalid_transition
+	Extensions map[string]json.RawMessage `json:"-"`
+}
+
+func (e *Error) Error() string {
+	msg := e.Detail
+	if msg == "" {
+		msg = e.Title
+	}
+	return fmt.Sprintf("virtualservers: %d %s: %s", e.StatusCode, e.Code, msg)
+}
+
+// UnmarshalJSON decodes a problem body, keeping the error-specific members
+// in Extensions
+func (e *Error) UnmarshalJSON(b []byte) error {
+	type base Error
+	if err := json.Unmarshal(b, (*base)(e)); err != nil {
+		return err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(b, &all); err != nil {
+		return err
+	}
+	for _, k := range []string{"type", "title", "status", "detail", "instance", "code", "request_id"} {
+		delete(all, k)
+	}
+	e.Extensions = all
+	return nil
+}
+
+// Error codes returned by the API
+const (
+	CodeBadRequest           = "bad_request"
+	CodeNotFound             = "not_found"
+	CodeInvalidTransition    = "invalid_transition"
+	CodeTransitionInProgress = "transition_in_progress"
+	CodeIPPoolExhausted      = "ip_pool_exhausted"
+	CodeQuotaExceeded        = "quota_exceeded"
+	CodeVolumeState          = "invalid_volume_state"
+	CodeResourceState        = "invalid_resource_state"
+	CodeZoneImpaired         = "zone_impaired"
+	CodeInsufficientCapacity = "insufficient_capacity"
+	CodeProvisionFailed      = "provision_failed"
+	CodeRebootStuck          = "reboot_stuck"
+	CodeChaosInjected        = "chaos_injected"
+	CodeTerminationProtected = "termination_protected"
+	CodeLockExists           = "lock_exists"
+	CodeKeyReused            = "idempotency_key_reused"
+	CodeKeyInProgress        = "idempotency_key_in_progress"
+	CodeInternal             = "internal_error"
+)
+
+// IsCode reports whether err is an API error with the given code
+func IsCode(err error, code string) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Code == code
+}
+
+// do sends the request, retrying transient failures, and decodes a 2xx JSON
+// body into out (if non-nil)
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out any) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	key := ""
+	if method == http.MethodPost {
+		key, _ = ctx.Value(idempotencyKey{}).(string)
+		if key == "" {
+			key = newIdempotencyKey()
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, method, u, body, key)
+		if err == nil && resp.StatusCode < 300 {
+			defer resp.Body.Close()
+			if out == nil || resp.StatusCode == http.StatusNoContent {
+				return nil
+			}
+			return json.NewDecoder(resp.Body).Decode(out)
+		}
+
+		var wait time.Duration
+		if err == nil {
+			apiErr := decodeError(resp)
+			if attempt >= c.maxRetries || !retryable(resp.StatusCode, apiErr.Code) {
+				return apiErr
+			}
+			wait = retryAfter(resp)
+			err = apiErr
+		} else if ctx.Err() != nil || attempt >= c.maxRetries {
+			return err
+		}
+		if wait == 0 {
+			wait = c.backoffFor(attempt)
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, method, u string, body []byte, key string) (*http.Response, error) {
+	var rd io.Reader
+	if body != nil {
+		rd = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, rd)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	if c.actor != "" {
+		req.Header.Set("X-Actor", c.actor)
+	}
+	return c.http.Do(req)
+}
+
+func retryable(status int, code string) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	case http.StatusConflict:
+		// The first attempt with this key is still running server-side
+		return code == CodeKeyInProgress
+	}
+	return false
+}
+
+func (c *Client) backoffFor(attempt int) time.Duration {
+	if c.backoff <= 0 {
+		return 0
+	}
+	d := c.backoff << attempt
+	if d <= 0 || d > c.maxBackoff {
+		d = c.maxBackoff
+	}
+	// Full jitter spreads retries from many clients
+	return time.Duration(rand.Int64N(int64(d)) + 1)
+}
+
+func retryAfter(resp *http.Response) time.Duration {
+	if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && s >= 0 {
+		return time.Duration(s) * time.Second
+	}
+	return 0
+}
+
+func decodeError(resp *http.Response) *Error {
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	e := &Error{}
+	if json.Unmarshal(b, e) != nil || e.Code == "" {
+		e.Code = "http_" + strconv.Itoa(resp.StatusCode)
+		e.Title = http.StatusText(resp.StatusCode)
+		e.Detail = strings.TrimSpace(string(b))
+	}
+	e.StatusCode = resp.StatusCode
+	return e
+}
+
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	if _, err := crand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
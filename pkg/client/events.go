@@ -0,0 +1,133 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type StreamParams struct {
+	// ServerID restricts the stream to one server
+	ServerID string
+	Events   []string
+	Labels   map[string]string
+	// LastEventID resumes after this event (replaying what was missed)
+	LastEventID int64
+}
+
+// StreamEvents follows the server-sent event stream and calls fn for every
+// event until ctx is cancelled or fn returns an error. Dropped connections
+// are resumed from the last event seen.
+func (c *Client) StreamEvents(ctx context.Context, p StreamParams, fn func(ServerEvent) error) error {
+	path := "/events/stream"
+	if p.ServerID != "" {
+		path = "/servers/" + url.PathEscape(p.ServerID) + "/events/stream"
+	}
+	q := url.Values{}
+	if len(p.Events) > 0 {
+		q.Set("event", strings.Join(p.Events, ","))
+	}
+	if len(p.Labels) > 0 {
+		q.Set("label", labelSelector(p.Labels))
+	}
+	u := c.baseURL + path
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+
+	var cursor string
+	if p.LastEventID > 0 {
+		cursor = strconv.FormatInt(p.LastEventID, 10)
+	}
+	for attempt := 0; ; attempt++ {
+		err := c.stream(ctx, u, &cursor, fn)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var cbErr callbackError
+		if errors.As(err, &cbErr) {
+			return cbErr.err
+		}
+		var apiErr *Error
+		if errors.As(err, &apiErr) && !retryable(apiErr.StatusCode, apiErr.Code) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(c.backoffFor(min(attempt, 5))):
+		}
+	}
+}
+
+// callbackError carries an error returned by the StreamEvents callback
+type callbackError struct{ err error }
+
+func (e callbackError) Error() string { return e.err.Error() }
+
+// stream reads one connection. cursor is the SSE id of the last event
+// received, which the server uses to replay what was missed, including
+// events that committed out of id order.
+func (c *Client) stream(ctx context.Context, u string, cursor *string, fn func(ServerEvent) error) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if *cursor != "" {
+		req.Header.Set("Last-Event-ID", *cursor)
+	}
+	if c.actor != "" {
+		req.Header.Set("X-Actor", c.actor)
+	}
+	// The stream outlives any client-wide timeout
+	hc := *c.http
+	hc.Timeout = 0
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return decodeError(resp)
+	}
+	defer resp.Body.Close()
+
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	var data strings.Builder
+	var id string
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case line == "":
+			if data.Len() == 0 {
+				continue
+			}
+			var ev ServerEvent
+			if err := json.Unmarshal([]byte(data.String()), &ev); err == nil {
+				if id != "" {
+					*cursor = id
+				}
+				if err := fn(ev); err != nil {
+					return callbackError{err}
+				}
+			}
+			data.Reset()
+			id = ""
+		case strings.HasPrefix(line, "id:"):
+			id = strings.TrimPrefix(strings.TrimPrefix(line, "id:"), " ")
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	return sc.Err()
+}
@@ -0,0 +1,119 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Host statuses
+const (
+	HostActive      = "active"
+	HostMaintenance = "maintenance"
+)
+
+type Host struct {
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	Region        string `json:"region"`
+	Zone          string `json:"zone"`
+	Status        string `json:"status"`
+	VCPUs         int    `json:"vcpus"`
+	MemoryMiB     int    `json:"memory_mib"`
+	UsedVCPUs     int    `json:"used_vcpus"`
+	UsedMemoryMiB int    `json:"used_memory_mib"`
+	// ServerIDs are the servers holding capacity on the host
+	ServerIDs         []string   `json:"server_ids"`
+	MaintenanceReason string     `json:"maintenance_reason,omitempty"`
+	MaintenanceAt     *time.Time `json:"maintenance_at,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+type CreateHostRequest struct {
+	Name      string `json:"name"`
+	Zone      string `json:"zone"`
+	VCPUs     int    `json:"vcpus"`
+	MemoryMiB int    `json:"memory_mib"`
+}
+
+type ListHostsParams struct {
+	Region string
+	Zone   string
+	Status string
+}
+
+// HostMove is a server live-migrated off a drained host
+type HostMove struct {
+	ServerID string `json:"server_id"`
+	Status   string `json:"status"`
+	HostID   string `json:"host_id"`
+}
+
+// DrainReport is the outcome of DrainHost
+type DrainReport struct {
+	Host     *Host      `json:"host"`
+	Migrated []HostMove `json:"migrated"`
+	Stopped  []string   `json:"stopped"`
+}
+
+func (c *Client) CreateHost(ctx context.Context, req CreateHostRequest) (*Host, error) {
+	var out Host
+	if err := c.do(ctx, http.MethodPost, "/hosts", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) ListHosts(ctx context.Context, p ListHostsParams) ([]Host, error) {
+	q := url.Values{}
+	if p.Region != "" {
+		q.Set("region", p.Region)
+	}
+	if p.Zone != "" {
+		q.Set("zone", p.Zone)
+	}
+	if p.Status != "" {
+		q.Set("status", p.Status)
+	}
+	var out struct {
+		Items []Host `json:"items"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/hosts", q, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Items, nil
+}
+
+func (c *Client) GetHost(ctx context.Context, id string) (*Host, error) {
+	var out Host
+	if err := c.do(ctx, http.MethodGet, "/hosts/"+url.PathEscape(id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) DeleteHost(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/hosts/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// DrainHost puts a host into maintenance and moves its servers off it,
+// stopping those no other host has room for
+func (c *Client) DrainHost(ctx context.Context, id, reason string) (*DrainReport, error) {
+	var out DrainReport
+	body := map[string]string{"reason": reason}
+	if err := c.do(ctx, http.MethodPost, "/hosts/"+url.PathEscape(id)+"/maintenance", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ActivateHost ends a host's maintenance
+func (c *Client) ActivateHost(ctx context.Context, id string) (*Host, error) {
+	var out Host
+	if err := c.do(ctx, http.MethodPost, "/hosts/"+url.PathEscape(id)+"/activate", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
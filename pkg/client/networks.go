@@ -0,0 +1,126 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+type VPC struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Region    string    `json:"region"`
+	CIDR      string    `json:"cidr"`
+	Default   bool      `json:"default"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type CreateVPCRequest struct {
+	Name   string `json:"name"`
+	Region string `json:"region"`
+	CIDR   string `json:"cidr"`
+}
+
+type Subnet struct {
+	ID           string    `json:"id"`
+	VPCID        string    `json:"vpc_id"`
+	Name         string    `json:"name"`
+	Region       string    `json:"region"`
+	Zone         string    `json:"zone,omitempty"`
+	CIDR         string    `json:"cidr"`
+	Default      bool      `json:"default"`
+	TotalIPs     int       `json:"total_ips"`
+	AvailableIPs int       `json:"available_ips"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+type CreateSubnetRequest struct {
+	VPCID string `json:"vpc_id"`
+	Name  string `json:"name"`
+	Zone  string `json:"zone,omitempty"`
+	CIDR  string `json:"cidr"`
+}
+
+type ListSubnetsParams struct {
+	VPCID  string
+	Region string
+	Zone   string
+}
+
+func (c *Client) CreateVPC(ctx context.Context, req CreateVPCRequest) (*VPC, error) {
+	var out VPC
+	if err := c.do(ctx, http.MethodPost, "/vpcs", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListVPCs lists VPCs, in one region if region is set
+func (c *Client) ListVPCs(ctx context.Context, region string) ([]VPC, error) {
+	q := url.Values{}
+	if region != "" {
+		q.Set("region", region)
+	}
+	var out struct {
+		Items []VPC `json:"items"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/vpcs", q, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Items, nil
+}
+
+func (c *Client) GetVPC(ctx context.Context, id string) (*VPC, error) {
+	var out VPC
+	if err := c.do(ctx, http.MethodGet, "/vpcs/"+url.PathEscape(id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) DeleteVPC(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/vpcs/"+url.PathEscape(id), nil, nil, nil)
+}
+
+func (c *Client) CreateSubnet(ctx context.Context, req CreateSubnetRequest) (*Subnet, error) {
+	var out Subnet
+	if err := c.do(ctx, http.MethodPost, "/subnets", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) ListSubnets(ctx context.Context, p ListSubnetsParams) ([]Subnet, error) {
+	q := url.Values{}
+	if p.VPCID != "" {
+		q.Set("vpc_id", p.VPCID)
+	}
+	if p.Region != "" {
+		q.Set("region", p.Region)
+	}
+	if p.Zone != "" {
+		q.Set("zone", p.Zone)
+	}
+	var out struct {
+		Items []Subnet `json:"items"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/subnets", q, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Items, nil
+}
+
+func (c *Client) GetSubnet(ctx context.Context, id string) (*Subnet, error) {
+	var out Subnet
+	if err := c.do(ctx, http.MethodGet, "/subnets/"+url.PathEscape(id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) DeleteSubnet(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/subnets/"+url.PathEscape(id), nil, nil, nil)
+}
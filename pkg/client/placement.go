@@ -0,0 +1,121 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+type Zone struct {
+	Name           string     `json:"name"`
+	Region         string     `json:"region"`
+	Impaired       bool       `json:"impaired"`
+	ImpairedReason string     `json:"impaired_reason,omitempty"`
+	ImpairedAt     *time.Time `json:"impaired_at,omitempty"`
+	Servers        int        `json:"servers"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// Placement group strategies
+const (
+	PlacementSpread        = "spread"
+	PlacementPack          = "pack"
+	PlacementSpreadByLabel = "spread_by_label"
+)
+
+type PlacementGroup struct {
+	ID        string         `json:"id"`
+	Name      string         `json:"name"`
+	Region    string         `json:"region"`
+	Strategy  string         `json:"strategy"`
+	LabelKey  string         `json:"label_key,omitempty"`
+	Members   int            `json:"members"`
+	Zones     map[string]int `json:"zones"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+type CreatePlacementGroupRequest struct {
+	Name     string `json:"name"`
+	Region   string `json:"region"`
+	Strategy string `json:"strategy"`
+	// LabelKey is required by (and only used with) spread_by_label
+	LabelKey string `json:"label_key,omitempty"`
+}
+
+// ListZones lists availability zones, in one region if region is set
+func (c *Client) ListZones(ctx context.Context, region string) ([]Zone, error) {
+	q := url.Values{}
+	if region != "" {
+		q.Set("region", region)
+	}
+	var out struct {
+		Items []Zone `json:"items"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/zones", q, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Items, nil
+}
+
+func (c *Client) GetZone(ctx context.Context, name string) (*Zone, error) {
+	var out Zone
+	if err := c.do(ctx, http.MethodGet, "/zones/"+url.PathEscape(name), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ImpairZone simulates an outage of a zone until RecoverZone
+func (c *Client) ImpairZone(ctx context.Context, name, reason string) (*Zone, error) {
+	var out Zone
+	body := map[string]string{"reason": reason}
+	if err := c.do(ctx, http.MethodPost, "/zones/"+url.PathEscape(name)+"/impair", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) RecoverZone(ctx context.Context, name string) (*Zone, error) {
+	var out Zone
+	if err := c.do(ctx, http.MethodPost, "/zones/"+url.PathEscape(name)+"/recover", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) CreatePlacementGroup(ctx context.Context, req CreatePlacementGroupRequest) (*PlacementGroup, error) {
+	var out PlacementGroup
+	if err := c.do(ctx, http.MethodPost, "/placement-groups", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListPlacementGroups lists placement groups, in one region if region is set
+func (c *Client) ListPlacementGroups(ctx context.Context, region string) ([]PlacementGroup, error) {
+	q := url.Values{}
+	if region != "" {
+		q.Set("region", region)
+	}
+	var out struct {
+		Items []PlacementGroup `json:"items"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/placement-groups", q, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Items, nil
+}
+
+func (c *Client) GetPlacementGroup(ctx context.Context, id string) (*PlacementGroup, error) {
+	var out PlacementGroup
+	if err := c.do(ctx, http.MethodGet, "/placement-groups/"+url.PathEscape(id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) DeletePlacementGroup(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/placement-groups/"+url.PathEscape(id), nil, nil, nil)
+}
@@ -0,0 +1,154 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Security group rule directions and protocols
+const (
+	DirectionIngress = "ingress"
+	DirectionEgress  = "egress"
+
+	ProtocolTCP  = "tcp"
+	ProtocolUDP  = "udp"
+	ProtocolICMP = "icmp"
+	ProtocolAll  = "all"
+)
+
+// SecurityGroupRule allows traffic in one direction. Ports are only set
+// for tcp and udp; the peer is either CIDR or the servers of SourceGroupID.
+type SecurityGroupRule struct {
+	ID            int64     `json:"id,omitempty"`
+	GroupID       string    `json:"group_id,omitempty"`
+	Direction     string    `json:"direction"`
+	Protocol      string    `json:"protocol"`
+	PortFrom      int       `json:"port_from,omitempty"`
+	PortTo        int       `json:"port_to,omitempty"`
+	CIDR          string    `json:"cidr,omitempty"`
+	SourceGroupID string    `json:"source_group_id,omitempty"`
+	Description   string    `json:"description,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type SecurityGroup struct {
+	ID          string              `json:"id"`
+	Name        string              `json:"name"`
+	Description string              `json:"description,omitempty"`
+	Region      string              `json:"region"`
+	Rules       []SecurityGroupRule `json:"rules"`
+	CreatedAt   time.Time           `json:"created_at"`
+	UpdatedAt   time.Time           `json:"updated_at"`
+}
+
+type CreateSecurityGroupRequest struct {
+	Name        string              `json:"name"`
+	Description string              `json:"description,omitempty"`
+	Region      string              `json:"region"`
+	Rules       []SecurityGroupRule `json:"rules,omitempty"`
+}
+
+// Reachability is the verdict of CheckReachability
+type Reachability struct {
+	ServerID       string             `json:"server_id"`
+	Source         string             `json:"source"`
+	Protocol       string             `json:"protocol"`
+	Port           int                `json:"port,omitempty"`
+	Allowed        bool               `json:"allowed"`
+	Reason         string             `json:"reason"`
+	SourceServerID string             `json:"source_server_id,omitempty"`
+	IngressRule    *SecurityGroupRule `json:"ingress_rule,omitempty"`
+	EgressRule     *SecurityGroupRule `json:"egress_rule,omitempty"`
+}
+
+func (c *Client) CreateSecurityGroup(ctx context.Context, req CreateSecurityGroupRequest) (*SecurityGroup, error) {
+	var out SecurityGroup
+	if err := c.do(ctx, http.MethodPost, "/security-groups", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListSecurityGroups lists groups, in one region if region is set
+func (c *Client) ListSecurityGroups(ctx context.Context, region string) ([]SecurityGroup, error) {
+	q := url.Values{}
+	if region != "" {
+		q.Set("region", region)
+	}
+	var out struct {
+		Items []SecurityGroup `json:"items"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/security-groups", q, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Items, nil
+}
+
+func (c *Client) GetSecurityGroup(ctx context.Context, id string) (*SecurityGroup, error) {
+	var out SecurityGroup
+	if err := c.do(ctx, http.MethodGet, "/security-groups/"+url.PathEscape(id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) DeleteSecurityGroup(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/security-groups/"+url.PathEscape(id), nil, nil, nil)
+}
+
+func (c *Client) AddSecurityGroupRule(ctx context.Context, groupID string, rule SecurityGroupRule) (*SecurityGroupRule, error) {
+	var out SecurityGroupRule
+	if err := c.do(ctx, http.MethodPost, "/security-groups/"+url.PathEscape(groupID)+"/rules", nil, rule, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) DeleteSecurityGroupRule(ctx context.Context, groupID string, ruleID int64) error {
+	path := "/security-groups/" + url.PathEscape(groupID) + "/rules/" + strconv.FormatInt(ruleID, 10)
+	return c.do(ctx, http.MethodDelete, path, nil, nil, nil)
+}
+
+func (c *Client) ListServerSecurityGroups(ctx context.Context, serverID string) ([]SecurityGroup, error) {
+	var out struct {
+		Items []SecurityGroup `json:"items"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/servers/"+url.PathEscape(serverID)+"/security-groups", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Items, nil
+}
+
+// AttachSecurityGroup attaches a group and returns all groups of the server
+func (c *Client) AttachSecurityGroup(ctx context.Context, serverID, groupID string) ([]SecurityGroup, error) {
+	var out struct {
+		Items []SecurityGroup `json:"items"`
+	}
+	body := map[string]string{"security_group_id": groupID}
+	if err := c.do(ctx, http.MethodPost, "/servers/"+url.PathEscape(serverID)+"/security-groups", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return out.Items, nil
+}
+
+func (c *Client) DetachSecurityGroup(ctx context.Context, serverID, groupID string) error {
+	path := "/servers/" + url.PathEscape(serverID) + "/security-groups/" + url.PathEscape(groupID)
+	return c.do(ctx, http.MethodDelete, path, nil, nil, nil)
+}
+
+// CheckReachability asks whether source can reach a server on
+// protocol/port (port is ignored for icmp)
+func (c *Client) CheckReachability(ctx context.Context, serverID, source, protocol string, port int) (*Reachability, error) {
+	q := url.Values{"source": {source}, "protocol": {protocol}}
+	if port != 0 {
+		q.Set("port", strconv.Itoa(port))
+	}
+	var out Reachability
+	if err := c.do(ctx, http.MethodGet, "/servers/"+url.PathEscape(serverID)+"/reachability", q, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
@@ -0,0 +1,374 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Server statuses
+const (
+	StatusPending     = "PENDING"
+	StatusStopped     = "STOPPED"
+	StatusStarting    = "STARTING"
+	StatusRunning     = "RUNNING"
+	StatusStopping    = "STOPPING"
+	StatusRebooting   = "REBOOTING"
+	StatusHibernated  = "HIBERNATED"
+	StatusTerminating = "TERMINATING"
+	StatusTerminated  = "TERMINATED"
+)
+
+// Lifecycle actions
+const (
+	ActionStart          = "start"
+	ActionStop           = "stop"
+	ActionReboot         = "reboot"
+	ActionCompleteReboot = "complete-reboot"
+	ActionHibernate      = "hibernate"
+	ActionResume         = "resume"
+	ActionTerminate      = "terminate"
+)
+
+type Server struct {
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	Region    string            `json:"region"`
+	Zone      string            `json:"zone,omitempty"`
+	Type      string            `json:"type"`
+	Status    string            `json:"status"`
+	IP        *string           `json:"ip,omitempty"`
+	Labels    map[string]string `json:"labels"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+type ServerDetail struct {
+	Server
+	AccruedSeconds        int64       `json:"accrued_seconds"`
+	AccruedCost           float64     `json:"accrued_cost"`
+	LastStartedAt         *time.Time  `json:"last_started_at,omitempty"`
+	HourlyRate            float64     `json:"hourly_rate"`
+	StorageHourlyRate     float64     `json:"storage_hourly_rate"`
+	LiveUptime            int64       `json:"live_uptime_seconds"`
+	LiveCost              float64     `json:"live_cost"`
+	TerminationProtection bool        `json:"termination_protection"`
+	Transition            *Transition `json:"transition,omitempty"`
+	ImageID               *string     `json:"image_id,omitempty"`
+	SecurityGroupIDs      []string    `json:"security_group_ids,omitempty"`
+	SubnetID              *string     `json:"subnet_id,omitempty"`
+	VPCID                 *string     `json:"vpc_id,omitempty"`
+	PlacementGroupID      *string     `json:"placement_group_id,omitempty"`
+	HostID                *string     `json:"host_id,omitempty"`
+}
+
+// Transition is a simulated start/stop/terminate in progress
+type Transition struct {
+	Action       string    `json:"action"`
+	TargetStatus string    `json:"target_status"`
+	StartedAt    time.Time `json:"started_at"`
+	DueAt        time.Time `json:"due_at"`
+	QueuedAction string    `json:"queued_action,omitempty"`
+}
+
+type ServerList struct {
+	Items  []Server `json:"items"`
+	Total  int      `json:"total"`
+	Limit  int      `json:"limit"`
+	Offset int      `json:"offset"`
+}
+
+type ListServersParams struct {
+	Region string
+	Zone   string
+	Type   string
+	Status string
+	Labels map[string]string
+	Limit  int
+	Offset int
+}
+
+type CreateServerRequest struct {
+	Name   string            `json:"name"`
+	Region string            `json:"region"`
+	Type   string            `json:"type"`
+	Labels map[string]string `json:"labels,omitempty"`
+	// ImageID optionally creates the server from an available image in
+	// its region
+	ImageID string `json:"image_id,omitempty"`
+	// SecurityGroupIDs are attached to the new server
+	SecurityGroupIDs []string `json:"security_group_ids,omitempty"`
+	// SubnetID is where the IP comes from; default: the region's default subnet
+	SubnetID string `json:"subnet_id,omitempty"`
+	// Zone pins the server to a zone; otherwise PlacementGroupID's strategy,
+	// or Placement ("spread" or "pack", default spread), picks one
+	Zone             string `json:"zone,omitempty"`
+	Placement        string `json:"placement,omitempty"`
+	PlacementGroupID string `json:"placement_group_id,omitempty"`
+}
+
+// ServerStatus is returned by create and lifecycle actions
+type ServerStatus struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+}
+
+type ServerEvent struct {
+	ID        int64             `json:"id"`
+	ServerID  string            `json:"server_id"`
+	Timestamp time.Time         `json:"timestamp"`
+	Event     string            `json:"event"`
+	Message   string            `json:"message"`
+	Data      json.RawMessage   `json:"data,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+type LogsParams struct {
+	Events []string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+}
+
+type ServerLock struct {
+	ServerID  string    `json:"server_id"`
+	Name      string    `json:"name"`
+	Reason    string    `json:"reason"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ResizeResult is returned by Resize
+type ResizeResult struct {
+	ID           string `json:"id"`
+	Status       string `json:"status"`
+	PreviousType string `json:"previous_type"`
+	Type         string `json:"type"`
+}
+
+// BulkActionRequest targets either IDs or every server matching Filter
+type BulkActionRequest struct {
+	Action string            `json:"action"`
+	IDs    []string          `json:"ids,omitempty"`
+	Filter *BulkActionFilter `json:"filter,omitempty"`
+	// DryRun reports what would happen without changing anything
+	DryRun      bool `json:"dry_run,omitempty"`
+	Concurrency int  `json:"concurrency,omitempty"`
+}
+
+// BulkActionFilter needs at least one field set. Terminated servers only
+// match when Status asks for them.
+type BulkActionFilter struct {
+	Region string            `json:"region,omitempty"`
+	Zone   string            `json:"zone,omitempty"`
+	Type   string            `json:"type,omitempty"`
+	Status string            `json:"status,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+type BulkActionResponse struct {
+	Action    string             `json:"action"`
+	DryRun    bool               `json:"dry_run"`
+	Matched   int                `json:"matched"`
+	Succeeded int                `json:"succeeded"`
+	Failed    int                `json:"failed"`
+	Results   []BulkActionResult `json:"results"`
+}
+
+// BulkActionResult is one server's outcome; Error is set on failure
+type BulkActionResult struct {
+	ID             string `json:"id"`
+	PreviousStatus string `json:"previous_status,omitempty"`
+	Status         string `json:"status,omitempty"`
+	Error          *Error `json:"error,omitempty"`
+}
+
+// labelSelector encodes labels as "k=v,k2=v2" in a stable order
+func labelSelector(labels map[string]string) string {
+	parts := make([]string, 0, len(labels))
+	for k, v := range labels {
+		parts = append(parts, k+"="+v)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+func (c *Client) ListServers(ctx context.Context, p ListServersParams) (*ServerList, error) {
+	q := url.Values{}
+	if p.Region != "" {
+		q.Set("region", p.Region)
+	}
+	if p.Zone != "" {
+		q.Set("zone", p.Zone)
+	}
+	if p.Type != "" {
+		q.Set("type", p.Type)
+	}
+	if p.Status != "" {
+		q.Set("status", p.Status)
+	}
+	if len(p.Labels) > 0 {
+		q.Set("label", labelSelector(p.Labels))
+	}
+	if p.Limit > 0 {
+		q.Set("limit", strconv.Itoa(p.Limit))
+	}
+	if p.Offset > 0 {
+		q.Set("offset", strconv.Itoa(p.Offset))
+	}
+	var out ServerList
+	if err := c.do(ctx, http.MethodGet, "/servers", q, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) GetServer(ctx context.Context, id string) (*ServerDetail, error) {
+	var out ServerDetail
+	if err := c.do(ctx, http.MethodGet, "/servers/"+url.PathEscape(id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// WaitForStatus polls the server every interval until it reaches one of
+// statuses (e.g. StatusStopped after a simulated stop) or ctx is done
+func (c *Client) WaitForStatus(ctx context.Context, id string, interval time.Duration, statuses ...string) (*ServerDetail, error) {
+	for {
+		s, err := c.GetServer(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		for _, st := range statuses {
+			if s.Status == st {
+				return s, nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return s, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// CreateServer provisions a STOPPED server with an IP from the region's pool
+func (c *Client) CreateServer(ctx context.Context, req CreateServerRequest) (*ServerStatus, error) {
+	var out ServerStatus
+	if err := c.do(ctx, http.MethodPost, "/server", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Action applies a lifecycle action (ActionStart, ActionStop, ...)
+func (c *Client) Action(ctx context.Context, id, action string) (*ServerStatus, error) {
+	var out ServerStatus
+	body := map[string]string{"action": action}
+	if err := c.do(ctx, http.MethodPost, "/servers/"+url.PathEscape(id)+"/action", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Resize changes a STOPPED server's instance type. With live set a RUNNING
+// server is resized too; it is left REBOOTING until ActionCompleteReboot.
+func (c *Client) Resize(ctx context.Context, id, typ string, live bool) (*ResizeResult, error) {
+	var out ResizeResult
+	body := map[string]any{"type": typ, "live": live}
+	if err := c.do(ctx, http.MethodPost, "/servers/"+url.PathEscape(id)+"/resize", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// BulkAction applies one action to many servers. Per-server failures are
+// reported in the results, not as an error.
+func (c *Client) BulkAction(ctx context.Context, req BulkActionRequest) (*BulkActionResponse, error) {
+	var out BulkActionResponse
+	if err := c.do(ctx, http.MethodPost, "/servers/actions", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) Start(ctx context.Context, id string) (*ServerStatus, error) {
+	return c.Action(ctx, id, ActionStart)
+}
+
+func (c *Client) Stop(ctx context.Context, id string) (*ServerStatus, error) {
+	return c.Action(ctx, id, ActionStop)
+}
+
+func (c *Client) Reboot(ctx context.Context, id string) (*ServerStatus, error) {
+	return c.Action(ctx, id, ActionReboot)
+}
+
+// Hibernate suspends a RUNNING server; it is billed at the storage rate
+// until Resume
+func (c *Client) Hibernate(ctx context.Context, id string) (*ServerStatus, error) {
+	return c.Action(ctx, id, ActionHibernate)
+}
+
+func (c *Client) Resume(ctx context.Context, id string) (*ServerStatus, error) {
+	return c.Action(ctx, id, ActionResume)
+}
+
+func (c *Client) Terminate(ctx context.Context, id string) (*ServerStatus, error) {
+	return c.Action(ctx, id, ActionTerminate)
+}
+
+// Logs returns lifecycle events of a server, newest first
+func (c *Client) Logs(ctx context.Context, id string, p LogsParams) ([]ServerEvent, error) {
+	q := url.Values{}
+	if len(p.Events) > 0 {
+		q.Set("event", strings.Join(p.Events, ","))
+	}
+	if !p.Since.IsZero() {
+		q.Set("since", p.Since.Format(time.RFC3339))
+	}
+	if !p.Until.IsZero() {
+		q.Set("until", p.Until.Format(time.RFC3339))
+	}
+	if p.Limit > 0 {
+		q.Set("limit", strconv.Itoa(p.Limit))
+	}
+	var out []ServerEvent
+	if err := c.do(ctx, http.MethodGet, "/servers/"+url.PathEscape(id)+"/logs", q, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *Client) SetProtection(ctx context.Context, id string, enabled bool) error {
+	body := map[string]bool{"enabled": enabled}
+	return c.do(ctx, http.MethodPut, "/servers/"+url.PathEscape(id)+"/protection", nil, body, nil)
+}
+
+func (c *Client) ListLocks(ctx context.Context, id string) ([]ServerLock, error) {
+	var out struct {
+		Items []ServerLock `json:"items"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/servers/"+url.PathEscape(id)+"/locks", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Items, nil
+}
+
+func (c *Client) AddLock(ctx context.Context, id, name, reason string) (*ServerLock, error) {
+	var out ServerLock
+	body := map[string]string{"name": name, "reason": reason}
+	if err := c.do(ctx, http.MethodPost, "/servers/"+url.PathEscape(id)+"/locks", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) RemoveLock(ctx context.Context, id, name string) error {
+	return c.do(ctx, http.MethodDelete, "/servers/"+url.PathEscape(id)+"/locks/"+url.PathEscape(name), nil, nil, nil)
+}
@@ -0,0 +1,234 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Snapshot statuses
+const (
+	SnapshotPending   = "pending"
+	SnapshotAvailable = "available"
+	SnapshotFailed    = "failed"
+	SnapshotDeleted   = "deleted"
+)
+
+// Operation statuses
+const (
+	OperationRunning   = "running"
+	OperationSucceeded = "succeeded"
+	OperationFailed    = "failed"
+)
+
+type Snapshot struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	SourceType  string            `json:"source_type"`
+	SourceID    string            `json:"source_id"`
+	Region      string            `json:"region"`
+	SizeGB      int               `json:"size_gb"`
+	Status      string            `json:"status"`
+	Progress    int               `json:"progress"`
+	Labels      map[string]string `json:"labels"`
+	GBMonthRate float64           `json:"gb_month_rate"`
+	AccruedCost float64           `json:"accrued_cost"`
+	LiveCost    float64           `json:"live_cost"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	CompletedAt *time.Time        `json:"completed_at,omitempty"`
+	DeletedAt   *time.Time        `json:"deleted_at,omitempty"`
+}
+
+type CreateSnapshotRequest struct {
+	Name string `json:"name"`
+	// SourceType is "server" (its root disk) or "volume"
+	SourceType string            `json:"source_type"`
+	SourceID   string            `json:"source_id"`
+	Labels     map[string]string `json:"labels,omitempty"`
+}
+
+type ListSnapshotsParams struct {
+	Region   string
+	Status   string
+	SourceID string
+}
+
+type Image struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	SnapshotID  string    `json:"snapshot_id"`
+	Region      string    `json:"region"`
+	SizeGB      int       `json:"size_gb"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type RegisterImageRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	SnapshotID  string `json:"snapshot_id"`
+}
+
+// Operation tracks a long-running change such as a snapshot
+type Operation struct {
+	ID           string     `json:"id"`
+	Type         string     `json:"type"`
+	ResourceType string     `json:"resource_type"`
+	ResourceID   string     `json:"resource_id"`
+	Status       string     `json:"status"`
+	Progress     int        `json:"progress"`
+	Error        string     `json:"error,omitempty"`
+	Actor        string     `json:"actor,omitempty"`
+	StartedAt    time.Time  `json:"started_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	DoneAt       *time.Time `json:"done_at,omitempty"`
+}
+
+type ListOperationsParams struct {
+	Status     string
+	ResourceID string
+	Limit      int
+}
+
+// CreateSnapshot starts a snapshot and returns the operation tracking it;
+// see WaitOperation
+func (c *Client) CreateSnapshot(ctx context.Context, req CreateSnapshotRequest) (*Operation, error) {
+	var out Operation
+	if err := c.do(ctx, http.MethodPost, "/snapshots", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListSnapshots lists snapshots; deleted ones only with Status SnapshotDeleted
+func (c *Client) ListSnapshots(ctx context.Context, p ListSnapshotsParams) ([]Snapshot, error) {
+	q := url.Values{}
+	if p.Region != "" {
+		q.Set("region", p.Region)
+	}
+	if p.Status != "" {
+		q.Set("status", p.Status)
+	}
+	if p.SourceID != "" {
+		q.Set("source_id", p.SourceID)
+	}
+	var out struct {
+		Items []Snapshot `json:"items"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/snapshots", q, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Items, nil
+}
+
+func (c *Client) GetSnapshot(ctx context.Context, id string) (*Snapshot, error) {
+	var out Snapshot
+	if err := c.do(ctx, http.MethodGet, "/snapshots/"+url.PathEscape(id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteSnapshot deletes an available or failed snapshot and returns its
+// final state
+func (c *Client) DeleteSnapshot(ctx context.Context, id string) (*Snapshot, error) {
+	var out Snapshot
+	if err := c.do(ctx, http.MethodDelete, "/snapshots/"+url.PathEscape(id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) RegisterImage(ctx context.Context, req RegisterImageRequest) (*Image, error) {
+	var out Image
+	if err := c.do(ctx, http.MethodPost, "/images", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListImages lists images; deregistered ones only when status asks for them
+func (c *Client) ListImages(ctx context.Context, region, status string) ([]Image, error) {
+	q := url.Values{}
+	if region != "" {
+		q.Set("region", region)
+	}
+	if status != "" {
+		q.Set("status", status)
+	}
+	var out struct {
+		Items []Image `json:"items"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/images", q, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Items, nil
+}
+
+func (c *Client) GetImage(ctx context.Context, id string) (*Image, error) {
+	var out Image
+	if err := c.do(ctx, http.MethodGet, "/images/"+url.PathEscape(id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) DeregisterImage(ctx context.Context, id string) (*Image, error) {
+	var out Image
+	if err := c.do(ctx, http.MethodDelete, "/images/"+url.PathEscape(id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) ListOperations(ctx context.Context, p ListOperationsParams) ([]Operation, error) {
+	q := url.Values{}
+	if p.Status != "" {
+		q.Set("status", p.Status)
+	}
+	if p.ResourceID != "" {
+		q.Set("resource_id", p.ResourceID)
+	}
+	if p.Limit > 0 {
+		q.Set("limit", strconv.Itoa(p.Limit))
+	}
+	var out struct {
+		Items []Operation `json:"items"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/operations", q, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Items, nil
+}
+
+func (c *Client) GetOperation(ctx context.Context, id string) (*Operation, error) {
+	var out Operation
+	if err := c.do(ctx, http.MethodGet, "/operations/"+url.PathEscape(id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// WaitOperation polls an operation every interval until it is no longer
+// running or ctx is done
+func (c *Client) WaitOperation(ctx context.Context, id string, interval time.Duration) (*Operation, error) {
+	for {
+		op, err := c.GetOperation(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if op.Status != OperationRunning {
+			return op, nil
+		}
+		select {
+		case <-ctx.Done():
+			return op, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Volume statuses
+const (
+	VolumeAvailable = "available"
+	VolumeInUse     = "in-use"
+	VolumeDeleted   = "deleted"
+)
+
+type Volume struct {
+	ID                  string            `json:"id"`
+	Name                string            `json:"name"`
+	Region              string            `json:"region"`
+	Type                string            `json:"type"`
+	SizeGB              int               `json:"size_gb"`
+	Status              string            `json:"status"`
+	ServerID            *string           `json:"server_id,omitempty"`
+	Device              *string           `json:"device,omitempty"`
+	DeleteOnTermination bool              `json:"delete_on_termination"`
+	Labels              map[string]string `json:"labels"`
+	GBMonthRate         float64           `json:"gb_month_rate"`
+	AccruedCost         float64           `json:"accrued_cost"`
+	LiveCost            float64           `json:"live_cost"`
+	CreatedAt           time.Time         `json:"created_at"`
+	UpdatedAt           time.Time         `json:"updated_at"`
+	AttachedAt          *time.Time        `json:"attached_at,omitempty"`
+	DeletedAt           *time.Time        `json:"deleted_at,omitempty"`
+}
+
+type CreateVolumeRequest struct {
+	Name                string            `json:"name"`
+	Region              string            `json:"region"`
+	Type                string            `json:"type"`
+	SizeGB              int               `json:"size_gb"`
+	DeleteOnTermination bool              `json:"delete_on_termination,omitempty"`
+	Labels              map[string]string `json:"labels,omitempty"`
+}
+
+type ListVolumesParams struct {
+	Region   string
+	Status   string
+	ServerID string
+}
+
+type AttachVolumeRequest struct {
+	ServerID string `json:"server_id"`
+	// Device defaults to the server's first free /dev/vdX
+	Device string `json:"device,omitempty"`
+	// DeleteOnTermination overrides the volume's flag when set
+	DeleteOnTermination *bool `json:"delete_on_termination,omitempty"`
+}
+
+func (c *Client) CreateVolume(ctx context.Context, req CreateVolumeRequest) (*Volume, error) {
+	var out Volume
+	if err := c.do(ctx, http.MethodPost, "/volumes", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListVolumes lists volumes; deleted ones only with Status VolumeDeleted
+func (c *Client) ListVolumes(ctx context.Context, p ListVolumesParams) ([]Volume, error) {
+	q := url.Values{}
+	if p.Region != "" {
+		q.Set("region", p.Region)
+	}
+	if p.Status != "" {
+		q.Set("status", p.Status)
+	}
+	if p.ServerID != "" {
+		q.Set("server_id", p.ServerID)
+	}
+	var out struct {
+		Items []Volume `json:"items"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/volumes", q, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Items, nil
+}
+
+func (c *Client) GetVolume(ctx context.Context, id string) (*Volume, error) {
+	var out Volume
+	if err := c.do(ctx, http.MethodGet, "/volumes/"+url.PathEscape(id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteVolume deletes an available volume and returns its final state
+func (c *Client) DeleteVolume(ctx context.Context, id string) (*Volume, error) {
+	var out Volume
+	if err := c.do(ctx, http.MethodDelete, "/volumes/"+url.PathEscape(id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) AttachVolume(ctx context.Context, id string, req AttachVolumeRequest) (*Volume, error) {
+	var out Volume
+	if err := c.do(ctx, http.MethodPost, "/volumes/"+url.PathEscape(id)+"/attach", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) DetachVolume(ctx context.Context, id string) (*Volume, error) {
+	var out Volume
+	if err := c.do(ctx, http.MethodPost, "/volumes/"+url.PathEscape(id)+"/detach", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}